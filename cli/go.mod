@@ -7,4 +7,6 @@ require (
 	neemek.com/anglais/core v0.0.0-00010101000000-000000000000
 )
 
+require golang.org/x/text v0.26.0 // indirect
+
 replace neemek.com/anglais/core => ../core
@@ -0,0 +1,645 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"neemek.com/anglais/core"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+type LspCmd struct{}
+
+// the subset of the language server protocol used by the server
+type (
+	lspMessage struct {
+		JsonRPC string           `json:"jsonrpc"`
+		ID      *json.RawMessage `json:"id,omitempty"`
+		Method  string           `json:"method,omitempty"`
+		Params  json.RawMessage  `json:"params,omitempty"`
+	}
+
+	// lspResponse always carries a result, since null is a valid one
+	lspResponse struct {
+		JsonRPC string           `json:"jsonrpc"`
+		ID      *json.RawMessage `json:"id"`
+		Result  interface{}      `json:"result"`
+		Error   *lspError        `json:"error,omitempty"`
+	}
+
+	lspError struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	}
+
+	lspPosition struct {
+		Line      int `json:"line"`
+		Character int `json:"character"`
+	}
+
+	lspRange struct {
+		Start lspPosition `json:"start"`
+		End   lspPosition `json:"end"`
+	}
+
+	lspLocation struct {
+		URI   string   `json:"uri"`
+		Range lspRange `json:"range"`
+	}
+
+	lspDiagnostic struct {
+		Range    lspRange `json:"range"`
+		Severity int      `json:"severity"`
+		Source   string   `json:"source"`
+		Message  string   `json:"message"`
+	}
+
+	lspDocumentSymbol struct {
+		Name           string              `json:"name"`
+		Detail         string              `json:"detail"`
+		Kind           int                 `json:"kind"`
+		Range          lspRange            `json:"range"`
+		SelectionRange lspRange            `json:"selectionRange"`
+		Children       []lspDocumentSymbol `json:"children,omitempty"`
+	}
+
+	lspCompletionItem struct {
+		Label  string `json:"label"`
+		Kind   int    `json:"kind"`
+		Detail string `json:"detail,omitempty"`
+	}
+
+	lspTextDocumentPosition struct {
+		TextDocument struct {
+			URI string `json:"uri"`
+		} `json:"textDocument"`
+		Position lspPosition `json:"position"`
+	}
+
+	lspReferenceParams struct {
+		Context struct {
+			IncludeDeclaration bool `json:"includeDeclaration"`
+		} `json:"context"`
+	}
+
+	lspRenameParams struct {
+		NewName string `json:"newName"`
+	}
+
+	lspTextEdit struct {
+		Range   lspRange `json:"range"`
+		NewText string   `json:"newText"`
+	}
+
+	lspWorkspaceEdit struct {
+		Changes map[string][]lspTextEdit `json:"changes"`
+	}
+)
+
+// kinds of symbols and completion items, as defined by the protocol
+const (
+	lspSymbolFunction = 12
+	lspSymbolVariable = 13
+
+	lspCompletionMethod   = 2
+	lspCompletionFunction = 3
+	lspCompletionVariable = 6
+	lspCompletionKeyword  = 14
+
+	lspSeverityError = 1
+
+	lspRequestFailed = -32803
+)
+
+// document an open text document and what is known about it
+type document struct {
+	src     []rune
+	symbols *core.SymbolTable
+	// program the document compiled, for the types of its expressions, nil if it doesn't compile
+	program *core.Program
+}
+
+type languageServer struct {
+	in        *bufio.Reader
+	out       io.Writer
+	documents map[string]*document
+	debug     bool
+}
+
+func (cmd *LspCmd) Run(ctx *Context) error {
+	s := &languageServer{
+		in:        bufio.NewReader(os.Stdin),
+		out:       os.Stdout,
+		documents: map[string]*document{},
+		debug:     ctx.Debug,
+	}
+
+	return s.serve()
+}
+
+func (s *languageServer) serve() error {
+	for {
+		msg, err := s.read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if s.debug {
+			log.Printf("Received %s", msg.Method)
+		}
+
+		if msg.Method == "exit" {
+			return nil
+		}
+
+		result, rpcErr := s.handle(msg)
+
+		// notifications are not answered
+		if msg.ID == nil {
+			continue
+		}
+
+		err = s.write(lspResponse{
+			JsonRPC: "2.0",
+			ID:      msg.ID,
+			Result:  result,
+			Error:   rpcErr,
+		})
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (s *languageServer) read() (*lspMessage, error) {
+	length := -1
+
+	// read headers
+	for {
+		line, err := s.in.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+
+		line = strings.TrimSpace(line)
+		if line == "" {
+			break
+		}
+
+		if value, ok := strings.CutPrefix(line, "Content-Length:"); ok {
+			length, err = strconv.Atoi(strings.TrimSpace(value))
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if length < 0 {
+		return nil, fmt.Errorf("message without content length")
+	}
+
+	body := make([]byte, length)
+	if _, err := io.ReadFull(s.in, body); err != nil {
+		return nil, err
+	}
+
+	msg := &lspMessage{}
+	return msg, json.Unmarshal(body, msg)
+}
+
+func (s *languageServer) write(msg interface{}) error {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(s.out, "Content-Length: %d\r\n\r\n%s", len(body), body)
+	return err
+}
+
+func (s *languageServer) notify(method string, params interface{}) error {
+	body, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+
+	return s.write(lspMessage{
+		JsonRPC: "2.0",
+		Method:  method,
+		Params:  body,
+	})
+}
+
+func (s *languageServer) handle(msg *lspMessage) (interface{}, *lspError) {
+	switch msg.Method {
+	case "initialize":
+		return map[string]interface{}{
+			"capabilities": map[string]interface{}{
+				// documents are always sent in full
+				"textDocumentSync":       1,
+				"hoverProvider":          true,
+				"definitionProvider":     true,
+				"documentSymbolProvider": true,
+				"referencesProvider":     true,
+				"renameProvider":         true,
+				"completionProvider": map[string]interface{}{
+					"triggerCharacters": []string{"."},
+				},
+			},
+			"serverInfo": map[string]string{
+				"name": "anglais",
+			},
+		}, nil
+
+	case "shutdown":
+		return nil, nil
+
+	case "textDocument/didOpen":
+		var params struct {
+			TextDocument struct {
+				URI  string `json:"uri"`
+				Text string `json:"text"`
+			} `json:"textDocument"`
+		}
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			return nil, &lspError{-32602, err.Error()}
+		}
+
+		s.update(params.TextDocument.URI, params.TextDocument.Text)
+		return nil, nil
+
+	case "textDocument/didChange":
+		var params struct {
+			TextDocument struct {
+				URI string `json:"uri"`
+			} `json:"textDocument"`
+			ContentChanges []struct {
+				Text string `json:"text"`
+			} `json:"contentChanges"`
+		}
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			return nil, &lspError{-32602, err.Error()}
+		}
+
+		if len(params.ContentChanges) > 0 {
+			s.update(params.TextDocument.URI, params.ContentChanges[len(params.ContentChanges)-1].Text)
+		}
+		return nil, nil
+
+	case "textDocument/didClose":
+		var params lspTextDocumentPosition
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			return nil, &lspError{-32602, err.Error()}
+		}
+
+		delete(s.documents, params.TextDocument.URI)
+		return nil, nil
+
+	case "textDocument/hover":
+		doc, offset, err := s.locate(msg.Params)
+		if err != nil {
+			return nil, err
+		}
+
+		return s.hover(doc, offset), nil
+
+	case "textDocument/definition":
+		var params lspTextDocumentPosition
+		_ = json.Unmarshal(msg.Params, &params)
+
+		doc, offset, err := s.locate(msg.Params)
+		if err != nil {
+			return nil, err
+		}
+
+		o := doc.symbols.At(offset)
+		if o == nil || o.Symbol.Declaration == nil {
+			return nil, nil
+		}
+
+		return lspLocation{params.TextDocument.URI, doc.tokenRange(o.Symbol.Declaration)}, nil
+
+	case "textDocument/references":
+		var params lspTextDocumentPosition
+		var reference lspReferenceParams
+		_ = json.Unmarshal(msg.Params, &params)
+		_ = json.Unmarshal(msg.Params, &reference)
+
+		doc, offset, err := s.locate(msg.Params)
+		if err != nil {
+			return nil, err
+		}
+
+		// references are only known of documents which compile, as they are found in the program
+		o := doc.occurrenceAt(offset)
+		if o == nil {
+			return []lspLocation{}, nil
+		}
+
+		locations := []lspLocation{}
+		for _, r := range core.References(doc.program, o.Symbol) {
+			if !r.Declaration || reference.Context.IncludeDeclaration {
+				locations = append(locations, lspLocation{params.TextDocument.URI, doc.tokenRange(r.Token)})
+			}
+		}
+
+		return locations, nil
+
+	case "textDocument/rename":
+		var params lspTextDocumentPosition
+		var rename lspRenameParams
+		_ = json.Unmarshal(msg.Params, &params)
+		_ = json.Unmarshal(msg.Params, &rename)
+
+		doc, offset, err := s.locate(msg.Params)
+		if err != nil {
+			return nil, err
+		}
+
+		o := doc.occurrenceAt(offset)
+		if o == nil {
+			return nil, &lspError{lspRequestFailed, "there is nothing to rename there, or the document doesn't compile"}
+		}
+
+		edits, renameErr := core.Rename(doc.program, o.Symbol, rename.NewName)
+		if renameErr != nil {
+			return nil, &lspError{lspRequestFailed, renameErr.Error()}
+		}
+
+		changes := []lspTextEdit{}
+		for _, edit := range edits {
+			changes = append(changes, lspTextEdit{lspRange{doc.position(edit.Start), doc.position(edit.End)}, edit.Text})
+		}
+
+		return lspWorkspaceEdit{map[string][]lspTextEdit{params.TextDocument.URI: changes}}, nil
+
+	case "textDocument/documentSymbol":
+		var params lspTextDocumentPosition
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			return nil, &lspError{-32602, err.Error()}
+		}
+
+		doc, ok := s.documents[params.TextDocument.URI]
+		if !ok {
+			return []lspDocumentSymbol{}, nil
+		}
+
+		return doc.documentSymbols(nil), nil
+
+	case "textDocument/completion":
+		doc, offset, err := s.locate(msg.Params)
+		if err != nil {
+			return nil, err
+		}
+
+		return doc.completions(offset), nil
+	}
+
+	if msg.ID != nil {
+		return nil, &lspError{-32601, "method not found: " + msg.Method}
+	}
+
+	return nil, nil
+}
+
+// locate get the document and offset within it of a text document position
+func (s *languageServer) locate(raw json.RawMessage) (*document, core.Pos, *lspError) {
+	var params lspTextDocumentPosition
+	if err := json.Unmarshal(raw, &params); err != nil {
+		return nil, 0, &lspError{-32602, err.Error()}
+	}
+
+	doc, ok := s.documents[params.TextDocument.URI]
+	if !ok {
+		return nil, 0, &lspError{-32602, "unknown document " + params.TextDocument.URI}
+	}
+
+	return doc, doc.offset(params.Position), nil
+}
+
+// update analyse the new text of a document and publish its diagnostics
+func (s *languageServer) update(uri string, text string) {
+	doc, ok := s.documents[uri]
+	if !ok {
+		doc = &document{
+			symbols: core.NewSymbolTable(&core.BlockNode{}, core.Positions{}),
+		}
+		s.documents[uri] = doc
+	}
+
+	doc.src = []rune(text)
+	diagnostics := []lspDiagnostic{}
+
+	tokens, err := core.NewLexer(text).Tokenize()
+	if err != nil {
+		// the lexer stops at the invalid token, so it follows the last valid one
+		at := lspPosition{}
+		if len(tokens) > 0 {
+			last := tokens[len(tokens)-1]
+			at = doc.position(last.Start + last.Length)
+		}
+
+		diagnostics = append(diagnostics, lspDiagnostic{lspRange{at, at}, lspSeverityError, "anglais", err.Error()})
+	} else {
+		p := core.NewParser(tokens)
+		tree, err := p.Parse()
+
+		if err != nil {
+			r := lspRange{}
+			if parsingError, ok := err.(*core.ParsingError); ok && parsingError.Causer != nil {
+				r = doc.tokenRange(parsingError.Causer)
+			}
+
+			diagnostics = append(diagnostics, lspDiagnostic{r, lspSeverityError, "anglais", err.Error()})
+		} else {
+			// only replace the symbols when the document is valid, so editing keeps the last known symbols
+			doc.symbols = core.NewSymbolTable(tree, p.Positions())
+		}
+	}
+
+	// the types of expressions are only known of documents which compile, as they are deduced by the compiler
+	doc.program = nil
+	if len(diagnostics) == 0 {
+		options := core.CompileOptions{}
+		if u, err := url.Parse(uri); err == nil && u.Scheme == "file" {
+			options.Imports = &WorkingDirectoryResolver{filepath.Dir(u.Path)}
+		}
+
+		if program, err := core.Compile(text, options); err == nil {
+			doc.program = program
+		}
+	}
+
+	err = s.notify("textDocument/publishDiagnostics", map[string]interface{}{
+		"uri":         uri,
+		"diagnostics": diagnostics,
+	})
+	if err != nil && s.debug {
+		log.Printf("Failed publishing diagnostics: %v", err)
+	}
+}
+
+func (s *languageServer) hover(doc *document, offset core.Pos) interface{} {
+	if doc.program != nil {
+		if info := core.TypeAt(doc.program, offset); info != nil {
+			return map[string]interface{}{
+				"contents": map[string]string{
+					"kind":  "markdown",
+					"value": "```anglais\n" + info.Signature + "\n```",
+				},
+				"range": doc.tokenRange(info.Token),
+			}
+		}
+	}
+
+	o := doc.symbols.At(offset)
+	if o == nil {
+		return nil
+	}
+
+	text := o.Symbol.Signature()
+	if o.Symbol.Declaration == nil && o.Symbol.Kind != core.SymbolParameter {
+		builtin := core.DefaultBuiltins.Get(o.Symbol.Name)
+		for _, module := range core.StandardModules {
+			if builtin == nil {
+				builtin = module.Get(o.Symbol.Name)
+			}
+		}
+
+		if builtin == nil {
+			return nil
+		}
+
+		text = fmt.Sprintf("func %s(%s) (builtin)", builtin.Name, strings.Join(builtin.Signature.Params, ", "))
+	}
+
+	return map[string]interface{}{
+		"contents": map[string]string{
+			"kind":  "markdown",
+			"value": "```anglais\n" + text + "\n```",
+		},
+		"range": doc.tokenRange(o.Token),
+	}
+}
+
+// offset convert a line and character position to an offset in the source
+func (d *document) offset(position lspPosition) core.Pos {
+	line := 0
+	for i, c := range d.src {
+		if line == position.Line {
+			return core.Pos(min(i+position.Character, len(d.src)))
+		}
+
+		if c == '\n' {
+			line++
+		}
+	}
+
+	return core.Pos(len(d.src))
+}
+
+// position convert an offset in the source to a line and character position
+func (d *document) position(offset core.Pos) lspPosition {
+	position := lspPosition{}
+	for i := 0; i < int(offset) && i < len(d.src); i++ {
+		if d.src[i] == '\n' {
+			position.Line++
+			position.Character = 0
+		} else {
+			position.Character++
+		}
+	}
+
+	return position
+}
+
+// occurrenceAt get the occurrence of a symbol of the compiled program at an offset, nil if there is none or the
+// document doesn't compile
+func (d *document) occurrenceAt(offset core.Pos) *core.Occurrence {
+	if d.program == nil {
+		return nil
+	}
+
+	return d.program.Symbols().At(offset)
+}
+
+func (d *document) tokenRange(t *core.Token) lspRange {
+	return lspRange{d.position(t.Start), d.position(t.Start + t.Length)}
+}
+
+// documentSymbols get the functions and variables declared within a function (or the top level, if nil)
+func (d *document) documentSymbols(parent *core.Symbol) []lspDocumentSymbol {
+	symbols := []lspDocumentSymbol{}
+
+	for _, s := range d.symbols.Symbols {
+		if s.Parent != parent || s.Declaration == nil || s.Kind == core.SymbolParameter {
+			continue
+		}
+
+		kind := lspSymbolVariable
+		var children []lspDocumentSymbol
+		if s.Kind == core.SymbolFunction {
+			kind = lspSymbolFunction
+			children = d.documentSymbols(s)
+		}
+
+		r := d.tokenRange(s.Declaration)
+		symbols = append(symbols, lspDocumentSymbol{
+			Name:           s.Name,
+			Detail:         s.Signature(),
+			Kind:           kind,
+			Range:          r,
+			SelectionRange: r,
+			Children:       children,
+		})
+	}
+
+	return symbols
+}
+
+func (d *document) completions(offset core.Pos) []lspCompletionItem {
+	items := []lspCompletionItem{}
+
+	// complete members after a dot
+	if offset > 0 && int(offset) <= len(d.src) && d.src[offset-1] == '.' {
+		for _, prototype := range []map[string]*core.BuiltinFunctionValue{core.ListPrototype, core.StringPrototype} {
+			for name, f := range prototype {
+				items = append(items, lspCompletionItem{name, lspCompletionMethod, fmt.Sprintf("%s(%s)", name, strings.Join(f.Parameters, ", "))})
+			}
+		}
+
+		for name := range core.ObjectPrototype {
+			items = append(items, lspCompletionItem{Label: name, Kind: lspCompletionMethod})
+		}
+
+		return items
+	}
+
+	for _, s := range d.symbols.Visible(offset) {
+		kind := lspCompletionVariable
+		if s.Kind == core.SymbolFunction {
+			kind = lspCompletionFunction
+		}
+
+		items = append(items, lspCompletionItem{s.Name, kind, s.Signature()})
+	}
+
+	for _, name := range core.DefaultBuiltins.Names() {
+		items = append(items, lspCompletionItem{Label: name, Kind: lspCompletionFunction, Detail: "builtin"})
+	}
+
+	for keyword := range core.Keywords {
+		items = append(items, lspCompletionItem{Label: keyword, Kind: lspCompletionKeyword})
+	}
+
+	return items
+}
@@ -1,11 +1,16 @@
 package main
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
 	"github.com/alecthomas/kong"
 	"log"
 	"neemek.com/anglais/core"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
 )
 
 type Context struct {
@@ -13,8 +18,98 @@ type Context struct {
 }
 
 type RunCmd struct {
-	Bytecode bool   `name:"bytecode" short:"c" help:"Run file as if it's bytecode"`
-	File     string `arg:"" name:"file" help:"File to read program from" type:"existingfile"`
+	Bytecode bool     `name:"bytecode" short:"c" help:"Run file as if it's bytecode"`
+	Codec    string   `name:"codec" aliases:"format" enum:"binary,gob,json" default:"binary" help:"The format the bytecode run with --bytecode is in (binary, gob or json)"`
+	File     string   `arg:"" name:"file" help:"File to read program from" type:"existingfile"`
+	Args     []string `arg:"" optional:"" name:"args" help:"Arguments passed to the main function of the program"`
+
+	Define     []string `name:"define" short:"d" help:"Constants to compile the program with, as name=value (or name, for true)"`
+	Trace      bool     `name:"trace" help:"Print each instruction executed, with the value on top of the stack, to standard error"`
+	Decimal    bool     `name:"decimal" help:"Make numbers exact decimals rather than floats, as #pragma decimal does"`
+	WarnAny    bool     `name:"warn-any" help:"Warn of variables declared with values whose types can't be deduced (implicitly any)"`
+	Strict     bool     `name:"strict" help:"Compile in strict mode, as #pragma strict does, making warnings errors"`
+	DeadStores bool     `name:"eliminate-dead-stores" help:"Leave assignments whose values are never read out of the bytecode"`
+	Watch      bool     `name:"watch" help:"Reload the functions of the program whenever its file changes, while it runs"`
+	Exec       bool     `name:"allow-exec" help:"Let the program run other programs with exec"`
+	Net        bool     `name:"allow-net" help:"Let the program connect to other machines with connect, send and receive"`
+	Growth     string   `name:"growth" enum:"fixed,doubling,chunked" default:"fixed" help:"How the stacks grow once full, up to 16 times their size (fixed, doubling or chunked)"`
+	Profile    string   `name:"profile" enum:"minimal,standard,full" default:"standard" help:"The builtins the program has as globals (minimal for none, standard, or full for those of --allow-exec and --allow-net too, which it must be run with)"`
+
+	Notation  string `name:"notation" enum:"default,fixed,scientific" default:"default" help:"How numbers are written when converted to strings (default, fixed or scientific)"`
+	Precision int    `name:"precision" default:"-1" help:"Digits after the point when converting numbers to strings, negative for as many as needed"`
+
+	MissingKeys string `name:"missing-keys" enum:"error,empty,keep" default:"error" help:"What render does with keys the data of a template doesn't have (error, empty or keep)"`
+}
+
+// Validate make sure programs are only given the builtins of the full profile, which run other programs and connect to
+// other machines, if they are allowed to use them with --allow-exec and --allow-net
+func (cmd *RunCmd) Validate() error {
+	if core.Profiles[cmd.Profile] == core.ProfileFull && (!cmd.Exec || !cmd.Net) {
+		return errors.New("--profile=full gives the program exec and sockets, so it must be run with --allow-exec and --allow-net")
+	}
+
+	return nil
+}
+
+// builtins get the builtins the program is allowed to use besides the default ones, such as exec with --allow-exec
+func (cmd *RunCmd) builtins() *core.Registry {
+	allowed := core.NewRegistry()
+	for _, r := range []struct {
+		allow    bool
+		builtins *core.Registry
+	}{{cmd.Exec, core.ExecBuiltins}, {cmd.Net, core.SocketBuiltins}} {
+		if !r.allow {
+			continue
+		}
+
+		for _, name := range r.builtins.Names() {
+			allowed.Register(*r.builtins.Get(name))
+		}
+	}
+
+	return allowed
+}
+
+var growthPolicies = map[string]core.GrowthPolicy{
+	"fixed":    core.GrowthFixed,
+	"doubling": core.GrowthDoubling,
+	"chunked":  core.GrowthChunked,
+}
+
+var missingKeys = map[string]core.MissingKeys{
+	"error": core.MissingKeysError,
+	"empty": core.MissingKeysEmpty,
+	"keep":  core.MissingKeysKeep,
+}
+
+var notations = map[string]core.Notation{
+	"default":    core.NotationDefault,
+	"fixed":      core.NotationFixed,
+	"scientific": core.NotationScientific,
+}
+
+// defines get the constants to compile a program with from --define flags, which are name=value or just name (for
+// true). Values are numbers, true or false if they can be, otherwise strings. wasm and debug are false unless defined.
+func defines(flags []string) map[string]core.Value {
+	values := map[string]core.Value{
+		"wasm":  core.NewBool(false),
+		"debug": core.NewBool(false),
+	}
+
+	for _, flag := range flags {
+		name, value, ok := strings.Cut(flag, "=")
+		if !ok {
+			values[name] = core.NewBool(true)
+		} else if n, err := strconv.ParseFloat(value, 64); err == nil {
+			values[name] = core.NewNumber(n)
+		} else if b, err := strconv.ParseBool(value); err == nil {
+			values[name] = core.NewBool(b)
+		} else {
+			values[name] = core.NewString(value)
+		}
+	}
+
+	return values
 }
 
 // WorkingDirectoryResolver resolves imports relative to the working directory
@@ -48,6 +143,20 @@ func (r *WorkingDirectoryResolver) Resolve(path string) (core.Node, error) {
 	return tree, nil
 }
 
+// ResolveSource read the source of an import, for the compiler to parse itself so errors in it show the right file
+func (r *WorkingDirectoryResolver) ResolveSource(path string) (string, error) {
+	f, err := os.ReadFile(filepath.Join(r.workingDirectory, path))
+	if err != nil {
+		return "", err
+	}
+
+	return string(f), nil
+}
+
+func (r *WorkingDirectoryResolver) ResolveBytecode(path string) ([]byte, error) {
+	return os.ReadFile(filepath.Join(r.workingDirectory, path))
+}
+
 func (cmd *RunCmd) Run(ctx *Context) error {
 	if ctx.Debug {
 		log.Println("Reading file")
@@ -60,8 +169,15 @@ func (cmd *RunCmd) Run(ctx *Context) error {
 	}
 
 	var chunk *core.Chunk
+
+	// the source, to show where errors happen; nil when running bytecode
+	var source []rune
+	// sources the sources of the files the program imports, to show where errors in them happen
+	var sources map[string][]rune
+
 	if !cmd.Bytecode {
 		src := string(f)
+		source = []rune(src)
 
 		if ctx.Debug {
 			log.Println("Initialized lexer")
@@ -103,6 +219,21 @@ func (cmd *RunCmd) Run(ctx *Context) error {
 			log.Println("Initialized compiler")
 		}
 		c := core.NewCompiler()
+		c.SetPositions(p.Positions())
+		c.SetDecimal(cmd.Decimal)
+		c.SetImplicitAnyWarnings(cmd.WarnAny)
+		c.SetStrict(cmd.Strict)
+		c.SetDeadStoreElimination(cmd.DeadStores)
+		c.SetFileName(cmd.File)
+		c.SetProfile(core.Profiles[cmd.Profile])
+
+		for name, value := range defines(cmd.Define) {
+			c.Define(name, value)
+		}
+
+		for _, name := range cmd.builtins().Names() {
+			c.DeclareGlobal(name)
+		}
 
 		if ctx.Debug {
 			log.Println("Setting imports resolver")
@@ -118,22 +249,29 @@ func (cmd *RunCmd) Run(ctx *Context) error {
 		}
 		err = c.Compile(tree)
 		if err != nil {
-			return err
+			print(core.FormatError(err, source))
+			os.Exit(1)
 		}
 
-		chunk = c.Chunk
-	} else {
-		if ctx.Debug {
-			log.Println("Registering GOB types")
+		sources = c.Sources()
+		for _, n := range c.Notes() {
+			if n.File != "" {
+				print(n.Format(sources[n.File]))
+			} else {
+				print(n.Format(source))
+			}
 		}
 
-		core.RegisterGOBTypes()
-
+		chunk = c.Chunk
+	} else {
 		if ctx.Debug {
 			log.Println("Deserializing file")
 		}
 
-		chunk = core.DeserializeChunk(f)
+		chunk, err = core.DecodeChunk(f, core.Codecs[cmd.Codec])
+		if err != nil {
+			return err
+		}
 	}
 
 	if ctx.Debug {
@@ -144,6 +282,41 @@ func (cmd *RunCmd) Run(ctx *Context) error {
 		log.Println("Initialized VM")
 	}
 	vm := core.NewVM(chunk, 256, 256)
+	vm.SetNumberFormat(core.NumberFormat{Notation: notations[cmd.Notation], Precision: cmd.Precision})
+	vm.SetStackGrowth(growthPolicies[cmd.Growth], 256*16, 256*16)
+	vm.SetMissingKeys(missingKeys[cmd.MissingKeys])
+	vm.SetProfile(core.Profiles[cmd.Profile])
+	defer vm.Close()
+
+	for name, value := range cmd.builtins().Values() {
+		vm.SetGlobal(name, value)
+	}
+
+	if ctx.Debug {
+		defer func() {
+			values, calls := vm.StackUsage()
+			log.Printf("Used %d of %d values and %d of %d calls at most", values.High, values.Size, calls.High, calls.Size)
+		}()
+	}
+
+	var handlers []func(vm *core.VM, chunk *core.Chunk, at core.Pos)
+	if cmd.Trace {
+		handlers = append(handlers, traceInstruction)
+	}
+
+	if cmd.Watch && !cmd.Bytecode {
+		dir, _ := filepath.Split(cmd.File)
+		options := core.CompileOptions{Imports: &WorkingDirectoryResolver{dir}, Defines: defines(cmd.Define), Decimal: cmd.Decimal, WarnImplicitAny: cmd.WarnAny, Strict: cmd.Strict, Builtins: cmd.builtins(), FileName: cmd.File, EliminateDeadStores: cmd.DeadStores, Profile: core.Profiles[cmd.Profile]}
+		handlers = append(handlers, newWatcher(cmd.File, options).poll)
+	}
+
+	if len(handlers) > 0 {
+		vm.SetInstructionHandler(func(vm *core.VM, chunk *core.Chunk, at core.Pos) {
+			for _, handler := range handlers {
+				handler(vm, chunk, at)
+			}
+		})
+	}
 
 	if ctx.Debug {
 		log.Println("Executing bytecode")
@@ -153,103 +326,219 @@ func (cmd *RunCmd) Run(ctx *Context) error {
 	for vm.Next() {
 	}
 
-	return nil
+	if err := vm.Error(); err != nil {
+		print(err.FormatSources(source, sources))
+		vm.Close()
+		os.Exit(1)
+	}
+
+	// programs with a main function begin there, once the top level has been executed
+	if main, ok := vm.Variable(core.MainFunction).(*core.FunctionValue); ok {
+		args := make([]interface{}, len(cmd.Args))
+		for i, arg := range cmd.Args {
+			args[i] = arg
+		}
+
+		_, err := vm.Call(main, []core.Value{core.GoToValue(args)})
+		if e, ok := err.(*core.ErrorValue); ok {
+			print(e.FormatSources(source, sources))
+			vm.Close()
+			os.Exit(1)
+		} else if err != nil {
+			return err
+		}
+	}
+
+	// then the timers the program has set, until there are none left
+	err = vm.RunTimers()
+	if e, ok := err.(*core.ErrorValue); ok {
+		print(e.FormatSources(source, sources))
+		vm.Close()
+		os.Exit(1)
+	}
+
+	return err
+}
+
+// traceInstruction print the instruction about to be executed, along with the function it is in and the value on top
+// of the stack
+func traceInstruction(vm *core.VM, chunk *core.Chunk, at core.Pos) {
+	top := "-"
+	if stack := vm.Stack(); len(stack) > 0 {
+		top = stack[len(stack)-1].DebugString()
+	}
+
+	fmt.Fprintf(os.Stderr, "%-12s %5d  %-40s | %s\n", vm.Trace()[0].Function, at, chunk.Disassemble(at), top)
 }
 
 type CompileCmd struct {
-	File   string `arg:"" name:"file" help:"File to compile program from" type:"existingfile"`
-	Output string `arg:"" name:"output" help:"File path to output bytecode to" type:"path"`
+	Files      []string `arg:"" name:"files" help:"Files to compile the program from, in order" type:"existingfile"`
+	Output     string   `name:"output" short:"o" help:"File path to output bytecode to, required unless --no-output" type:"path"`
+	Bundle     bool     `name:"bundle" help:"Compile each file into a program of its own, keyed by its path, instead of one program"`
+	Codec      string   `name:"codec" aliases:"format" enum:"binary,gob,json" default:"binary" help:"The format bytecode is written in (binary, gob, or json for people to read). Bundles are always binary."`
+	Define     []string `name:"define" short:"d" help:"Constants to compile the program with, as name=value (or name, for true)"`
+	Decimal    bool     `name:"decimal" help:"Make numbers exact decimals rather than floats, as #pragma decimal does"`
+	WarnAny    bool     `name:"warn-any" help:"Warn of variables declared with values whose types can't be deduced (implicitly any)"`
+	Strict     bool     `name:"strict" help:"Compile in strict mode, as #pragma strict does, making warnings errors"`
+	DeadStores bool     `name:"eliminate-dead-stores" help:"Leave assignments whose values are never read out of the bytecode"`
+	Profile    string   `name:"profile" enum:"minimal,standard,full" default:"standard" help:"The builtins the program is checked against, as it is run with them (minimal, standard or full)"`
+
+	Diagnostics string `name:"diagnostics" enum:"text,json" default:"text" help:"How errors and warnings are written (text, or json for tools to read)"`
+	Summary     bool   `name:"summary" help:"Write the functions, constants and bytes of bytecode of each program compiled"`
+	NoOutput    bool   `name:"no-output" help:"Only check the program compiles, without writing bytecode"`
+}
+
+// compileReport what compiling is reported with --diagnostics=json, written as one JSON object
+type compileReport struct {
+	Diagnostics []core.Diagnostic `json:"diagnostics"`
+	// Summary the summary of each program compiled, with --summary
+	Summary []moduleSummary `json:"summary,omitempty"`
+}
+
+// moduleSummary the summary of a program compiled, keyed by its file (the first, for programs of several files)
+type moduleSummary struct {
+	Module string `json:"module"`
+	core.ChunkSummary
 }
 
 func (cmd *CompileCmd) Run(ctx *Context) error {
-	if ctx.Debug {
-		log.Println("Reading file")
+	if cmd.Output == "" && !cmd.NoOutput {
+		return errors.New("--output is required unless --no-output is given")
 	}
 
-	f, err := os.ReadFile(cmd.File)
-
-	if err != nil {
-		return err
+	if cmd.Bundle && cmd.Codec != "binary" {
+		return errors.New("bundles are only written in the binary format")
 	}
 
-	src := string(f)
+	files := make([]core.SourceFile, len(cmd.Files))
+	for i, file := range cmd.Files {
+		if ctx.Debug {
+			log.Printf("Reading %s", file)
+		}
 
-	if ctx.Debug {
-		log.Println("Initializing lexer")
-	}
-	l := core.NewLexer(src)
+		f, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
 
-	if ctx.Debug {
-		log.Println("Lexing all tokens")
+		files[i] = core.SourceFile{Name: file, Source: string(f)}
 	}
-	tokens, err := l.Tokenize()
 
-	if err != nil {
-		log.Fatal(err)
-	}
+	// imports are relative to the first file
+	dir, _ := filepath.Split(cmd.Files[0])
+	options := core.CompileOptions{Imports: &WorkingDirectoryResolver{dir}, Defines: defines(cmd.Define), Decimal: cmd.Decimal, WarnImplicitAny: cmd.WarnAny, Strict: cmd.Strict, EliminateDeadStores: cmd.DeadStores, Profile: core.Profiles[cmd.Profile]}
 
-	if ctx.Debug {
-		log.Println("Initializing parser")
-	}
-	p := core.NewParser(tokens)
+	var serialized []byte
+	report := compileReport{Diagnostics: []core.Diagnostic{}}
 
-	if ctx.Debug {
-		log.Println("Parsing tree")
-	}
+	if cmd.Bundle {
+		if ctx.Debug {
+			log.Printf("Compiling %d files into a bundle", len(files))
+		}
 
-	tree, err := p.Parse()
+		bundle, err := core.CompileBundle(files, options)
+		if err != nil {
+			cmd.fail(report, err)
+		}
 
-	if err != nil {
-		print(err.(*core.ParsingError).Format([]rune(src)))
+		for _, file := range files {
+			cmd.report(&report, file.Name, bundle[file.Name], files)
+		}
+
+		serialized = bundle.Serialize()
+	} else {
+		if ctx.Debug {
+			log.Printf("Compiling %d files into one program", len(files))
+		}
+
+		program, err := core.CompileFiles(files, options)
+		if err != nil {
+			cmd.fail(report, err)
+		}
+
+		cmd.report(&report, cmd.Files[0], program, files)
+
+		serialized, err = program.Encode(core.Codecs[cmd.Codec])
+		if err != nil {
+			return err
+		}
 	}
 
-	if ctx.Debug {
-		log.Println("Initialized compiler")
+	if cmd.Diagnostics == "json" {
+		if err := writeReport(report); err != nil {
+			return err
+		}
 	}
 
-	c := core.NewCompiler()
+	if cmd.NoOutput {
+		return nil
+	}
 
 	if ctx.Debug {
-		log.Println("Setting import resolver")
+		log.Println("Writing file")
 	}
 
-	dir, _ := filepath.Split(cmd.File)
-	c.SetImportsResolver(&WorkingDirectoryResolver{
-		dir,
-	})
+	return os.WriteFile(cmd.Output, serialized, 0666)
+}
 
-	if ctx.Debug {
-		log.Println("Compiling parse tree")
-	}
+// report add the notes and summary of a program compiled to the report, or print them if they aren't written as
+// JSON
+func (cmd *CompileCmd) report(report *compileReport, module string, program *core.Program, files []core.SourceFile) {
+	summary := moduleSummary{module, program.Chunk().Summary()}
 
-	err = c.Compile(tree)
-	if err != nil {
-		return err
+	if cmd.Diagnostics == "json" {
+		report.Diagnostics = append(report.Diagnostics, program.Diagnostics()...)
+		if cmd.Summary {
+			report.Summary = append(report.Summary, summary)
+		}
+
+		return
 	}
 
-	if ctx.Debug {
-		log.Println("Registering GOB types")
+	printNotes(program, files)
+	if cmd.Summary {
+		fmt.Printf("%s: %d functions, %d constants, %d bytes of bytecode\n", module, summary.Functions, summary.Constants, summary.Bytecode)
 	}
+}
 
-	core.RegisterGOBTypes()
+// fail report the error compiling failed with, and exit
+func (cmd *CompileCmd) fail(report compileReport, err error) {
+	if cmd.Diagnostics != "json" {
+		print(core.FormatError(err, nil))
+		log.Fatal("Compiling had errors")
+	}
 
-	if ctx.Debug {
-		log.Println("Serializing chunk")
+	report.Diagnostics = append(report.Diagnostics, core.ErrorDiagnostic(err, nil))
+	if err := writeReport(report); err != nil {
+		log.Fatal(err)
 	}
 
-	serialized := c.Chunk.Serialize()
+	os.Exit(1)
+}
 
-	if ctx.Debug {
-		log.Println("Writing file")
-	}
+// writeReport write the report of compiling as JSON to standard output
+func writeReport(report compileReport) error {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
 
-	err = os.WriteFile(cmd.Output, serialized, 0666)
+	return encoder.Encode(report)
+}
 
-	if err != nil {
-		return err
+// printNotes print the notes of a program compiled from the files, along with where in them they are about. Notes
+// about the files the program imports are shown with the source of the import.
+func printNotes(program *core.Program, files []core.SourceFile) {
+	sources := make(map[string][]rune, len(files))
+	for _, file := range files {
+		sources[file.Name] = []rune(file.Source)
 	}
 
-	return nil
+	for _, n := range program.Notes() {
+		if src, ok := sources[n.File]; ok {
+			print(n.Format(src))
+		} else {
+			print(n.Format(program.ImportedSource(n.File)))
+		}
+	}
 }
 
 var cli struct {
@@ -257,6 +546,11 @@ var cli struct {
 
 	Run        RunCmd     `cmd:"" name:"run" help:"Run program."`
 	CompileCmd CompileCmd `cmd:"" name:"compile" help:"Compile program to bytecode."`
+	Test       TestCmd    `cmd:"" name:"test" help:"Run test files, reporting the result of each."`
+	Repl       ReplCmd    `cmd:"" name:"repl" help:"Evaluate lines interactively, keeping what they declare."`
+	Syntax     SyntaxCmd  `cmd:"" name:"syntax" help:"Generate a syntax definition for editors."`
+	Lsp        LspCmd     `cmd:"" name:"lsp" help:"Start a language server communicating over stdio."`
+	Rename     RenameCmd  `cmd:"" name:"rename" help:"Rename a variable, function or parameter wherever it is used."`
 }
 
 func main() {
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/alecthomas/kong"
+)
+
+func TestRunCmd_FullProfile(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "main.ang")
+	if err := os.WriteFile(file, []byte("print(1)"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	for args, allowed := range map[string]bool{
+		"":                            true,
+		"--profile=minimal":           true,
+		"--profile=full":              false,
+		"--profile=full --allow-exec": false,
+		"--profile=full --allow-net":  false,
+		"--profile=full --allow-exec --allow-net":     true,
+		"--profile=standard --allow-exec --allow-net": true,
+	} {
+		var cli struct {
+			Run RunCmd `cmd:"" name:"run"`
+		}
+
+		parser, err := kong.New(&cli)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = parser.Parse(append([]string{"run", file}, strings.Fields(args)...))
+		if allowed && err != nil {
+			t.Errorf("Expected run %s to be allowed, got %v", args, err)
+		} else if !allowed && (err == nil || !strings.Contains(err.Error(), "--allow-exec and --allow-net")) {
+			t.Errorf("Expected run %s to be rejected, got %v", args, err)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"neemek.com/anglais/core"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+type RenameCmd struct {
+	File     string `arg:"" name:"file" help:"File of the program to rename in" type:"existingfile"`
+	Position string `arg:"" name:"position" help:"Where the name to rename is, as line:column (starting at 1)"`
+	Name     string `arg:"" name:"name" help:"What to rename it to"`
+
+	Define []string `name:"define" short:"d" help:"Constants to compile the program with, as name=value (or name, for true)"`
+	Write  bool     `name:"write" short:"w" help:"Write the renamed source back to the file, instead of to stdout"`
+}
+
+func (cmd *RenameCmd) Run(ctx *Context) error {
+	src, err := os.ReadFile(cmd.File)
+	if err != nil {
+		return err
+	}
+
+	offset, err := offsetOf([]rune(string(src)), cmd.Position)
+	if err != nil {
+		return err
+	}
+
+	// only programs which compile are renamed in, as names are resolved as the compiler resolves them
+	dir, _ := filepath.Split(cmd.File)
+	program, err := core.Compile(string(src), core.CompileOptions{Imports: &WorkingDirectoryResolver{dir}, Defines: defines(cmd.Define)})
+	if err != nil {
+		print(core.FormatError(err, []rune(string(src))))
+		return errors.New("the program doesn't compile")
+	}
+
+	o := program.Symbols().At(offset)
+	if o == nil {
+		return fmt.Errorf("there is no name at %s", cmd.Position)
+	}
+
+	edits, err := core.Rename(program, o.Symbol, cmd.Name)
+	if err != nil {
+		return err
+	}
+
+	if ctx.Debug {
+		log.Printf("Renaming %s to %s in %d places", o.Symbol.Name, cmd.Name, len(edits))
+	}
+
+	renamed := core.ApplyEdits([]rune(string(src)), edits)
+	if !cmd.Write {
+		fmt.Print(renamed)
+		return nil
+	}
+
+	return os.WriteFile(cmd.File, []byte(renamed), 0666)
+}
+
+// offsetOf get the offset into src of a position written as line:column, both starting at 1 with columns in runes
+func offsetOf(src []rune, position string) (core.Pos, error) {
+	l, c, ok := strings.Cut(position, ":")
+	line, lineErr := strconv.Atoi(l)
+	column, columnErr := strconv.Atoi(c)
+	if !ok || lineErr != nil || columnErr != nil || line < 1 || column < 1 {
+		return 0, fmt.Errorf("expected a position as line:column, got %s", position)
+	}
+
+	offset := 0
+	for ; line > 1 && offset < len(src); offset++ {
+		if src[offset] == '\n' {
+			line--
+		}
+	}
+
+	if line > 1 || offset+column-1 > len(src) {
+		return 0, fmt.Errorf("%s is past the end of the file", position)
+	}
+
+	return core.Pos(offset + column - 1), nil
+}
@@ -0,0 +1,286 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"neemek.com/anglais/core"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+type ReplCmd struct {
+	Define  []string `name:"define" short:"d" help:"Constants to compile the inputs with, as name=value (or name, for true)"`
+	Decimal bool     `name:"decimal" help:"Make numbers exact decimals rather than floats, as #pragma decimal does"`
+	WarnAny bool     `name:"warn-any" help:"Warn of variables declared with values whose types can't be deduced (implicitly any)"`
+	Strict  bool     `name:"strict" help:"Compile in strict mode, as #pragma strict does, making warnings errors"`
+	Preload []string `name:"preload" sep:"none" type:"existingfile" help:"Files to run in the session before the first line, in order"`
+}
+
+// repl the state of an interactive session
+type repl struct {
+	options core.CompileOptions
+	// preload the files run in each session before anything typed
+	preload []string
+	session *core.Session
+	// inputs what was typed in the session, leaving out inputs which failed, as they were undone. Expressions are kept
+	// as statements discarding their values, so the inputs are the source of a program.
+	inputs []string
+}
+
+func (cmd *ReplCmd) Run(ctx *Context) error {
+	wd, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+
+	r := &repl{options: core.CompileOptions{Imports: &WorkingDirectoryResolver{wd}, Defines: defines(cmd.Define), Decimal: cmd.Decimal, WarnImplicitAny: cmd.WarnAny, Strict: cmd.Strict}, preload: cmd.Preload}
+	r.session, err = r.newSession()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		r.session.Close()
+	}()
+
+	scanner := bufio.NewScanner(os.Stdin)
+	input := strings.Builder{}
+
+	fmt.Print("> ")
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		// commands are lines of their own, beginning with a colon
+		if input.Len() == 0 && strings.HasPrefix(line, ":") {
+			r.command(line)
+			fmt.Print("> ")
+			continue
+		}
+
+		input.WriteString(line)
+		input.WriteRune('\n')
+
+		// inputs carry on over lines until their brackets are closed
+		src := input.String()
+		if unclosed(src) {
+			fmt.Print(". ")
+			continue
+		}
+		input.Reset()
+
+		if strings.TrimSpace(src) == "" {
+			fmt.Print("> ")
+			continue
+		}
+
+		if ok, expression := r.evaluate(r.session, src); ok && expression {
+			r.inputs = append(r.inputs, "discard "+src)
+		} else if ok {
+			r.inputs = append(r.inputs, src)
+		}
+
+		fmt.Print("> ")
+	}
+
+	fmt.Println()
+	return scanner.Err()
+}
+
+// newSession create a session to evaluate inputs in, with the files to preload run in it
+func (r *repl) newSession() (*core.Session, error) {
+	session := core.NewSession(r.options, core.RunOptions{Growth: core.GrowthDoubling})
+
+	for _, file := range r.preload {
+		src, err := os.ReadFile(file)
+		if err != nil {
+			session.Close()
+			return nil, err
+		}
+
+		if ok, _ := r.evaluate(session, string(src)); !ok {
+			session.Close()
+			return nil, fmt.Errorf("preloading %s failed", file)
+		}
+	}
+
+	return session, nil
+}
+
+// command run a command of the repl (:save file, :edit or :type expression)
+func (r *repl) command(line string) {
+	name, arg, _ := strings.Cut(strings.TrimSpace(line), " ")
+	arg = strings.TrimSpace(arg)
+
+	switch name {
+	case ":save":
+		if arg == "" {
+			fmt.Println("usage: :save file")
+			return
+		}
+
+		if err := os.WriteFile(arg, []byte(r.source()), 0666); err != nil {
+			fmt.Printf("error: %v\n", err)
+			return
+		}
+
+		fmt.Printf("saved %d inputs to %s\n", len(r.inputs), arg)
+	case ":edit":
+		if err := r.edit(); err != nil {
+			fmt.Printf("error: %v\n", err)
+		}
+	case ":type":
+		if arg == "" {
+			fmt.Println("usage: :type expression")
+			return
+		}
+
+		if err := r.printType(arg); err != nil {
+			fmt.Printf("error: %v\n", err)
+		}
+	default:
+		fmt.Printf("unknown command %s, the commands are :save file, :edit and :type expression\n", name)
+	}
+}
+
+// source what was typed in the session, as the source of a program
+func (r *repl) source() string {
+	return strings.Join(r.inputs, "")
+}
+
+// edit open what was typed in the session in the editor of the user ($EDITOR), then reload the session with what it
+// was edited to. The session is kept as it was if the edited source fails.
+func (r *repl) edit() error {
+	f, err := os.CreateTemp("", "session-*.ang")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.WriteString(r.source()); err != nil {
+		f.Close()
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	editor := os.Getenv("EDITOR")
+	if editor == "" {
+		editor = "vi"
+	}
+
+	// the editor may be given with arguments, such as "code --wait"
+	args := append(strings.Fields(editor), f.Name())
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("running %s: %w", editor, err)
+	}
+
+	edited, err := os.ReadFile(f.Name())
+	if err != nil {
+		return err
+	}
+
+	session, err := r.newSession()
+	if err != nil {
+		return err
+	}
+
+	if ok, _ := r.evaluate(session, string(edited)); !ok && strings.TrimSpace(string(edited)) != "" {
+		session.Close()
+		fmt.Println("the session was kept as it was, as the edited source failed")
+		return nil
+	}
+
+	r.session.Close()
+	r.session, r.inputs = session, []string{string(edited)}
+	fmt.Println("reloaded the session")
+
+	return nil
+}
+
+// printType print the type of an expression, as it would be if it was typed next. It isn't evaluated, as its type is
+// deduced from what was typed (and preloaded) before it.
+func (r *repl) printType(expression string) error {
+	src := strings.Builder{}
+	for _, file := range r.preload {
+		preloaded, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+
+		src.Write(preloaded)
+		src.WriteRune('\n')
+	}
+	src.WriteString(r.source())
+
+	// the expression is discarded, which is of the type of the expression
+	discard := len([]rune(src.String()))
+	src.WriteString("discard " + expression + "\n")
+
+	program, err := core.Compile(src.String(), r.options)
+	if err != nil {
+		return err
+	}
+
+	// names are described by what they were declared as
+	start := core.Pos(discard + len("discard "))
+	if info := core.TypeAt(program, start); info != nil && info.Name != "" && int(info.Token.Length) == len([]rune(expression)) {
+		fmt.Println(info.Signature)
+		return nil
+	}
+
+	if info := core.TypeAt(program, core.Pos(discard)); info != nil {
+		fmt.Println(info.Kind)
+	}
+
+	return nil
+}
+
+// evaluate run an input of a session, printing its value, notes and errors. Returns whether it succeeded, and whether
+// it was an expression, which has a value.
+func (r *repl) evaluate(session *core.Session, src string) (bool, bool) {
+	v, err := session.Eval(src)
+
+	for _, n := range session.Notes() {
+		print(n.Format([]rune(src)))
+	}
+
+	var runtime *core.ErrorValue
+	if errors.As(err, &runtime) {
+		print(runtime.FormatSource([]rune(src)))
+	} else if err != nil {
+		print(core.FormatError(err, []rune(src)))
+	} else if v != nil {
+		fmt.Println(v.DebugString())
+	}
+
+	return err == nil, v != nil
+}
+
+// unclosed whether source has brackets which are opened but not closed yet, outside of strings and comments
+func unclosed(src string) bool {
+	depth := 0
+	inString, inComment := false, false
+	for _, r := range src {
+		switch {
+		case inComment:
+			inComment = r != '\n'
+		case inString:
+			inString = r != '"'
+		case r == '"':
+			inString = true
+		case r == '#':
+			inComment = true
+		case r == '{' || r == '(' || r == '[':
+			depth++
+		case r == '}' || r == ')' || r == ']':
+			depth--
+		}
+	}
+
+	return depth > 0
+}
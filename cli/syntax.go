@@ -0,0 +1,131 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"neemek.com/anglais/core"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+type SyntaxCmd struct {
+	Format string `name:"format" short:"f" enum:"textmate,tree-sitter" default:"textmate" help:"Format of the syntax definition (textmate or tree-sitter)"`
+	Output string `name:"output" short:"o" help:"File path to write the definition to, instead of stdout" type:"path"`
+}
+
+// patterns for the tokens that aren't fixed lexemes, matching what the lexer accepts
+const (
+	syntaxNamePattern    = `[\p{L}_][\p{L}\p{N}_]*`
+	syntaxNumberPattern  = `\d+(n|\.\d*)?`
+	syntaxStringPattern  = `"[^"\n]*"`
+	syntaxCommentPattern = `#.*$`
+)
+
+func (cmd *SyntaxCmd) Run(ctx *Context) error {
+	var definition interface{}
+	switch cmd.Format {
+	case "textmate":
+		definition = textMateGrammar()
+	case "tree-sitter":
+		definition = treeSitterTokens()
+	default:
+		return fmt.Errorf("unknown syntax format %s", cmd.Format)
+	}
+
+	out, err := json.MarshalIndent(definition, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if cmd.Output == "" {
+		fmt.Println(string(out))
+		return nil
+	}
+
+	return os.WriteFile(cmd.Output, append(out, '\n'), 0666)
+}
+
+// isConstantKeyword whether a keyword is a literal value rather than a control keyword
+func isConstantKeyword(t core.TokenType) bool {
+	return t == core.TokenTrue || t == core.TokenFalse || t == core.TokenNil
+}
+
+// sortedLexemes get the lexemes of a token table, longest first so alternations match greedily
+func sortedLexemes(table map[string]core.TokenType, include func(core.TokenType) bool) []string {
+	lexemes := make([]string, 0, len(table))
+	for lexeme, t := range table {
+		if include(t) {
+			lexemes = append(lexemes, lexeme)
+		}
+	}
+
+	sort.Slice(lexemes, func(i, j int) bool {
+		if len(lexemes[i]) != len(lexemes[j]) {
+			return len(lexemes[i]) > len(lexemes[j])
+		}
+
+		return lexemes[i] < lexemes[j]
+	})
+
+	return lexemes
+}
+
+func alternation(lexemes []string) string {
+	quoted := make([]string, len(lexemes))
+	for i, lexeme := range lexemes {
+		quoted[i] = regexp.QuoteMeta(lexeme)
+	}
+
+	return strings.Join(quoted, "|")
+}
+
+func textMateGrammar() map[string]interface{} {
+	constants := sortedLexemes(core.Keywords, isConstantKeyword)
+	keywords := sortedLexemes(core.Keywords, func(t core.TokenType) bool { return !isConstantKeyword(t) })
+	operators := sortedLexemes(core.Operators, func(t core.TokenType) bool { return true })
+
+	return map[string]interface{}{
+		"$schema":   "https://raw.githubusercontent.com/martinring/tmlanguage/master/tmlanguage.json",
+		"name":      "Anglais",
+		"scopeName": "source.anglais",
+		"fileTypes": []string{"ang"},
+		"patterns": []map[string]interface{}{
+			{"name": "comment.line.number-sign.anglais", "match": syntaxCommentPattern},
+			{"name": "comment.block.anglais", "begin": `/\*`, "end": `\*/`},
+			{"name": "string.unquoted.heredoc.anglais", "begin": `<<<([\p{L}_][\p{L}\p{N}_]*)$`, "end": `^\s*\1\b`},
+			{"name": "string.quoted.double.anglais", "match": syntaxStringPattern},
+			{"name": "constant.numeric.anglais", "match": `\b` + syntaxNumberPattern},
+			{"name": "constant.language.anglais", "match": `\b(` + alternation(constants) + `)\b`},
+			{"name": "keyword.control.anglais", "match": `\b(` + alternation(keywords) + `)\b`},
+			{"name": "entity.name.function.anglais", "match": syntaxNamePattern + `(?=\s*\()`},
+			{"name": "variable.other.anglais", "match": syntaxNamePattern},
+			{"name": "keyword.operator.anglais", "match": alternation(operators)},
+		},
+	}
+}
+
+func treeSitterTokens() map[string]interface{} {
+	tokens := map[string]interface{}{
+		"name":    map[string]string{"type": "PATTERN", "value": syntaxNamePattern},
+		"number":  map[string]string{"type": "PATTERN", "value": syntaxNumberPattern},
+		"string":  map[string]string{"type": "PATTERN", "value": syntaxStringPattern},
+		"comment": map[string]string{"type": "PATTERN", "value": syntaxCommentPattern},
+	}
+
+	for lexeme, t := range core.Keywords {
+		tokens[strings.ReplaceAll(t.String(), " ", "_")] = map[string]string{"type": "STRING", "value": lexeme}
+	}
+
+	for lexeme, t := range core.Operators {
+		tokens[strings.ReplaceAll(t.String(), " ", "_")] = map[string]string{"type": "STRING", "value": lexeme}
+	}
+
+	return map[string]interface{}{
+		"name":   "anglais",
+		"word":   "name",
+		"extras": []map[string]string{{"type": "PATTERN", "value": `\s`}, {"type": "SYMBOL", "name": "comment"}},
+		"rules":  tokens,
+	}
+}
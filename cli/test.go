@@ -0,0 +1,230 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"neemek.com/anglais/core"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+type TestCmd struct {
+	Paths []string `arg:"" name:"paths" help:"Test files, or directories of test files (*.ang), to run" type:"existingfile|existingdir"`
+
+	Golden bool `name:"golden" help:"Compare the output of each file (along with its diagnostics) to the .golden file next to it"`
+	Update bool `name:"update" help:"Write the .golden files with the current output, instead of comparing to them"`
+}
+
+// testResult the outcome of running a test file
+type testResult struct {
+	file     string
+	duration time.Duration
+	// err why the test failed, nil if it passed
+	err error
+}
+
+func (r testResult) failedAssertion() bool {
+	e, ok := r.err.(*core.ErrorValue)
+	return ok && strings.HasPrefix(e.Message, core.AssertionError)
+}
+
+// testFiles find the test files of the paths, with directories containing every .ang file within them
+func testFiles(paths []string) ([]string, error) {
+	var files []string
+
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+
+		if !info.IsDir() {
+			files = append(files, path)
+			continue
+		}
+
+		matches, err := filepath.Glob(filepath.Join(path, "*.ang"))
+		if err != nil {
+			return nil, err
+		}
+
+		files = append(files, matches...)
+	}
+
+	return files, nil
+}
+
+// compileFile lex, parse and compile a source file, also giving the notes of the compiler
+func compileFile(file string) (*core.Chunk, string, error) {
+	f, err := os.ReadFile(file)
+	if err != nil {
+		return nil, "", err
+	}
+
+	src := string(f)
+
+	tokens, err := core.NewLexer(src).Tokenize()
+	if err != nil {
+		return nil, "", err
+	}
+
+	p := core.NewParser(tokens)
+	tree, err := p.Parse()
+	if err != nil {
+		var parsingError *core.ParsingError
+		if errors.As(err, &parsingError) && parsingError.Causer != nil {
+			return nil, "", errors.New(parsingError.Format([]rune(src)))
+		}
+
+		return nil, "", err
+	}
+
+	c := core.NewCompiler()
+	c.SetPositions(p.Positions())
+
+	dir, _ := filepath.Split(file)
+	c.SetImportsResolver(&WorkingDirectoryResolver{
+		dir,
+	})
+
+	err = c.Compile(tree)
+	if err != nil {
+		return nil, "", err
+	}
+
+	notes := strings.Builder{}
+	for _, n := range c.Notes() {
+		if n.File != "" {
+			notes.WriteString(n.Format(c.Sources()[n.File]))
+		} else {
+			notes.WriteString(n.Format([]rune(src)))
+		}
+	}
+
+	return c.Chunk, notes.String(), nil
+}
+
+func runTest(file string) testResult {
+	start := time.Now()
+
+	chunk, _, err := compileFile(file)
+	if err != nil {
+		return testResult{file, time.Since(start), err}
+	}
+
+	vm := core.NewVM(chunk, 256, 256)
+	vm.SetOutput(io.Discard)
+	defer vm.Close()
+
+	for vm.Next() {
+	}
+
+	if e := vm.Error(); e != nil {
+		return testResult{file, time.Since(start), e}
+	}
+
+	return testResult{file, time.Since(start), nil}
+}
+
+// goldenFile the file the expected output of a test file is kept in
+func goldenFile(file string) string {
+	return strings.TrimSuffix(file, filepath.Ext(file)) + ".golden"
+}
+
+// goldenOutput run a test file, getting what it writes along with the diagnostics of compiling and running it
+func goldenOutput(file string) string {
+	out := bytes.Buffer{}
+
+	chunk, notes, err := compileFile(file)
+	if err != nil {
+		out.WriteString(strings.TrimSuffix(err.Error(), "\n") + "\n")
+		return out.String()
+	}
+
+	out.WriteString(notes)
+
+	vm := core.NewVM(chunk, 256, 256)
+	vm.SetOutput(&out)
+	defer vm.Close()
+
+	for vm.Next() {
+	}
+
+	if e := vm.Error(); e != nil {
+		src, _ := os.ReadFile(file)
+		out.WriteString(e.FormatSource([]rune(string(src))))
+	}
+
+	return out.String()
+}
+
+// runGoldenTest run a test file, failing if its output differs from its golden file. If update is set, the golden
+// file is written with the output instead.
+func runGoldenTest(file string, update bool) testResult {
+	start := time.Now()
+	output := goldenOutput(file)
+
+	if update {
+		err := os.WriteFile(goldenFile(file), []byte(output), 0666)
+		return testResult{file, time.Since(start), err}
+	}
+
+	expected, err := os.ReadFile(goldenFile(file))
+	if err != nil {
+		return testResult{file, time.Since(start), fmt.Errorf("no golden file, run with --update to create it: %w", err)}
+	}
+
+	if output != string(expected) {
+		return testResult{file, time.Since(start), fmt.Errorf("output differs from %s\n--- expected ---\n%s--- got ---\n%s", goldenFile(file), expected, output)}
+	}
+
+	return testResult{file, time.Since(start), nil}
+}
+
+func (cmd *TestCmd) Run(ctx *Context) error {
+	files, err := testFiles(cmd.Paths)
+	if err != nil {
+		return err
+	}
+
+	failed := 0
+	for _, file := range files {
+		var result testResult
+		if cmd.Golden || cmd.Update {
+			result = runGoldenTest(file, cmd.Update)
+		} else {
+			result = runTest(file)
+		}
+
+		if result.err == nil {
+			fmt.Printf("ok   \t%s\t(%s)\n", result.file, result.duration.Round(time.Microsecond))
+			continue
+		}
+
+		failed++
+		kind := "error"
+		if result.failedAssertion() {
+			kind = "assertion"
+		}
+
+		fmt.Printf("FAIL \t%s\t(%s, %s)\n", result.file, result.duration.Round(time.Microsecond), kind)
+
+		if e, ok := result.err.(*core.ErrorValue); ok {
+			fmt.Print(e.Format())
+		} else {
+			fmt.Println(result.err)
+		}
+	}
+
+	fmt.Printf("%d passed, %d failed\n", len(files)-failed, failed)
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d tests failed", failed, len(files))
+	}
+
+	return nil
+}
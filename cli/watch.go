@@ -0,0 +1,66 @@
+package main
+
+import (
+	"log"
+	"neemek.com/anglais/core"
+	"os"
+	"time"
+)
+
+// watchInterval how often the watched file is checked for changes, at most
+const watchInterval = 250 * time.Millisecond
+
+// watcher reloads the functions of a running program whenever its source file changes
+type watcher struct {
+	file    string
+	options core.CompileOptions
+
+	modified time.Time
+	checked  time.Time
+	// steps instructions executed since the file was last checked, so the clock isn't read for each
+	steps int
+}
+
+func newWatcher(file string, options core.CompileOptions) *watcher {
+	w := &watcher{file: file, options: options, checked: time.Now()}
+	if info, err := os.Stat(file); err == nil {
+		w.modified = info.ModTime()
+	}
+
+	return w
+}
+
+// poll reload the program if its file has changed since it was last checked. It is called before instructions are
+// executed, where the functions of the VM can be swapped.
+func (w *watcher) poll(vm *core.VM, _ *core.Chunk, _ core.Pos) {
+	if w.steps++; w.steps < 1000 {
+		return
+	}
+	w.steps = 0
+
+	if time.Since(w.checked) < watchInterval {
+		return
+	}
+	w.checked = time.Now()
+
+	info, err := os.Stat(w.file)
+	if err != nil || !info.ModTime().After(w.modified) {
+		return
+	}
+	w.modified = info.ModTime()
+
+	src, err := os.ReadFile(w.file)
+	if err != nil {
+		log.Printf("Could not read %s to reload it: %v", w.file, err)
+		return
+	}
+
+	// a program which fails to compile is left running as it was
+	program, err := core.Compile(string(src), w.options)
+	if err != nil {
+		print(core.FormatError(err, []rune(string(src))))
+		return
+	}
+
+	log.Printf("Reloaded %d functions of %s", len(vm.Reload(program)), w.file)
+}
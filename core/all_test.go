@@ -16,8 +16,9 @@ func GetAllTestCases() map[string]AllTestCase {
 			[]Value{
 				&VariableValue{
 					"a",
-					&NumberValue{1},
+					&NumberValue{1, nil},
 					0,
+					nil,
 				},
 			},
 		},
@@ -37,11 +38,14 @@ func GetAllTestCases() map[string]AllTestCase {
 								InstructionAdd,
 								InstructionReturn,
 								InstructionAscend,
+								InstructionNil,
+								InstructionReturn,
 							},
 							Constants: []Value{&StringValue{"a"}, &StringValue{"b"}},
 						},
 					},
 					0,
+					nil,
 				},
 			},
 		},
@@ -0,0 +1,165 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+)
+
+// BigIntValue an integer of any size, written as a literal with an n after it (123n)
+type BigIntValue struct {
+	int *big.Int
+}
+
+func NewBigInt(n *big.Int) *BigIntValue {
+	return &BigIntValue{n}
+}
+
+func (v *BigIntValue) BigInt() *big.Int {
+	return new(big.Int).Set(v.int)
+}
+
+func (v *BigIntValue) Type() ValueType {
+	return BigIntValueType
+}
+
+func (v *BigIntValue) String() string {
+	return v.int.String()
+}
+
+func (v *BigIntValue) DebugString() string {
+	return v.String() + "n"
+}
+
+func (v *BigIntValue) Equals(other Value) bool {
+	switch other := other.(type) {
+	case *BigIntValue:
+		return v.int.Cmp(other.int) == 0
+	case *NumberValue:
+		// the same integer, whichever type it is
+		n, ok := other.toBigInt()
+		return ok && v.int.Cmp(n) == 0
+	}
+
+	return false
+}
+
+func (v *BigIntValue) Hash() uint64 {
+	return hashInteger(v.int)
+}
+
+var BigIntPrototype = map[string]*BuiltinFunctionValue{
+	"number": {
+		"number",
+		[]string{},
+		func(_ *VM, this Value, p map[string]Value) (Value, error) {
+			f, _ := new(big.Float).SetInt(this.(*BigIntValue).int).Float64()
+			return &NumberValue{f, nil}, nil
+		},
+		nil,
+	},
+}
+
+func (v *BigIntValue) Get(key string) (Value, error) {
+	if prop, ok := BigIntPrototype[key]; ok {
+		return prop, nil
+	}
+
+	return nil, errors.New(fmt.Sprintf("bigint has no property \"%s\"", key))
+}
+
+// toBigInt get the number as an integer of any size, if it is an integer
+func (v *NumberValue) toBigInt() (*big.Int, bool) {
+	if math.IsInf(v.float64, 0) || v.float64 != math.Trunc(v.float64) {
+		return nil, false
+	}
+
+	n, _ := big.NewFloat(v.float64).Int(nil)
+	return n, true
+}
+
+// bigIntArithmetic do an arithmetic or comparison instruction on a bigint and another number. Numbers which are
+// integers are used as bigints, so 2n * 3 is 6n, while numbers with a fraction can only be compared to bigints.
+// Division rounds towards zero.
+func bigIntArithmetic(op Bytecode, l Value, r Value) (Value, error) {
+	li, lok := bigInt(l)
+	ri, rok := bigInt(r)
+	if !lok || !rok {
+		// compared as floats, which are exact for integers of any size
+		lf, lok := bigFloat(l)
+		rf, rok := bigFloat(r)
+		if lok && rok {
+			if c := compare(op, lf.Cmp(rf)); c != nil {
+				return c, nil
+			}
+		}
+
+		return nil, errors.New(fmt.Sprintf("cannot %s %s and %s", operations[op], TypeOf(l), TypeOf(r)))
+	}
+
+	switch op {
+	case InstructionAdd:
+		return &BigIntValue{new(big.Int).Add(li, ri)}, nil
+	case InstructionSub:
+		return &BigIntValue{new(big.Int).Sub(li, ri)}, nil
+	case InstructionMul:
+		return &BigIntValue{new(big.Int).Mul(li, ri)}, nil
+	case InstructionDiv:
+		if ri.Sign() == 0 {
+			return nil, errors.New("cannot divide by zero")
+		}
+
+		return &BigIntValue{new(big.Int).Quo(li, ri)}, nil
+	case InstructionBitwiseAnd:
+		return &BigIntValue{new(big.Int).And(li, ri)}, nil
+	case InstructionBitwiseOr:
+		return &BigIntValue{new(big.Int).Or(li, ri)}, nil
+	case InstructionBitwiseXor:
+		return &BigIntValue{new(big.Int).Xor(li, ri)}, nil
+	case InstructionShiftLeft, InstructionShiftRight:
+		if ri.Sign() < 0 || !ri.IsUint64() || ri.Uint64() > math.MaxInt32 {
+			return nil, errors.New(fmt.Sprintf("cannot shift by %s", ri))
+		}
+
+		if op == InstructionShiftLeft {
+			return &BigIntValue{new(big.Int).Lsh(li, uint(ri.Uint64()))}, nil
+		}
+
+		return &BigIntValue{new(big.Int).Rsh(li, uint(ri.Uint64()))}, nil
+	}
+
+	if c := compare(op, li.Cmp(ri)); c != nil {
+		return c, nil
+	}
+
+	return nil, errors.New(fmt.Sprintf("cannot %s %s and %s", operations[op], TypeOf(l), TypeOf(r)))
+}
+
+// bigInt get a bigint or a number which is an integer as a big.Int
+func bigInt(v Value) (*big.Int, bool) {
+	switch v := v.(type) {
+	case *BigIntValue:
+		return v.int, true
+	case *NumberValue:
+		return v.toBigInt()
+	}
+
+	return nil, false
+}
+
+// bigFloat get a bigint or a number, other than NaN, as a big.Float
+func bigFloat(v Value) (*big.Float, bool) {
+	switch v := v.(type) {
+	case *BigIntValue:
+		return new(big.Float).SetInt(v.int), true
+	case *NumberValue:
+		if math.IsNaN(v.float64) {
+			return nil, false
+		}
+
+		return big.NewFloat(v.float64), true
+	}
+
+	return nil, false
+}
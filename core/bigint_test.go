@@ -0,0 +1,91 @@
+package core
+
+import (
+	"bytes"
+	"math/big"
+	"strings"
+	"testing"
+)
+
+func TestBigInt(t *testing.T) {
+	for src, expected := range map[string]string{
+		`print(9007199254740993n + 1n)`: "9007199254740994",
+		`print(2n * 3)`:                 "6",
+		`print(7n / 2n)`:                "3",
+		`print(-7n / 2)`:                "-3",
+		`print(1n < 1.5)`:               "true",
+		`print(5n == 5)`:                "true",
+		`print(5 == 5n)`:                "true",
+		`print(typeof(5n))`:             "bigint",
+		`print([1n, 2])`:                "[1n, 2]",
+		`print(bigint("123456789012345678901234567890") * 10)`: "1234567890123456789012345678900",
+		`print((2n * 3n).number() + 0.5)`:                      "6.5",
+		`x := 1n
+i := 0
+while i < 100 {
+	x = x * 2
+	i = i + 1
+}
+print(x)`: "1267650600228229401496703205376",
+	} {
+		for _, options := range []CompileOptions{{}, {NoFolding: true}} {
+			program, err := Compile(src, options)
+			if err != nil {
+				t.Fatalf("Unexpected error compiling %q: %v", src, err)
+			}
+
+			out := bytes.Buffer{}
+			if _, err := program.Run(RunOptions{Output: &out}); err != nil {
+				t.Fatalf("Unexpected error running %q: %v", src, err)
+			}
+
+			if out.String() != expected {
+				t.Errorf("Expected %q to print %q, got %q", src, expected, out.String())
+			}
+		}
+	}
+}
+
+func TestBigInt_Errors(t *testing.T) {
+	for src, expected := range map[string]string{
+		`x := 0n
+print(1n / x)`: "cannot divide by zero",
+		`x := 0.5
+print(1n + x)`: "cannot add bigint and number",
+	} {
+		program, err := Compile(src, CompileOptions{})
+		if err != nil {
+			t.Fatalf("Unexpected error compiling %q: %v", src, err)
+		}
+
+		if _, err := program.Run(RunOptions{Output: &bytes.Buffer{}}); err == nil || !strings.Contains(err.Error(), expected) {
+			t.Errorf("Expected %q to fail with %q, got %v", src, expected, err)
+		}
+	}
+}
+
+func TestBigInt_Serialize(t *testing.T) {
+	program, err := Compile(`x := 5
+print(x == 5n)
+print(123456789012345678901234567890n)`, CompileOptions{})
+	if err != nil {
+		t.Fatalf("Unexpected error compiling: %v", err)
+	}
+
+	loaded, err := LoadProgram(program.Serialize())
+	if err != nil {
+		t.Fatalf("Unexpected error loading: %v", err)
+	}
+
+	out := bytes.Buffer{}
+	if _, err := loaded.Run(RunOptions{Output: &out}); err != nil {
+		t.Fatalf("Unexpected error running: %v", err)
+	}
+
+	if out.String() != "true123456789012345678901234567890" {
+		t.Errorf("Expected loaded programs to keep their bigints, got %q", out.String())
+	}
+
+	n, _ := new(big.Int).SetString("123456789012345678901234567890", 10)
+	CompareValues(t, GoToValue(n), NewBigInt(n))
+}
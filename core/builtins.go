@@ -0,0 +1,90 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// Signature the parameters a builtin is called with
+type Signature struct {
+	Params []string
+}
+
+// Check check that a function with the signature is called with the right number of arguments
+func (s Signature) Check(name string, args int) error {
+	if args != len(s.Params) {
+		return errors.New(fmt.Sprintf("%s takes %d arguments, got %d", name, len(s.Params), args))
+	}
+
+	return nil
+}
+
+// Builtin a function implemented in Go, which programs call like any other function
+type Builtin struct {
+	Name      string
+	Signature Signature
+	// Const whether what the builtin returns only depends on its arguments, without side effects, so calls with
+	// constant arguments can be computed while compiling
+	Const bool
+	F     func(vm *VM, this Value, args map[string]Value) (Value, error)
+}
+
+// Value get the function value programs call the builtin through
+func (b *Builtin) Value() *BuiltinFunctionValue {
+	return &BuiltinFunctionValue{b.Name, b.Signature.Params, b.F, nil}
+}
+
+// Registry builtins by name, such as the default globals, the functions of a standard module or those provided by a
+// host. Registries are shared by every VM using them, so they should be filled before programs run, and not changed
+// after.
+type Registry struct {
+	builtins map[string]*Builtin
+	values   map[string]Value
+}
+
+// NewRegistry create a registry of the builtins. The names of the builtins must be unique.
+func NewRegistry(builtins ...Builtin) *Registry {
+	r := &Registry{map[string]*Builtin{}, map[string]Value{}}
+	for _, b := range builtins {
+		if err := r.Register(b); err != nil {
+			panic(err)
+		}
+	}
+
+	return r
+}
+
+// Register add a builtin to the registry
+func (r *Registry) Register(b Builtin) error {
+	if _, ok := r.builtins[b.Name]; ok {
+		return errors.New(fmt.Sprintf("builtin %s is already registered", b.Name))
+	}
+
+	r.builtins[b.Name] = &b
+	r.values[b.Name] = b.Value()
+
+	return nil
+}
+
+// Get get the builtin with the name, or nil if there is none
+func (r *Registry) Get(name string) *Builtin {
+	return r.builtins[name]
+}
+
+// Names get the names of the builtins, sorted
+func (r *Registry) Names() []string {
+	names := make([]string, 0, len(r.builtins))
+	for name := range r.builtins {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+// Values get the function values of the builtins by name. The map is shared, so it must not be changed.
+func (r *Registry) Values() map[string]Value {
+	return r.values
+}
@@ -0,0 +1,132 @@
+package core
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRegistry(t *testing.T) {
+	r := NewRegistry(Builtin{"double", Signature{[]string{"n"}}, true, func(vm *VM, this Value, params map[string]Value) (Value, error) {
+		return NewNumber(params["n"].(*NumberValue).Number() * 2), nil
+	}})
+
+	if err := r.Register(Builtin{"double", Signature{}, false, nil}); err == nil {
+		t.Errorf("Expected registering a builtin twice to fail")
+	}
+
+	if r.Get("double") == nil || r.Get("triple") != nil {
+		t.Errorf("Expected only the registered builtin to be found")
+	}
+
+	program, err := Compile(`x := double(21)`, CompileOptions{Builtins: r})
+	if err != nil {
+		t.Fatalf("Unexpected error compiling: %v", err)
+	}
+
+	vm := program.NewVM(RunOptions{Builtins: r})
+	defer vm.Close()
+
+	for vm.Next() {
+	}
+
+	if vm.Error() != nil {
+		t.Fatalf("Unexpected error running: %v", vm.Error())
+	}
+
+	CompareValues(t, vm.Variable("x"), NewNumber(42))
+}
+
+func TestVM_Arity(t *testing.T) {
+	// functions known while compiling are checked then
+	for src, expected := range map[string]string{
+		`typeof(1, 2)`: "typeof takes 1 arguments, got 2",
+		`func f(a, b) {}
+f(1)`: "f takes 2 arguments, got 1",
+	} {
+		if _, err := Compile(src, CompileOptions{}); err == nil || !strings.Contains(err.Error(), expected) {
+			t.Errorf("Expected %q to fail compiling with %q, got %v", src, expected, err)
+		}
+	}
+
+	for src, expected := range map[string]string{
+		`g := typeof
+g(1, 2)`: "typeof takes 1 arguments, got 2",
+		`func f(a, b) {}
+g := f
+g(1)`: "f takes 2 arguments, got 1",
+	} {
+		program, err := Compile(src, CompileOptions{})
+		if err != nil {
+			t.Fatalf("Unexpected error compiling: %v", err)
+		}
+
+		_, err = program.Run(RunOptions{})
+		if err == nil || !strings.Contains(err.Error(), expected) {
+			t.Errorf("Expected %q to fail with %q, got %v", src, expected, err)
+		}
+	}
+}
+
+func TestCompiler_FoldsBuiltins(t *testing.T) {
+	c := NewCompiler()
+	if err := c.Compile(&AssignNode{"x", &CallNode{&ReferenceNode{"typeof"}, []Node{&NumberNode{1}}, true}, true}); err != nil {
+		t.Fatalf("Compiling failed: %v", err)
+	}
+
+	for _, b := range instructions(c.Chunk) {
+		if b == InstructionCall {
+			t.Errorf("Expected typeof with a constant argument to be computed while compiling")
+		}
+	}
+
+	// builtins which aren't constant are called while executing
+	c = NewCompiler()
+	if err := c.Compile(&CallNode{&ReferenceNode{"print"}, []Node{&NumberNode{1}}, false}); err != nil {
+		t.Fatalf("Compiling failed: %v", err)
+	}
+
+	if i := instructions(c.Chunk); len(i) < 2 || i[len(i)-2] != InstructionCall {
+		t.Errorf("Expected print to be called, got %v", i)
+	}
+}
+
+func TestSecureBuiltins(t *testing.T) {
+	vm := runSource(t, `a := randomBytes(32)
+b := randomBytes(32)
+none := randomBytes(0)
+id := randomUUID()
+same := secureEquals("token", "token")
+different := secureEquals("token", "tokem")
+shorter := secureEquals("token", "tok")
+mixed := secureEquals(bytes("token"), "token")`)
+
+	a, b := vm.Variable("a").(*BytesValue), vm.Variable("b").(*BytesValue)
+	if len(a.bytes) != 32 || a.Equals(b) {
+		t.Errorf("Expected 32 random bytes, got %s and %s", a, b)
+	}
+
+	if n := len(vm.Variable("none").(*BytesValue).bytes); n != 0 {
+		t.Errorf("Expected no bytes, got %d", n)
+	}
+
+	id := vm.Variable("id").String()
+	if len(id) != 36 || id[14] != '4' || !strings.ContainsRune("89ab", rune(id[19])) || strings.Count(id, "-") != 4 {
+		t.Errorf("Expected a version 4 UUID, got %s", id)
+	}
+
+	CompareValues(t, vm.Variable("same"), NewBool(true))
+	CompareValues(t, vm.Variable("different"), NewBool(false))
+	CompareValues(t, vm.Variable("shorter"), NewBool(false))
+	CompareValues(t, vm.Variable("mixed"), NewBool(true))
+
+	for _, src := range []string{`randomBytes(-1)`, `randomBytes(1.5)`, `secureEquals(1, "a")`} {
+		program, err := Compile(src, CompileOptions{})
+		if err != nil {
+			t.Fatalf("Unexpected error compiling %q: %v", src, err)
+		}
+
+		if _, err := program.Run(RunOptions{}); err == nil {
+			t.Errorf("Expected %q to fail", src)
+		}
+	}
+}
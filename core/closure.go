@@ -0,0 +1,86 @@
+package core
+
+// freeNames the names a function refers to which it doesn't declare itself (before referring to them), which are
+// those of the scopes it is declared in, or globals. Those the functions within it refer to are among them, unless it
+// declares them, as the function needs them to create those functions.
+func freeNames(f *FunctionNode) []string {
+	declared := map[string]bool{}
+	for _, param := range f.params {
+		declared[param] = true
+	}
+
+	var names []string
+	var visit func(Node) bool
+	visit = func(node Node) bool {
+		switch n := node.(type) {
+		case *ReferenceNode:
+			if !declared[n.name] {
+				names = append(names, n.name)
+			}
+		case *AssignNode:
+			// the value is computed before the variable is declared
+			Walk(n.value, visit)
+			if n.declare {
+				declared[n.name] = true
+			} else if !declared[n.name] {
+				names = append(names, n.name)
+			}
+
+			return false
+		case *ConstNode:
+			Walk(n.value, visit)
+			declared[n.name] = true
+			return false
+		case *DestructureNode:
+			Walk(n.value, visit)
+			for _, name := range n.names {
+				declared[name] = true
+			}
+
+			return false
+		case *ForEachNode:
+			Walk(n.items, visit)
+			declared[n.name] = true
+			Walk(n.do, visit)
+
+			return false
+		case *FunctionNode:
+			if n == f {
+				return true
+			}
+
+			for _, name := range freeNames(n) {
+				if !declared[name] {
+					names = append(names, name)
+				}
+			}
+
+			return false
+		}
+
+		return true
+	}
+	Walk(f, visit)
+
+	return names
+}
+
+// captures the names a function being compiled refers to which are variables of the scopes enclosing it, such as those
+// of the functions or loops it is declared in, which its closures keep (see InstructionClosure). Variables of the top
+// scope are left out, as they are never removed.
+func (c *Compiler) captures(f *FunctionNode) []Value {
+	seen := map[string]bool{}
+	var names []Value
+	for _, name := range freeNames(f) {
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+
+		if v := c.local(name); v != nil && v.scope > 0 {
+			names = append(names, NewString(name))
+		}
+	}
+
+	return names
+}
@@ -0,0 +1,232 @@
+package core
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"math/big"
+	"sync"
+)
+
+// Codec a format chunks are serialized in, for storing programs as bytecode (see Program.Encode and DecodeProgram).
+// Bundles and imported bytecode are always in the format of BinaryCodec.
+type Codec interface {
+	// Encode write the chunk, failing if it has constants the format can't hold
+	Encode(c *Chunk) ([]byte, error)
+	// Decode read a chunk written by Encode, without verifying its bytecode
+	Decode(b []byte) (*Chunk, error)
+}
+
+var (
+	// BinaryCodec the format of the language's own, which Chunk.Serialize writes (see encoding.go). The same chunk is
+	// always written as the same bytes.
+	BinaryCodec Codec = binaryCodec{}
+	// GobCodec chunks encoded with encoding/gob, for programs which store them along with other values with gob
+	GobCodec Codec = gobCodec{}
+)
+
+// Codecs the codecs by their names, for choosing one by name, as the CLI's --codec does
+var Codecs = map[string]Codec{
+	"binary": BinaryCodec,
+	"gob":    GobCodec,
+	"json":   JSONCodec,
+}
+
+type binaryCodec struct{}
+
+func (binaryCodec) Encode(c *Chunk) ([]byte, error) {
+	e := &encoder{}
+	e.header(formatChunk)
+	if err := e.chunk(c); err != nil {
+		return nil, err
+	}
+
+	return e.buf.Bytes(), nil
+}
+
+func (binaryCodec) Decode(b []byte) (*Chunk, error) {
+	d := &decoder{b: b}
+	d.header(formatChunk)
+	c := d.chunk()
+	if d.err == nil && len(d.b) > 0 {
+		d.fail("%d bytes after the end", len(d.b))
+	}
+
+	return c, d.err
+}
+
+// registerGOB registers the values which can be constants with gob once, before the first chunk is encoded with it
+var registerGOB sync.Once
+
+type gobCodec struct{}
+
+func (gobCodec) Encode(c *Chunk) ([]byte, error) {
+	registerGOB.Do(RegisterGOBTypes)
+
+	b := bytes.Buffer{}
+	if err := gob.NewEncoder(&b).Encode(c); err != nil {
+		return nil, err
+	}
+
+	return b.Bytes(), nil
+}
+
+func (gobCodec) Decode(b []byte) (*Chunk, error) {
+	registerGOB.Do(RegisterGOBTypes)
+
+	c := &Chunk{}
+	if err := gob.NewDecoder(bytes.NewReader(b)).Decode(c); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// Serialize write the chunk as bytecode, which DeserializeChunk can read. The same chunk is always written as the same
+// bytes, so bytecode can be cached by its contents and builds are reproducible.
+func (c Chunk) Serialize() []byte {
+	b, err := BinaryCodec.Encode(&c)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	return b
+}
+
+// DeserializeChunk read a chunk serialized with Serialize, verifying its bytecode
+func DeserializeChunk(b []byte) (*Chunk, error) {
+	return DecodeChunk(b, BinaryCodec)
+}
+
+// DecodeChunk read a chunk encoded with the codec, verifying its bytecode
+func DecodeChunk(b []byte, codec Codec) (*Chunk, error) {
+	m, err := codec.Decode(b)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("invalid bytecode file: %v", err))
+	}
+
+	if err := m.Verify(); err != nil {
+		return nil, errors.New(fmt.Sprintf("invalid bytecode: %v", err))
+	}
+
+	return m, nil
+}
+
+// RegisterGOBTypes register the values which can be constants with gob, for encoding them with it. GobCodec registers
+// them itself, so this is only needed to encode constants with gob directly.
+func RegisterGOBTypes() {
+	gob.Register(&StringValue{""})
+	gob.Register(&BoolValue{false})
+	gob.Register(&NumberValue{0, nil})
+	gob.Register(&BigIntValue{})
+	gob.Register(&NilValue{})
+	gob.Register(&ListValue{})
+	gob.Register(&FunctionValue{
+		Name:   "",
+		Params: nil,
+		Chunk:  nil,
+	})
+}
+
+// the values which can be constants keep their contents unexported, so they encode themselves for gob
+
+func (v *BigIntValue) GobEncode() ([]byte, error) {
+	return v.int.GobEncode()
+}
+
+func (v *BigIntValue) GobDecode(b []byte) error {
+	v.int = new(big.Int)
+	return v.int.GobDecode(b)
+}
+
+func (v *StringValue) GobEncode() ([]byte, error) {
+	return []byte(v.string), nil
+}
+
+func (v *StringValue) GobDecode(b []byte) error {
+	v.string = string(b)
+	return nil
+}
+
+// numbers are encoded as their float, followed by the decimal if they have one
+func (v *NumberValue) GobEncode() ([]byte, error) {
+	b := binary.BigEndian.AppendUint64(nil, math.Float64bits(v.float64))
+	if v.decimal == nil {
+		return b, nil
+	}
+
+	d, err := v.decimal.GobEncode()
+	return append(b, d...), err
+}
+
+func (v *NumberValue) GobDecode(b []byte) error {
+	if len(b) < 8 {
+		return errors.New(fmt.Sprintf("a number is at least 8 bytes, got %d", len(b)))
+	}
+
+	v.float64 = math.Float64frombits(binary.BigEndian.Uint64(b))
+	if len(b) == 8 {
+		return nil
+	}
+
+	v.decimal = new(big.Rat)
+	return v.decimal.GobDecode(b[8:])
+}
+
+func (v *BoolValue) GobEncode() ([]byte, error) {
+	if v.bool {
+		return []byte{1}, nil
+	}
+
+	return []byte{0}, nil
+}
+
+func (v *BoolValue) GobDecode(b []byte) error {
+	if len(b) != 1 {
+		return errors.New(fmt.Sprintf("a boolean is 1 byte, got %d", len(b)))
+	}
+
+	v.bool = b[0] != 0
+	return nil
+}
+
+func (v *NilValue) GobEncode() ([]byte, error) {
+	return []byte{}, nil
+}
+
+func (v *NilValue) GobDecode(_ []byte) error {
+	return nil
+}
+
+// encodedList the contents of a list, as encoded by gob
+type encodedList struct {
+	Items  []Value
+	Frozen bool
+}
+
+func (v *ListValue) GobEncode() ([]byte, error) {
+	b := bytes.Buffer{}
+	err := gob.NewEncoder(&b).Encode(encodedList{v.items, v.frozen})
+
+	return b.Bytes(), err
+}
+
+func (v *ListValue) GobDecode(b []byte) error {
+	l := encodedList{}
+	if err := gob.NewDecoder(bytes.NewReader(b)).Decode(&l); err != nil {
+		return err
+	}
+
+	for _, item := range l.Items {
+		if item == nil {
+			return errors.New("list item is missing")
+		}
+	}
+
+	v.items, v.frozen = l.Items, l.Frozen
+	return nil
+}
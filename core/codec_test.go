@@ -0,0 +1,77 @@
+package core
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestCodecs(t *testing.T) {
+	program, err := Compile("#pragma decimal\nfunc add(a, b) {\n\treturn a + b\n}\nprint([add(0.1, 0.2), \"x\", 10n, nil, true].length())", CompileOptions{})
+	if err != nil {
+		t.Fatalf("Unexpected error compiling: %v", err)
+	}
+
+	for name, codec := range Codecs {
+		b, err := program.Encode(codec)
+		if err != nil {
+			t.Fatalf("Unexpected error encoding with %s: %v", name, err)
+		}
+
+		loaded, err := DecodeProgram(b, codec)
+		if err != nil {
+			t.Fatalf("Unexpected error decoding with %s: %v", name, err)
+		}
+
+		if loaded.Chunk().String() != program.Chunk().String() {
+			t.Errorf("Expected %s to decode the chunk it encoded, got\n%s", name, loaded.Chunk())
+		}
+
+		out := bytes.Buffer{}
+		if _, err := loaded.Run(RunOptions{Output: &out}); err != nil {
+			t.Fatalf("Unexpected error running what %s decoded: %v", name, err)
+		}
+
+		if out.String() != "5" {
+			t.Errorf("Expected what %s decoded to print 5, got %q", name, out.String())
+		}
+
+		if _, err := DecodeProgram(b[:len(b)/2], codec); err == nil {
+			t.Errorf("Expected %s to fail decoding half of a chunk", name)
+		}
+	}
+
+	// the binary format is what Serialize writes
+	if b, _ := program.Encode(BinaryCodec); !bytes.Equal(b, program.Serialize()) {
+		t.Errorf("Expected the binary codec to write what Serialize does")
+	}
+}
+
+func TestJSONCodec(t *testing.T) {
+	program, err := Compile("a := [1, \"two\"]\nwrite(a)", CompileOptions{})
+	if err != nil {
+		t.Fatalf("Unexpected error compiling: %v", err)
+	}
+
+	b, err := program.Encode(JSONCodec)
+	if err != nil {
+		t.Fatalf("Unexpected error encoding: %v", err)
+	}
+
+	// instructions are named, and constants tagged with their types
+	for _, s := range []string{`"op": "CONSTANT"`, `"disassembly": "DECLARE_LOCAL 1 (\"a\")"`, `"type": "string"`, `"value": "two"`} {
+		if !bytes.Contains(b, []byte(s)) {
+			t.Errorf("Expected the JSON to contain %s, got\n%s", s, b)
+		}
+	}
+
+	for _, src := range []string{
+		`{"instructions": [{"op": "JUMPING"}]}`,
+		`{"instructions": [{"op": "CONSTANT", "operands": [0, 1]}], "constants": [{"type": "nil"}]}`,
+		`{"instructions": [], "constants": [{"type": "number", "value": "many"}]}`,
+		`{"instructions": [], "constants": [{"type": "function", "name": "f"}]}`,
+	} {
+		if _, err := DecodeProgram([]byte(src), JSONCodec); err == nil {
+			t.Errorf("Expected %s to fail decoding", src)
+		}
+	}
+}
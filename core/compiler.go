@@ -1,7 +1,13 @@
 package core
 
 import (
+	"errors"
 	"fmt"
+	"io"
+	"math"
+	"regexp"
+	"slices"
+	"strings"
 )
 
 type Compiler struct {
@@ -11,45 +17,280 @@ type Compiler struct {
 
 	imports  map[string]Node
 	resolver ImportsResolver
+	// bytecode the precompiled programs imported, by path
+	bytecode map[string]*Chunk
+
+	// globals names of globals provided by the host, in addition to the default globals
+	globals map[string]bool
+	// defines constants set by the host (such as whether the program runs in a browser), which references to them are
+	// replaced with while compiling
+	defines map[string]Value
+
+	// positions where the nodes being compiled are found in the source, used for line information
+	positions Positions
+	line      Pos
+	// file the file the line is in, for the bytecode to be marked with (see Chunk.Files)
+	file string
+	// name the name of the source being compiled, see SetFileName
+	name string
+	// files which imported file each token of the positions is from, for the files parsed by the compiler (see
+	// SourceResolver). Tokens of the source being compiled have none.
+	files map[*Token]string
+	// sources the source of each file imported by path, for errors and notes to show where in them they are about
+	sources map[string][]rune
+	// importedAt where each file parsed by the compiler was first imported, for errors and notes about it to show
+	importedAt map[string]Location
+
+	// notes remarks on the program which don't stop it from compiling
+	notes []Note
+	// loops how many loops the code being compiled is within
+	loops int
+	// inFunction whether the code being compiled is within a function, which calls can only be deferred in
+	inFunction bool
+	// declared names of every variable declared somewhere in the programs compiled
+	declared map[string]bool
+	// functions the functions of names which are only ever declared as that function, nil for names which are also
+	// given other values, so calls to them can be checked while compiling
+	functions map[string]*FunctionNode
+	// types the types of objects declared with type, by name
+	types map[string]*TypeNode
+	// depth how deep into the tree being compiled the compiler is
+	depth int
+	// noFolding whether constant expressions are compiled as they are, instead of being computed by the compiler
+	noFolding bool
+	// profile the builtins the program is run with, which calls to them are checked against
+	profile Profile
+	// decimal whether numbers are decimals rather than floats, set with #pragma decimal
+	decimal bool
+	// warnAny whether to note variables declared with values of types which can't be deduced
+	warnAny bool
+	// strict whether the program is compiled in strict mode, set with #pragma strict
+	strict bool
+	// limits how large and deep the program can be, see SetLimits
+	limits Limits
+	// token the token of the innermost node being compiled which has a position, for errors to show where they are
+	token *Token
+	// exceeded the first limit the program has exceeded, which fails compiling once the tree is compiled
+	exceeded error
+	// kinds the types deduced for the nodes compiled, by the token they begin at, if they are kept (see TypeAt)
+	kinds map[*Token]string
+	// captured names which functions refer to, so assignments to them are never dead, as the functions may read them
+	captured map[string]bool
+	// deadStores assignments whose values are never read, with the assignment overwriting each (see deadStores)
+	deadStores map[*AssignNode]*AssignNode
+	// eliminateDeadStores whether dead stores are left out of the bytecode, besides being noted
+	eliminateDeadStores bool
 
 	stack *Stack[LocalVariable]
 }
 
+// Note a remark on the program being compiled which does not stop it from compiling, such as a suggestion
+type Note struct {
+	Description string
+	// Causer the token the remark is about, nil if unknown
+	Causer *Token
+	// File the name of the file the remark is about, for programs compiled from several files
+	File string
+	// Imported where the file was imported, from the innermost import out, if it was imported
+	Imported []Location
+}
+
+// Format Print the note, along with where in the source it is about if known. Notes about other files than the
+// source being compiled begin with the file and line they are about and where the file was imported.
+func (n *Note) Format(src []rune) string {
+	b := strings.Builder{}
+	if n.File != "" && n.Causer != nil {
+		b.WriteString(fmt.Sprintf("in %s\n", Location{n.File, n.Causer.Line}))
+	} else if n.File != "" {
+		b.WriteString(fmt.Sprintf("in %s\n", n.File))
+	}
+
+	for _, location := range n.Imported {
+		b.WriteString(fmt.Sprintf("\timported at %s\n", location))
+	}
+
+	if n.Causer == nil {
+		return b.String() + n.Description + "\n"
+	}
+
+	return b.String() + (&ParsingError{n.Description, n.Causer}).Format(src)
+}
+
+// MainFunction the name of the function called to begin a program, after its top level statements are executed.
+// Main functions of imported files are left out, so files can be both imported and run.
+const MainFunction = "main"
+
 type ImportsResolver interface {
 	Resolve(path string) (Node, error)
 }
 
+// BytecodeResolver resolves imports of precompiled programs (paths ending in BytecodeExtension) to their bytecode, as
+// made by Program.Serialize. Resolvers implement it besides ImportsResolver to allow such imports.
+type BytecodeResolver interface {
+	ResolveBytecode(path string) ([]byte, error)
+}
+
+// SourceResolver resolves imports to their source, which the compiler parses itself, so the nodes of imported files
+// have positions, and errors and notes in them show the right file. Resolvers implement it besides ImportsResolver,
+// and it is used instead of Resolve.
+type SourceResolver interface {
+	ResolveSource(path string) (string, error)
+}
+
+// BytecodeExtension the extension of files of compiled programs, which are imported as bytecode rather than source
+const BytecodeExtension = ".angc"
+
+// isBytecodeImport whether an import is of a precompiled program
+func isBytecodeImport(path string) bool {
+	return strings.HasSuffix(path, BytecodeExtension)
+}
+
 type LocalVariable struct {
 	name  string
 	scope int
+	// kind the type deduced for the value it was declared with, any if it couldn't be
+	kind string
+	// constant whether it was declared with const, so it can't be given another value
+	constant bool
+	// value the value of a constant which is known while compiling, which references to it are replaced with, nil if
+	// it isn't known
+	value Value
 }
 
 func NewCompiler() *Compiler {
 	c := &Compiler{
-		Chunk:   NewChunk(make([]Bytecode, 0), make([]Value, 0)),
-		ip:      0,
-		scope:   0,
-		stack:   NewStack[LocalVariable](256),
-		imports: make(map[string]Node),
+		Chunk:    NewChunk(make([]Bytecode, 0), make([]Value, 0)),
+		ip:       0,
+		scope:    0,
+		stack:    NewStack[LocalVariable](256),
+		imports:  make(map[string]Node),
+		bytecode: make(map[string]*Chunk),
+		globals:  make(map[string]bool),
+		defines:  make(map[string]Value),
+		files:    make(map[*Token]string),
+		sources:  make(map[string][]rune),
+
+		importedAt: make(map[string]Location),
+
+		declared:  make(map[string]bool),
+		functions: make(map[string]*FunctionNode),
+		types:     make(map[string]*TypeNode),
+
+		captured:   make(map[string]bool),
+		deadStores: make(map[*AssignNode]*AssignNode),
 	}
 
 	return c
 }
 
+// Limits how large and complex the programs compiled can be, for hosts running programs they don't trust. Programs
+// exceeding them fail to compile, rather than being compiled into bytecode which can't hold them. Limits which are zero
+// are those of the bytecode.
+type Limits struct {
+	// Constants the most constants a function or the top level can have, which is at most 256, as instructions
+	// refer to them by a byte
+	Constants int
+	// Bytecode the most bytes of bytecode a function or the top level can be compiled to
+	Bytecode int
+	// Depth how deep the nodes of a program can nest, such as expressions within expressions or blocks within blocks
+	Depth int
+}
+
+// maxConstants the most constants a chunk can have, as instructions refer to them by a byte
+const maxConstants = 256
+
+// SetLimits set how large and complex the programs compiled can be
+func (c *Compiler) SetLimits(limits Limits) {
+	c.limits = limits
+}
+
+// SetFolding set whether constant expressions (such as 1 + 2) are computed by the compiler, which they are by default.
+// Either way the program does the same, only the bytecode differs.
+func (c *Compiler) SetFolding(fold bool) {
+	c.noFolding = !fold
+}
+
+// SetProfile set the builtins the program is run with (see VM.SetProfile), which calls are checked against and
+// constant calls folded with. Comptime blocks are run with them too. Programs are compiled for ProfileStandard unless
+// set otherwise.
+func (c *Compiler) SetProfile(profile Profile) {
+	c.profile = profile
+}
+
+// SetDeadStoreElimination set whether assignments whose values are never read, as the variable is assigned again
+// before anything reads it, are left out of the bytecode. They are noted either way, and their values are still
+// computed unless they are known while compiling, so the program does the same.
+func (c *Compiler) SetDeadStoreElimination(eliminate bool) {
+	c.eliminateDeadStores = eliminate
+}
+
+// SetImplicitAnyWarnings set whether the compiler notes variables declared with values of a type it can't deduce, such
+// as what list.at or a builtin returns, which are implicitly any. Casting the value with as gives it a type.
+func (c *Compiler) SetImplicitAnyWarnings(warn bool) {
+	c.warnAny = warn
+}
+
+// SetStrict set whether the program is compiled in strict mode, which is the same as it beginning with #pragma strict.
+// Strict mode warns of variables which are implicitly any, variables shadowing those of outer scopes and functions
+// which only return a value if the condition of their last if is true, and makes every note an error.
+func (c *Compiler) SetStrict(strict bool) {
+	c.strict = strict
+	c.Chunk.Strict = strict
+	if strict {
+		c.warnAny = true
+	}
+}
+
+// SetFileName set the name of the file the source being compiled is from, so the lines of its bytecode are marked with
+// it like those of the files it imports (see Chunk.Files), for traces and imports to show them as file:line
+func (c *Compiler) SetFileName(name string) {
+	c.name = name
+	c.file = name
+}
+
+// SetDecimal set whether numbers of the program are decimals, which are exact (0.1 + 0.2 == 0.3), rather than floats.
+// This is the same as the program beginning with #pragma decimal.
+func (c *Compiler) SetDecimal(decimal bool) {
+	c.decimal = decimal
+	c.Chunk.Decimal = decimal
+}
+
 func (c *Compiler) add(instruction Bytecode) {
 	for len(c.Chunk.Bytecode) <= int(c.ip) {
 		c.Chunk.Bytecode = append(c.Chunk.Bytecode, 0)
 	}
 
+	if c.limits.Bytecode > 0 && len(c.Chunk.Bytecode) > c.limits.Bytecode {
+		c.exceed(fmt.Sprintf("the code is compiled to more than %d bytes of bytecode; split it into smaller functions", c.limits.Bytecode))
+	}
+
+	for len(c.Chunk.Lines) <= int(c.ip) {
+		c.Chunk.Lines = append(c.Chunk.Lines, c.line)
+	}
+
+	// the bytecode is only marked with files once some of it is of a file
+	for (c.file != "" || len(c.Chunk.Files) > 0) && len(c.Chunk.Files) <= int(c.ip) {
+		c.Chunk.Files = append(c.Chunk.Files, "")
+	}
+
 	c.Chunk.Bytecode[c.ip] = instruction
+	c.Chunk.Lines[c.ip] = c.line
+	if len(c.Chunk.Files) > int(c.ip) {
+		c.Chunk.Files[c.ip] = c.file
+	}
 
 	c.advance(1)
 }
 
 func (c *Compiler) addConstant(value Value) {
+	if c.decimal {
+		value = decimalValue(value)
+	}
+
 	chunk := c.Chunk
 	for i := 0; i < len(chunk.Constants); i++ {
-		if chunk.Constants[i].Equals(value) {
+		// bigints equal numbers, but are not the same constant
+		if chunk.Constants[i].Type() == value.Type() && chunk.Constants[i].Equals(value) {
 			c.add(Bytecode(i))
 
 			return
@@ -58,14 +299,97 @@ func (c *Compiler) addConstant(value Value) {
 
 	chunk.Constants = append(chunk.Constants, value)
 
+	limit := maxConstants
+	if c.limits.Constants > 0 {
+		limit = min(c.limits.Constants, maxConstants)
+	}
+
+	if len(chunk.Constants) > limit {
+		c.exceed(fmt.Sprintf("the code has more than %d constants; split it into smaller functions", limit))
+	}
+
 	c.add(Bytecode(len(chunk.Constants) - 1))
 }
 
-func (c *Compiler) Compile(tree Node) error {
+// u16 an operand of two bytes, such as the length of a jump, noting what it is of when it is too large for them
+func (c *Compiler) u16(n Pos, what string) uint16 {
+	if n > math.MaxUint16 {
+		c.exceed(fmt.Sprintf("%s is too large for the bytecode, which holds at most %d; split it up", what, math.MaxUint16))
+	}
+
+	return uint16(n)
+}
+
+// exceed note that the program exceeds a limit, which fails compiling once the tree is compiled, as the bytecode
+// can't hold it. Only the first limit exceeded is kept.
+func (c *Compiler) exceed(description string) {
+	if c.exceeded != nil {
+		return
+	}
+
+	// reported once everything is compiled, rather than returned through the imports, so it is marked with its file here
+	c.exceeded = c.errorAt(nil, description)
+	if file := c.files[c.token]; c.token != nil && file != "" {
+		c.exceeded = &FileError{file, c.sources[file], c.exceeded, c.importChain(file)}
+	}
+}
+
+// errorAt an error about a node, showing where it is if it is known. Nodes without a position of their own (or nil)
+// are shown at the node being compiled. Errors of imported files are marked with the file as they are returned through
+// the import.
+func (c *Compiler) errorAt(n Node, description string) error {
+	token := c.positions[n]
+	if token == nil {
+		token = c.token
+	}
+
+	if token == nil {
+		return errors.New(description)
+	}
+
+	return &ParsingError{description, token}
+}
+
+func (c *Compiler) Compile(tree Node) (err error) {
 	if tree == nil {
 		panic("compile called with nil value")
 	}
 
+	if c.depth == 0 {
+		c.collectDeclarations(tree)
+		c.Chunk.Exports = append(c.Chunk.Exports, c.exports(tree)...)
+
+		// in strict mode notes are errors, which are only known once everything is compiled
+		defer func() {
+			if err == nil && c.strict && len(c.notes) > 0 {
+				err = c.noteError(c.notes[0])
+			}
+		}()
+
+		defer c.reportExceeded(&err)
+	}
+	c.depth++
+	defer func() {
+		c.depth--
+	}()
+
+	// the lines of the bytecode are marked with the file they are in, so imported code is on its own lines
+	if t, ok := c.positions[tree]; ok {
+		line, file, token := c.line, c.file, c.token
+		c.line, c.file, c.token = t.Line, c.fileOf(t), t
+		defer func() {
+			c.line, c.file, c.token = line, file, token
+		}()
+	}
+
+	if c.kinds != nil {
+		c.recordKind(tree)
+	}
+
+	if c.limits.Depth > 0 && c.depth > c.limits.Depth {
+		return c.errorAt(tree, fmt.Sprintf("the code is nested more than %d deep; split it into smaller functions", c.limits.Depth))
+	}
+
 	switch tree.Type() {
 	case StringNodeType:
 		c.add(InstructionConstant)
@@ -75,17 +399,25 @@ func (c *Compiler) Compile(tree Node) error {
 
 	case NumberNodeType:
 		c.add(InstructionConstant)
-		c.addConstant(&NumberValue{tree.(*NumberNode).value})
+		c.addConstant(&NumberValue{tree.(*NumberNode).value, nil})
+
+	case BigIntNodeType:
+		c.add(InstructionConstant)
+		c.addConstant(&BigIntValue{tree.(*BigIntNode).value})
 
 	case ListNodeType:
 		l := tree.(*ListNode)
 
 		if len(l.items) == 0 {
 			c.add(InstructionNewList)
-		} else if c.isTreeConstant(l) {
+		} else if hasSpread(l.items) {
+			if err := c.compileSpread(l.items); err != nil {
+				return err
+			}
+		} else if !c.noFolding && c.isTreeConstant(l) {
 			v, err := c.compute(l)
 			if err != nil {
-				panic(err) // this shouldn't happen
+				return err
 			}
 
 			c.add(InstructionConstant)
@@ -98,11 +430,37 @@ func (c *Compiler) Compile(tree Node) error {
 				}
 			}
 			c.add(InstructionFormList)
-			c.addU16(uint16(len(l.items)))
+			c.addU16(c.u16(Pos(len(l.items)-1), "the number of items of the list"))
+		}
+
+	case ObjectNodeType:
+		n := tree.(*ObjectNode)
+
+		for i, key := range n.keys {
+			c.add(InstructionConstant)
+			c.addConstant(&StringValue{key})
+
+			if err := c.Compile(n.values[i]); err != nil {
+				return err
+			}
 		}
 
+		c.add(InstructionFormObject)
+		c.addU16(c.u16(Pos(2*len(n.keys)), "the number of members of the object"))
+
 	case ReferenceNodeType:
-		c.getVar(tree.(*ReferenceNode).name)
+		name := tree.(*ReferenceNode).name
+		if v, ok := c.constantOf(name); ok {
+			c.add(InstructionConstant)
+			c.addConstant(v)
+			break
+		}
+
+		if !c.isGlobal(name) && !c.isLocal(name) && !c.declared[name] && name != "this" {
+			c.note(tree, fmt.Sprintf("%s is not declared anywhere, so it must be a global set before running", name))
+		}
+
+		c.getVar(name)
 
 	case BinaryNodeType:
 		err := c.compileBinary(tree.(*BinaryNode))
@@ -121,8 +479,11 @@ func (c *Compiler) Compile(tree Node) error {
 		c.add(InstructionNil)
 
 	case BlockNodeType:
+		statements := tree.(*BlockNode).statements
+		c.markDeadStores(statements)
+
 		c.descend()
-		for _, n := range tree.(*BlockNode).statements {
+		for _, n := range statements {
 			err := c.Compile(n)
 			if err != nil {
 				return err
@@ -133,6 +494,24 @@ func (c *Compiler) Compile(tree Node) error {
 	case ConditionalNodeType:
 		n := tree.(*ConditionalNode)
 
+		// conditions known while compiling (such as on defined constants) only need the branch which is taken
+		if !c.noFolding && c.isTreeConstant(n.condition) {
+			v, err := c.compute(n.condition)
+			if err != nil {
+				return err
+			}
+
+			if b, ok := v.(*BoolValue); ok {
+				if b.bool {
+					return c.Compile(n.do)
+				} else if n.otherwise != nil {
+					return c.Compile(n.otherwise)
+				}
+
+				break
+			}
+		}
+
 		// the stack should have whether the condition was truthful
 		err := c.Compile(n.condition)
 		if err != nil {
@@ -162,14 +541,14 @@ func (c *Compiler) Compile(tree Node) error {
 		}
 
 		// put the u16 of where to jump if the condition was false
-		c.putU16(jumpByPos, uint16(c.ip-jumpByPos-2))
+		c.putU16(jumpByPos, c.u16(c.ip-jumpByPos-2, "the body of the if"))
 
 		if n.otherwise != nil {
 			err := c.Compile(n.otherwise)
 			if err != nil {
 				return err
 			}
-			c.putU16(jumpOverElse, uint16(c.ip-jumpOverElse-2))
+			c.putU16(jumpOverElse, c.u16(c.ip-jumpOverElse-2, "the body of the else"))
 		}
 
 	case LoopNodeType:
@@ -185,16 +564,116 @@ func (c *Compiler) Compile(tree Node) error {
 		jumpValuePos := c.ip
 		c.advance(2)
 
+		c.loops++
 		err = c.Compile(n.do)
+		c.loops--
 		if err != nil {
 			return err
 		}
 
 		c.add(InstructionLoop)
 		// condition pos < ip
-		c.addU16(uint16(c.ip - conditionPos + 2))
+		c.addU16(c.u16(c.ip-conditionPos+2, "the body of the loop"))
+
+		c.putU16(jumpValuePos, c.u16(c.ip-jumpValuePos-2, "the body of the loop"))
+
+	case ForNodeType:
+		n := tree.(*ForNode)
+
+		// the scope of the variables init declares
+		c.descend()
+
+		err := c.Compile(n.init)
+		if err != nil {
+			return err
+		}
+
+		if loop := c.numericLoop(n); loop != nil {
+			if err := c.compileNumericLoop(n, loop); err != nil {
+				return err
+			}
+
+			c.ascend()
+			break
+		}
+
+		conditionPos := c.ip
+		err = c.Compile(n.condition)
+		if err != nil {
+			return err
+		}
+
+		c.add(InstructionJumpFalse)
+		jumpValuePos := c.ip
+		c.advance(2)
+
+		c.loops++
+		err = c.Compile(n.do)
+		if err == nil {
+			err = c.Compile(n.step)
+		}
+		c.loops--
+		if err != nil {
+			return err
+		}
+
+		c.add(InstructionLoop)
+		c.addU16(c.u16(c.ip-conditionPos+2, "the body of the loop"))
+
+		c.putU16(jumpValuePos, c.u16(c.ip-jumpValuePos-2, "the body of the loop"))
+
+		c.ascend()
+
+	case ForEachNodeType:
+		n := tree.(*ForEachNode)
+
+		// the scope of what the loop goes through and where it is at, which InstructionIterate looks up
+		c.descend()
+
+		if err := c.setVar(loopItems, n.items, true); err != nil {
+			return err
+		}
+
+		c.add(InstructionConstant)
+		c.addConstant(NewNumber(0))
+		c.add(InstructionDeclareLocal)
+		c.addConstant(NewString(loopIndex))
+		c.registerTypedVar(loopIndex, "number")
+
+		iteratePos := c.ip
+		c.add(InstructionIterate)
+		jumpPos := c.ip
+		c.advance(2)
+
+		// each item is a variable of its own, so the closures made for each of them keep their own
+		c.descend()
+		if n.name == "_" {
+			c.add(InstructionPop)
+		} else {
+			c.checkShadowing(tree, n.name, c.scope)
+			c.add(InstructionDeclareLocal)
+			c.addConstant(NewString(n.name))
+			c.registerTypedVar(n.name, itemKind(c.kindOf(n.items)))
+		}
+
+		c.loops++
+		err := c.Compile(n.do)
+		c.loops--
+		if err != nil {
+			return err
+		}
+
+		c.ascend()
+
+		c.add(InstructionLoop)
+		c.addU16(c.u16(c.ip-iteratePos+2, "the body of the loop"))
+
+		c.putU16(jumpPos, c.u16(c.ip-jumpPos-2, "the body of the loop"))
 
-		c.putU16(jumpValuePos, uint16(c.ip-jumpValuePos-2))
+		// the nil pushed once there are no items left
+		c.add(InstructionPop)
+
+		c.ascend()
 
 	case AssignNodeType:
 		n := tree.(*AssignNode)
@@ -207,28 +686,132 @@ func (c *Compiler) Compile(tree Node) error {
 			}
 			c.add(InstructionPop)
 		} else {
+			if n.declare {
+				c.checkImplicitAny(tree, n.name, n.value)
+				c.checkShadowing(tree, n.name, c.scope)
+			}
+
+			if v := c.local(n.name); !n.declare && v != nil && v.constant {
+				return c.errorAt(n, fmt.Sprintf("cannot assign to %s, as it is a constant", n.name))
+			}
+
+			if !n.declare && c.loops > 0 && c.isConcatenationOf(n.name, n.value) {
+				c.note(tree, fmt.Sprintf("%s is concatenated to in a loop, which copies the whole string every time; consider building it with newBuilder()", n.name))
+			}
+
+			if over, ok := c.deadStores[n]; ok && (n.declare || c.isLocal(n.name)) {
+				c.noteDeadStore(n, over)
+
+				// declarations are kept, as the variable is assigned to after
+				if c.eliminateDeadStores && !n.declare {
+					return c.eliminateStore(n)
+				}
+			}
+
 			err := c.setVar(n.name, n.value, n.declare)
 			if err != nil {
 				return err
 			}
 		}
 
-	case CallNodeType:
-		n := tree.(*CallNode)
+	case ConstNodeType:
+		n := tree.(*ConstNode)
 
-		for _, arg := range n.args {
-			err := c.Compile(arg)
+		c.checkImplicitAny(tree, n.name, n.value)
+		c.checkShadowing(tree, n.name, c.scope)
+
+		// the value is kept for references to be replaced with if it is known, and the variable is declared either way
+		// for functions referring to it before it is declared
+		var value Value
+		if !c.noFolding && c.isTreeConstant(n.value) {
+			v, err := c.compute(n.value)
 			if err != nil {
 				return err
 			}
+
+			value = v
 		}
 
-		err := c.Compile(n.source)
+		if err := c.setVar(n.name, n.value, true); err != nil {
+			return err
+		}
+
+		local := &c.stack.items[c.stack.Current-1]
+		local.constant, local.value = true, value
+
+	case DestructureNodeType:
+		n := tree.(*DestructureNode)
+
+		if err := c.checkMatchGroups(n); err != nil {
+			return err
+		}
+
+		err := c.Compile(n.value)
 		if err != nil {
 			return err
 		}
 
-		c.add(InstructionCall)
+		names := make([]Value, len(n.names))
+		for i, name := range n.names {
+			names[i] = &StringValue{name}
+			if name != "_" {
+				c.checkShadowing(tree, name, c.scope)
+				c.registerVar(name)
+			}
+		}
+
+		c.add(InstructionDestructure)
+		c.addConstant(NewList(names))
+
+	case CallNodeType:
+		n := tree.(*CallNode)
+
+		err := c.checkFormat(n)
+		if err != nil {
+			return err
+		}
+
+		if err := c.checkCall(n); err != nil {
+			return err
+		}
+
+		if v, ok := c.foldCall(n); ok {
+			if n.keep {
+				c.add(InstructionConstant)
+				c.addConstant(v)
+			}
+
+			break
+		}
+
+		// the arguments of calls spreading lists into them are gathered into a list, whose items they are called with
+		spread := hasSpread(n.args)
+
+		args := 0
+		if spread {
+			err = c.compileSpread(n.args)
+		} else {
+			args, err = c.compileArgs(n)
+		}
+		if err != nil {
+			return err
+		}
+
+		if access, ok := n.source.(*AccessNode); ok && access.optional {
+			return c.compileOptionalCall(n, access, spread)
+		}
+
+		err = c.Compile(n.source)
+		if err != nil {
+			return err
+		}
+
+		if spread {
+			c.add(InstructionCallSpread)
+		} else {
+			c.add(InstructionCall)
+			c.add(Bytecode(args))
+		}
 
 		if !n.keep {
 			c.add(InstructionPop)
@@ -250,39 +833,93 @@ func (c *Compiler) Compile(tree Node) error {
 
 		// assign a new empty chunk
 		c.Chunk = NewChunk(make([]Bytecode, 0), make([]Value, 0))
+		c.Chunk.Decimal = c.decimal
 		// reset instruction pointer (ip)
 		c.ip = 0
 
-		for _, p := range n.params {
-			c.registerVar(p)
+		// the parameters are in the scope of the body of the function
+		locals := c.stack.Current
+		for i, p := range n.params {
+			c.checkShadowing(tree, p, c.scope+1)
+			c.registerTypedVar(p, n.paramType(i))
+		}
+
+		// parameters declared with types are checked as the function begins
+		for i, p := range n.params {
+			if n.paramType(i) == "any" {
+				continue
+			}
+
+			target, err := c.resolveType(n.paramType(i))
+			if err != nil {
+				return c.errorAt(n, err.Error())
+			}
+
+			c.add(InstructionGetLocal)
+			c.addConstant(&StringValue{p})
+			c.add(InstructionCast)
+			c.addConstant(&StringValue{target})
+			c.add(InstructionPop)
 		}
 
+		c.checkLastIf(n)
+
+		// the body of a function declared in a loop isn't itself looped
+		loops, inFunction := c.loops, c.inFunction
+		c.loops, c.inFunction = 0, true
+
 		err := c.Compile(n.logic)
+		c.loops, c.inFunction = loops, inFunction
 		if err != nil {
 			return err
 		}
 
-		if n.logic.Type() != BlockNodeType {
-			c.stack.Pop()
+		// functions which end without returning return nil
+		c.add(InstructionNil)
+		c.add(InstructionReturn)
+
+		// mistakes of the compiler are caught here, rather than when the function is run
+		if err := c.Chunk.verifyStack(); err != nil {
+			return fmt.Errorf("compiled invalid bytecode for function %s: %w", n.name, err)
 		}
 
+		c.stack.Current = locals
+
 		mc.Constants[fi] = &FunctionValue{
 			n.name,
 			n.params,
 			c.Chunk,
 			nil,
+			nil,
 		}
 
 		// restore old chunk and ip
 		c.Chunk = mc
 		c.ip = mip
 
+		if captured := c.captures(n); len(captured) > 0 {
+			c.add(InstructionClosure)
+			c.addConstant(NewList(captured))
+		}
+
 	case AccessNodeType:
 		n := tree.(*AccessNode)
+
+		if err := c.checkMember(n); err != nil {
+			return err
+		}
+
 		err := c.Compile(n.source)
 		if err != nil {
 			return err
 		}
+
+		// nil is left as it is, skipping the access
+		if n.optional {
+			c.add(InstructionJumpNil)
+			c.addU16(2)
+		}
+
 		c.add(InstructionAccessProperty)
 		c.addConstant(&StringValue{
 			n.property,
@@ -291,241 +928,1602 @@ func (c *Compiler) Compile(tree Node) error {
 	case ImportNodeType:
 		n := tree.(*ImportNode)
 
+		if module, ok := StandardModules[n.path]; ok {
+			for _, name := range module.Names() {
+				c.DeclareGlobal(name)
+			}
+
+			c.add(InstructionImport)
+			c.addConstant(&StringValue{
+				n.path,
+			})
+			break
+		}
+
+		if isBytecodeImport(n.path) {
+			if err := c.importBytecode(n.path); err != nil {
+				return c.errorAt(n, err.Error())
+			}
+			break
+		}
+
+		c.markImport(n)
 		t := c.resolveImport(n.path).(*BlockNode)
 
 		for _, statement := range t.statements {
+			// only the main function of the program being run is its entrypoint
+			if assign, ok := statement.(*AssignNode); ok && assign.name == MainFunction && assign.declare {
+				continue
+			}
+
 			err := c.Compile(statement)
 			if err != nil {
+				// marked with the file, which for nested imports is within the error of the file importing it
+				return &FileError{n.path, c.sources[n.path], err, []Location{c.importedAt[n.path]}}
+			}
+		}
+
+	case ReturnNodeType:
+		err := c.Compile(tree.(*ReturnNode).value)
+		if err != nil {
+			return err
+		}
+		c.add(InstructionReturn)
+
+	case DeferNodeType:
+		n := tree.(*DeferNode)
+
+		if !c.inFunction {
+			return c.errorAt(n, "calls can only be deferred within functions")
+		}
+
+		if access, ok := n.call.source.(*AccessNode); ok && access.optional {
+			return c.errorAt(n, "optional calls can't be deferred")
+		}
+
+		if hasSpread(n.call.args) {
+			return c.errorAt(n, "calls spreading lists into their arguments can't be deferred")
+		}
+
+		if err := c.checkFormat(n.call); err != nil {
+			return err
+		}
+
+		if err := c.checkCall(n.call); err != nil {
+			return err
+		}
+
+		// the arguments and the function are evaluated now, and kept by the VM until the function returns
+		args, err := c.compileArgs(n.call)
+		if err != nil {
+			return err
+		}
+
+		if err := c.Compile(n.call.source); err != nil {
+			return err
+		}
+
+		c.add(InstructionDefer)
+		c.add(Bytecode(args))
+
+	case BreakpointNodeType:
+		c.add(InstructionBreakpoint)
+
+	case PragmaNodeType:
+		// pragmas only change how the program is compiled, which collectDeclarations has already done
+		if n := tree.(*PragmaNode); n.name != "decimal" && n.name != "strict" {
+			return c.errorAt(n, fmt.Sprintf("unknown pragma %s", n.name))
+		}
+
+	case GlobalNodeType:
+		n := tree.(*GlobalNode)
+
+		c.checkImplicitAny(tree, n.name, n.value)
+
+		err := c.Compile(n.value)
+		if err != nil {
+			return err
+		}
+
+		c.DeclareGlobal(n.name)
+
+		c.add(InstructionSetGlobal)
+		c.addConstant(&StringValue{
+			n.name,
+		})
+
+	case ComptimeNodeType:
+		v, err := c.comptime(tree.(*ComptimeNode))
+		if err != nil {
+			return err
+		}
+
+		c.add(InstructionConstant)
+		c.addConstant(v)
+
+	case IndexNodeType:
+		n := tree.(*IndexNode)
+
+		if err := c.Compile(n.source); err != nil {
+			return err
+		}
+
+		if err := c.Compile(n.index); err != nil {
+			return err
+		}
+
+		c.add(InstructionIndex)
+
+	case RangeNodeType:
+		n := tree.(*RangeNode)
+
+		if err := c.Compile(n.start); err != nil {
+			return err
+		}
+
+		if err := c.Compile(n.end); err != nil {
+			return err
+		}
+
+		if n.inclusive {
+			c.add(InstructionRangeInclusive)
+		} else {
+			c.add(InstructionRange)
+		}
+
+	case SpreadNodeType:
+		// spreads are compiled by the lists and calls they are in (see compileSpread)
+		return c.errorAt(tree, "lists can only be spread into lists and the arguments of calls")
+
+	case CastNodeType:
+		n := tree.(*CastNode)
+
+		target, err := c.resolveType(n.target)
+		if err != nil {
+			return c.errorAt(n, err.Error())
+		}
+
+		// a constant of the wrong type can never be cast
+		if c.isTreeConstant(n.value) {
+			v, err := c.compute(n.value)
+			if err != nil {
+				return err
+			}
+
+			if !IsOfType(v, target) {
+				return c.errorAt(n, fmt.Sprintf("cannot cast %s to %s", TypeOf(v), n.target))
+			}
+		}
+
+		err = c.Compile(n.value)
+		if err != nil {
+			return err
+		}
+
+		c.add(InstructionCast)
+		c.addConstant(&StringValue{
+			target,
+		})
+
+	case TypeNodeType:
+		n := tree.(*TypeNode)
+
+		name := n.signature.Name
+		if c.types[name] != n {
+			return c.errorAt(n, fmt.Sprintf("type %s is already declared", name))
+		}
+
+		// the types of the members must be known, and can't contain the type itself
+		if _, err := c.resolveType(name); err != nil {
+			return c.errorAt(n, err.Error())
+		}
+
+		if t, ok := c.positions[tree]; ok {
+			c.positions[n.constructor] = t
+		}
+
+		if err := c.setVar(name, n.constructor, true); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// compileContinuation compile a piece of a program entered after what the compiler has already compiled, such as an
+// input of a session (see Session), into a chunk of its own. Its statements are compiled in the scope of the top
+// level, which is never left, so the variables it declares are known to the pieces compiled after it. Names it
+// declares at its top level replace what earlier pieces declared them as, so calls to a redefined function are checked
+// against the new one.
+func (c *Compiler) compileContinuation(tree Node) (err error) {
+	c.Chunk, c.ip = NewChunk(make([]Bytecode, 0), make([]Value, 0)), 0
+	c.Chunk.Decimal, c.Chunk.Strict = c.decimal, c.strict
+
+	statements := []Node{tree}
+	if block, ok := tree.(*BlockNode); ok {
+		statements = block.statements
+	}
+
+	for _, statement := range statements {
+		if n, ok := statement.(*AssignNode); ok && n.declare {
+			delete(c.declared, n.name)
+			delete(c.functions, n.name)
+		} else if n, ok := statement.(*ConstNode); ok {
+			delete(c.declared, n.name)
+			delete(c.functions, n.name)
+		} else if n, ok := statement.(*TypeNode); ok {
+			delete(c.declared, n.signature.Name)
+			delete(c.functions, n.signature.Name)
+			delete(c.types, n.signature.Name)
+		}
+	}
+
+	notes := len(c.notes)
+	c.collectDeclarations(tree)
+	c.markDeadStores(statements)
+	defer func() {
+		if err == nil && c.strict && len(c.notes) > notes {
+			err = c.noteError(c.notes[notes])
+		}
+	}()
+	defer c.reportExceeded(&err)
+
+	c.depth++
+	defer func() {
+		c.depth--
+	}()
+
+	for _, statement := range statements {
+		if err := c.Compile(statement); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// binaryInstructions the instruction doing each binary operation
+var binaryInstructions = map[BinaryOperation]Bytecode{
+	BinaryAddition:       InstructionAdd,
+	BinarySubtraction:    InstructionSub,
+	BinaryMultiplication: InstructionMul,
+	BinaryDivision:       InstructionDiv,
+	BinaryEquality:       InstructionEquals,
+	BinaryInequality:     InstructionNotEqual,
+	BinaryLess:           InstructionLess,
+	BinaryGreater:        InstructionGreater,
+	BinaryLessEqual:      InstructionLessOrEqual,
+	BinaryGreaterEqual:   InstructionGreaterOrEqual,
+	BinaryAnd:            InstructionAnd,
+	BinaryOr:             InstructionOr,
+	BinaryBitwiseAnd:     InstructionBitwiseAnd,
+	BinaryBitwiseOr:      InstructionBitwiseOr,
+	BinaryBitwiseXor:     InstructionBitwiseXor,
+	BinaryShiftLeft:      InstructionShiftLeft,
+	BinaryShiftRight:     InstructionShiftRight,
+}
+
+// numericLoop a for loop counting a variable declared by its init towards a limit by a constant step, such as
+// for i := 0; i < n; i = i + 1, which is compiled into InstructionForPrep and InstructionForLoop rather than the
+// instructions of its condition and step
+type numericLoop struct {
+	counter string
+	// limit a number, or the name of the variable the counter is compared to
+	limit Value
+	step  Value
+	// comparison the instruction of the condition, and operation the instruction of the step
+	comparison Bytecode
+	operation  Bytecode
+}
+
+// numericLoop get the numeric loop a for loop is, nil if it isn't one. Its init must already be compiled.
+func (c *Compiler) numericLoop(n *ForNode) *numericLoop {
+	init, ok := n.init.(*AssignNode)
+	if !ok || !init.declare || init.name == "_" {
+		return nil
+	}
+
+	loop := &numericLoop{counter: init.name}
+
+	condition, ok := n.condition.(*BinaryNode)
+	if !ok || !isReferenceTo(condition.Left, init.name) {
+		return nil
+	}
+
+	switch loop.comparison = binaryInstructions[condition.BinaryOperation]; loop.comparison {
+	case InstructionLess, InstructionLessOrEqual, InstructionGreater, InstructionGreaterOrEqual:
+	default:
+		return nil
+	}
+
+	switch limit := condition.Right.(type) {
+	case *NumberNode:
+		loop.limit = NewNumber(limit.value)
+	case *ReferenceNode:
+		// the limit is looked up each time, as it is in the condition, unless it is a constant
+		v := c.local(limit.name)
+		if v == nil || limit.name == init.name {
+			return nil
+		}
+
+		if number, ok := v.value.(*NumberValue); v.constant && ok {
+			loop.limit = number
+		} else if !v.constant {
+			loop.limit = NewString(limit.name)
+		} else {
+			return nil
+		}
+	default:
+		return nil
+	}
+
+	step, ok := n.step.(*AssignNode)
+	if !ok || step.declare || step.name != init.name {
+		return nil
+	}
+
+	value, ok := step.value.(*BinaryNode)
+	if !ok || !isReferenceTo(value.Left, init.name) {
+		return nil
+	}
+
+	by, ok := value.Right.(*NumberNode)
+	if !ok || (value.BinaryOperation != BinaryAddition && value.BinaryOperation != BinarySubtraction) {
+		return nil
+	}
+	loop.step, loop.operation = NewNumber(by.value), binaryInstructions[value.BinaryOperation]
+
+	return loop
+}
+
+// isReferenceTo whether a node refers to the variable of a name
+func isReferenceTo(n Node, name string) bool {
+	r, ok := n.(*ReferenceNode)
+	return ok && r.name == name
+}
+
+// compileNumericLoop compile the condition, body and step of a numeric loop, whose init is already compiled
+func (c *Compiler) compileNumericLoop(n *ForNode, loop *numericLoop) error {
+	// the condition and step aren't compiled, so what is known of them is kept here instead
+	if c.kinds != nil {
+		for _, node := range []Node{n.condition, n.step} {
+			Walk(node, func(node Node) bool {
+				c.recordKind(node)
+				return true
+			})
+		}
+	}
+
+	operands := func() {
+		c.addConstant(NewString(loop.counter))
+		c.addConstant(loop.limit)
+		c.addConstant(loop.step)
+		c.add(loop.comparison)
+		c.add(loop.operation)
+	}
+
+	c.add(InstructionForPrep)
+	operands()
+	jumpPos := c.ip
+	c.advance(2)
+
+	bodyPos := c.ip
+	c.loops++
+	err := c.Compile(n.do)
+	c.loops--
+	if err != nil {
+		return err
+	}
+
+	c.add(InstructionForLoop)
+	operands()
+	c.addU16(c.u16(c.ip-bodyPos+2, "the body of the loop"))
+
+	c.putU16(jumpPos, c.u16(c.ip-jumpPos-2, "the body of the loop"))
+
+	return nil
+}
+
+func (c *Compiler) compileBinary(binary *BinaryNode) error {
+	if !c.noFolding && c.isTreeConstant(binary) {
+		v, err := c.compute(binary)
+		if err != nil {
+			return c.errorAt(binary, err.Error())
+		}
+
+		c.add(InstructionConstant)
+		c.addConstant(v)
+		return nil
+	}
+
+	// bitwise operations only take numbers, so other literals fail before the program is run
+	if binary.BinaryOperation >= BinaryBitwiseAnd {
+		for _, operand := range []Node{binary.Left, binary.Right} {
+			if kind := deduceKind(operand); kind != "number" && kind != "bigint" && kind != "any" {
+				return c.errorAt(binary, fmt.Sprintf("cannot %s %s, only numbers", binary.BinaryOperation, kind))
+			}
+		}
+	}
+
+	if !c.noFolding && binary.BinaryOperation == BinaryAddition {
+		if joined, err := c.compileConcatenation(binary); joined || err != nil {
+			return err
+		}
+	}
+
+	if binary.BinaryOperation == BinaryCoalesce {
+		return c.compileCoalesce(binary)
+	}
+
+	err := c.Compile(binary.Left)
+	if err != nil {
+		return err
+	}
+	err = c.Compile(binary.Right)
+	if err != nil {
+		return err
+	}
+
+	c.add(binaryInstructions[binary.BinaryOperation])
+
+	return nil
+}
+
+// compileOptionalCall compile a call of a prop got with ?. (user?.greet()), which is nil without calling anything if
+// the value the prop is got from is nil. The arguments are already on the stack, as they are evaluated first either way,
+// gathered into a list if the call spreads lists into them.
+func (c *Compiler) compileOptionalCall(call *CallNode, access *AccessNode, spread bool) error {
+	if err := c.checkMember(access); err != nil {
+		return err
+	}
+
+	if err := c.Compile(access.source); err != nil {
+		return err
+	}
+
+	c.add(InstructionJumpNil)
+	jumpToNil := c.ip
+	c.advance(2)
+
+	c.add(InstructionAccessProperty)
+	c.addConstant(&StringValue{access.property})
+	args := len(call.args)
+	if spread {
+		c.add(InstructionCallSpread)
+		args = 1
+	} else {
+		c.add(InstructionCall)
+		c.add(Bytecode(args))
+	}
+	if !call.keep {
+		c.add(InstructionPop)
+	}
+
+	c.add(InstructionJump)
+	jumpOverNil := c.ip
+	c.advance(2)
+
+	// the value is nil, so it and the arguments are popped
+	c.putU16(jumpToNil, c.u16(c.ip-jumpToNil-2, "the optional call"))
+	for i := 0; i <= args; i++ {
+		c.add(InstructionPop)
+	}
+	if call.keep {
+		c.add(InstructionNil)
+	}
+
+	c.putU16(jumpOverNil, c.u16(c.ip-jumpOverNil-2, "the optional call"))
+
+	return nil
+}
+
+// checkMember make sure the prop got is a member of the values it is got from, if they are of a declared type, as
+// objects of declared types only have the members they are declared with. Props got with . rather than ?. from values
+// which may be nil are noted.
+func (c *Compiler) checkMember(n *AccessNode) error {
+	kind, nullable := strings.CutSuffix(c.kindOf(n.source), "|nil")
+
+	t := c.types[kind]
+	if t != nil && !t.signature.Has(n.property) && ObjectPrototype[n.property] == nil {
+		return c.errorAt(n, fmt.Sprintf("%s has no member %s", t.signature.Name, n.property))
+	}
+
+	if nullable && !n.optional {
+		c.note(n, fmt.Sprintf("%s may be nil, so getting %s from it may fail; use ?.%s to get nil instead", kind, n.property, n.property))
+	}
+
+	return nil
+}
+
+// compileCoalesce compile a ?? b, which only evaluates b if a is nil. a is left on the stack unless it is nil, in which
+// case it is popped for b.
+func (c *Compiler) compileCoalesce(binary *BinaryNode) error {
+	if err := c.Compile(binary.Left); err != nil {
+		return err
+	}
+
+	c.add(InstructionJumpNil)
+	c.addU16(3)
+
+	// the left operand isn't nil, so the right one is skipped
+	c.add(InstructionJump)
+	jumpOverRight := c.ip
+	c.advance(2)
+
+	c.add(InstructionPop)
+	if err := c.Compile(binary.Right); err != nil {
+		return err
+	}
+
+	c.putU16(jumpOverRight, c.u16(c.ip-jumpOverRight-2, "the right operand of ??"))
+
+	return nil
+}
+
+// compileConcatenation compile a chain of additions (such as "a" + b + "c" + "d") with adjacent strings joined, if there
+// are any to join. Adding anything to a string either results in a string or fails, so once a chain starts with a
+// string, ("a" + b + "c") + "d" is the same as "a" + b + "cd". Chains starting with anything else are left as they
+// are, as the first operand may be an object overloading add. Returns whether the chain was compiled.
+func (c *Compiler) compileConcatenation(binary *BinaryNode) (bool, error) {
+	// the chain is nested to the left, ((a + b) + c) + d
+	var operands []Node
+	var n Node = binary
+	for b, ok := n.(*BinaryNode); ok && b.BinaryOperation == BinaryAddition && !c.isTreeConstant(b); b, ok = n.(*BinaryNode) {
+		operands = append([]Node{b.Right}, operands...)
+		n = b.Left
+	}
+	operands = append([]Node{n}, operands...)
+
+	// parts the operands, with the strings (nil for the others) after joining them
+	var parts []Node
+	var texts []*StringValue
+	joined := false
+
+	for _, operand := range operands {
+		var s *StringValue
+		if c.isTreeConstant(operand) {
+			v, err := c.compute(operand)
+			if err != nil {
+				return false, err
+			}
+
+			s, _ = v.(*StringValue)
+		}
+
+		if last := len(texts) - 1; s != nil && last >= 0 && texts[last] != nil && texts[0] != nil {
+			texts[last] = &StringValue{texts[last].string + s.string}
+			joined = true
+			continue
+		}
+
+		parts = append(parts, operand)
+		texts = append(texts, s)
+	}
+
+	if !joined {
+		return false, nil
+	}
+
+	for i, part := range parts {
+		if texts[i] != nil {
+			c.add(InstructionConstant)
+			c.addConstant(texts[i])
+		} else if err := c.Compile(part); err != nil {
+			return false, err
+		}
+
+		if i > 0 {
+			c.add(InstructionAdd)
+		}
+	}
+
+	return true, nil
+}
+
+func (c *Compiler) getVar(name string) {
+	if c.isGlobal(name) {
+		c.add(InstructionGetGlobal)
+		c.addConstant(&StringValue{
+			name,
+		})
+	} else {
+		c.add(InstructionGetLocal)
+		c.addConstant(&StringValue{
+			name,
+		})
+	}
+}
+
+func (c *Compiler) setVar(name string, value Node, declare bool) error {
+	err := c.Compile(value)
+	if err != nil {
+		return err
+	}
+
+	if declare {
+		c.add(InstructionDeclareLocal)
+		c.registerTypedVar(name, c.kindOf(value))
+	} else if c.isGlobal(name) && !c.isLocal(name) {
+		c.add(InstructionSetGlobal)
+	} else {
+		c.add(InstructionSetLocal)
+		c.retypeVar(name, c.kindOf(value))
+	}
+
+	c.addConstant(&StringValue{
+		name,
+	})
+
+	return nil
+}
+
+// markDeadStores find the dead stores among the statements of a block, for them to be noted once they are compiled
+func (c *Compiler) markDeadStores(statements []Node) {
+	for n, over := range deadStores(statements, c.captured) {
+		c.deadStores[n] = over
+	}
+}
+
+// noteDeadStore note an assignment whose value is never read, as over assigns to the variable first
+func (c *Compiler) noteDeadStore(n *AssignNode, over *AssignNode) {
+	if token, ok := c.positions[over]; ok {
+		c.note(n, fmt.Sprintf("the value assigned to %s is never read, as it is assigned again on line %d first", n.name, token.Line+1))
+		return
+	}
+
+	c.note(n, fmt.Sprintf("the value assigned to %s is never read, as it is assigned again first", n.name))
+}
+
+// eliminateStore compile a dead store without storing its value, which is still computed for what it does (such as
+// calls) unless it is known while compiling. The variable is given its type as if it were stored, so the program is
+// checked the same either way.
+func (c *Compiler) eliminateStore(n *AssignNode) error {
+	if !c.isTreeConstant(n.value) {
+		if err := c.Compile(n.value); err != nil {
+			return err
+		}
+		c.add(InstructionPop)
+	}
+
+	c.retypeVar(n.name, c.kindOf(n.value))
+	return nil
+}
+
+// keep track that a variable is declared but doesn't necessarily have a deducible type
+func (c *Compiler) registerVar(name string) {
+	c.registerTypedVar(name, "any")
+}
+
+// keep track that a variable is declared with a value of a type
+func (c *Compiler) registerTypedVar(name string, kind string) {
+	c.stack.Push(LocalVariable{
+		name,
+		int(c.scope),
+		kind,
+		false,
+		nil,
+	})
+}
+
+// retypeVar keep track that a variable is given a value of a type, after which it may be of either type, so it is
+// any unless it is of the same type as before
+func (c *Compiler) retypeVar(name string, kind string) {
+	for i := c.stack.Current - 1; i >= 0; i-- {
+		if v := &c.stack.items[i]; v.name == name {
+			if v.kind != kind {
+				v.kind = "any"
+			}
+
+			return
+		}
+	}
+}
+
+// itemKind the type of the items a for-each loop goes through in a value of a type, which is only known of ranges
+func itemKind(kind string) string {
+	if kind == "range" {
+		return "number"
+	}
+
+	return "any"
+}
+
+// kindOf deduce the type of value a node results in, as deduceKind does, also knowing the types of local variables
+func (c *Compiler) kindOf(n Node) string {
+	switch n := n.(type) {
+	case *ReferenceNode:
+		for i := c.stack.Current - 1; i >= 0; i-- {
+			if c.stack.items[i].name == n.name {
+				return c.stack.items[i].kind
+			}
+		}
+	case *CallNode:
+		// calls to the constructor of a declared type, unless its name is given another value
+		if reference, ok := n.source.(*ReferenceNode); ok {
+			if t := c.types[reference.name]; t != nil && c.functions[reference.name] == t.constructor {
+				return reference.name
+			}
+		}
+	case *AccessNode:
+		// members of objects of declared types are of the type they are declared with, or nil if got with ?. from nil
+		kind, nullable := strings.CutSuffix(c.kindOf(n.source), "|nil")
+		if t := c.types[kind]; t != nil {
+			if i := slices.Index(t.signature.Members, n.property); i >= 0 {
+				if nullable && n.optional {
+					return nullableKind(t.signature.Types[i])
+				}
+
+				return t.signature.Types[i]
+			}
+		}
+	case *BinaryNode:
+		// a ?? b is of the type of a, once it isn't nil, if b is of it too
+		if n.BinaryOperation != BinaryCoalesce {
+			break
+		}
+
+		left, right := strings.TrimSuffix(c.kindOf(n.Left), "|nil"), c.kindOf(n.Right)
+		switch {
+		case left == right:
+			return left
+		case right == "nil":
+			return nullableKind(left)
+		case left == "nil" || strings.TrimSuffix(right, "|nil") == left:
+			return right
+		}
+
+		return "any"
+	}
+
+	return deduceKind(n)
+}
+
+// recordKind keep the type deduced for a node, by the token it begins at. Nodes are compiled before those within them,
+// so of nodes beginning at the same token the innermost is kept. Declarations are kept as the type of their value.
+func (c *Compiler) recordKind(n Node) {
+	token, ok := c.positions[n]
+	if !ok {
+		return
+	}
+
+	switch n := n.(type) {
+	case *AssignNode:
+		c.kinds[token] = c.kindOf(n.value)
+	case *ConstNode:
+		c.kinds[token] = c.kindOf(n.value)
+	case *GlobalNode:
+		c.kinds[token] = c.kindOf(n.value)
+	case *ReferenceNode, *AccessNode, *CallNode, *IndexNode, *CastNode, *BinaryNode, *ListNode, *ObjectNode,
+		*StringNode, *NumberNode, *BigIntNode, *BooleanNode, *NilNode, *FunctionNode, *RangeNode:
+		c.kinds[token] = c.kindOf(n)
+	}
+}
+
+// nullableKind the type of values of a type, or nil (Node|nil)
+func nullableKind(kind string) string {
+	if kind == "any" || kind == "nil" || strings.HasSuffix(kind, "|nil") {
+		return kind
+	}
+
+	return kind + "|nil"
+}
+
+// isLocal whether a variable of with the name provided is declared within the local scope
+func (c *Compiler) isLocal(name string) bool {
+	return c.local(name) != nil
+}
+
+// local get the innermost local variable of a name, or nil if there is none
+func (c *Compiler) local(name string) *LocalVariable {
+	for i := c.stack.Current - 1; i >= 0; i-- {
+		if c.stack.items[i].name == name {
+			return &c.stack.items[i]
+		}
+	}
+	return nil
+}
+
+// constantOf get the value a reference to a name is replaced with while compiling, which is that of a constant
+// declared with const (unless folding is off) or set with Define
+func (c *Compiler) constantOf(name string) (Value, bool) {
+	if v := c.local(name); v != nil {
+		return v.value, v.value != nil && !c.noFolding
+	}
+
+	if c.isDefined(name) {
+		return c.defines[name], true
+	}
+
+	return nil, false
+}
+
+// isTreeConstant check if a node tree is constant (predictable)
+func (c *Compiler) isTreeConstant(tree Node) bool {
+	switch tree.Type() {
+	case StringNodeType, NumberNodeType, BooleanNodeType, NilNodeType, BigIntNodeType:
+		return true
+	case ListNodeType:
+		for _, item := range tree.(*ListNode).items {
+			if !c.isTreeConstant(item) {
+				return false
+			}
+		}
+
+		return true
+	case BinaryNodeType:
+		return c.isTreeConstant(tree.(*BinaryNode).Left) && c.isTreeConstant(tree.(*BinaryNode).Right)
+	case ReferenceNodeType:
+		_, ok := c.constantOf(tree.(*ReferenceNode).name)
+		return ok
+	case BlockNodeType, ConditionalNodeType, LoopNodeType, ForNodeType, AssignNodeType, CallNodeType, FunctionNodeType,
+		ReturnNodeType, AccessNodeType, BreakpointNodeType, ImportNodeType, CastNodeType, GlobalNodeType,
+		ComptimeNodeType, IndexNodeType, PragmaNodeType, DestructureNodeType, ObjectNodeType, TypeNodeType,
+		DeferNodeType, ConstNodeType, RangeNodeType, SpreadNodeType, ForEachNodeType:
+		return false
+	default:
+		panic(fmt.Sprintf("unexpected node %s", tree))
+	}
+}
+
+func (c *Compiler) compute(tree Node) (Value, error) {
+	switch n := tree.(type) {
+	case *StringNode:
+		return &StringValue{
+			n.value,
+		}, nil
+
+	case *NumberNode:
+		if c.decimal {
+			return decimalValue(&NumberValue{n.value, nil}), nil
+		}
+
+		return &NumberValue{
+			n.value,
+			nil,
+		}, nil
+
+	case *BigIntNode:
+		return &BigIntValue{n.value}, nil
+
+	case *BooleanNode:
+		return &BoolValue{
+			n.value,
+		}, nil
+
+	case *NilNode:
+		return &NilValue{}, nil
+
+	case *ListNode:
+		items := make([]Value, len(n.items))
+		var err error
+		for i, item := range n.items {
+			items[i], err = c.compute(item)
+
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		// constants are shared by every evaluation of their literal, so they may not be changed (the VM pushes lists which
+		// copy the items once changed)
+		return Freeze(&ListValue{
+			items,
+			false,
+			false,
+		}), nil
+
+	case *BinaryNode:
+		return c.computeBinary(n)
+
+	case *ReferenceNode:
+		v, _ := c.constantOf(n.name)
+		return v, nil
+
+	default:
+		panic(fmt.Sprintf("unexpected node %s, %T", tree.String(), tree))
+	}
+}
+
+func (c *Compiler) computeBinary(n *BinaryNode) (Value, error) {
+	l, err := c.compute(n.Left)
+	if err != nil {
+		return nil, err
+	}
+	r, err := c.compute(n.Right)
+	if err != nil {
+		return nil, err
+	}
+
+	// computed the same way the VM executes it, so the program does the same whether it is folded or not
+	if c.decimal {
+		l, r = decimalValue(l), decimalValue(r)
+	}
+
+	if n.BinaryOperation == BinaryCoalesce {
+		if l.Type() == NilValueType {
+			return r, nil
+		}
+
+		return l, nil
+	}
+
+	return binaryOperation(binaryInstructions[n.BinaryOperation], l, r)
+}
+
+// checkFormat make sure calls to format with a constant format string and list of values have as many values as the
+// format string uses
+func (c *Compiler) checkFormat(call *CallNode) error {
+	reference, ok := call.source.(*ReferenceNode)
+	if !ok || reference.name != "format" || c.isLocal("format") || len(call.args) != 2 {
+		return nil
+	}
+
+	format, ok := call.args[0].(*StringNode)
+	if !ok {
+		return nil
+	}
+
+	needed, err := FormatCount(format.value)
+	if err != nil {
+		return c.errorAt(call, err.Error())
+	}
+
+	values, ok := call.args[1].(*ListNode)
+	if ok && !hasSpread(values.items) && needed > len(values.items) {
+		return c.errorAt(call, fmt.Sprintf("format string %s uses %d values, but only %d are given", format.quoted, needed, len(values.items)))
+	}
+
+	return nil
+}
+
+// calledFunction the function a call is to, if it is known while compiling
+func (c *Compiler) calledFunction(call *CallNode) *FunctionNode {
+	reference, ok := call.source.(*ReferenceNode)
+	if !ok || c.isDefined(reference.name) {
+		return nil
+	}
+
+	return c.functions[reference.name]
+}
+
+// compileArgs compile the arguments of a call, followed by the defaults of the parameters they leave out if the
+// function called is known, returning how many arguments the function is called with. Functions which aren't known
+// while compiling (such as those passed as values) are called with only the arguments given.
+func (c *Compiler) compileArgs(call *CallNode) (int, error) {
+	for _, arg := range call.args {
+		if err := c.Compile(arg); err != nil {
+			return 0, err
+		}
+	}
+
+	args := len(call.args)
+	if f := c.calledFunction(call); f != nil {
+		for ; args < len(f.defaults); args++ {
+			if err := c.Compile(f.defaults[args]); err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	if args > 255 {
+		return 0, c.errorAt(call, fmt.Sprintf("cannot call a function with more than 255 arguments, got %d", args))
+	}
+
+	return args, nil
+}
+
+// hasSpread whether any of the items of a list or arguments of a call is a list spread into them (...xs)
+func hasSpread(items []Node) bool {
+	return slices.ContainsFunc(items, func(n Node) bool {
+		return n.Type() == SpreadNodeType
+	})
+}
+
+// compileSpread compile items some of which are lists spread into them ([1, ...xs]) into a list, appending the items
+// one by one and extending it with the spread lists. The spread values must be lists, or ranges, where their type is
+// known.
+func (c *Compiler) compileSpread(items []Node) error {
+	c.add(InstructionNewList)
+
+	for _, item := range items {
+		spread, ok := item.(*SpreadNode)
+		if !ok {
+			if err := c.Compile(item); err != nil {
 				return err
 			}
+
+			c.add(InstructionAppend)
+			continue
+		}
+
+		kind, nullable := strings.CutSuffix(c.kindOf(spread.value), "|nil")
+		if kind != "any" && kind != "list" && kind != "range" {
+			return c.errorAt(spread, fmt.Sprintf("cannot spread %s, as only lists can be spread", kind))
+		}
+
+		if nullable {
+			c.note(spread, fmt.Sprintf("%s may be nil, so spreading it may fail", spread.value))
+		}
+
+		if err := c.Compile(spread.value); err != nil {
+			return err
+		}
+
+		c.add(InstructionExtend)
+	}
+
+	return nil
+}
+
+// checkCall check that a call to a function known while compiling (a default builtin which isn't shadowed, or a
+// function of the program which its name is never given another value than) is given as many arguments as the
+// function takes. Calls whose results are unused are noted if the result is what the function is for.
+func (c *Compiler) checkCall(call *CallNode) error {
+	reference, ok := call.source.(*ReferenceNode)
+	if !ok || c.isDefined(reference.name) {
+		return nil
+	}
+
+	// how many arguments calls spreading lists into them are given is only known while executing
+	spread := hasSpread(call.args)
+
+	name := reference.name
+	if f := c.functions[name]; f != nil {
+		if err := f.checkArgs(name, len(call.args)); err != nil && !spread {
+			return c.errorAt(call, err.Error())
+		}
+
+		if !call.keep && returnsValue(f) {
+			c.note(call, fmt.Sprintf("%s returns a value which is unused; use discard %s(...) if that is intended", name, name))
+		}
+
+		return nil
+	}
+
+	builtin := c.profile.Builtins().Get(name)
+	if builtin == nil || c.isLocal(name) || c.declared[name] || c.globals[name] {
+		return nil
+	}
+
+	if err := builtin.Signature.Check(name, len(call.args)); err != nil && !spread {
+		return c.errorAt(call, err.Error())
+	}
+
+	// calls to constant builtins do nothing else than return
+	if !call.keep && builtin.Const {
+		c.note(call, fmt.Sprintf("%s returns a value which is unused; use discard %s(...) if that is intended", name, name))
+	}
+
+	return nil
+}
+
+// checkMatchGroups check that destructuring what match returns for a constant pattern has a name for the whole match
+// and for each group of the pattern, as the list it returns always has that many items
+func (c *Compiler) checkMatchGroups(n *DestructureNode) error {
+	call, ok := n.value.(*CallNode)
+	if !ok || len(call.args) != 2 || !c.isTreeConstant(call.args[1]) {
+		return nil
+	}
+
+	reference, ok := call.source.(*ReferenceNode)
+	if !ok || reference.name != "match" || c.isDefined(reference.name) || c.isLocal(reference.name) ||
+		c.declared[reference.name] || c.globals[reference.name] {
+		return nil
+	}
+
+	v, err := c.compute(call.args[1])
+	if err != nil {
+		return err
+	}
+
+	pattern, ok := v.(*StringValue)
+	if !ok {
+		return nil
+	}
+
+	re, err := regexp.Compile(pattern.string)
+	if err != nil {
+		return c.errorAt(n, fmt.Sprintf("invalid pattern %q: %v", pattern.string, err))
+	}
+
+	if groups := re.NumSubexp(); len(n.names) != groups+1 {
+		return c.errorAt(n, fmt.Sprintf("cannot destructure a match of %q into %d names, it has the whole match and %d groups",
+			pattern.string, len(n.names), groups))
+	}
+
+	return nil
+}
+
+// checkImplicitAny note a variable declared with a value whose type can't be deduced, if implicit any is warned of.
+// Values which are constant are computed to find their type.
+func (c *Compiler) checkImplicitAny(node Node, name string, value Node) {
+	if !c.warnAny || c.kindOf(value) != "any" {
+		return
+	}
+
+	if c.isTreeConstant(value) {
+		if _, err := c.compute(value); err == nil {
+			return
+		}
+	}
+
+	c.note(node, fmt.Sprintf("%s is implicitly any, as the type of its value can't be deduced; cast it with as to check its type", name))
+}
+
+// checkShadowing note a variable declared in a scope which shadows one of an outer scope, in strict mode
+func (c *Compiler) checkShadowing(node Node, name string, scope Pos) {
+	if !c.strict {
+		return
+	}
+
+	for i := c.stack.Current - 1; i >= 0; i-- {
+		if v := c.stack.items[i]; v.name == name && v.scope < int(scope) {
+			c.note(node, fmt.Sprintf("%s shadows a variable of an outer scope", name))
+			return
+		}
+	}
+}
+
+// checkLastIf note a function which returns a value, but ends with an if without an else, so it returns nil when the
+// condition is false, in strict mode
+func (c *Compiler) checkLastIf(f *FunctionNode) {
+	block, ok := f.logic.(*BlockNode)
+	if !c.strict || !ok || len(block.statements) == 0 || !returnsValue(f) {
+		return
+	}
+
+	if last, ok := block.statements[len(block.statements)-1].(*ConditionalNode); ok && last.otherwise == nil {
+		c.note(last, fmt.Sprintf("%s only returns a value if the condition of its last if is true; add an else", f.name))
+	}
+}
+
+// returnsValue whether a function returns something other than nil anywhere
+func returnsValue(f *FunctionNode) bool {
+	returns := false
+	Walk(f.logic, func(node Node) bool {
+		switch n := node.(type) {
+		case *ReturnNode:
+			if n.value.Type() != NilNodeType {
+				returns = true
+			}
+		case *FunctionNode:
+			// returns of functions within the function are their own
+			return false
+		}
+
+		return true
+	})
+
+	return returns
+}
+
+// foldCall compute a call to a constant default builtin (see Builtin.Const) with constant arguments, such as
+// typeof(1). Calls which fail, or return values which can't be constants, are left to fail or return while executing.
+func (c *Compiler) foldCall(call *CallNode) (Value, bool) {
+	reference, ok := call.source.(*ReferenceNode)
+	if c.noFolding || !ok {
+		return nil, false
+	}
+
+	name := reference.name
+	builtin := c.profile.Builtins().Get(name)
+	if builtin == nil || !builtin.Const || c.isLocal(name) || c.declared[name] || c.globals[name] || c.isDefined(name) {
+		return nil, false
+	}
+
+	if builtin.Signature.Check(name, len(call.args)) != nil {
+		return nil, false
+	}
+
+	params := make(map[string]Value, len(call.args))
+	for i, arg := range call.args {
+		if !c.isTreeConstant(arg) {
+			return nil, false
+		}
+
+		v, err := c.compute(arg)
+		if err != nil {
+			return nil, false
+		}
+
+		params[builtin.Signature.Params[i]] = v
+	}
+
+	vm := NewVM(NewChunk(nil, nil), 1, 1)
+	defer vm.Close()
+
+	v, err := builtin.F(vm, nil, params)
+	if err != nil || !isConstantValue(v) {
+		return nil, false
+	}
+
+	return Freeze(v), true
+}
+
+// isConcatenationOf whether a value adds strings onto the variable with the name (name + "..." + ...)
+func (c *Compiler) isConcatenationOf(name string, value Node) bool {
+	binary, ok := value.(*BinaryNode)
+	if !ok || binary.BinaryOperation != BinaryAddition {
+		return false
+	}
+
+	// find the leftmost operand, and whether any operand is a string
+	hasString := false
+	left := Node(binary)
+	for {
+		b, ok := left.(*BinaryNode)
+		if !ok || b.BinaryOperation != BinaryAddition {
+			break
 		}
 
-	case ReturnNodeType:
-		err := c.Compile(tree.(*ReturnNode).value)
-		if err != nil {
-			return err
+		if b.Right.Type() == StringNodeType {
+			hasString = true
 		}
-		c.add(InstructionReturn)
 
-	case BreakpointNodeType:
-		c.add(InstructionBreakpoint)
+		left = b.Left
 	}
 
-	return nil
+	reference, ok := left.(*ReferenceNode)
+	return ok && reference.name == name && hasString
 }
 
-func (c *Compiler) compileBinary(binary *BinaryNode) error {
-	if c.isTreeConstant(binary) {
-		v, err := c.compute(binary)
-		if err != nil {
-			return err
+// collectDeclarations remember the names of all variables declared in a tree, including in the files it imports.
+// As variables are looked up when executed, a variable may be used before where it is declared in the source.
+func (c *Compiler) collectDeclarations(tree Node) {
+	Walk(tree, func(node Node) bool {
+		switch n := node.(type) {
+		case *AssignNode:
+			f, ok := n.value.(*FunctionNode)
+			if _, seen := c.functions[n.name]; ok && n.declare && !seen && !c.declared[n.name] {
+				c.functions[n.name] = f
+			} else {
+				c.functions[n.name] = nil
+			}
+
+			if n.declare {
+				c.declared[n.name] = true
+			}
+		case *DestructureNode:
+			for _, name := range n.names {
+				c.declared[name] = true
+				c.functions[name] = nil
+			}
+		case *ConstNode:
+			c.declared[n.name] = true
+			c.functions[n.name] = nil
+		case *GlobalNode:
+			c.declared[n.name] = true
+			c.functions[n.name] = nil
+		case *TypeNode:
+			name := n.signature.Name
+			if _, seen := c.functions[name]; !seen && !c.declared[name] {
+				c.functions[name] = n.constructor
+			} else {
+				c.functions[name] = nil
+			}
+
+			c.declared[name] = true
+			if _, seen := c.types[name]; !seen {
+				c.types[name] = n
+			}
+		case *FunctionNode:
+			for _, param := range n.params {
+				c.declared[param] = true
+				c.functions[param] = nil
+			}
+
+			for _, name := range freeNames(n) {
+				c.captured[name] = true
+			}
+		case *ImportNode:
+			if isBytecodeImport(n.path) {
+				// failing to load it is an error once the import is compiled
+				if chunk, err := c.resolveBytecode(n.path); err == nil {
+					c.collectExports(chunk.Exports)
+				}
+			} else if _, ok := StandardModules[n.path]; !ok && c.resolver != nil {
+				c.markImport(n)
+				c.collectDeclarations(c.resolveImport(n.path))
+			}
+		case *PragmaNode:
+			// known before anything is compiled, so every number of the program is the same
+			switch n.name {
+			case "decimal":
+				c.SetDecimal(true)
+			case "strict":
+				c.SetStrict(true)
+			}
 		}
 
-		c.add(InstructionConstant)
-		c.addConstant(v)
+		return true
+	})
+}
+
+// collectExports remember the names a precompiled program declares, as collectDeclarations does for source. Its
+// functions have no bodies, but their parameters are enough to check calls to them.
+func (c *Compiler) collectExports(exports []Export) {
+	for _, e := range exports {
+		if _, seen := c.functions[e.Name]; e.Function && !seen && !c.declared[e.Name] {
+			c.functions[e.Name] = &FunctionNode{e.Name, e.Params, nil, nil, &BlockNode{}}
+		} else {
+			c.functions[e.Name] = nil
+		}
+
+		c.declared[e.Name] = true
+	}
+}
+
+// exports get the names declared at the top level of a tree, including those of the files it imports, whose
+// statements are compiled into it. Main functions are left out, as they are when imported.
+func (c *Compiler) exports(tree Node) []Export {
+	block, ok := tree.(*BlockNode)
+	if !ok {
 		return nil
 	}
 
-	err := c.Compile(binary.Left)
+	var exports []Export
+	for _, statement := range block.statements {
+		switch n := statement.(type) {
+		case *AssignNode:
+			if !n.declare || n.name == MainFunction {
+				continue
+			}
+
+			if f, ok := n.value.(*FunctionNode); ok {
+				exports = append(exports, Export{n.name, false, true, f.params})
+			} else {
+				exports = append(exports, Export{n.name, false, false, nil})
+			}
+		case *DestructureNode:
+			for _, name := range n.names {
+				if name != "_" {
+					exports = append(exports, Export{name, false, false, nil})
+				}
+			}
+		case *ConstNode:
+			exports = append(exports, Export{n.name, false, false, nil})
+		case *GlobalNode:
+			exports = append(exports, Export{n.name, true, false, nil})
+		case *TypeNode:
+			exports = append(exports, Export{n.signature.Name, false, true, n.signature.Members})
+		case *ImportNode:
+			if isBytecodeImport(n.path) {
+				if chunk, err := c.resolveBytecode(n.path); err == nil {
+					exports = append(exports, chunk.Exports...)
+				}
+			} else if _, ok := StandardModules[n.path]; !ok && c.resolver != nil {
+				exports = append(exports, c.exports(c.resolveImport(n.path))...)
+			}
+		}
+	}
+
+	return exports
+}
+
+// comptime run a comptime block, getting the value it returns. The block is run like a function of its own, on a VM
+// of its own, so it can only use the globals of the profile and the defined constants, and what it prints is
+// discarded.
+func (c *Compiler) comptime(n *ComptimeNode) (Value, error) {
+	sub := NewCompiler()
+	sub.resolver, sub.imports, sub.bytecode = c.resolver, c.imports, c.bytecode
+	sub.positions, sub.defines, sub.noFolding = c.positions, c.defines, c.noFolding
+	sub.SetDecimal(c.decimal)
+	sub.warnAny, sub.strict = c.warnAny, c.strict
+	sub.files, sub.sources, sub.importedAt = c.files, c.sources, c.importedAt
+	sub.name, sub.file = c.name, c.file
+	sub.types, sub.profile = c.types, c.profile
+
+	err := sub.Compile(&FunctionNode{"comptime", nil, nil, nil, n.body})
+	c.notes = append(c.notes, sub.notes...)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	err = c.Compile(binary.Right)
+
+	vm := NewVM(sub.Chunk, 256, 256)
+	vm.SetProfile(c.profile)
+	vm.SetOutput(io.Discard)
+	defer vm.Close()
+
+	v, err := vm.Call(sub.Chunk.Constants[0], nil)
 	if err != nil {
-		return err
+		return nil, c.errorAt(n, fmt.Sprintf("comptime block failed: %v", err))
 	}
 
-	switch binary.BinaryOperation {
-	case BinaryAddition:
-		c.add(InstructionAdd)
-	case BinarySubtraction:
-		c.add(InstructionSub)
-	case BinaryMultiplication:
-		c.add(InstructionMul)
-	case BinaryDivision:
-		c.add(InstructionDiv)
-	case BinaryEquality:
-		c.add(InstructionEquals)
-	case BinaryInequality:
-		c.add(InstructionNotEqual)
-	case BinaryLess:
-		c.add(InstructionLess)
-	case BinaryGreater:
-		c.add(InstructionGreater)
-	case BinaryLessEqual:
-		c.add(InstructionLessOrEqual)
-	case BinaryGreaterEqual:
-		c.add(InstructionGreaterOrEqual)
-	case BinaryAnd:
-		c.add(InstructionAnd)
-	case BinaryOr:
-		c.add(InstructionOr)
+	if !isConstantValue(v) {
+		return nil, c.errorAt(n, fmt.Sprintf("comptime block returned %s, but only numbers, strings, booleans, nil, "+
+			"functions and lists of them can be compiled", v.DebugString()))
 	}
 
-	return nil
+	return Freeze(v), nil
 }
 
-func (c *Compiler) getVar(name string) {
-	if c.isGlobal(name) {
-		c.add(InstructionGetGlobal)
-		c.addConstant(&StringValue{
-			name,
-		})
-	} else {
-		c.add(InstructionGetLocal)
-		c.addConstant(&StringValue{
-			name,
-		})
+// isConstantValue check if a value can be a constant of a chunk
+func isConstantValue(value Value) bool {
+	switch v := value.(type) {
+	case *NumberValue, *StringValue, *BoolValue, *NilValue:
+		return true
+	case *FunctionValue:
+		return v.Parent == nil
+	case *ListValue:
+		for _, item := range v.items {
+			if !isConstantValue(item) {
+				return false
+			}
+		}
+
+		return true
 	}
+
+	return false
 }
 
-func (c *Compiler) setVar(name string, value Node, declare bool) error {
-	err := c.Compile(value)
-	if err != nil {
-		return err
+// note remark on a node of the program
+func (c *Compiler) note(node Node, description string) {
+	token := c.positions[node]
+	c.notes = append(c.notes, Note{description, token, c.files[token], c.importChain(c.files[token])})
+}
+
+// fileOf get the file a token is in, which is the name of the source being compiled unless it is of another file
+func (c *Compiler) fileOf(token *Token) string {
+	if file, ok := c.files[token]; ok {
+		return file
 	}
 
-	if declare {
-		c.add(InstructionDeclareLocal)
-		c.registerVar(name)
+	return c.name
+}
+
+// markImport remember where a file is first imported, at the import if it has a position or the line being compiled
+func (c *Compiler) markImport(n *ImportNode) {
+	if _, ok := c.importedAt[n.path]; ok {
+		return
+	}
+
+	if t, ok := c.positions[n]; ok {
+		c.importedAt[n.path] = Location{c.fileOf(t), t.Line}
 	} else {
-		c.add(InstructionSetLocal)
+		c.importedAt[n.path] = Location{c.file, c.line}
 	}
+}
 
-	c.addConstant(&StringValue{
-		name,
-	})
+// importChain get where a file was imported, from the innermost import out
+func (c *Compiler) importChain(file string) []Location {
+	var chain []Location
+	seen := map[string]bool{}
+	for !seen[file] {
+		seen[file] = true
 
-	return nil
+		at, ok := c.importedAt[file]
+		if !ok {
+			break
+		}
+
+		chain = append(chain, at)
+		file = at.File
+	}
+
+	return chain
 }
 
-// keep track that a variable is declared but doesn't necessarily have a deducible type
-func (c *Compiler) registerVar(name string) {
-	c.stack.Push(LocalVariable{
-		name,
-		int(c.scope),
-	})
+// reportExceeded fail compiling with the first limit the program exceeded, if it exceeded any, unless it already
+// failed. The compiler is left ready to compile more, as sessions do.
+func (c *Compiler) reportExceeded(err *error) {
+	if *err == nil && c.exceeded != nil {
+		*err = c.exceeded
+	}
+
+	c.exceeded = nil
 }
 
-// isLocal whether a variable of with the name provided is declared within the local scope
-func (c *Compiler) isLocal(name string) bool {
-	for i := c.stack.Current - 1; i >= 0; i-- {
-		if c.stack.items[i].name == name {
-			return true
-		}
+// noteError make a note an error, as notes are in strict mode
+func (c *Compiler) noteError(n Note) error {
+	description := "strict: " + n.Description
+	if n.Causer == nil {
+		return fmt.Errorf("%s", description)
+	} else if n.File != "" {
+		return &FileError{n.File, c.sources[n.File], &ParsingError{description, n.Causer}, n.Imported}
 	}
-	return false
+
+	return &ParsingError{description, n.Causer}
 }
 
-// isTreeConstant check if a node tree is constant (predictable)
-func (c *Compiler) isTreeConstant(tree Node) bool {
-	switch tree.Type() {
-	case StringNodeType, NumberNodeType, BooleanNodeType, NilNodeType:
-		return true
-	case ListNodeType:
-		for _, item := range tree.(*ListNode).items {
-			if !c.isTreeConstant(item) {
-				return false
-			}
-		}
+// Sources get the sources of the files the compiler parsed as they were imported, by their paths, for showing notes
+// about them (see Note.File)
+func (c *Compiler) Sources() map[string][]rune {
+	return c.sources
+}
 
-		return true
-	case BinaryNodeType:
-		return c.isTreeConstant(tree.(*BinaryNode).Left) && c.isTreeConstant(tree.(*BinaryNode).Right)
-	case BlockNodeType, ConditionalNodeType, LoopNodeType, AssignNodeType, CallNodeType, FunctionNodeType,
-		ReturnNodeType, AccessNodeType, BreakpointNodeType, ImportNodeType, ReferenceNodeType:
-		return false
-	default:
-		panic(fmt.Sprintf("unexpected node %s", tree))
-	}
+// Notes get the remarks made on the program while compiling it
+func (c *Compiler) Notes() []Note {
+	return c.notes
 }
 
-func (c *Compiler) compute(tree Node) (Value, error) {
-	switch n := tree.(type) {
-	case *StringNode:
-		return &StringValue{
-			n.value,
-		}, nil
+// isGlobal whether a variable is defined in the global environment of the profile, or declared as a global
+func (c *Compiler) isGlobal(name string) bool {
+	return c.profile.Builtins().Get(name) != nil || c.globals[name]
+}
 
-	case *NumberNode:
-		return &NumberValue{
-			n.value,
-		}, nil
+// Define set a constant which references to name are replaced with while compiling, unless the program declares a
+// variable of the same name. Conditions on defined constants are decided while compiling, only compiling the branch
+// which is taken, so a program can have code for some hosts only.
+func (c *Compiler) Define(name string, value Value) {
+	c.defines[name] = value
+}
 
-	case *BooleanNode:
-		return &BoolValue{
-			n.value,
-		}, nil
+// isDefined check if a name refers to a constant set with Define
+func (c *Compiler) isDefined(name string) bool {
+	_, ok := c.defines[name]
+	return ok && !c.isLocal(name) && !c.declared[name]
+}
 
-	case *NilNode:
-		return &NilValue{}, nil
+// resolveType get the name of a type which casts check values against, with the types declared with type written
+// out as the members of their objects (see shapeName), as the VM doesn't know the declarations
+func (c *Compiler) resolveType(name string) (string, error) {
+	return c.resolveTypeWithin(name, nil, 0)
+}
 
-	case *ListNode:
-		items := make([]Value, len(n.items))
-		var err error
-		for i, item := range n.items {
-			items[i], err = c.compute(item)
+// resolveTypeWithin resolve a type named by the members of the declared types it is within, which it can't be itself
+// unless one of the members between may be nil, from the one at index nillable on. Such types contain themselves
+// through members which may be nil (type Node { next: Node|nil }), which are only checked to be objects, as their
+// names would otherwise never end.
+func (c *Compiler) resolveTypeWithin(name string, within []string, nillable int) (string, error) {
+	if base, ok := strings.CutSuffix(name, "|nil"); ok {
+		resolved, err := c.resolveTypeWithin(base, within, len(within))
+		if err != nil {
+			return "", err
+		}
 
-			if err != nil {
-				return nil, err
-			}
+		return nullableKind(resolved), nil
+	}
+
+	for _, kind := range []string{"dict", "map"} {
+		key, of, ok := keyedType(name, kind)
+		if !ok {
+			continue
 		}
-		return &ListValue{
-			items,
-		}, nil
 
-	case *BinaryNode:
-		return c.computeBinary(n)
+		key, err := c.resolveTypeWithin(key, within, nillable)
+		if err != nil {
+			return "", err
+		}
 
-	default:
-		panic(fmt.Sprintf("unexpected node %s, %T", tree.String(), tree))
+		of, err = c.resolveTypeWithin(of, within, nillable)
+		if err != nil {
+			return "", err
+		}
+
+		return fmt.Sprintf("%s[%s]%s", kind, key, of), nil
 	}
-}
 
-func (c *Compiler) computeBinary(n *BinaryNode) (Value, error) {
-	l, err := c.compute(n.Left)
-	if err != nil {
-		return nil, err
+	if !IsDeclaredTypeName(name) {
+		return name, nil
 	}
-	r, err := c.compute(n.Right)
-	if err != nil {
-		return nil, err
+
+	t, ok := c.types[name]
+	if !ok {
+		return "", fmt.Errorf("unknown type %s", name)
+	} else if i := slices.Index(within, name); i >= nillable {
+		return "", fmt.Errorf("type %s contains itself, so its objects could never be made", name)
+	} else if i >= 0 {
+		return "object", nil
 	}
 
-	var v interface{}
-	switch n.BinaryOperation {
-	case BinaryAddition:
-		v = l.(*NumberValue).float64 + r.(*NumberValue).float64
-	case BinarySubtraction:
-		v = l.(*NumberValue).float64 - r.(*NumberValue).float64
-	case BinaryMultiplication:
-		v = l.(*NumberValue).float64 * r.(*NumberValue).float64
-	case BinaryDivision:
-		v = l.(*NumberValue).float64 / r.(*NumberValue).float64
-	case BinaryAnd:
-		v = l.(*BoolValue).bool && r.(*BoolValue).bool
-	case BinaryOr:
-		v = l.(*BoolValue).bool && r.(*BoolValue).bool
-	case BinaryEquality:
-		v = l.Equals(r)
-	case BinaryInequality:
-		v = !l.Equals(r.(*BoolValue))
-	case BinaryLess:
-		v = l.(*NumberValue).float64 < r.(*NumberValue).float64
-	case BinaryGreater:
-		v = l.(*NumberValue).float64 > r.(*NumberValue).float64
-	case BinaryLessEqual:
-		v = l.(*NumberValue).float64 <= r.(*NumberValue).float64
-	case BinaryGreaterEqual:
-		v = l.(*NumberValue).float64 >= r.(*NumberValue).float64
-	}
-
-	return GoToValue(v), nil
-}
-
-// isGlobal whether a variable is defined in the standard global environment
-func (c *Compiler) isGlobal(name string) bool {
-	return DefaultGlobals[name] != nil
+	types := make([]string, len(t.signature.Types))
+	for i, member := range t.signature.Types {
+		resolved, err := c.resolveTypeWithin(member, append(within, name), nillable)
+		if err != nil {
+			return "", err
+		}
+
+		types[i] = resolved
+	}
+
+	return shapeName(name, t.signature.Members, types), nil
+}
+
+// DeclareGlobal let the compiler know a global with the name will be set on the VM before running, such as a host
+// provided function
+func (c *Compiler) DeclareGlobal(name string) {
+	c.globals[name] = true
 }
 
 func (c *Compiler) ascend() {
@@ -551,6 +2549,32 @@ func (c *Compiler) resolveImport(path string) Node {
 		return chunk
 	}
 
+	if resolver, ok := c.resolver.(SourceResolver); ok {
+		src, err := resolver.ResolveSource(path)
+		if err != nil {
+			panic(err)
+		}
+
+		tree, positions, err := parse(src)
+		if err != nil {
+			panic(&FileError{path, []rune(src), err, c.importChain(path)})
+		}
+
+		if c.positions == nil {
+			c.positions = Positions{}
+		}
+
+		for node, token := range positions {
+			c.positions[node] = token
+			c.files[token] = path
+		}
+
+		c.sources[path] = []rune(src)
+		c.imports[path] = tree
+
+		return tree
+	}
+
 	// find tree
 	tree, err := c.resolver.Resolve(path)
 	if err != nil {
@@ -562,10 +2586,123 @@ func (c *Compiler) resolveImport(path string) Node {
 	return tree
 }
 
+// resolveBytecode load a precompiled program which is imported, verifying its bytecode
+func (c *Compiler) resolveBytecode(path string) (*Chunk, error) {
+	if chunk, ok := c.bytecode[path]; ok {
+		return chunk, nil
+	}
+
+	resolver, ok := c.resolver.(BytecodeResolver)
+	if !ok {
+		return nil, fmt.Errorf("cannot import %s, as compiled programs can't be imported", path)
+	}
+
+	b, err := resolver.ResolveBytecode(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot import %s: %w", path, err)
+	}
+
+	program, err := LoadProgram(b)
+	if err != nil {
+		return nil, fmt.Errorf("cannot import %s: %w", path, err)
+	}
+
+	c.bytecode[path] = program.chunk
+	return program.chunk, nil
+}
+
+// importBytecode compile an import of a precompiled program. The program is run as a function of its own, returning
+// the values of the variables it declares, which are then declared where it is imported, as they would be had it been
+// imported from source. Its globals are set by the program itself.
+func (c *Compiler) importBytecode(path string) error {
+	chunk, err := c.resolveBytecode(path)
+	if err != nil {
+		return err
+	}
+
+	var locals []string
+	for _, e := range chunk.Exports {
+		if e.Global {
+			c.DeclareGlobal(e.Name)
+		} else {
+			locals = append(locals, e.Name)
+		}
+	}
+
+	mc, mip := c.Chunk, c.ip
+
+	// the program is copied, as other imports of it get the same chunk
+	c.Chunk = &Chunk{
+		append([]Bytecode{}, chunk.Bytecode...),
+		append([]Value{}, chunk.Constants...),
+		append([]Pos{}, chunk.Lines...),
+		append([]string{}, chunk.Files...),
+		chunk.Decimal,
+		chunk.Strict,
+		nil,
+	}
+	c.ip = Pos(len(chunk.Bytecode))
+
+	for _, name := range locals {
+		c.add(InstructionGetLocal)
+		c.addConstant(&StringValue{name})
+	}
+
+	if len(locals) == 0 {
+		c.add(InstructionNil)
+	} else {
+		c.add(InstructionFormList)
+		c.addU16(c.u16(Pos(len(locals)-1), "the number of variables of the module"))
+	}
+	c.add(InstructionReturn)
+
+	if len(c.Chunk.Constants) > maxConstants {
+		return fmt.Errorf("cannot import %s, as it has too many constants", path)
+	}
+
+	module := &FunctionValue{path, nil, c.Chunk, nil, nil}
+	c.Chunk, c.ip = mc, mip
+
+	c.add(InstructionConstant)
+	c.addConstant(module)
+	c.add(InstructionCall)
+	c.add(0)
+
+	if len(locals) == 0 {
+		c.add(InstructionPop)
+		return nil
+	}
+
+	// the values are kept in a variable no program can name, while they are declared
+	values := "import " + path
+	c.add(InstructionDeclareLocal)
+	c.registerVar(values)
+	c.addConstant(&StringValue{values})
+
+	for i, name := range locals {
+		c.add(InstructionGetLocal)
+		c.addConstant(&StringValue{values})
+		c.add(InstructionConstant)
+		c.addConstant(&NumberValue{float64(i), nil})
+		c.add(InstructionIndex)
+
+		c.add(InstructionDeclareLocal)
+		c.registerVar(name)
+		c.addConstant(&StringValue{name})
+	}
+
+	return nil
+}
+
 func (c *Compiler) SetImportsResolver(resolver ImportsResolver) {
 	c.resolver = resolver
 }
 
+// SetPositions set where the nodes of the tree are found in the source, so the bytecode can be mapped back to lines
+func (c *Compiler) SetPositions(positions Positions) {
+	c.positions = positions
+}
+
 func (c *Compiler) advance(amount Pos) {
 	c.ip += amount
 }
@@ -1,7 +1,12 @@
 package core
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
+	"io"
+	"math/rand"
+	"strings"
 	"testing"
 )
 
@@ -34,6 +39,53 @@ type CompileTestData struct {
 
 func GetCompileTestData() map[string]CompileTestData {
 	return map[string]CompileTestData{
+		"string_concatenation": {
+			&BinaryNode{
+				BinaryAddition,
+				&StringNode{"a", "\"a\""},
+				&CallNode{
+					&ReferenceNode{"typeof"},
+					[]Node{&NilNode{}},
+					true,
+				},
+			},
+			[]Value{
+				&StringValue{"anil"},
+			},
+		},
+		"constant_inequality": {
+			&BinaryNode{
+				BinaryInequality,
+				&NumberNode{1},
+				&NumberNode{2},
+			},
+			[]Value{
+				&BoolValue{true},
+			},
+		},
+		"constant_or": {
+			&BinaryNode{
+				BinaryOr,
+				&BooleanNode{true},
+				&BooleanNode{false},
+			},
+			[]Value{
+				&BoolValue{true},
+			},
+		},
+		"cast_typeof": {
+			&CastNode{
+				&CallNode{
+					&ReferenceNode{"typeof"},
+					[]Node{&NumberNode{1}},
+					true,
+				},
+				"string",
+			},
+			[]Value{
+				&StringValue{"number"},
+			},
+		},
 		"constant_string": {
 			&StringNode{
 				"Hello world!",
@@ -75,8 +127,9 @@ func GetCompileTestData() map[string]CompileTestData {
 			[]Value{
 				&VariableValue{
 					"a",
-					&NumberValue{0},
+					&NumberValue{0, nil},
 					0,
+					nil,
 				},
 			},
 		},
@@ -112,8 +165,9 @@ func GetCompileTestData() map[string]CompileTestData {
 			[]Value{
 				&VariableValue{
 					"a",
-					&NumberValue{1},
+					&NumberValue{1, nil},
 					0,
+					nil,
 				},
 			},
 		},
@@ -159,8 +213,9 @@ func GetCompileTestData() map[string]CompileTestData {
 			[]Value{
 				&VariableValue{
 					"a",
-					&NumberValue{2},
+					&NumberValue{2, nil},
 					0,
+					nil,
 				},
 			},
 		},
@@ -206,8 +261,9 @@ func GetCompileTestData() map[string]CompileTestData {
 			[]Value{
 				&VariableValue{
 					"a",
-					&NumberValue{1},
+					&NumberValue{1, nil},
 					0,
+					nil,
 				},
 			},
 		},
@@ -222,7 +278,7 @@ func GetCompileTestData() map[string]CompileTestData {
 				},
 			},
 			[]Value{
-				&NumberValue{3},
+				&NumberValue{3, nil},
 			},
 		},
 		"sum_function": {&BlockNode{
@@ -232,6 +288,8 @@ func GetCompileTestData() map[string]CompileTestData {
 					&FunctionNode{
 						"sum",
 						[]string{"a", "b"},
+						nil,
+						nil,
 						&BlockNode{
 							[]Node{
 								&ReturnNode{
@@ -263,14 +321,18 @@ func GetCompileTestData() map[string]CompileTestData {
 								InstructionAdd,
 								InstructionReturn,
 								InstructionAscend,
+								InstructionNil,
+								InstructionReturn,
 							},
 							[]Value{
 								&StringValue{"a"}, &StringValue{"b"},
 							},
 						),
 						nil,
+						nil,
 					},
 					0,
+					nil,
 				},
 			},
 		},
@@ -282,6 +344,8 @@ func GetCompileTestData() map[string]CompileTestData {
 						&FunctionNode{
 							"a",
 							[]string{},
+							nil,
+							nil,
 							&BlockNode{
 								[]Node{
 									&AssignNode{
@@ -320,14 +384,18 @@ func GetCompileTestData() map[string]CompileTestData {
 								InstructionGetLocal, 1,
 								InstructionReturn,
 								InstructionAscend,
+								InstructionNil,
+								InstructionReturn,
 							},
 							[]Value{
-								&NumberValue{1}, &StringValue{"b"},
+								&NumberValue{1, nil}, &StringValue{"b"},
 							},
 						),
 						nil,
+						nil,
 					},
 					0,
+					nil,
 				},
 			},
 		},
@@ -419,7 +487,8 @@ func TestCompiler_CleanStack(t *testing.T) {
 	for name, tc := range cases {
 		switch tc.tree.Type() {
 		// skip all expected unclean nodes
-		case StringNodeType, NumberNodeType, ReferenceNodeType, BooleanNodeType, NilNodeType, BinaryNodeType, ReturnNodeType:
+		case StringNodeType, NumberNodeType, ReferenceNodeType, BooleanNodeType, NilNodeType, BinaryNodeType, ReturnNodeType,
+			CastNodeType:
 			continue
 
 		case CallNodeType:
@@ -454,3 +523,1203 @@ func TestCompiler_CleanStack(t *testing.T) {
 		})
 	}
 }
+
+func TestCompiler_Lines(t *testing.T) {
+	tokens, err := NewLexer("a := 1\n\nwrite(a)").Tokenize()
+	if err != nil {
+		t.Fatalf("Unexpected error tokenizing: %v", err)
+	}
+
+	p := NewParser(tokens)
+	tree, err := p.Parse()
+	if err != nil {
+		t.Fatalf("Unexpected error(s): %s", err)
+	}
+
+	c := NewCompiler()
+	c.SetPositions(p.Positions())
+	if err := c.Compile(tree); err != nil {
+		t.Fatalf("Compiling failed: %v", err)
+	}
+
+	printChunk(t, "lines", c.Chunk)
+
+	if len(c.Chunk.Lines) != len(c.Chunk.Bytecode) {
+		t.Fatalf("got %d lines for %d bytes of bytecode", len(c.Chunk.Lines), len(c.Chunk.Bytecode))
+	}
+
+	for i := 0; i < len(c.Chunk.Bytecode); i += operands(c.Chunk.Bytecode[i]).width() + 1 {
+		b := c.Chunk.Bytecode[i]
+		want := Pos(0)
+		if b == InstructionCall || b == InstructionGetGlobal {
+			want = 2
+		}
+
+		if b == InstructionCall || b == InstructionDeclareLocal || b == InstructionGetGlobal {
+			if c.Chunk.Lines[i] != want {
+				t.Errorf("i=%d (%s) is on line %d; want %d", i, b, c.Chunk.Lines[i], want)
+			}
+		}
+	}
+}
+
+func TestCompiler_DeclareGlobal(t *testing.T) {
+	c := NewCompiler()
+	c.DeclareGlobal("host")
+
+	err := c.Compile(&ReferenceNode{"host"})
+	if err != nil {
+		t.Fatalf("Compiling failed: %v", err)
+	}
+
+	if c.Chunk.Bytecode[0] != InstructionGetGlobal {
+		t.Errorf("got %s; want a global to be read", c.Chunk.Bytecode[0])
+	}
+}
+
+func TestCompiler_ConstantCast(t *testing.T) {
+	c := NewCompiler()
+
+	err := c.Compile(&CastNode{&NumberNode{1}, "string"})
+	if err == nil {
+		t.Errorf("Expected casting a constant number to a string to fail")
+	}
+
+	err = c.Compile(&CastNode{&NumberNode{1}, "any"})
+	if err != nil {
+		t.Errorf("Expected casting a constant to any to succeed, got %v", err)
+	}
+}
+
+func TestCompiler_Notes(t *testing.T) {
+	cases := map[string]int{
+		"s := \"\"\nwhile true { s = s + \"a\" }":                 1,
+		"s := \"\"\ns = s + \"a\"":                                0,
+		"i := 0\nwhile true { i = i + 1 }":                        0,
+		"s := \"\"\nwhile true { f := func() { s = s + \"a\" } }": 0,
+	}
+
+	for src, expected := range cases {
+		tokens, err := NewLexer(src).Tokenize()
+		if err != nil {
+			t.Fatalf("Unexpected error tokenizing: %v", err)
+		}
+
+		p := NewParser(tokens)
+		tree, err := p.Parse()
+		if err != nil {
+			t.Fatalf("Unexpected error parsing: %v", err)
+		}
+
+		c := NewCompiler()
+		c.SetPositions(p.Positions())
+		if err := c.Compile(tree); err != nil {
+			t.Fatalf("Unexpected error compiling: %v", err)
+		}
+
+		if len(c.Notes()) != expected {
+			t.Errorf("expected %d notes for %q, got %v", expected, src, c.Notes())
+		}
+
+		for _, n := range c.Notes() {
+			if n.Causer == nil {
+				t.Errorf("expected note %q to have a position", n.Description)
+			}
+		}
+	}
+}
+
+func TestCompiler_UndeclaredNotes(t *testing.T) {
+	cases := map[string]int{
+		"write(x)": 1,
+		"func f() { return x }\nx := 1\ndiscard f()": 0,
+		"func fib(n) { return fib(n - 1) }":          0,
+		"import \"std/test\"\nassertTrue(true)":      0,
+		"write(typeof(1))":                           0,
+	}
+
+	for src, expected := range cases {
+		tokens, err := NewLexer(src).Tokenize()
+		if err != nil {
+			t.Fatalf("Unexpected error tokenizing: %v", err)
+		}
+
+		tree, err := NewParser(tokens).Parse()
+		if err != nil {
+			t.Fatalf("Unexpected error parsing: %v", err)
+		}
+
+		c := NewCompiler()
+		if err := c.Compile(tree); err != nil {
+			t.Fatalf("Unexpected error compiling: %v", err)
+		}
+
+		if len(c.Notes()) != expected {
+			t.Errorf("expected %d notes for %q, got %v", expected, src, c.Notes())
+		}
+	}
+}
+
+func TestCompiler_ImplicitAnyNotes(t *testing.T) {
+	cases := map[string]int{
+		"x := [1, 2].at(0)":                  1,
+		"x := [1, 2].at(0) as number":        0,
+		"x := 1 + 2":                         0,
+		"x := \"a\"\ny := x":                 0,
+		"global g := typeof(1)":              1,
+		"func f(a) { b := a\nreturn b }":     1,
+		"f := func() { return 1 }\nx := f()": 1,
+	}
+
+	for src, expected := range cases {
+		program, err := Compile(src, CompileOptions{WarnImplicitAny: true})
+		if err != nil {
+			t.Fatalf("Unexpected error compiling %q: %v", src, err)
+		}
+
+		if len(program.Notes()) != expected {
+			t.Errorf("expected %d notes for %q, got %v", expected, src, program.Notes())
+		}
+
+		// only noted when asked for
+		if program, _ := Compile(src, CompileOptions{}); len(program.Notes()) != 0 {
+			t.Errorf("expected no notes for %q without warning of implicit any, got %v", src, program.Notes())
+		}
+	}
+}
+
+func TestCompiler_Strict(t *testing.T) {
+	failing := map[string]string{
+		"x := [1].at(0)": "implicitly any",
+		"x := 1\nfunc f() {\n\tx := 2\n\treturn x\n}": "x shadows a variable",
+		"x := 1\nfunc f(x) { return x }":              "x shadows a variable",
+		"func f(a) {\n\tif a { return 1 }\n}":         "add an else",
+		"s := \"\"\nwhile true { s = s + \"a\" }":     "concatenated to in a loop",
+	}
+
+	for src, expected := range failing {
+		for _, strict := range []string{"#pragma strict\n", ""} {
+			_, err := Compile(strict+src, CompileOptions{Strict: strict == ""})
+			if err == nil || !strings.Contains(err.Error(), expected) {
+				t.Errorf("Expected %q to fail compiling in strict mode with %q, got %v", src, expected, err)
+			}
+		}
+
+		if _, err := Compile(src, CompileOptions{}); err != nil {
+			t.Errorf("Expected %q to compile outside of strict mode, got %v", src, err)
+		}
+	}
+
+	program, err := Compile("#pragma strict\nx := 1\nfunc f(a) {\n\tif a { return 1 }\n\treturn x\n}\nprint(f(false))", CompileOptions{})
+	if err != nil {
+		t.Fatalf("Unexpected error compiling in strict mode: %v", err)
+	}
+
+	if !program.Strict() {
+		t.Errorf("Expected the program to be strict")
+	}
+
+	loaded, err := LoadProgram(program.Serialize())
+	if err != nil || !loaded.Strict() {
+		t.Errorf("Expected loaded programs to stay strict, got %v", err)
+	}
+}
+
+func TestCompiler_Global(t *testing.T) {
+	vm := runSource(t, "func f() {\n\tglobal count := 1\n\treturn nil\n}\nf()\n"+
+		"func g() {\n\tcount = count + 1\n\treturn nil\n}\ng()\nx := count")
+
+	if vm.Error() != nil {
+		t.Fatalf("Unexpected error: %s", vm.Error().Format())
+	}
+
+	CompareValues(t, vm.GetGlobal("count"), &NumberValue{2, nil})
+	CompareValues(t, vm.getVar("x").value, &NumberValue{2, nil})
+
+	if NewVM(NewChunk(nil, nil), 256, 256).GetGlobal("count") != nil {
+		t.Errorf("Expected globals to not be shared between VMs")
+	}
+}
+
+// mapResolver resolves imports to the parsed source of the path in the map
+type mapResolver map[string]string
+
+func (r mapResolver) Resolve(path string) (Node, error) {
+	tokens, err := NewLexer(r[path]).Tokenize()
+	if err != nil {
+		return nil, err
+	}
+
+	return NewParser(tokens).Parse()
+}
+
+// sourceResolver resolves imports to the source of the path in the map, for the compiler to parse
+type sourceResolver map[string]string
+
+func (r sourceResolver) Resolve(path string) (Node, error) {
+	return mapResolver(r).Resolve(path)
+}
+
+func (r sourceResolver) ResolveSource(path string) (string, error) {
+	src, ok := r[path]
+	if !ok {
+		return "", errors.New("no such file")
+	}
+
+	return src, nil
+}
+
+func TestCompiler_ImportedSources(t *testing.T) {
+	resolver := sourceResolver{
+		"lib":    "import \"nested\"\nfunc f() { return 1 }",
+		"nested": "x := 1\ny := \"a\" as number",
+		"notes":  "s := \"\"\nwhile true { s = s + \"a\" }",
+		"strict": "\n\nz := [1].at(0)",
+	}
+
+	_, err := Compile("import \"lib\"\nprint(1)", CompileOptions{Imports: resolver})
+	var file *FileError
+	if !errors.As(err, &file) || file.File != "lib" {
+		t.Fatalf("Expected an error in lib, got %v", err)
+	}
+
+	if formatted := FormatError(err, nil); !strings.Contains(formatted, "in nested:2\n\timported at lib:1\n\timported at line 1\n") {
+		t.Errorf("Expected the error to be shown within nested within lib, got %q", formatted)
+	}
+
+	program, err := Compile("import \"notes\"\nprint(1)", CompileOptions{Imports: resolver})
+	if err != nil {
+		t.Fatalf("Unexpected error compiling: %v", err)
+	}
+
+	if notes := program.Notes(); len(notes) != 1 || notes[0].File != "notes" {
+		t.Fatalf("Expected a note about notes, got %v", notes)
+	}
+
+	if formatted := program.Notes()[0].Format(program.ImportedSource("notes")); !strings.Contains(formatted, "while true") {
+		t.Errorf("Expected the note to show the source of notes, got %q", formatted)
+	}
+
+	_, err = Compile("import \"strict\"\nprint(1)", CompileOptions{Imports: resolver, Strict: true})
+	if formatted := FormatError(err, nil); !strings.Contains(formatted, "in strict:") || !strings.Contains(formatted, "3:1") {
+		t.Errorf("Expected the error to be shown in strict on its line, got %q", formatted)
+	}
+}
+
+func TestCompiler_ImportLocations(t *testing.T) {
+	resolver := sourceResolver{
+		"lib":    "import \"nested\"\nfunc twice(x) {\n\treturn fail(x) + fail(x)\n}",
+		"nested": "func fail(x) {\n\treturn [].at(x)\n}\n\nz := [1].at(0)",
+	}
+
+	program, err := Compile("\nimport \"lib\"\ndiscard twice(1)", CompileOptions{Imports: resolver, FileName: "main.ang", WarnImplicitAny: true})
+	if err != nil {
+		t.Fatalf("Unexpected error compiling: %v", err)
+	}
+
+	notes := program.Notes()
+	if len(notes) != 1 {
+		t.Fatalf("Expected a note about nested, got %v", notes)
+	}
+
+	formatted := notes[0].Format(program.ImportedSource(notes[0].File))
+	if !strings.HasPrefix(formatted, "in nested:5\n\timported at lib:1\n\timported at main.ang:2\n") {
+		t.Errorf("Expected the note to show where nested was imported, got %q", formatted)
+	}
+
+	_, err = program.Run(RunOptions{})
+	e, ok := err.(*ErrorValue)
+	if !ok {
+		t.Fatalf("Expected the execution to fail, got %v", err)
+	}
+
+	expected := []string{"at fail (nested:2)", "at twice (lib:3)", "at main (main.ang:3)"}
+	if len(e.Trace) != len(expected) {
+		t.Fatalf("Expected trace %v, got %v", expected, e.Trace)
+	}
+
+	for i, frame := range expected {
+		if e.Trace[i].String() != frame {
+			t.Errorf("Expected frame %d to be %s, got %s", i, frame, e.Trace[i])
+		}
+	}
+
+	if formatted := program.FormatError(err); !strings.Contains(formatted, "at fail (nested:2)\n\t   2 | return [].at(x)\n") {
+		t.Errorf("Expected the error to show the line of nested it happened at, got:\n%s", formatted)
+	}
+}
+
+func TestCompiler_ImportedMain(t *testing.T) {
+	tokens, err := NewLexer("import \"lib\"\nfunc main() {\n\treturn double(2)\n}").Tokenize()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tree, err := NewParser(tokens).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := NewCompiler()
+	c.SetImportsResolver(mapResolver{
+		"lib": "func double(x) {\n\treturn x * 2\n}\nfunc main() {\n\treturn \"demo\"\n}",
+	})
+
+	if err := c.Compile(tree); err != nil {
+		t.Fatal(err)
+	}
+
+	vm := NewVM(c.Chunk, 256, 256)
+	for vm.Next() {
+	}
+
+	result, err := vm.Call(vm.Variable(MainFunction), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	CompareValues(t, result, &NumberValue{4, nil})
+}
+
+// bytecodeResolver resolves imports of precompiled programs to the bytecode of the path in the map
+type bytecodeResolver map[string][]byte
+
+func (r bytecodeResolver) Resolve(path string) (Node, error) {
+	return nil, errors.New("only precompiled programs can be imported")
+}
+
+func (r bytecodeResolver) ResolveBytecode(path string) ([]byte, error) {
+	b, ok := r[path]
+	if !ok {
+		return nil, errors.New("no such program")
+	}
+
+	return b, nil
+}
+
+func TestCompiler_BytecodeImport(t *testing.T) {
+	lib, err := Compile(`func double(x) {
+	return x * factor
+}
+
+factor := 2
+global calls := 0
+
+func count() {
+	calls = calls + 1
+	return calls
+}
+
+func main() {
+	return "demo"
+}`, CompileOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resolver := bytecodeResolver{"lib.angc": lib.Serialize()}
+	program, err := Compile(`import "lib.angc"
+
+x := double(21)
+discard count()
+y := calls`, CompileOptions{Imports: resolver})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	vm := program.NewVM(RunOptions{})
+	for vm.Next() {
+	}
+
+	if vm.Error() != nil {
+		t.Fatalf("Unexpected error: %s", vm.Error().Format())
+	}
+
+	CompareValues(t, vm.Variable("x"), NewNumber(42))
+	CompareValues(t, vm.Variable("y"), NewNumber(1))
+
+	// the main function of the precompiled program isn't declared
+	if vm.Variable(MainFunction) != nil {
+		t.Errorf("Expected the main function of the imported program to be left out")
+	}
+
+	// calls are checked against the signatures the program exports
+	for src, expected := range map[string]string{
+		"import \"lib.angc\"\ndiscard double(1, 2)": "double takes 1 arguments, got 2",
+		"import \"other.angc\"":                     "cannot import other.angc",
+	} {
+		if _, err := Compile(src, CompileOptions{Imports: resolver}); err == nil || !strings.Contains(err.Error(), expected) {
+			t.Errorf("Expected %q to fail compiling with %q, got %v", src, expected, err)
+		}
+	}
+
+	resolver["broken.angc"] = []byte("not bytecode")
+	if _, err := Compile("import \"broken.angc\"", CompileOptions{Imports: resolver}); err == nil {
+		t.Errorf("Expected importing invalid bytecode to fail")
+	}
+}
+
+func TestCompiler_ImplicitReturn(t *testing.T) {
+	vm := runSource(t, "func f() {\n\ta := 1\n}\nx := f()\ny := 2")
+
+	if vm.Error() != nil {
+		t.Fatalf("Unexpected error: %s", vm.Error().Format())
+	}
+
+	CompareValues(t, vm.Variable("x"), &NilValue{})
+	CompareValues(t, vm.Variable("y"), &NumberValue{2, nil})
+}
+
+// randomExpression generate the source of a random constant expression, of about the depth given
+func randomExpression(r *rand.Rand, depth int) string {
+	if depth <= 0 || r.Intn(4) == 0 {
+		switch r.Intn(6) {
+		case 0:
+			return fmt.Sprint(r.Intn(10))
+		case 1:
+			return fmt.Sprintf("%d.%d", r.Intn(10), r.Intn(10))
+		case 2:
+			return []string{`"a"`, `"b"`, `""`}[r.Intn(3)]
+		case 3:
+			return []string{"true", "false"}[r.Intn(2)]
+		case 4:
+			return "nil"
+		case 5:
+			return fmt.Sprintf("[%s, %s]", randomExpression(r, depth-1), randomExpression(r, depth-1))
+		}
+	}
+
+	operators := []string{"+", "-", "*", "/", "==", "!=", "<", ">", "<=", ">=", "&&", "||"}
+	return fmt.Sprintf("(%s %s %s)", randomExpression(r, depth-1), operators[r.Intn(len(operators))], randomExpression(r, depth-1))
+}
+
+// evaluate compile and run a program assigning an expression to result, giving the result or the error it failed
+// with (whether when compiling or running)
+func evaluate(t *testing.T, expression string, fold bool) string {
+	tokens, err := NewLexer("result := " + expression).Tokenize()
+	if err != nil {
+		t.Fatalf("unexpected error lexing %s: %v", expression, err)
+	}
+
+	p := NewParser(tokens)
+	tree, err := p.Parse()
+	if err != nil {
+		t.Fatalf("unexpected error parsing %s: %v", expression, err)
+	}
+
+	c := NewCompiler()
+	c.SetFolding(fold)
+	if err := c.Compile(tree); err != nil {
+		return "error: " + err.Error()
+	}
+
+	vm := NewVM(c.Chunk, 256, 256)
+	for vm.Next() {
+	}
+
+	if err := vm.Error(); err != nil {
+		return "error: " + err.Message
+	}
+
+	return vm.Variable("result").DebugString()
+}
+
+// TestCompiler_FoldingMatchesVM expressions computed by the compiler must result in what the VM would have executed
+func TestCompiler_FoldingMatchesVM(t *testing.T) {
+	r := rand.New(rand.NewSource(219))
+
+	for i := 0; i < 1000; i++ {
+		expression := randomExpression(r, 4)
+
+		folded := evaluate(t, expression, true)
+		executed := evaluate(t, expression, false)
+
+		if folded != executed {
+			t.Errorf("%s is %s when folded, but %s when executed", expression, folded, executed)
+		}
+	}
+}
+
+// instructions get the instructions of a chunk, without their operands
+func instructions(chunk *Chunk) []Bytecode {
+	var result []Bytecode
+	for i := 0; i < len(chunk.Bytecode); i += operands(chunk.Bytecode[i]).width() + 1 {
+		result = append(result, chunk.Bytecode[i])
+	}
+
+	return result
+}
+
+func TestCompiler_Define(t *testing.T) {
+	src := "if wasm {\n\tplatform := \"browser\"\n\tprint(platform)\n} else {\n\tprint(\"terminal\")\n}\n" +
+		"if level > 1 {\n\tprint(\" verbose\")\n}"
+
+	for _, wasm := range []bool{true, false} {
+		program, err := Compile(src, CompileOptions{Defines: map[string]Value{"wasm": NewBool(wasm), "level": NewNumber(2)}})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(program.Notes()) != 0 {
+			t.Errorf("Expected defined constants to be known, got notes %v", program.Notes())
+		}
+
+		for _, b := range instructions(program.Chunk()) {
+			if b == InstructionJumpFalse {
+				t.Errorf("Expected conditions on defined constants to be decided while compiling")
+			}
+		}
+
+		out := strings.Builder{}
+		if _, err := program.Run(RunOptions{Output: &out}); err != nil {
+			t.Fatal(err)
+		}
+
+		want := "terminal verbose"
+		if wasm {
+			want = "browser verbose"
+		}
+
+		if out.String() != want {
+			t.Errorf("Expected %q with wasm = %v, got %q", want, wasm, out.String())
+		}
+	}
+
+	// variables of the program take precedence over defined constants
+	program, err := Compile("wasm := false\nx := wasm", CompileOptions{Defines: map[string]Value{"wasm": NewBool(true)}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	vm := program.NewVM(RunOptions{})
+	for vm.Next() {
+	}
+
+	CompareValues(t, vm.Variable("x"), NewBool(false))
+}
+
+func TestCompiler_Comptime(t *testing.T) {
+	program, err := Compile(`
+squares := comptime {
+	t := []
+	i := 0
+	while i < 5 {
+		t.append(i * i)
+		i = i + 1
+	}
+	return t
+}
+double := comptime {
+	print("only while compiling")
+	return func(x) {
+		return x * 2
+	}
+}
+x := squares.at(3) + double(4)
+`, CompileOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, b := range instructions(program.Chunk()) {
+		if b == InstructionLoop {
+			t.Errorf("Expected the loop of the comptime block to not be compiled into the program")
+		}
+	}
+
+	out := strings.Builder{}
+	vm := program.NewVM(RunOptions{Output: &out})
+	for vm.Next() {
+	}
+
+	if vm.Error() != nil {
+		t.Fatalf("Unexpected error: %s", vm.Error().Format())
+	}
+
+	CompareValues(t, vm.Variable("x"), NewNumber(17))
+	if out.Len() != 0 {
+		t.Errorf("Expected comptime blocks to print nothing when the program runs, got %q", out.String())
+	}
+
+	for src, want := range map[string]string{
+		"x := comptime {\n\treturn [].at(1)\n}":     "comptime block failed",
+		"x := comptime {\n\treturn newDeque([])\n}": "only numbers, strings, booleans, nil, functions and lists",
+	} {
+		if _, err := Compile(src, CompileOptions{}); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("Expected compiling %q to fail with %q, got %v", src, want, err)
+		}
+	}
+}
+
+func TestCompiler_JoinsStrings(t *testing.T) {
+	// w is left as it is, as x could be an object overloading add
+	src := "x := \"x\"\ny := \"x\" + x + \"a\" + \"b\" + x + \"c\" + (\"d\" + \"e\") + \"f\"\nz := \"a\" + \"b\" + x\n" +
+		"w := x + \"a\" + \"b\""
+
+	adds := map[bool]int{}
+	for _, fold := range []bool{true, false} {
+		program, err := Compile(src, CompileOptions{NoFolding: !fold})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, b := range instructions(program.Chunk()) {
+			if b == InstructionAdd {
+				adds[fold]++
+			}
+		}
+
+		vm := program.NewVM(RunOptions{})
+		for vm.Next() {
+		}
+
+		if vm.Error() != nil {
+			t.Fatalf("Unexpected error: %s", vm.Error().Format())
+		}
+
+		CompareValues(t, vm.Variable("y"), &StringValue{"xxabxcdef"})
+		CompareValues(t, vm.Variable("z"), &StringValue{"abx"})
+		CompareValues(t, vm.Variable("w"), &StringValue{"xab"})
+	}
+
+	if adds[true] != 7 || adds[false] != 12 {
+		t.Errorf("Expected joining strings to leave 7 of 12 additions, got %d of %d", adds[true], adds[false])
+	}
+
+	// adding a string to anything but a string fails the same either way
+	program, err := Compile("n := 1\nx := n + \"a\" + \"b\"", CompileOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := program.Run(RunOptions{}); err == nil || !strings.Contains(err.Error(), "cannot add number and string") {
+		t.Errorf("Expected adding a string to a number to fail, got %v", err)
+	}
+}
+
+func TestCompiler_Discard(t *testing.T) {
+	cases := map[string]int{
+		"func f() { return 1 }\nf()":                     1,
+		"func f() { return 1 }\ndiscard f()":             0,
+		"func f() { return 1 }\n_ = f()":                 0,
+		"func f() { write(1) }\nf()":                     0,
+		"typeof(1)":                                      1,
+		"write(1)":                                       0,
+		"b := newBuilder()\nb.add(\"a\").length()":       0,
+		"func f() {\n\tg := func() { return 1 }\n}\nf()": 0,
+	}
+
+	for src, expected := range cases {
+		program, err := Compile(src, CompileOptions{})
+		if err != nil {
+			t.Fatalf("Unexpected error compiling %q: %v", src, err)
+		}
+
+		if len(program.Notes()) != expected {
+			t.Errorf("expected %d notes for %q, got %v", expected, src, program.Notes())
+		}
+
+		if _, err := program.Run(RunOptions{Output: io.Discard}); err != nil {
+			t.Errorf("Unexpected error running %q: %v", src, err)
+		}
+	}
+
+	// only calls and assignments are statements
+	if _, err := Compile("x := 1\nx + 1", CompileOptions{}); err == nil {
+		t.Errorf("Expected an expression which isn't a call to not be a statement")
+	}
+}
+
+func TestCompiler_For(t *testing.T) {
+	for src, expected := range map[string]string{
+		"for i := 0; i < 3; i = i + 1 { print(i) }":                                                  "012",
+		"for i := 3; i < 3; i = i + 1 { print(i) }":                                                  "",
+		"s := 0\nfor i := 1; i <= 4; i = i + 1 { s = s + i }\nprint(s)":                              "10",
+		"i := 10\nfor i := 0; i < 2; i = i + 1 { print(i) }\nprint(i)":                               "0110",
+		"for i := 0; i < 2; i = i + 1 {\n\tfor j := 0; j < 2; j = j + 1 {\n\t\tprint(i + j)\n\t}\n}": "0112",
+	} {
+		program, err := Compile(src, CompileOptions{})
+		if err != nil {
+			t.Fatalf("Unexpected error compiling %q: %v", src, err)
+		}
+
+		out := bytes.Buffer{}
+		if _, err := program.Run(RunOptions{Output: &out}); err != nil {
+			t.Fatalf("Unexpected error running %q: %v", src, err)
+		}
+
+		if out.String() != expected {
+			t.Errorf("Expected %q to print %q, got %q", src, expected, out.String())
+		}
+	}
+
+	// the variable of the loop is only visible within it
+	program, err := Compile("for i := 0; i < 1; i = i + 1 {}\nprint(i)", CompileOptions{})
+	if err == nil {
+		if _, err := program.Run(RunOptions{Output: io.Discard}); err == nil {
+			t.Errorf("Expected the variable of a loop to be undefined after it")
+		}
+	}
+}
+
+func TestCompiler_Bitwise(t *testing.T) {
+	for src, expected := range map[string]string{
+		"print(6 & 3)":            "2",
+		"print(6 | 3)":            "7",
+		"print(6 ^ 3)":            "5",
+		"print(1 << 4)":           "16",
+		"print(-16 >> 2)":         "-4",
+		"print(7.9 & 5.2)":        "5",
+		"print(1 + 2 << 1)":       "5",
+		"print(1 | 2 == 3)":       "true",
+		"print(2 | 4 & 6)":        "6",
+		"print((1n << 70) >> 69)": "2",
+		"print(12n & 10)":         "8",
+	} {
+		for _, options := range []CompileOptions{{}, {NoFolding: true}} {
+			program, err := Compile(src, options)
+			if err != nil {
+				t.Fatalf("Unexpected error compiling %q: %v", src, err)
+			}
+
+			out := bytes.Buffer{}
+			if _, err := program.Run(RunOptions{Output: &out}); err != nil {
+				t.Fatalf("Unexpected error running %q: %v", src, err)
+			}
+
+			if out.String() != expected {
+				t.Errorf("Expected %q to print %q, got %q", src, expected, out.String())
+			}
+		}
+	}
+
+	// literals which aren't numbers are caught while compiling
+	if _, err := Compile(`x := 1
+y := x & "a"`, CompileOptions{}); err == nil || !strings.Contains(err.Error(), "cannot bitwise and string") {
+		t.Errorf("Expected a bitwise operation on a string to fail compiling, got %v", err)
+	}
+
+	for _, src := range []string{"x := 1\nprint(x << -1)", "x := 0\nprint(1 / x & 1)", "x := true\nprint(x | 1)"} {
+		program, err := Compile(src, CompileOptions{})
+		if err != nil {
+			t.Fatalf("Unexpected error compiling %q: %v", src, err)
+		}
+
+		if _, err := program.Run(RunOptions{Output: io.Discard}); err == nil {
+			t.Errorf("Expected %q to fail", src)
+		}
+	}
+}
+
+func TestCompiler_Destructure(t *testing.T) {
+	for src, expected := range map[string]string{
+		"[a, b] := [1, 2]\nprint(a + b)": "3",
+		"[_, user, domain] := match(\"ada@example.com\", \"([a-z]+)@([a-z.]+)\")\nprint(user + domain)": "adaexample.com",
+		"pattern := \"(a)(b)?\"\n[_, a, b] := match(\"a\", pattern)\nprint(a)\nprint(b)":                "anil",
+		"func f() {\n\t[x, y] := [1, 2]\n\treturn x * y\n}\nprint(f())":                                 "2",
+	} {
+		program, err := Compile(src, CompileOptions{})
+		if err != nil {
+			t.Fatalf("Unexpected error compiling %q: %v", src, err)
+		}
+
+		out := bytes.Buffer{}
+		if _, err := program.Run(RunOptions{Output: &out}); err != nil {
+			t.Fatalf("Unexpected error running %q: %v", src, err)
+		}
+
+		if out.String() != expected {
+			t.Errorf("Expected %q to print %q, got %q", src, expected, out.String())
+		}
+	}
+
+	// the number of groups of a constant pattern is known when compiling
+	for _, src := range []string{
+		"[_, user] := match(\"ada@example.com\", \"([a-z]+)@([a-z.]+)\")",
+		"[a, b] := match(\"a\", \"(a\")",
+	} {
+		if _, err := Compile(src, CompileOptions{}); err == nil {
+			t.Errorf("Expected %q to fail compiling", src)
+		}
+	}
+
+	for _, src := range []string{
+		"[a, b] := [1, 2, 3]",
+		"[_, a] := match(\"b\", \"(a)\")",
+	} {
+		program, err := Compile(src, CompileOptions{})
+		if err != nil {
+			t.Fatalf("Unexpected error compiling %q: %v", src, err)
+		}
+
+		if _, err := program.Run(RunOptions{Output: io.Discard}); err == nil {
+			t.Errorf("Expected %q to fail running", src)
+		}
+	}
+}
+
+func TestCompiler_Object(t *testing.T) {
+	vm := runSource(t, `
+o := {
+	"name": "ann",
+	"tags": [1, 2]
+}
+empty := {}
+name := o.name
+tags := o.tags
+scores := {"a": 1, "b": 2} as map[string]number
+`)
+
+	if err := vm.Error(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	CompareValues(t, vm.Variable("name"), &StringValue{"ann"})
+	CompareValues(t, vm.Variable("tags"), NewList([]Value{NewNumber(1), NewNumber(2)}))
+	if empty := vm.Variable("empty"); !empty.Equals(&ObjectValue{map[string]Value{}, false}) {
+		t.Errorf("expected an empty object, got %s", empty.DebugString())
+	}
+
+	if scores := vm.Variable("scores"); !scores.Equals(&ObjectValue{map[string]Value{"a": NewNumber(1), "b": NewNumber(2)}, false}) {
+		t.Errorf("expected an object scoring a and b, got %s", scores.DebugString())
+	}
+
+	vm = runSource(t, `scores := {"a": 1, "b": "two"} as map[string]number`)
+	if vm.Error() == nil {
+		t.Errorf("expected casting an object with a string member to map[string]number to fail")
+	}
+}
+
+func TestCompiler_Type(t *testing.T) {
+	vm := runSource(t, `
+type Point {
+	x: number,
+	y: number
+}
+type Line {
+	from: Point,
+	to: Point
+}
+
+func width(line: Line) {
+	return line.to.x - line.from.x
+}
+
+p := Point(1, 2)
+w := width(Line(p, Point(4, 6)))
+same := {"x": 1, "y": 2, "z": 3} as Point
+`)
+
+	if err := vm.Error(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if p := vm.Variable("p"); !p.Equals(&ObjectValue{map[string]Value{"x": NewNumber(1), "y": NewNumber(2)}, false}) {
+		t.Errorf("expected a point at 1, 2, got %s", p.DebugString())
+	}
+
+	CompareValues(t, vm.Variable("w"), NewNumber(3))
+
+	for src, message := range map[string]string{
+		"type Point {\n\tx: number\n}\np := Point(1)\ndiscard p.y":          "Point has no member y",
+		"type Point {\n\tx: number\n}\nfunc f(p: Point) {\n\treturn p.z\n}": "Point has no member z",
+		"type Point {\n\tx: number\n}\ndiscard Point(1, 2)":                 "Point takes 1 arguments, got 2",
+		"type Node {\n\tnext: Node\n}":                                      "type Node contains itself",
+		"type Point {\n\tx: number\n}\ntype Point {\n\ty: number\n}":        "type Point is already declared",
+		"discard 1 as Point": "unknown type Point",
+		"type Point {\n\tx: number\n}\np := Point(1)\np = {\"y\": 1}\ndiscard p.y": "",
+	} {
+		_, err := Compile(src, CompileOptions{})
+		if message == "" && err != nil {
+			t.Errorf("expected %q to compile, got %v", src, err)
+		} else if message != "" && (err == nil || !strings.Contains(err.Error(), message)) {
+			t.Errorf("expected %q to fail with %q, got %v", src, message, err)
+		}
+	}
+
+	for _, src := range []string{
+		"type Point {\n\tx: number\n}\np := Point(\"one\")",
+		"type Point {\n\tx: number\n}\nfunc f(p: Point) {\n\treturn p.x\n}\ndiscard f({\"y\": 1})",
+		"type Point {\n\tx: number\n}\np := {\"x\": \"one\"} as Point",
+	} {
+		if vm := runSource(t, src); vm.Error() == nil {
+			t.Errorf("expected %q to fail checking the type of a value", src)
+		}
+	}
+}
+
+func TestCompiler_NilCoalescing(t *testing.T) {
+	vm := runSource(t, `
+type Node {
+	value: number,
+	next: Node|nil
+}
+
+func second(n: Node) {
+	return n.next?.value ?? -1
+}
+
+calls := 0
+func count() {
+	calls = calls + 1
+	return calls
+}
+
+list := Node(1, Node(2, nil))
+a := second(list)
+b := second(Node(3, nil))
+c := nil ?? "default"
+d := 0 ?? count()
+e := nil ?? count()
+f := list.next?.next?.value
+none := nil
+g := none?.greet(count())
+`)
+
+	if err := vm.Error(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for name, want := range map[string]Value{
+		"a": NewNumber(2), "b": NewNumber(-1), "c": NewString("default"), "d": NewNumber(0), "e": NewNumber(1),
+		"f": &NilValue{}, "g": &NilValue{},
+		// only e's right operand is evaluated, and the arguments of optional calls are evaluated either way
+		"calls": NewNumber(2),
+	} {
+		CompareValues(t, vm.Variable(name), want)
+	}
+
+	if vm := runSource(t, "type Node {\n\tnext: Node|nil\n}\nn := Node({\"next\": 1})"); vm.Error() == nil {
+		t.Errorf("expected a Node to fail checking the type of a next which isn't a Node")
+	}
+
+	program, err := Compile("type Node {\n\tnext: Node|nil\n}\nn := Node(Node(nil))\ndiscard n.next.next", CompileOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if notes := program.Notes(); len(notes) != 1 || !strings.Contains(notes[0].Description, "use ?.next") {
+		t.Errorf("expected a note suggesting ?.next, got %v", notes)
+	}
+}
+
+func TestCompiler_Defer(t *testing.T) {
+	for src, want := range map[string]string{
+		"defer write(1)":                     "only be deferred within functions",
+		"func f() {\n\tdefer 1 + 2\n}":       "only calls can be deferred",
+		"func f(a) {\n\tdefer f()\n}":        "f",
+		"func f(a) {\n\tdefer a?.close()\n}": "optional calls",
+	} {
+		_, err := Compile(src, CompileOptions{})
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("expected compiling %q to fail with %q, got %v", src, want, err)
+		}
+	}
+}
+
+func TestCompiler_Limits(t *testing.T) {
+	// more constants than instructions can refer to
+	constants := strings.Builder{}
+	for i := 0; i < 300; i++ {
+		constants.WriteString(fmt.Sprintf("write(\"%d\")\n", i))
+	}
+
+	// an if with a body longer than can be jumped over
+	long := strings.Builder{}
+	long.WriteString("if true {\n")
+	for i := 0; i < 20000; i++ {
+		long.WriteString("\twrite(1)\n")
+	}
+	long.WriteString("}")
+
+	for _, test := range []struct {
+		src    string
+		limits Limits
+		want   string
+	}{
+		{constants.String(), Limits{}, "more than 256 constants"},
+		{"a := \"x\"\nb := \"y\"\nc := \"z\"", Limits{Constants: 4}, "more than 4 constants"},
+		{long.String(), Limits{}, "the body of the if is too large"},
+		{"func f() {\n\twrite(1)\n\twrite(2)\n}", Limits{Bytecode: 8}, "more than 8 bytes"},
+		{"x := [[[[1]]]]", Limits{Depth: 4}, "nested more than 4 deep"},
+	} {
+		_, err := Compile(test.src, CompileOptions{Limits: test.limits, NoFolding: true})
+		if err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("expected %.20q to fail with %q, got %v", test.src, test.want, err)
+		}
+	}
+
+	// errors show where the limit was exceeded
+	// a and 1 are the constants of the first line
+	_, err := Compile("a := 1\nb := \"b\"", CompileOptions{Limits: Limits{Constants: 2}})
+	if d := ErrorDiagnostic(err, []rune("a := 1\nb := \"b\"")); d.Line != 2 {
+		t.Errorf("expected exceeding the limit to be on line 2, got %+v", d)
+	}
+
+	if _, err := Compile("x := [[[[1]]]]", CompileOptions{Limits: Limits{Depth: 8, Constants: 8, Bytecode: 64}}); err != nil {
+		t.Errorf("expected a program within the limits to compile, got %v", err)
+	}
+}
+
+func TestCompiler_Const(t *testing.T) {
+	vm := runSource(t, "const size = 4\nconst area = size * size\nfunc f() {\n\treturn area + 1\n}\nx := f()\nconst n = [1, 2].length()\ny := n")
+	if err := vm.Error(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	CompareValues(t, vm.Variable("x"), NewNumber(17))
+	CompareValues(t, vm.Variable("y"), NewNumber(2))
+
+	// references to constants known while compiling are replaced with their values
+	for _, constant := range vm.chunk.Constants {
+		f, ok := constant.(*FunctionValue)
+		if !ok || f.Name != "f" {
+			continue
+		}
+
+		for _, v := range f.Chunk.Constants {
+			if v.Equals(NewString("area")) {
+				t.Errorf("expected area to be replaced with its value in f, got the constants %v", f.Chunk.Constants)
+			}
+		}
+	}
+
+	for _, src := range []string{"const x = 1\nx = 2", "const x = 1\nfunc f() {\n\tx = 2\n}"} {
+		if _, err := Compile(src, CompileOptions{}); err == nil || !strings.Contains(err.Error(), "cannot assign to x") {
+			t.Errorf("expected assigning to the constant in %q to fail, got %v", src, err)
+		}
+	}
+
+	if _, err := Compile("const x := 1", CompileOptions{}); err == nil {
+		t.Errorf("expected constants to be declared with =")
+	}
+}
+
+func TestCompiler_DefaultParams(t *testing.T) {
+	vm := runSource(t, `
+mark := "."
+func greet(name: string = "world", punctuation = mark) {
+	return "hello " + name + punctuation
+}
+
+a := greet()
+b := greet("you")
+c := greet("you", "!")
+`)
+
+	if err := vm.Error(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	CompareValues(t, vm.Variable("a"), NewString("hello world."))
+	CompareValues(t, vm.Variable("b"), NewString("hello you."))
+	CompareValues(t, vm.Variable("c"), NewString("hello you!"))
+
+	for src, want := range map[string]string{
+		"func f(a, b = 1) {\n}\nf()":        "f takes 1 to 2 arguments, got 0",
+		"func f(a, b = 1) {\n}\nf(1, 2, 3)": "f takes 1 to 2 arguments, got 3",
+		"func f(a = 1, b) {\n}":             "b follows a parameter with a default value",
+	} {
+		if _, err := Compile(src, CompileOptions{}); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("expected compiling %q to fail with %q, got %v", src, want, err)
+		}
+	}
+
+	// defaults are checked against the types of their parameters like arguments are
+	if vm := runSource(t, "func f(n: number = \"one\") {\n\treturn n\n}\ndiscard f()"); vm.Error() == nil {
+		t.Errorf("expected a default of the wrong type to fail")
+	}
+}
+
+func TestCompiler_DeadStores(t *testing.T) {
+	cases := map[string]int{
+		"x := 1\nx = 2\nwrite(x)":                                   1,
+		"x := 1\nx = x + 1\nwrite(x)":                               0,
+		"x := 1\nif true { x = 2 }\nx = 3\nwrite(x)":                1,
+		"x := 1\nwhile x < 3 { x = x + 1 }\nx = 0":                  0,
+		"x := 1\nfunc f() {\n\treturn x\n}\nx = 2\nwrite(f())":      0,
+		"func f(a) {\n\ta = 1\n\ta = 2\n\treturn a\n}\nwrite(f(0))": 1,
+		"x := 1\nbreakpoint\nx = 2":                                 0,
+	}
+
+	for src, expected := range cases {
+		program, err := Compile(src, CompileOptions{})
+		if err != nil {
+			t.Fatalf("Unexpected error compiling %q: %v", src, err)
+		}
+
+		if notes := program.Notes(); len(notes) != expected {
+			t.Errorf("expected %d notes for %q, got %v", expected, src, notes)
+		} else if expected > 0 && !strings.Contains(notes[0].Description, "never read") {
+			t.Errorf("expected the store to be noted as never read for %q, got %v", src, notes)
+		}
+	}
+
+	// eliminated stores are left out, while their values are still computed
+	src := "n := 0\nfunc count() {\n\twrite(\"counted \")\n\treturn 5\n}\nn = count()\nn = 2\nn = 3\nwrite(n)"
+	sets := func(options CompileOptions) (int, string) {
+		program, err := Compile(src, options)
+		if err != nil {
+			t.Fatalf("Unexpected error compiling: %v", err)
+		}
+
+		n := 0
+		for _, b := range program.chunk.Bytecode {
+			if b == InstructionSetLocal {
+				n++
+			}
+		}
+
+		var out bytes.Buffer
+		if _, err := program.Run(RunOptions{Output: &out}); err != nil {
+			t.Fatalf("Unexpected error running: %v", err)
+		}
+
+		return n, out.String()
+	}
+
+	kept, out := sets(CompileOptions{})
+	eliminated, eliminatedOut := sets(CompileOptions{EliminateDeadStores: true})
+	if kept != 3 || eliminated != 1 {
+		t.Errorf("expected 3 stores, 1 once dead stores are eliminated, got %d and %d", kept, eliminated)
+	}
+
+	if out != eliminatedOut || out != "counted \n3\n" {
+		t.Errorf("expected both programs to write counted and 3, got %q and %q", out, eliminatedOut)
+	}
+}
+
+func TestCompiler_ErrorPositions(t *testing.T) {
+	for src, line := range map[string]int{
+		"const x = 1\nx = 2":                                 2,
+		"func f() {\n\treturn 1\n}\ndefer f()":               4,
+		"x := 1\ny := [1, ...\"a\"]":                         2,
+		"x := 1\ny := \"a\" as number":                       2,
+		"func f(a) {\n\treturn a\n}\n\ndiscard f(1, 2)":      5,
+		"x := 1\ny := 1 - \"a\"":                             2,
+		"x := 1\nwrite(format(\"{} {} {}\", [1, 2]))":        2,
+		"x := 1\n[a, b] := match(\"a\", \"(a\")":             2,
+		"x := 1\n[_, user] := match(\"a@b\", \"(a)@(b)\")":   2,
+		"x := 1\ny := x & \"a\"":                             2,
+		"x := 1\n#pragma loose":                              2,
+		"x := 1\ndiscard 1 as Point":                         2,
+		"x := 1\ntype Node {\n\tnext: Node\n}":               2,
+		"x := 1\nfunc f(p: Point) {\n\treturn p\n}":          2,
+		"x := print\nx(" + strings.Repeat("1, ", 256) + "1)": 2,
+		"x := 1\ny := comptime {\n\treturn [].at(1)\n}":      2,
+		"x := 1\ny := comptime {\n\treturn newDeque([])\n}":  2,
+		"x := 1\nimport \"other.angc\"":                      2,
+	} {
+		_, err := Compile(src, CompileOptions{})
+
+		var parsing *ParsingError
+		if !errors.As(err, &parsing) {
+			t.Errorf("Expected compiling %q to fail with a position, got %v", src, err)
+			continue
+		}
+
+		if got := int(parsing.Causer.Line) + 1; got != line {
+			t.Errorf("Expected the error compiling %q to be on line %d, got %d", src, line, got)
+		}
+	}
+}
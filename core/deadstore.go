@@ -0,0 +1,51 @@
+package core
+
+// deadStores find the assignments among statements whose values are never read, as a later statement assigns to the
+// variable again before anything reads it, mapped to the assignment overwriting each. Only the statements themselves
+// are followed, so assignments within branches and loops never overwrite others, and variables in captured are left
+// out, as functions refer to them, so calling the functions may read them at any time.
+func deadStores(statements []Node, captured map[string]bool) map[*AssignNode]*AssignNode {
+	dead := map[*AssignNode]*AssignNode{}
+
+	for i, statement := range statements {
+		n, ok := statement.(*AssignNode)
+		if !ok || n.name == "_" || captured[n.name] {
+			continue
+		}
+
+		// functions are declared to be called, which reads them
+		if _, ok := n.value.(*FunctionNode); ok {
+			continue
+		}
+
+		for _, later := range statements[i+1:] {
+			if reads(later, n.name) {
+				break
+			}
+
+			if next, ok := later.(*AssignNode); ok && next.name == n.name {
+				dead[n] = next
+				break
+			}
+		}
+	}
+
+	return dead
+}
+
+// reads whether a node may read a variable. Breakpoints read every variable, as they can be inspected there.
+func reads(node Node, name string) bool {
+	found := false
+	Walk(node, func(n Node) bool {
+		switch n := n.(type) {
+		case *ReferenceNode:
+			found = found || n.name == name
+		case *BreakpointNode:
+			found = true
+		}
+
+		return !found
+	})
+
+	return found
+}
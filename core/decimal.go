@@ -0,0 +1,119 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// NewDecimal create a number of a program in decimal mode, which is exactly the decimal number written in s (such as
+// "0.1")
+func NewDecimal(s string) (*NumberValue, error) {
+	r, ok := new(big.Rat).SetString(s)
+	if !ok {
+		return nil, errors.New(fmt.Sprintf("invalid decimal %q", s))
+	}
+
+	return newDecimal(r), nil
+}
+
+// newDecimal create a number which is exactly r
+func newDecimal(r *big.Rat) *NumberValue {
+	f, _ := r.Float64()
+	return &NumberValue{f, r}
+}
+
+// toDecimal get the number as a decimal. Floats are taken to be the shortest decimal which is read as them (so 0.1
+// is exactly 0.1), as they are usually written that way. Infinities and NaN have no decimal, so they are left as they
+// are.
+func (v *NumberValue) toDecimal() *NumberValue {
+	if v.decimal != nil || math.IsInf(v.float64, 0) || math.IsNaN(v.float64) {
+		return v
+	}
+
+	r, _ := new(big.Rat).SetString(strconv.FormatFloat(v.float64, 'g', -1, NumberSize))
+	return newDecimal(r)
+}
+
+// decimalValue make a value a decimal if it is a number, leaving other values as they are
+func decimalValue(v Value) Value {
+	if n, ok := v.(*NumberValue); ok {
+		return n.toDecimal()
+	}
+
+	return v
+}
+
+// decimalArithmetic do an arithmetic or comparison instruction on two decimals. Decimals are exact, so dividing by
+// zero is an error rather than an infinity.
+func decimalArithmetic(op Bytecode, l *big.Rat, r *big.Rat) (Value, error) {
+	switch op {
+	case InstructionAdd:
+		return newDecimal(new(big.Rat).Add(l, r)), nil
+	case InstructionSub:
+		return newDecimal(new(big.Rat).Sub(l, r)), nil
+	case InstructionMul:
+		return newDecimal(new(big.Rat).Mul(l, r)), nil
+	case InstructionDiv:
+		if r.Sign() == 0 {
+			return nil, errors.New("cannot divide by zero")
+		}
+
+		return newDecimal(new(big.Rat).Quo(l, r)), nil
+	}
+
+	if c := compare(op, l.Cmp(r)); c != nil {
+		return c, nil
+	}
+
+	return nil, errors.New(fmt.Sprintf("cannot %s number and number", operations[op]))
+}
+
+// decimalPrecision how many digits are written after the point of decimals which can't be written exactly, such as
+// 1 / 3
+const decimalPrecision = 20
+
+// formatDecimal write a decimal in the format. Decimals are written exactly when they can be (and the format has no
+// precision), with as many digits as needed, and otherwise rounded to decimalPrecision digits. Scientific notation
+// writes the closest float.
+func formatDecimal(r *big.Rat, f NumberFormat) string {
+	if f.Notation == NotationScientific {
+		n, _ := r.Float64()
+		return f.Format(n)
+	}
+
+	if f.Precision >= 0 {
+		return r.FloatString(f.Precision)
+	}
+
+	if places, exact := decimalPlaces(r); exact {
+		return r.FloatString(places)
+	}
+
+	s := strings.TrimRight(r.FloatString(decimalPrecision), "0")
+	return strings.TrimSuffix(s, ".")
+}
+
+// decimalPlaces how many digits after the point a decimal has, and whether it has a finite number of them (its
+// denominator only has the factors 2 and 5)
+func decimalPlaces(r *big.Rat) (int, bool) {
+	d := new(big.Int).Set(r.Denom())
+	two, five := big.NewInt(2), big.NewInt(5)
+	m := new(big.Int)
+
+	twos, fives := 0, 0
+	for d.QuoRem(d, two, m); m.Sign() == 0; d.QuoRem(d, two, m) {
+		twos++
+	}
+	d.Mul(d, two).Add(d, m)
+
+	for d.QuoRem(d, five, m); m.Sign() == 0; d.QuoRem(d, five, m) {
+		fives++
+	}
+	d.Mul(d, five).Add(d, m)
+
+	return max(twos, fives), d.Cmp(big.NewInt(1)) == 0
+}
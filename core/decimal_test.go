@@ -0,0 +1,124 @@
+package core
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestDecimal(t *testing.T) {
+	for src, expected := range map[string]string{
+		`print(0.1 + 0.2)`:                     "0.3",
+		`print(0.1 + 0.2 == 0.3)`:              "true",
+		`print(1 / 3)`:                         "0.33333333333333333333",
+		`print(10 / 4 * 2)`:                    "5",
+		`print(1.10 - 0.1 > 1)`:                "false",
+		`print((0.7 + 0.1) * 10)`:              "8",
+		`print([1, 2, 3].length() / 10 + 0.2)`: "0.5",
+		`x := 0.1
+x = x + 0.2
+print(x)`: "0.3",
+	} {
+		for _, options := range []CompileOptions{{Decimal: true}, {NoFolding: true, Decimal: true}} {
+			program, err := Compile(src, options)
+			if err != nil {
+				t.Fatalf("Unexpected error compiling %q: %v", src, err)
+			}
+
+			out := bytes.Buffer{}
+			if _, err := program.Run(RunOptions{Output: &out}); err != nil {
+				t.Fatalf("Unexpected error running %q: %v", src, err)
+			}
+
+			if out.String() != expected {
+				t.Errorf("Expected %q to print %q, got %q", src, expected, out.String())
+			}
+		}
+	}
+}
+
+func TestDecimal_Pragma(t *testing.T) {
+	src := `#pragma decimal
+func f(a) {
+	return a + 0.2
+}
+
+print(f(0.1))`
+
+	out := bytes.Buffer{}
+	program, err := Compile(src, CompileOptions{})
+	if err != nil {
+		t.Fatalf("Unexpected error compiling: %v", err)
+	}
+
+	if _, err := program.Run(RunOptions{Output: &out}); err != nil {
+		t.Fatalf("Unexpected error running: %v", err)
+	}
+
+	if out.String() != "0.3" {
+		t.Errorf("Expected functions of programs in decimal mode to use decimals, got %q", out.String())
+	}
+
+	// without the pragma numbers are floats
+	out.Reset()
+	program, _ = Compile(strings.TrimPrefix(src, "#pragma decimal\n"), CompileOptions{})
+	if _, err := program.Run(RunOptions{Output: &out}); err != nil {
+		t.Fatalf("Unexpected error running: %v", err)
+	}
+
+	if out.String() != "0.30000000000000004" {
+		t.Errorf("Expected numbers to be floats without the pragma, got %q", out.String())
+	}
+
+	if _, err := Compile("#pragma fast\nprint(1)", CompileOptions{}); err == nil || !strings.Contains(err.Error(), "unknown pragma fast") {
+		t.Errorf("Expected an unknown pragma to fail compiling, got %v", err)
+	}
+}
+
+func TestDecimal_DivideByZero(t *testing.T) {
+	program, err := Compile(`x := 0
+print(1 / x)`, CompileOptions{Decimal: true})
+	if err != nil {
+		t.Fatalf("Unexpected error compiling: %v", err)
+	}
+
+	if _, err := program.Run(RunOptions{Output: &bytes.Buffer{}}); err == nil || !strings.Contains(err.Error(), "cannot divide by zero") {
+		t.Errorf("Expected dividing a decimal by zero to fail, got %v", err)
+	}
+}
+
+func TestDecimal_Serialize(t *testing.T) {
+	program, err := Compile(`print(0.1 + 0.2)`, CompileOptions{Decimal: true, NoFolding: true})
+	if err != nil {
+		t.Fatalf("Unexpected error compiling: %v", err)
+	}
+
+	loaded, err := LoadProgram(program.Serialize())
+	if err != nil {
+		t.Fatalf("Unexpected error loading: %v", err)
+	}
+
+	out := bytes.Buffer{}
+	if _, err := loaded.Run(RunOptions{Output: &out}); err != nil {
+		t.Fatalf("Unexpected error running: %v", err)
+	}
+
+	if out.String() != "0.3" {
+		t.Errorf("Expected loaded programs to keep their decimals, got %q", out.String())
+	}
+
+	d, err := NewDecimal("0.1")
+	if err != nil {
+		t.Fatalf("Unexpected error creating a decimal: %v", err)
+	}
+
+	b, _ := d.GobEncode()
+	decoded := &NumberValue{}
+	if err := decoded.GobDecode(b); err != nil {
+		t.Fatalf("Unexpected error decoding: %v", err)
+	}
+
+	if decoded.decimal == nil || !decoded.Equals(d) {
+		t.Errorf("Expected %s to be decoded as the same decimal, got %s", d, decoded)
+	}
+}
@@ -0,0 +1,87 @@
+package core
+
+import (
+	"errors"
+)
+
+// Severity how serious a diagnostic is
+type Severity string
+
+const (
+	SeverityError   Severity = "error"
+	SeverityWarning Severity = "warning"
+)
+
+// Diagnostic an error or note from compiling a program, in a form for tools to read (such as editors and CI) rather
+// than people, which is encoded as JSON with the field names in lower case
+type Diagnostic struct {
+	Severity Severity `json:"severity"`
+	// File the file it is about, empty for the source being compiled if it wasn't named
+	File string `json:"file,omitempty"`
+	// Line the line it is about, starting at 1, or 0 if unknown
+	Line int `json:"line,omitempty"`
+	// Column the column it is about in runes, starting at 1, or 0 if unknown
+	Column  int    `json:"column,omitempty"`
+	Message string `json:"message"`
+	// Imported where the file was imported, from the innermost import out, written as file:line
+	Imported []string `json:"imported,omitempty"`
+}
+
+// Diagnostic describe the note as a warning, with src being the source of the file it is about to find its column
+func (n *Note) Diagnostic(src []rune) Diagnostic {
+	d := Diagnostic{Severity: SeverityWarning, File: n.File, Message: n.Description, Imported: locationStrings(n.Imported)}
+	if n.Causer != nil {
+		d.Line, d.Column = int(n.Causer.Line)+1, column(src, n.Causer.Start)
+	}
+
+	return d
+}
+
+// ErrorDiagnostic describe an error from compiling the program compiled from src. Errors in other files are about
+// the innermost file they happened in, as FormatError shows them.
+func ErrorDiagnostic(err error, src []rune) Diagnostic {
+	d := Diagnostic{Severity: SeverityError}
+
+	var imported []Location
+	var file *FileError
+	for errors.As(err, &file) {
+		imported = append(append([]Location{}, file.Imported...), imported...)
+		d.File, src, err = file.File, file.Source, file.Err
+	}
+
+	d.Message, d.Imported = err.Error(), locationStrings(imported)
+
+	var parsing *ParsingError
+	if errors.As(err, &parsing) && parsing.Causer != nil {
+		d.Line, d.Column = int(parsing.Causer.Line)+1, column(src, parsing.Causer.Start)
+	}
+
+	return d
+}
+
+// column the column of an offset into src, starting at 1, or 0 if src doesn't have it
+func column(src []rune, offset Pos) int {
+	if int(offset) > len(src) {
+		return 0
+	}
+
+	c := 1
+	for i := int(offset) - 1; i >= 0 && src[i] != '\n'; i-- {
+		c++
+	}
+
+	return c
+}
+
+func locationStrings(locations []Location) []string {
+	if len(locations) == 0 {
+		return nil
+	}
+
+	strs := make([]string, len(locations))
+	for i, location := range locations {
+		strs[i] = location.String()
+	}
+
+	return strs
+}
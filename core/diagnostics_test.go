@@ -0,0 +1,41 @@
+package core
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestDiagnostics(t *testing.T) {
+	files := []SourceFile{{"a.ang", "x := 1\n"}, {"b.ang", "y := 2\nz :=  unknown\n"}}
+	program, err := CompileFiles(files, CompileOptions{})
+	if err != nil {
+		t.Fatalf("Unexpected error compiling: %v", err)
+	}
+
+	diagnostics := program.Diagnostics()
+	if len(diagnostics) != 1 {
+		t.Fatalf("Expected a diagnostic, got %v", diagnostics)
+	}
+
+	d := diagnostics[0]
+	if d.Severity != SeverityWarning || d.File != "b.ang" || d.Line != 2 || d.Column != 7 {
+		t.Errorf("Expected a warning about b.ang at 2:7, got %+v", d)
+	}
+
+	files[1].Source = "y := 2\nz := )\n"
+	_, err = CompileFiles(files, CompileOptions{})
+	if err == nil {
+		t.Fatalf("Expected an error compiling")
+	}
+
+	d = ErrorDiagnostic(err, nil)
+	if d.Severity != SeverityError || d.File != "b.ang" || d.Line != 2 || d.Message == "" {
+		t.Errorf("Expected an error about line 2 of b.ang, got %+v", d)
+	}
+
+	d = ErrorDiagnostic(&FileError{"a.ang", nil, &FileError{"c.ang", nil, errors.New("no such file"), nil}, []Location{{"main.ang", 3}}}, nil)
+	if d.File != "c.ang" || !reflect.DeepEqual(d.Imported, []string{"main.ang:4"}) {
+		t.Errorf("Expected an error about c.ang imported at main.ang:4, got %+v", d)
+	}
+}
@@ -0,0 +1,240 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// DictValue a dictionary, mapping keys of any type to values. Unlike the members of objects, which are named by
+// strings, keys may be numbers, lists or any other value, and are looked up by their hash, so 1 and 1n are the same
+// key while 1 and "1" are not. The entries are kept in the order their keys were added.
+type DictValue struct {
+	entries *valueMap
+	// frozen whether the entries can no longer be set or removed
+	frozen bool
+}
+
+func NewDict() *DictValue {
+	return &DictValue{newValueMap(), false}
+}
+
+// Lookup get a value by its key, and whether the dictionary has it
+func (v *DictValue) Lookup(key Value) (Value, bool) {
+	return v.entries.get(key)
+}
+
+// Set set the value of a key
+func (v *DictValue) Set(key Value, value Value) {
+	v.entries.set(key, value)
+}
+
+func (v *DictValue) Type() ValueType {
+	return DictValueType
+}
+
+func (v *DictValue) String() string {
+	return formatNested(v, map[Value]bool{}, true)
+}
+
+func (v *DictValue) format(visiting map[Value]bool) string {
+	var entries []string
+	v.entries.each(func(key Value, value Value) bool {
+		entries = append(entries, fmt.Sprintf("%s=%s", formatNested(key, visiting, true), formatNested(value, visiting, true)))
+		return true
+	})
+
+	return fmt.Sprintf("dict{%s}", strings.Join(entries, ", "))
+}
+
+func (v *DictValue) cycle() string {
+	return "dict{...}"
+}
+
+func (v *DictValue) DebugString() string {
+	return v.String()
+}
+
+func (v *DictValue) Equals(other Value) bool {
+	return equalsNested(v, other, map[[2]Value]bool{})
+}
+
+func (v *DictValue) Hash() uint64 {
+	return hashNested(v, 0)
+}
+
+// equals dictionaries are equal when they have equal values for the same keys, whichever order they were added in
+func (v *DictValue) equals(other Value, comparing map[[2]Value]bool) bool {
+	dict, ok := other.(*DictValue)
+	if !ok || v.entries.len() != dict.entries.len() {
+		return false
+	}
+
+	equal := true
+	v.entries.each(func(key Value, value Value) bool {
+		o, ok := dict.entries.get(key)
+		equal = ok && equalsNested(value, o, comparing)
+		return equal
+	})
+
+	return equal
+}
+
+// keyedType split the name of a dictionary (dict[key]value) or map (map[string]value) type into the types of its keys
+// and values
+func keyedType(name string, kind string) (string, string, bool) {
+	if !strings.HasPrefix(name, kind+"[") {
+		return "", "", false
+	}
+
+	// the type of the keys may itself be a dictionary type, so its brackets are counted
+	depth := 0
+	for i := len(kind); i < len(name); i++ {
+		switch name[i] {
+		case '[':
+			depth++
+		case ']':
+			depth--
+			if depth == 0 {
+				return name[len(kind)+1 : i], name[i+1:], true
+			}
+		}
+	}
+
+	return "", "", false
+}
+
+// isDictOfType whether a value is a dictionary with keys and values of the types of a dictionary type
+func isDictOfType(value Value, key string, of string) bool {
+	dict, ok := value.(*DictValue)
+	if !ok {
+		return false
+	}
+
+	matches := true
+	dict.entries.each(func(k Value, v Value) bool {
+		matches = IsOfType(k, key) && IsOfType(v, of)
+		return matches
+	})
+
+	return matches
+}
+
+// isMapOfType whether a value is an object with members of a type, as map[string]value types are
+func isMapOfType(value Value, of string) bool {
+	object, ok := value.(*ObjectValue)
+	if !ok {
+		return false
+	}
+
+	for _, member := range object.members {
+		if !IsOfType(member, of) {
+			return false
+		}
+	}
+
+	return true
+}
+
+var DictPrototype = map[string]*BuiltinFunctionValue{
+	"at": {
+		"at",
+		[]string{"key"},
+		func(_ *VM, this Value, p map[string]Value) (Value, error) {
+			value, ok := this.(*DictValue).Lookup(p["key"])
+			if !ok {
+				return nil, errors.New(fmt.Sprintf("dict has no key %s", p["key"].DebugString()))
+			}
+
+			return value, nil
+		},
+		nil,
+	},
+	"get": {
+		"get",
+		[]string{"key", "fallback"},
+		func(_ *VM, this Value, p map[string]Value) (Value, error) {
+			if value, ok := this.(*DictValue).Lookup(p["key"]); ok {
+				return value, nil
+			}
+
+			return p["fallback"], nil
+		},
+		nil,
+	},
+	"set": {
+		"set",
+		[]string{"key", "value"},
+		func(_ *VM, this Value, p map[string]Value) (Value, error) {
+			dict := this.(*DictValue)
+			if dict.frozen {
+				return nil, errors.New(fmt.Sprintf("cannot set key %s of frozen dict", p["key"].DebugString()))
+			}
+
+			dict.Set(p["key"], p["value"])
+			return &NilValue{}, nil
+		},
+		nil,
+	},
+	"has": {
+		"has",
+		[]string{"key"},
+		func(_ *VM, this Value, p map[string]Value) (Value, error) {
+			_, ok := this.(*DictValue).Lookup(p["key"])
+			return &BoolValue{ok}, nil
+		},
+		nil,
+	},
+	"remove": {
+		"remove",
+		[]string{"key"},
+		func(_ *VM, this Value, p map[string]Value) (Value, error) {
+			dict := this.(*DictValue)
+			if dict.frozen {
+				return nil, errors.New(fmt.Sprintf("cannot remove key %s from frozen dict", p["key"].DebugString()))
+			}
+
+			return &BoolValue{dict.entries.remove(p["key"])}, nil
+		},
+		nil,
+	},
+	"length": {
+		"length",
+		[]string{},
+		func(_ *VM, this Value, p map[string]Value) (Value, error) {
+			return GoToValue(this.(*DictValue).entries.len()), nil
+		},
+		nil,
+	},
+	"keys": {
+		"keys",
+		[]string{},
+		func(_ *VM, this Value, p map[string]Value) (Value, error) {
+			return &ListValue{this.(*DictValue).entries.keys(), false, false}, nil
+		},
+		nil,
+	},
+	"values": {
+		"values",
+		[]string{},
+		func(_ *VM, this Value, p map[string]Value) (Value, error) {
+			dict := this.(*DictValue)
+			values := make([]Value, 0, dict.entries.len())
+			dict.entries.each(func(_ Value, value Value) bool {
+				values = append(values, value)
+				return true
+			})
+
+			return &ListValue{values, false, false}, nil
+		},
+		nil,
+	},
+}
+
+func (v *DictValue) Get(key string) (Value, error) {
+	if prop, ok := DictPrototype[key]; ok {
+		return prop, nil
+	}
+
+	return nil, errors.New(fmt.Sprintf("dict has no property \"%s\"", key))
+}
@@ -0,0 +1,79 @@
+package core
+
+import (
+	"math/big"
+	"testing"
+)
+
+func TestDictValue_Program(t *testing.T) {
+	vm := runSource(t, `
+names := newDict([[1, "one"], [2, "two"]])
+names.set(3n, "three")
+names.set([1, 2], "pair")
+three := names.at(3)
+pair := names[[1, 2]]
+missing := names.get("1", "none")
+removed := names.remove(2)
+keys := names.keys()
+length := names.length()
+o := newObject()
+o.set("b", 2)
+o.set("a", 1)
+fromObject := newDict(o).keys()
+`)
+
+	if err := vm.Error(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	CompareValues(t, vm.Variable("three"), &StringValue{"three"})
+	CompareValues(t, vm.Variable("pair"), &StringValue{"pair"})
+	CompareValues(t, vm.Variable("missing"), &StringValue{"none"})
+	CompareValues(t, vm.Variable("removed"), &BoolValue{true})
+	CompareValues(t, vm.Variable("keys"), NewList([]Value{
+		NewNumber(1),
+		NewBigInt(big.NewInt(3)),
+		NewList([]Value{NewNumber(1), NewNumber(2)}),
+	}))
+	CompareValues(t, vm.Variable("length"), &NumberValue{3, nil})
+	CompareValues(t, vm.Variable("fromObject"), NewList([]Value{NewString("a"), NewString("b")}))
+
+	frozen := runSource(t, `
+d := freeze(newDict([["a", [1]]]))
+length := d.length()
+inner := d.at("a")
+`)
+	if err := frozen.Error(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	CompareValues(t, frozen.Variable("length"), NewNumber(1))
+	if !IsFrozen(frozen.Variable("inner")) {
+		t.Errorf("expected freezing a dict to freeze its values")
+	}
+
+	for _, src := range []string{`x := newDict([]).at(1)`, `x := newDict([1])`, `x := newDict(1)`,
+		`freeze(newDict(nil)).set("a", 1)`, `freeze(newDict([["a", 1]])).remove("a")`} {
+		if vm := runSource(t, src); vm.Error() == nil {
+			t.Errorf("expected %q to fail", src)
+		}
+	}
+}
+
+func TestDictValue_Cast(t *testing.T) {
+	vm := runSource(t, `
+d := newDict([[1, "one"], [2, "two"]]) as dict[number]string
+same := d == newDict([[2, "two"], [1, "one"]])
+`)
+
+	if err := vm.Error(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	CompareValues(t, vm.Variable("same"), &BoolValue{true})
+
+	vm = runSource(t, `d := newDict([[1, "one"], ["2", "two"]]) as dict[number]string`)
+	if vm.Error() == nil {
+		t.Errorf("expected casting a dict with a string key to dict[number]string to fail")
+	}
+}
@@ -0,0 +1,19 @@
+// Package core implements the anglais language: its lexer, parser, compiler and the VM running the compiled bytecode.
+//
+// Programs embedding the language should use the facade, which is kept compatible between versions:
+//
+//   - Compile and CompileOptions, to compile source into a Program
+//   - LoadProgram and Program.Serialize, to store programs as bytecode, or DecodeProgram and Program.Encode with a
+//     Codec, to store it in another format
+//   - Program.Run and RunOptions, to run programs to their end, or Program.NewVM to run them step by step
+//   - Builtin, Signature and Registry, to give programs functions implemented in Go
+//   - the Value interface, the constructors of values (NewString, NewNumber, NewBool, NewList, NewObject, ...) with
+//     their accessors, and GoToValue and ValueToGo
+//   - ErrorValue, ParsingError, Note and FormatError, to describe what went wrong
+//   - the exported methods of VM
+//
+// Everything else is exported for the tools in this repository (the command line, the language server and the
+// browser debugger) and may change between versions. This includes the bytecode itself (Chunk, its Bytecode and
+// Constants, and the instructions), the nodes of parse trees, Stack and the stages of the pipeline (Lexer, Parser and
+// Compiler). Bytecode stored with Program.Serialize should be compiled again when the language is upgraded.
+package core
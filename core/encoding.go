@@ -0,0 +1,413 @@
+package core
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"slices"
+)
+
+// bytecodeMagic what serialized chunks and bundles begin with, followed by the version of their format
+var bytecodeMagic = []byte("ANG")
+
+// bytecodeVersion the version of the format chunks are serialized in, which is changed whenever the format is
+const bytecodeVersion = 1
+
+const (
+	// formatChunk serialized chunks are one chunk
+	formatChunk byte = iota
+	// formatBundle serialized bundles are chunks keyed by the names of their files
+	formatBundle
+)
+
+// the tags of the kinds of constants, which each constant begins with
+const (
+	constantNil byte = iota
+	constantBool
+	constantNumber
+	constantDecimal
+	constantString
+	constantBigInt
+	constantList
+	constantFunction
+)
+
+// The format chunks are serialized in writes everything in the order it is in the chunk, with nothing depending on
+// the order of maps or on what was serialized before, so a chunk is always serialized to the same bytes. Lengths and
+// numbers are written as varints, and strings as their length followed by their bytes.
+
+// encoder writes chunks in the format of serialized bytecode
+type encoder struct {
+	buf bytes.Buffer
+}
+
+func (e *encoder) uvarint(n uint64) {
+	e.buf.Write(binary.AppendUvarint(nil, n))
+}
+
+func (e *encoder) varint(n int64) {
+	e.buf.Write(binary.AppendVarint(nil, n))
+}
+
+func (e *encoder) bool(b bool) {
+	if b {
+		e.buf.WriteByte(1)
+	} else {
+		e.buf.WriteByte(0)
+	}
+}
+
+func (e *encoder) string(s string) {
+	e.uvarint(uint64(len(s)))
+	e.buf.WriteString(s)
+}
+
+func (e *encoder) strings(strs []string) {
+	e.uvarint(uint64(len(strs)))
+	for _, s := range strs {
+		e.string(s)
+	}
+}
+
+func (e *encoder) header(format byte) {
+	e.buf.Write(bytecodeMagic)
+	e.buf.WriteByte(bytecodeVersion)
+	e.buf.WriteByte(format)
+}
+
+func (e *encoder) chunk(c *Chunk) error {
+	e.uvarint(uint64(len(c.Bytecode)))
+	for _, b := range c.Bytecode {
+		e.buf.WriteByte(byte(b))
+	}
+
+	e.uvarint(uint64(len(c.Constants)))
+	for _, constant := range c.Constants {
+		if err := e.constant(constant); err != nil {
+			return err
+		}
+	}
+
+	e.uvarint(uint64(len(c.Lines)))
+	for _, line := range c.Lines {
+		e.varint(int64(line))
+	}
+
+	e.strings(c.Files)
+	e.bool(c.Decimal)
+	e.bool(c.Strict)
+
+	e.uvarint(uint64(len(c.Exports)))
+	for _, export := range c.Exports {
+		e.string(export.Name)
+		e.bool(export.Global)
+		e.bool(export.Function)
+		e.strings(export.Params)
+	}
+
+	return nil
+}
+
+func (e *encoder) constant(v Value) error {
+	switch v := v.(type) {
+	case *NilValue:
+		e.buf.WriteByte(constantNil)
+	case *BoolValue:
+		e.buf.WriteByte(constantBool)
+		e.bool(v.bool)
+	case *NumberValue:
+		if v.decimal != nil {
+			e.buf.WriteByte(constantDecimal)
+			e.string(v.decimal.String())
+		} else {
+			e.buf.WriteByte(constantNumber)
+		}
+
+		e.buf.Write(binary.BigEndian.AppendUint64(nil, math.Float64bits(v.float64)))
+	case *StringValue:
+		e.buf.WriteByte(constantString)
+		e.string(v.string)
+	case *BigIntValue:
+		e.buf.WriteByte(constantBigInt)
+		e.string(v.int.String())
+	case *ListValue:
+		e.buf.WriteByte(constantList)
+		e.bool(v.frozen)
+		e.uvarint(uint64(len(v.items)))
+		for _, item := range v.items {
+			if err := e.constant(item); err != nil {
+				return err
+			}
+		}
+	case *FunctionValue:
+		e.buf.WriteByte(constantFunction)
+		e.string(v.Name)
+		e.strings(v.Params)
+		return e.chunk(v.Chunk)
+	default:
+		return errors.New(fmt.Sprintf("%s values can't be serialized as constants", v.Type()))
+	}
+
+	return nil
+}
+
+// decoder reads chunks written by encoder. The first error it runs into is kept, after which it reads nothing more.
+type decoder struct {
+	b   []byte
+	err error
+}
+
+func (d *decoder) fail(format string, a ...interface{}) {
+	if d.err == nil {
+		d.err = errors.New(fmt.Sprintf(format, a...))
+	}
+}
+
+func (d *decoder) byte() byte {
+	if d.err != nil {
+		return 0
+	}
+
+	if len(d.b) == 0 {
+		d.fail("unexpected end")
+		return 0
+	}
+
+	b := d.b[0]
+	d.b = d.b[1:]
+	return b
+}
+
+func (d *decoder) bytes(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+
+	if len(d.b) < n {
+		d.fail("unexpected end")
+		return nil
+	}
+
+	b := d.b[:n]
+	d.b = d.b[n:]
+	return b
+}
+
+func (d *decoder) uvarint() uint64 {
+	if d.err != nil {
+		return 0
+	}
+
+	n, size := binary.Uvarint(d.b)
+	if size <= 0 {
+		d.fail("invalid varint")
+		return 0
+	}
+
+	d.b = d.b[size:]
+	return n
+}
+
+func (d *decoder) varint() int64 {
+	if d.err != nil {
+		return 0
+	}
+
+	n, size := binary.Varint(d.b)
+	if size <= 0 {
+		d.fail("invalid varint")
+		return 0
+	}
+
+	d.b = d.b[size:]
+	return n
+}
+
+// length read the length of something of which each item takes at least one byte, which can't be more than the bytes
+// left, so invalid lengths fail before anything is allocated for them
+func (d *decoder) length() int {
+	n := d.uvarint()
+	if n > uint64(len(d.b)) {
+		d.fail("length %d is more than the %d bytes left", n, len(d.b))
+		return 0
+	}
+
+	return int(n)
+}
+
+func (d *decoder) bool() bool {
+	switch b := d.byte(); b {
+	case 0:
+		return false
+	case 1:
+		return true
+	default:
+		d.fail("a boolean is 0 or 1, got %d", b)
+		return false
+	}
+}
+
+func (d *decoder) string() string {
+	return string(d.bytes(d.length()))
+}
+
+func (d *decoder) strings() []string {
+	n := d.length()
+	if n == 0 {
+		return nil
+	}
+
+	strs := make([]string, n)
+	for i := range strs {
+		strs[i] = d.string()
+	}
+
+	return strs
+}
+
+func (d *decoder) header(format byte) {
+	if !bytes.HasPrefix(d.b, bytecodeMagic) {
+		d.fail("not bytecode")
+		return
+	}
+	d.b = d.b[len(bytecodeMagic):]
+
+	if version := d.byte(); d.err == nil && version != bytecodeVersion {
+		d.fail("bytecode version %d, compiled by another version of the language, should be compiled again", version)
+	}
+
+	if f := d.byte(); d.err == nil && f != format {
+		d.fail("expected format %d, got %d", format, f)
+	}
+}
+
+func (d *decoder) chunk() *Chunk {
+	c := &Chunk{}
+
+	c.Bytecode = make([]Bytecode, d.length())
+	for i, b := range d.bytes(len(c.Bytecode)) {
+		c.Bytecode[i] = Bytecode(b)
+	}
+
+	if n := d.length(); n > 0 {
+		c.Constants = make([]Value, n)
+		for i := range c.Constants {
+			c.Constants[i] = d.constant()
+		}
+	}
+
+	if n := d.length(); n > 0 {
+		c.Lines = make([]Pos, n)
+		for i := range c.Lines {
+			c.Lines[i] = Pos(d.varint())
+		}
+	}
+
+	c.Files = d.strings()
+	c.Decimal = d.bool()
+	c.Strict = d.bool()
+
+	if n := d.length(); n > 0 {
+		c.Exports = make([]Export, n)
+		for i := range c.Exports {
+			c.Exports[i] = Export{d.string(), d.bool(), d.bool(), d.strings()}
+		}
+	}
+
+	return c
+}
+
+func (d *decoder) constant() Value {
+	switch tag := d.byte(); tag {
+	case constantNil:
+		return &NilValue{}
+	case constantBool:
+		return &BoolValue{d.bool()}
+	case constantNumber:
+		return &NumberValue{d.float(), nil}
+	case constantDecimal:
+		decimal, ok := new(big.Rat).SetString(d.string())
+		if !ok {
+			d.fail("invalid decimal")
+		}
+
+		return &NumberValue{d.float(), decimal}
+	case constantString:
+		return &StringValue{d.string()}
+	case constantBigInt:
+		n, ok := new(big.Int).SetString(d.string(), 10)
+		if !ok {
+			d.fail("invalid integer")
+		}
+
+		return &BigIntValue{n}
+	case constantList:
+		frozen := d.bool()
+		items := make([]Value, d.length())
+		for i := range items {
+			items[i] = d.constant()
+		}
+
+		return &ListValue{items, frozen, false}
+	case constantFunction:
+		return &FunctionValue{Name: d.string(), Params: d.strings(), Chunk: d.chunk()}
+	default:
+		d.fail("unknown constant %d", tag)
+		return &NilValue{}
+	}
+}
+
+func (d *decoder) float() float64 {
+	b := d.bytes(8)
+	if b == nil {
+		return 0
+	}
+
+	return math.Float64frombits(binary.BigEndian.Uint64(b))
+}
+
+// encodeBundle write chunks keyed by name, in the order of their names
+func encodeBundle(chunks map[string]*Chunk) ([]byte, error) {
+	names := make([]string, 0, len(chunks))
+	for name := range chunks {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	e := &encoder{}
+	e.header(formatBundle)
+	e.uvarint(uint64(len(names)))
+	for _, name := range names {
+		e.string(name)
+		if err := e.chunk(chunks[name]); err != nil {
+			return nil, err
+		}
+	}
+
+	return e.buf.Bytes(), nil
+}
+
+// decodeBundle read chunks written by encodeBundle
+func decodeBundle(b []byte) (map[string]*Chunk, error) {
+	d := &decoder{b: b}
+	d.header(formatBundle)
+
+	chunks := map[string]*Chunk{}
+	for n := d.length(); n > 0 && d.err == nil; n-- {
+		name := d.string()
+		if _, ok := chunks[name]; ok {
+			d.fail("%s is in the bundle twice", name)
+		}
+
+		chunks[name] = d.chunk()
+	}
+
+	if d.err == nil && len(d.b) > 0 {
+		d.fail("%d bytes after the end", len(d.b))
+	}
+
+	return chunks, d.err
+}
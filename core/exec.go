@@ -0,0 +1,80 @@
+package core
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"sync"
+)
+
+// ExecBuiltins builtins which run other programs, for hosts to give the programs they trust (see
+// CompileOptions.Builtins and RunOptions.Builtins). They aren't default builtins, so programs can only run others
+// when their host allows it, such as the command line does with --allow-exec.
+var ExecBuiltins = NewRegistry(
+	Builtin{
+		"exec",
+		Signature{[]string{"command", "args"}},
+		false,
+		func(vm *VM, this Value, params map[string]Value) (Value, error) {
+			command, ok := params["command"].(*StringValue)
+			if !ok {
+				return nil, errors.New(fmt.Sprintf("the command must be a string, got %s", TypeOf(params["command"])))
+			}
+
+			list, ok := params["args"].(*ListValue)
+			if !ok {
+				return nil, errors.New(fmt.Sprintf("the arguments must be a list, got %s", TypeOf(params["args"])))
+			}
+
+			args := make([]string, len(list.items))
+			for i, arg := range list.items {
+				s, ok := arg.(*StringValue)
+				if !ok {
+					return nil, errors.New(fmt.Sprintf("the arguments must be strings, got %s", TypeOf(arg)))
+				}
+
+				args[i] = s.string
+			}
+
+			// the output is written where the program writes to as the command runs, besides being returned
+			// both are copied as the command runs, each on its own goroutine, so writing to the output is guarded
+			var stdout, stderr bytes.Buffer
+			output := &lockedWriter{w: vm.output}
+			cmd := exec.Command(command.string, args...)
+			cmd.Stdout = io.MultiWriter(&stdout, output)
+			cmd.Stderr = io.MultiWriter(&stderr, output)
+
+			// commands exiting with a code other than 0 have still run, so only failing to run them is an error
+			code := 0
+			if err := cmd.Run(); err != nil {
+				var exit *exec.ExitError
+				if !errors.As(err, &exit) {
+					return nil, errors.New(fmt.Sprintf("could not run %s: %v", command.string, err))
+				}
+
+				code = exit.ExitCode()
+			}
+
+			return NewObject(map[string]Value{
+				"stdout": NewString(stdout.String()),
+				"stderr": NewString(stderr.String()),
+				"code":   NewNumber(float64(code)),
+			}), nil
+		},
+	},
+)
+
+// lockedWriter a writer which may be written to from several goroutines at once, writing to another one at a time
+type lockedWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (l *lockedWriter) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.w.Write(p)
+}
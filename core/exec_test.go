@@ -0,0 +1,59 @@
+package core
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestExecBuiltins(t *testing.T) {
+	src := `result := exec("sh", ["-c", "echo out; echo err >&2; exit 3"])
+print(result.code)`
+
+	if program, err := Compile(src, CompileOptions{}); err == nil {
+		if _, err := program.Run(RunOptions{Output: &bytes.Buffer{}}); err == nil {
+			t.Errorf("Expected exec to be undefined unless it is given to the program")
+		}
+	}
+
+	program, err := Compile(src, CompileOptions{Builtins: ExecBuiltins})
+	if err != nil {
+		t.Fatalf("Unexpected error compiling: %v", err)
+	}
+
+	out := bytes.Buffer{}
+	vm := program.NewVM(RunOptions{Builtins: ExecBuiltins, Output: &out})
+	for vm.Next() {
+	}
+
+	if err := vm.Error(); err != nil {
+		t.Fatalf("Unexpected error running: %v", err)
+	}
+
+	if out.String() != "out\nerr\n3" && out.String() != "err\nout\n3" {
+		t.Errorf("Expected the output of the command to be written to the output of the VM, got %q", out.String())
+	}
+
+	result := vm.Variable("result").(*ObjectValue)
+	CompareValues(t, result.members["stdout"], NewString("out\n"))
+	CompareValues(t, result.members["stderr"], NewString("err\n"))
+	CompareValues(t, result.members["code"], NewNumber(3))
+}
+
+func TestExecBuiltins_Errors(t *testing.T) {
+	for src, expected := range map[string]string{
+		`exec("a command which does not exist", [])`: "could not run",
+		`exec("echo", "hi")`:                         "the arguments must be a list",
+		`exec("echo", [1])`:                          "the arguments must be strings",
+	} {
+		program, err := Compile(src, CompileOptions{Builtins: ExecBuiltins})
+		if err != nil {
+			t.Fatalf("Unexpected error compiling %q: %v", src, err)
+		}
+
+		_, err = program.Run(RunOptions{Builtins: ExecBuiltins, Output: &bytes.Buffer{}})
+		if err == nil || !strings.Contains(err.Error(), expected) {
+			t.Errorf("Expected %q to fail with %q, got %v", src, expected, err)
+		}
+	}
+}
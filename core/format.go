@@ -0,0 +1,326 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// placeholder a {} in a format string, {index:fill align width.precision}
+type placeholder struct {
+	index     int
+	fill      rune
+	align     rune
+	width     int
+	precision int
+}
+
+// parseFormat split a format string into the literal text and placeholders between them. Placeholders without an
+// index take the value after the previous placeholder's. {{ and }} are literal braces.
+func parseFormat(format string) ([]string, []placeholder, error) {
+	texts := make([]string, 0)
+	placeholders := make([]placeholder, 0)
+
+	text := strings.Builder{}
+	next := 0
+
+	for i := 0; i < len(format); i++ {
+		c := format[i]
+
+		if c == '}' {
+			if i+1 < len(format) && format[i+1] == '}' {
+				text.WriteByte('}')
+				i++
+				continue
+			}
+
+			return nil, nil, errors.New(fmt.Sprintf("unmatched } at %d in format string", i))
+		}
+
+		if c != '{' {
+			text.WriteByte(c)
+			continue
+		}
+
+		if i+1 < len(format) && format[i+1] == '{' {
+			text.WriteByte('{')
+			i++
+			continue
+		}
+
+		end := strings.IndexByte(format[i:], '}')
+		if end < 0 {
+			return nil, nil, errors.New(fmt.Sprintf("unclosed { at %d in format string", i))
+		}
+
+		p, err := parsePlaceholder(format[i+1:i+end], next)
+		if err != nil {
+			return nil, nil, err
+		}
+		next = p.index + 1
+
+		texts = append(texts, text.String())
+		text.Reset()
+		placeholders = append(placeholders, p)
+
+		i += end
+	}
+
+	texts = append(texts, text.String())
+
+	return texts, placeholders, nil
+}
+
+func parsePlaceholder(s string, next int) (placeholder, error) {
+	p := placeholder{
+		index:     next,
+		fill:      ' ',
+		align:     '<',
+		precision: -1,
+	}
+
+	index, spec, hasSpec := strings.Cut(s, ":")
+
+	if index != "" {
+		i, err := strconv.Atoi(index)
+		if err != nil || i < 0 {
+			return p, errors.New(fmt.Sprintf("invalid placeholder index \"%s\"", index))
+		}
+		p.index = i
+	}
+
+	if !hasSpec {
+		return p, nil
+	}
+
+	// alignment, optionally preceded by a fill character
+	first, size := utf8.DecodeRuneInString(spec)
+	if second, secondSize := utf8.DecodeRuneInString(spec[size:]); isAlignment(second) {
+		p.fill = first
+		p.align = second
+		spec = spec[size+secondSize:]
+	} else if isAlignment(first) {
+		p.align = first
+		spec = spec[size:]
+	} else if strings.HasPrefix(spec, "0") {
+		// zero padding numbers
+		p.fill = '0'
+		p.align = '>'
+		spec = spec[1:]
+	}
+
+	width, precision, hasPrecision := strings.Cut(spec, ".")
+
+	if width != "" {
+		w, err := strconv.Atoi(width)
+		if err != nil || w < 0 {
+			return p, errors.New(fmt.Sprintf("invalid placeholder width \"%s\"", width))
+		}
+		p.width = w
+	}
+
+	if hasPrecision {
+		pr, err := strconv.Atoi(precision)
+		if err != nil || pr < 0 {
+			return p, errors.New(fmt.Sprintf("invalid placeholder precision \"%s\"", precision))
+		}
+		p.precision = pr
+	}
+
+	return p, nil
+}
+
+func isAlignment(c rune) bool {
+	return c == '<' || c == '>' || c == '^'
+}
+
+// format a value as described by the placeholder
+func (p placeholder) format(value Value) string {
+	var s string
+	switch v := value.(type) {
+	case *NumberValue:
+		if p.precision >= 0 {
+			s = strconv.FormatFloat(v.float64, 'f', p.precision, NumberSize)
+		} else {
+			s = v.String()
+		}
+	default:
+		s = value.String()
+
+		if p.precision >= 0 && utf8.RuneCountInString(s) > p.precision {
+			s = string([]rune(s)[:p.precision])
+		}
+	}
+
+	padding := p.width - utf8.RuneCountInString(s)
+	if padding <= 0 {
+		return s
+	}
+
+	// pad zeroes after the sign of negative numbers
+	if p.fill == '0' && strings.HasPrefix(s, "-") {
+		return "-" + strings.Repeat("0", padding) + s[1:]
+	}
+
+	fill := string(p.fill)
+	switch p.align {
+	case '>':
+		return strings.Repeat(fill, padding) + s
+	case '^':
+		return strings.Repeat(fill, padding/2) + s + strings.Repeat(fill, padding-padding/2)
+	default:
+		return s + strings.Repeat(fill, padding)
+	}
+}
+
+// FormatCount get how many values a format string needs
+func FormatCount(format string) (int, error) {
+	_, placeholders, err := parseFormat(format)
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, p := range placeholders {
+		count = max(count, p.index+1)
+	}
+
+	return count, nil
+}
+
+// Format replace the placeholders of a format string with the values. A placeholder is written {index:spec}, where
+// both the index and spec are optional. The spec is [[fill]align][width][.precision], with < > and ^ aligning left,
+// right and centered. A width starting with 0 pads numbers with zeroes. The precision is the amount of decimals of
+// numbers, and the maximum length of other values.
+func Format(format string, values []Value) (string, error) {
+	texts, placeholders, err := parseFormat(format)
+	if err != nil {
+		return "", err
+	}
+
+	out := strings.Builder{}
+	for i, p := range placeholders {
+		if p.index >= len(values) {
+			return "", errors.New(fmt.Sprintf("format string refers to value %d, but only %d were given", p.index, len(values)))
+		}
+
+		out.WriteString(texts[i])
+		out.WriteString(p.format(values[p.index]))
+	}
+	out.WriteString(texts[len(texts)-1])
+
+	return out.String(), nil
+}
+
+// Notation how a number is written when converted to a string
+type Notation int
+
+const (
+	// NotationDefault writes numbers plainly, unless they are very large or very small, when they are written in
+	// scientific notation
+	NotationDefault Notation = iota
+	// NotationFixed always writes numbers plainly (1000000)
+	NotationFixed
+	// NotationScientific always writes numbers with an exponent (1e+06)
+	NotationScientific
+)
+
+// NumberFormat how numbers are converted to strings. The precision is the number of digits after the point, where
+// a negative precision uses as many digits as needed to write the number exactly.
+type NumberFormat struct {
+	Notation  Notation
+	Precision int
+}
+
+// DefaultNumberFormat the format numbers are converted to strings with, unless the VM is set to use another
+var DefaultNumberFormat = NumberFormat{NotationDefault, -1}
+
+// Format write a number in the format
+func (f NumberFormat) Format(n float64) string {
+	switch f.Notation {
+	case NotationFixed:
+		return strconv.FormatFloat(n, 'f', f.Precision, NumberSize)
+	case NotationScientific:
+		return strconv.FormatFloat(n, 'e', f.Precision, NumberSize)
+	}
+
+	// the same range javascript writes plainly
+	if abs := math.Abs(n); n == 0 || (abs >= 1e-7 && abs < 1e21) {
+		return strconv.FormatFloat(n, 'f', f.Precision, NumberSize)
+	}
+
+	return strconv.FormatFloat(n, 'e', f.Precision, NumberSize)
+}
+
+// digits used for numbers in bases up to 36
+const digits = "0123456789abcdefghijklmnopqrstuvwxyz"
+
+// FormatNumber write a number in a base (2 to 36) with a number of digits after the point. A negative precision
+// uses as many digits as needed.
+func FormatNumber(n float64, base int, precision int) (string, error) {
+	if base < 2 || base > 36 {
+		return "", errors.New(fmt.Sprintf("invalid base %d, must be between 2 and 36", base))
+	}
+
+	if math.IsNaN(n) || math.IsInf(n, 0) {
+		return strconv.FormatFloat(n, 'g', -1, NumberSize), nil
+	}
+
+	if base == 10 {
+		return strconv.FormatFloat(n, 'f', precision, NumberSize), nil
+	}
+
+	sign := ""
+	if n < 0 {
+		sign = "-"
+		n = -n
+	}
+
+	whole, fraction := math.Modf(n)
+
+	// round to the precision, carrying into the whole part if needed
+	if precision >= 0 {
+		scale := math.Pow(float64(base), float64(precision))
+		fraction = math.Round(fraction*scale) / scale
+		if fraction >= 1 {
+			whole++
+			fraction--
+		}
+	}
+
+	if whole >= 1<<53 {
+		return "", errors.New(fmt.Sprintf("%s%.0f is too large to write in base %d", sign, whole, base))
+	}
+
+	out := strings.Builder{}
+	out.WriteString(sign)
+	out.WriteString(strconv.FormatInt(int64(whole), base))
+
+	count := precision
+	if count < 0 {
+		// enough digits to represent the precision of a float64
+		count = int(math.Ceil(52 / math.Log2(float64(base))))
+	}
+
+	fractionDigits := make([]byte, 0, count)
+	for i := 0; i < count; i++ {
+		fraction *= float64(base)
+		digit := int(fraction)
+		fraction -= float64(digit)
+		fractionDigits = append(fractionDigits, digits[digit])
+	}
+
+	if precision < 0 {
+		fractionDigits = []byte(strings.TrimRight(string(fractionDigits), "0"))
+	}
+
+	if len(fractionDigits) > 0 {
+		out.WriteByte('.')
+		out.Write(fractionDigits)
+	}
+
+	return out.String(), nil
+}
@@ -0,0 +1,138 @@
+package core
+
+import (
+	"testing"
+)
+
+func TestFormat(t *testing.T) {
+	values := []Value{&NumberValue{3.14159, nil}, &StringValue{"pi"}, &NumberValue{-7, nil}}
+
+	cases := map[string]string{
+		"{} is {}":           "3.14159 is pi",
+		"{1} is {0:.2}":      "pi is 3.14",
+		"{1:>5}|{1:<5}|":     "   pi|pi   |",
+		"{1:*^6}":            "**pi**",
+		"{2:04}":             "-007",
+		"{0:08.3}":           "0003.142",
+		"{1:.1}":             "p",
+		"{{{}}}":             "{3.14159}",
+		"no placeholders":    "no placeholders",
+		"{2} then {}":        "-7 then nil",
+		"{0}{0}{0}":          "3.141593.141593.14159",
+		"after {1}, next {}": "after pi, next -7",
+	}
+
+	values = append(values, &NilValue{})
+
+	for format, expected := range cases {
+		got, err := Format(format, values)
+		if err != nil {
+			t.Errorf("unexpected error formatting %q: %v", format, err)
+			continue
+		}
+
+		if got != expected {
+			t.Errorf("formatting %q: got %q, want %q", format, got, expected)
+		}
+	}
+}
+
+func TestFormat_Errors(t *testing.T) {
+	for _, format := range []string{"{", "}", "{a}", "{:x}", "{:.x}", "{5}"} {
+		_, err := Format(format, []Value{&NumberValue{1, nil}})
+		if err == nil {
+			t.Errorf("expected an error formatting %q", format)
+		}
+	}
+}
+
+func TestCompiler_FormatCount(t *testing.T) {
+	call := func(format string, values ...Node) Node {
+		return &CallNode{
+			&ReferenceNode{"format"},
+			[]Node{&StringNode{format, "\"" + format + "\""}, &ListNode{values}},
+			true,
+		}
+	}
+
+	err := NewCompiler().Compile(call("{} and {}", &NumberNode{1}))
+	if err == nil {
+		t.Errorf("expected an error when too few values are given")
+	}
+
+	err = NewCompiler().Compile(call("{1}", &NumberNode{1}, &NumberNode{2}))
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestFormatNumber(t *testing.T) {
+	cases := []struct {
+		n         float64
+		base      int
+		precision int
+		expected  string
+	}{
+		{255, 16, 0, "ff"},
+		{255, 16, -1, "ff"},
+		{-255, 2, 0, "-11111111"},
+		{0.5, 2, -1, "0.1"},
+		{10.75, 16, 2, "a.c0"},
+		{3.14159, 10, 2, "3.14"},
+		{3.14159, 10, -1, "3.14159"},
+		{0.99, 16, 0, "1"},
+	}
+
+	for _, tc := range cases {
+		got, err := FormatNumber(tc.n, tc.base, tc.precision)
+		if err != nil {
+			t.Errorf("unexpected error formatting %v in base %d: %v", tc.n, tc.base, err)
+			continue
+		}
+
+		if got != tc.expected {
+			t.Errorf("formatting %v in base %d with precision %d: got %q, want %q", tc.n, tc.base, tc.precision, got, tc.expected)
+		}
+	}
+
+	if _, err := FormatNumber(1, 1, 0); err == nil {
+		t.Errorf("expected an error for base 1")
+	}
+}
+
+func TestParseNumbers(t *testing.T) {
+	vm := runSource(t, "a := parseInt(\"ff\", 16)\nb := parseInt(\"0x10\", 0)\nc := parseFloat(\"2.5\")\nd := typeof(parseInt(\"z\", 10))")
+
+	if vm.Error() != nil {
+		t.Fatalf("Unexpected error: %s", vm.Error().Format())
+	}
+
+	CompareValues(t, vm.Variable("a"), &NumberValue{255, nil})
+	CompareValues(t, vm.Variable("b"), &NumberValue{16, nil})
+	CompareValues(t, vm.Variable("c"), &NumberValue{2.5, nil})
+	CompareValues(t, vm.Variable("d"), &StringValue{"error"})
+}
+
+func TestNumberFormat(t *testing.T) {
+	cases := []struct {
+		format   NumberFormat
+		n        float64
+		expected string
+	}{
+		{DefaultNumberFormat, 1e6, "1000000"},
+		{DefaultNumberFormat, 0.1, "0.1"},
+		{DefaultNumberFormat, 0, "0"},
+		{DefaultNumberFormat, -2.5e-8, "-2.5e-08"},
+		{DefaultNumberFormat, 1e21, "1e+21"},
+		{NumberFormat{NotationFixed, 2}, 1.005e3, "1005.00"},
+		{NumberFormat{NotationFixed, -1}, 1e-9, "0.000000001"},
+		{NumberFormat{NotationScientific, -1}, 1e6, "1e+06"},
+		{NumberFormat{NotationScientific, 1}, 1234, "1.2e+03"},
+	}
+
+	for _, tc := range cases {
+		if got := tc.format.Format(tc.n); got != tc.expected {
+			t.Errorf("formatting %v with %+v: got %q, want %q", tc.n, tc.format, got, tc.expected)
+		}
+	}
+}
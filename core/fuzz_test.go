@@ -0,0 +1,78 @@
+package core
+
+import (
+	"testing"
+)
+
+// fuzzSources programs the fuzz targets start from
+var fuzzSources = []string{
+	"x := 1 + 2 * 3\nprint(x)",
+	"func fib(n) {\n\tif n < 2 {\n\t\treturn n\n\t}\n\treturn fib(n - 1) + fib(n - 2)\n}\nfib(5)",
+	"l := [1, \"a\", true, nil]\nl.append(l.length())",
+	"i := 0\nwhile i < 3 {\n\ti = i + 1\n}",
+	"global g := \"a\" + \"b\"\ns := g.at(0) as string",
+}
+
+// runBounded execute at most limit instructions of a chunk, so programs which never finish don't hang the fuzzer
+func runBounded(chunk *Chunk, limit int) {
+	vm := NewVM(chunk, 256, 256)
+	for i := 0; i < limit && vm.Next(); i++ {
+	}
+}
+
+func compileFuzzSource(src string) *Chunk {
+	tokens, err := NewLexer(src).Tokenize()
+	if err != nil {
+		return nil
+	}
+
+	p := NewParser(tokens)
+	tree, err := p.Parse()
+	if err != nil {
+		return nil
+	}
+
+	c := NewCompiler()
+	c.SetPositions(p.Positions())
+	if err := c.Compile(tree); err != nil {
+		return nil
+	}
+
+	return c.Chunk
+}
+
+func FuzzPipeline(f *testing.F) {
+	for _, src := range fuzzSources {
+		f.Add(src)
+	}
+
+	f.Fuzz(func(t *testing.T, src string) {
+		chunk := compileFuzzSource(src)
+		if chunk == nil {
+			return
+		}
+
+		if err := chunk.Verify(); err != nil {
+			t.Fatalf("compiled bytecode which does not verify: %v", err)
+		}
+
+		runBounded(chunk, 10000)
+	})
+}
+
+func FuzzDeserializeChunk(f *testing.F) {
+	for _, src := range fuzzSources {
+		if chunk := compileFuzzSource(src); chunk != nil {
+			f.Add(chunk.Serialize())
+		}
+	}
+
+	f.Fuzz(func(t *testing.T, b []byte) {
+		chunk, err := DeserializeChunk(b)
+		if err != nil {
+			return
+		}
+
+		runBounded(chunk, 10000)
+	})
+}
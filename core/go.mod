@@ -1,3 +1,5 @@
 module neemek.com/anglais/core
 
 go 1.23.0
+
+require golang.org/x/text v0.26.0
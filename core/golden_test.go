@@ -0,0 +1,93 @@
+package core
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files with the current output")
+
+// goldenOutput run a program through every stage, getting what it writes along with the diagnostics of each stage
+func goldenOutput(src string) string {
+	out := bytes.Buffer{}
+
+	tokens, err := NewLexer(src).Tokenize()
+	if err != nil {
+		out.WriteString(err.Error() + "\n")
+		return out.String()
+	}
+
+	p := NewParser(tokens)
+	tree, err := p.Parse()
+	if err != nil {
+		if e, ok := err.(*ParsingError); ok {
+			out.WriteString(e.Format([]rune(src)))
+		} else {
+			out.WriteString(err.Error() + "\n")
+		}
+
+		return out.String()
+	}
+
+	c := NewCompiler()
+	c.SetPositions(p.Positions())
+	if err := c.Compile(tree); err != nil {
+		out.WriteString(err.Error() + "\n")
+		return out.String()
+	}
+
+	for _, n := range c.Notes() {
+		out.WriteString(n.Format([]rune(src)))
+	}
+
+	vm := NewVM(c.Chunk, 256, 256)
+	vm.SetOutput(&out)
+	for vm.Next() {
+	}
+
+	if err := vm.Error(); err != nil {
+		out.WriteString(err.FormatSource([]rune(src)))
+	}
+
+	return out.String()
+}
+
+// TestGolden run the programs in testdata/golden, comparing their output to the .golden file next to them. Run with
+// -update to write the golden files.
+func TestGolden(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join("testdata", "golden", "*.ang"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, file := range files {
+		t.Run(filepath.Base(file), func(t *testing.T) {
+			src, err := os.ReadFile(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			output := goldenOutput(string(src))
+			golden := strings.TrimSuffix(file, ".ang") + ".golden"
+
+			if *update {
+				if err := os.WriteFile(golden, []byte(output), 0666); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			expected, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatalf("missing golden file, run with -update to create it: %v", err)
+			}
+
+			if output != string(expected) {
+				t.Errorf("output differs from %s\n--- expected ---\n%s\n--- got ---\n%s", golden, expected, output)
+			}
+		})
+	}
+}
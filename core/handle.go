@@ -0,0 +1,137 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// HandleValue a resource outside the VM, such as a file or a socket. Handles are opened through the VM, which closes
+// the ones still open when it is closed itself (see VM.OpenHandle). The host may revoke a handle to take the resource
+// back from the program, after which the handle no longer refers to it (see VM.Revoke).
+type HandleValue struct {
+	name     string
+	resource io.Closer
+	closed   bool
+	revoked  bool
+}
+
+// Resource get the resource of the handle, or nil if it has been closed or revoked
+func (v *HandleValue) Resource() io.Closer {
+	if v.closed {
+		return nil
+	}
+
+	return v.resource
+}
+
+// Use get the resource of the handle, for builtins using it, failing if it has been closed or revoked
+func (v *HandleValue) Use() (io.Closer, error) {
+	if v.revoked {
+		return nil, errors.New(fmt.Sprintf("%s has been revoked", v.name))
+	} else if v.closed {
+		return nil, errors.New(fmt.Sprintf("%s is closed", v.name))
+	}
+
+	return v.resource, nil
+}
+
+// Object get the Go value a handle was bound to with VM.Bind, or nil if it has been revoked or was opened otherwise
+func (v *HandleValue) Object() any {
+	if b, ok := v.Resource().(bound); ok {
+		return b.object
+	}
+
+	return nil
+}
+
+// Close close the resource of the handle. Closing a handle which is already closed or revoked does nothing.
+func (v *HandleValue) Close() error {
+	if v.closed {
+		return nil
+	}
+
+	v.closed = true
+
+	if err := v.resource.Close(); err != nil {
+		return errors.New(fmt.Sprintf("failed to close %s: %v", v.name, err))
+	}
+
+	return nil
+}
+
+// revoke let go of the resource of the handle without closing it, as it belongs to the host
+func (v *HandleValue) revoke() {
+	v.closed, v.revoked = true, true
+	v.resource = nil
+}
+
+// bound a Go value bound to a handle, which there is nothing to close of
+type bound struct {
+	object any
+}
+
+func (b bound) Close() error {
+	return nil
+}
+
+func (v *HandleValue) Type() ValueType {
+	return HandleValueType
+}
+
+func (v *HandleValue) String() string {
+	if v.revoked {
+		return fmt.Sprintf("<handle %s revoked>", v.name)
+	} else if v.closed {
+		return fmt.Sprintf("<handle %s closed>", v.name)
+	}
+
+	return fmt.Sprintf("<handle %s>", v.name)
+}
+
+func (v *HandleValue) DebugString() string {
+	return v.String()
+}
+
+func (v *HandleValue) Equals(other Value) bool {
+	return v == other
+}
+
+func (v *HandleValue) Hash() uint64 {
+	return uint64(HandleValueType)
+}
+
+var HandlePrototype = map[string]*BuiltinFunctionValue{
+	"close": {
+		"close",
+		[]string{},
+		func(_ *VM, this Value, p map[string]Value) (Value, error) {
+			return &NilValue{}, this.(*HandleValue).Close()
+		},
+		nil,
+	},
+	"isClosed": {
+		"isClosed",
+		[]string{},
+		func(_ *VM, this Value, p map[string]Value) (Value, error) {
+			return &BoolValue{this.(*HandleValue).closed}, nil
+		},
+		nil,
+	},
+	"isRevoked": {
+		"isRevoked",
+		[]string{},
+		func(_ *VM, this Value, p map[string]Value) (Value, error) {
+			return &BoolValue{this.(*HandleValue).revoked}, nil
+		},
+		nil,
+	},
+}
+
+func (v *HandleValue) Get(key string) (Value, error) {
+	if prop, ok := HandlePrototype[key]; ok {
+		return prop, nil
+	}
+
+	return nil, errors.New(fmt.Sprintf("handle has no property \"%s\"", key))
+}
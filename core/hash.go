@@ -0,0 +1,101 @@
+package core
+
+import (
+	"hash/fnv"
+	"math"
+	"math/big"
+)
+
+// hashDepth how deep lists and objects are hashed. What is nested deeper only adds its type, so values containing
+// themselves can be hashed, and equal values still hash the same.
+const hashDepth = 8
+
+// hashBytes hash bytes of a kind of value, so a string and bytes with the same contents hash differently
+func hashBytes(kind ValueType, b []byte) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte{byte(kind)})
+	h.Write(b)
+
+	return h.Sum64()
+}
+
+// mix combine a hash into another, depending on their order
+func mix(h uint64, other uint64) uint64 {
+	return (h ^ other) * 1099511628211
+}
+
+// hashInteger hash an integer, whether it is a number or a bigint, as they are equal when they are the same integer
+func hashInteger(n *big.Int) uint64 {
+	if n.IsInt64() {
+		return hashInt64(n.Int64())
+	}
+
+	return mix(hashBytes(BigIntValueType, n.Bytes()), uint64(n.Sign()))
+}
+
+func hashInt64(n int64) uint64 {
+	return mix(uint64(NumberValueType), uint64(n))
+}
+
+// hashNumber hash a float, which is hashed as an integer if it is one
+func hashNumber(f float64) uint64 {
+	if f == math.Trunc(f) && math.Abs(f) < 1<<63 {
+		return hashInt64(int64(f))
+	} else if n, ok := (&NumberValue{f, nil}).toBigInt(); ok {
+		return hashInteger(n)
+	}
+
+	return mix(uint64(NumberValueType), math.Float64bits(f))
+}
+
+// hashNested hash a list, an object, a set or a dictionary, hashing their items no deeper than hashDepth
+func hashNested(v Value, depth int) uint64 {
+	h := uint64(v.Type())
+	if depth >= hashDepth {
+		return h
+	}
+
+	switch v := v.(type) {
+	case *ListValue:
+		for _, item := range v.items {
+			h = mix(h, hashAt(item, depth+1))
+		}
+	case *ObjectValue:
+		// summed, as the members have no order
+		sum := uint64(0)
+		for key, member := range v.members {
+			sum += mix(hashBytes(StringValueType, []byte(key)), hashAt(member, depth+1))
+		}
+
+		h = mix(h, sum)
+	case *SetValue:
+		// summed as well, as sets with the same items are equal whichever order they were added in
+		sum := uint64(0)
+		v.items.each(func(item Value, _ Value) bool {
+			sum += hashAt(item, depth+1)
+			return true
+		})
+
+		h = mix(h, sum)
+	case *DictValue:
+		sum := uint64(0)
+		v.entries.each(func(key Value, value Value) bool {
+			sum += mix(hashAt(key, depth+1), hashAt(value, depth+1))
+			return true
+		})
+
+		h = mix(h, sum)
+	}
+
+	return h
+}
+
+// hashAt hash a value nested in a list or an object
+func hashAt(v Value, depth int) uint64 {
+	switch v.(type) {
+	case *ListValue, *ObjectValue, *SetValue, *DictValue:
+		return hashNested(v, depth)
+	}
+
+	return v.Hash()
+}
@@ -0,0 +1,87 @@
+package core
+
+import (
+	"fmt"
+	"strings"
+)
+
+// TypeInfo what is known of the expression at a place in the source of a program, for editors to show when hovering
+// over it and the REPL to show for :type
+type TypeInfo struct {
+	// Token the token of the expression
+	Token *Token
+	// Kind the type deduced for the value of the expression, any if it can't be deduced
+	Kind string
+	// Signature a short description of the expression, such as func f(a, b) or x := number
+	Signature string
+	// Name the name the expression refers to, empty if it isn't a reference or declaration
+	Name string
+	// Declaration where the name was declared, nil if it isn't known, such as for builtins
+	Declaration *Token
+}
+
+// TypeAt get what is known of the expression at an offset of the source of a program, or nil if there is none there
+// or the program wasn't compiled from source (see Compile). Types are deduced as the compiler deduces them to check
+// the program, so the types of expressions whose values can't be known while compiling are any.
+func TypeAt(p *Program, offset Pos) *TypeInfo {
+	if p.parsed == nil {
+		return nil
+	}
+
+	// the program is compiled again, keeping the types the compiler deduces. Nothing is folded, so every expression
+	// is compiled, and the program has compiled before, so it succeeds.
+	c := p.parsed.options.compiler()
+	c.SetPositions(p.parsed.positions)
+	c.SetFolding(false)
+	c.kinds = map[*Token]string{}
+	_ = c.Compile(p.parsed.tree)
+
+	if o := p.Symbols().At(offset); o != nil {
+		return symbolInfo(o, c.kinds[o.Token])
+	}
+
+	for _, token := range p.parsed.positions {
+		if kind, ok := c.kinds[token]; ok && token.Start <= offset && offset <= token.Start+token.Length {
+			return &TypeInfo{Token: token, Kind: kind, Signature: kind}
+		}
+	}
+
+	return nil
+}
+
+// symbolInfo describe an occurrence of a symbol, which is of the kind deduced for it there
+func symbolInfo(o *Occurrence, kind string) *TypeInfo {
+	if kind == "" {
+		kind = "any"
+	}
+
+	s := o.Symbol
+	info := &TypeInfo{Token: o.Token, Kind: kind, Name: s.Name, Declaration: s.Declaration}
+
+	switch {
+	case s.Kind == SymbolParameter && kind != "any":
+		info.Signature = fmt.Sprintf("parameter %s: %s", s.Name, kind)
+	case s.Kind == SymbolVariable && s.Declaration != nil:
+		info.Signature = fmt.Sprintf("%s := %s", s.Name, kind)
+	case s.Declaration == nil && s.Kind != SymbolParameter:
+		// names which aren't declared in the program are globals, which may be builtins
+		builtin := DefaultBuiltins.Get(s.Name)
+		for _, module := range StandardModules {
+			if builtin == nil {
+				builtin = module.Get(s.Name)
+			}
+		}
+
+		if builtin == nil {
+			info.Signature = fmt.Sprintf("%s (global)", s.Name)
+			break
+		}
+
+		info.Kind = "function"
+		info.Signature = fmt.Sprintf("func %s(%s) (builtin)", builtin.Name, strings.Join(builtin.Signature.Params, ", "))
+	default:
+		info.Signature = s.Signature()
+	}
+
+	return info
+}
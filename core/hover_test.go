@@ -0,0 +1,76 @@
+package core
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTypeAt(t *testing.T) {
+	src := `type Point {
+	x: number,
+	y: number
+}
+
+func length(p: Point) {
+	return p.x + p.y
+}
+
+origin := Point(0, 0)
+name := "origin"
+size := length(origin)
+write(name)
+`
+	program, err := Compile(src, CompileOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	at := func(s string, n int) Pos {
+		i := -1
+		for ; n > 0; n-- {
+			i += 1 + strings.Index(src[i+1:], s)
+		}
+
+		return Pos(len([]rune(src[:i])))
+	}
+
+	for _, test := range []struct {
+		offset      Pos
+		signature   string
+		kind        string
+		declaration bool
+	}{
+		// the parameter, in the body of length
+		{at("p.x", 1), "parameter p: Point", "Point", true},
+		// the member of it
+		{at("x +", 1), "number", "number", false},
+		{at("origin", 1), "origin := Point", "Point", true},
+		{at("origin", 3), "origin := Point", "Point", true},
+		{at("name", 2), "name := string", "string", true},
+		{at("length", 2), "func length(p)", "function", true},
+		{at("write", 1), "func write(value) (builtin)", "function", false},
+	} {
+		info := TypeAt(program, test.offset)
+		if info == nil {
+			t.Errorf("expected type information at %d, got none", test.offset)
+			continue
+		}
+
+		if info.Signature != test.signature || info.Kind != test.kind || (info.Declaration != nil) != test.declaration {
+			t.Errorf("expected %q of kind %s at %d, got %+v", test.signature, test.kind, test.offset, info)
+		}
+	}
+
+	if info := TypeAt(program, at("{", 1)); info != nil {
+		t.Errorf("expected no type information at a brace, got %+v", info)
+	}
+
+	loaded, err := LoadProgram(program.Serialize())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if info := TypeAt(loaded, at("origin", 1)); info != nil {
+		t.Errorf("expected programs loaded from bytecode to have no type information, got %+v", info)
+	}
+}
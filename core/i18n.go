@@ -0,0 +1,50 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"golang.org/x/text/cases"
+	"golang.org/x/text/collate"
+	"golang.org/x/text/language"
+	"golang.org/x/text/unicode/norm"
+)
+
+// locale get the language of a BCP 47 tag given to a string method, such as "en-GB" or "tr". An empty tag is no
+// language in particular.
+func locale(v Value) (language.Tag, error) {
+	s, ok := v.(*StringValue)
+	if !ok {
+		return language.Und, errors.New(fmt.Sprintf("the locale must be a string, got %s", TypeOf(v)))
+	} else if s.string == "" {
+		return language.Und, nil
+	}
+
+	tag, err := language.Parse(s.string)
+	if err != nil {
+		return language.Und, errors.New(fmt.Sprintf("invalid locale %s", s.string))
+	}
+
+	return tag, nil
+}
+
+// changeCase convert a string to upper or lower case by the rules of a language, such as Turkish with its dotted i
+func changeCase(s string, tag language.Tag, upper bool) string {
+	if upper {
+		return cases.Upper(tag).String(s)
+	}
+
+	return cases.Lower(tag).String(s)
+}
+
+// normalForms the Unicode normal forms strings can be normalized to
+var normalForms = map[string]norm.Form{
+	"NFC":  norm.NFC,
+	"NFD":  norm.NFD,
+	"NFKC": norm.NFKC,
+	"NFKD": norm.NFKD,
+}
+
+// collateStrings compare two strings as they are ordered in a language, returning -1, 0 or 1
+func collateStrings(a string, b string, tag language.Tag) int {
+	return collate.New(tag).CompareString(a, b)
+}
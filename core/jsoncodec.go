@@ -0,0 +1,315 @@
+package core
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+)
+
+// JSONCodec chunks written as JSON for people to read, with each instruction named and each constant tagged with its
+// type, so the output of the compiler can be diffed in tests and bug reports. It is much larger than BinaryCodec.
+var JSONCodec Codec = jsonCodec{}
+
+// jsonChunk a chunk as JSONCodec writes it
+type jsonChunk struct {
+	Instructions []jsonInstruction `json:"instructions"`
+	Constants    []jsonConstant    `json:"constants"`
+	Decimal      bool              `json:"decimal,omitempty"`
+	Strict       bool              `json:"strict,omitempty"`
+	Exports      []jsonExport      `json:"exports,omitempty"`
+}
+
+// jsonInstruction an instruction and the bytes of its operand. Its disassembly is only written for people to read, and
+// is left out when decoding.
+type jsonInstruction struct {
+	Offset      Pos    `json:"offset"`
+	Op          string `json:"op"`
+	Operands    []int  `json:"operands,omitempty"`
+	Disassembly string `json:"disassembly"`
+	Line        Pos    `json:"line"`
+	File        string `json:"file,omitempty"`
+}
+
+// jsonConstant a constant, the fields other than its type being those of its kind: the value of nils, booleans,
+// numbers, decimals (as fractions), strings and bigints, the items of lists and the name, parameters and chunk of
+// functions
+type jsonConstant struct {
+	Type   string          `json:"type"`
+	Value  json.RawMessage `json:"value,omitempty"`
+	Items  []jsonConstant  `json:"items,omitempty"`
+	Frozen bool            `json:"frozen,omitempty"`
+	Name   string          `json:"name,omitempty"`
+	Params []string        `json:"params,omitempty"`
+	Chunk  *jsonChunk      `json:"chunk,omitempty"`
+}
+
+type jsonExport struct {
+	Name     string   `json:"name"`
+	Global   bool     `json:"global,omitempty"`
+	Function bool     `json:"function,omitempty"`
+	Params   []string `json:"params,omitempty"`
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Encode(c *Chunk) ([]byte, error) {
+	j, err := toJSONChunk(c)
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := json.MarshalIndent(j, "", "\t")
+	return append(b, '\n'), err
+}
+
+func (jsonCodec) Decode(b []byte) (*Chunk, error) {
+	j := &jsonChunk{}
+	if err := json.Unmarshal(b, j); err != nil {
+		return nil, err
+	}
+
+	return fromJSONChunk(j)
+}
+
+func toJSONChunk(c *Chunk) (*jsonChunk, error) {
+	j := &jsonChunk{
+		Instructions: []jsonInstruction{},
+		Constants:    make([]jsonConstant, len(c.Constants)),
+		Decimal:      c.Decimal,
+		Strict:       c.Strict,
+	}
+
+	for at := Pos(0); int(at) < len(c.Bytecode); {
+		b := c.Bytecode[at]
+		if !b.valid() {
+			return nil, errors.New(fmt.Sprintf("unknown instruction %d at %d", b, at))
+		}
+
+		end := min(int(at)+1+operands(b).width(), len(c.Bytecode))
+		operand := make([]int, 0, end-int(at)-1)
+		for _, o := range c.Bytecode[at+1 : end] {
+			operand = append(operand, int(o))
+		}
+
+		j.Instructions = append(j.Instructions, jsonInstruction{at, opcodes[b].name, operand, c.Disassemble(at), c.Line(at), c.File(at)})
+		at = Pos(end)
+	}
+
+	for i, constant := range c.Constants {
+		v, err := toJSONConstant(constant)
+		if err != nil {
+			return nil, err
+		}
+
+		j.Constants[i] = v
+	}
+
+	for _, export := range c.Exports {
+		j.Exports = append(j.Exports, jsonExport{export.Name, export.Global, export.Function, export.Params})
+	}
+
+	return j, nil
+}
+
+func toJSONConstant(v Value) (jsonConstant, error) {
+	switch v := v.(type) {
+	case *NilValue:
+		return jsonConstant{Type: "nil"}, nil
+	case *BoolValue:
+		return jsonConstant{Type: "bool", Value: json.RawMessage(strconv.FormatBool(v.bool))}, nil
+	case *NumberValue:
+		if v.decimal != nil {
+			return jsonConstant{Type: "decimal", Value: jsonString(v.decimal.RatString())}, nil
+		}
+
+		// JSON has no infinities, so they are written as strings
+		if math.IsInf(v.float64, 0) || math.IsNaN(v.float64) {
+			return jsonConstant{Type: "number", Value: jsonString(strconv.FormatFloat(v.float64, 'g', -1, 64))}, nil
+		}
+
+		return jsonConstant{Type: "number", Value: json.RawMessage(strconv.FormatFloat(v.float64, 'g', -1, 64))}, nil
+	case *StringValue:
+		return jsonConstant{Type: "string", Value: jsonString(v.string)}, nil
+	case *BigIntValue:
+		return jsonConstant{Type: "bigint", Value: jsonString(v.int.String())}, nil
+	case *ListValue:
+		items := make([]jsonConstant, len(v.items))
+		for i, item := range v.items {
+			c, err := toJSONConstant(item)
+			if err != nil {
+				return jsonConstant{}, err
+			}
+
+			items[i] = c
+		}
+
+		return jsonConstant{Type: "list", Items: items, Frozen: v.frozen}, nil
+	case *FunctionValue:
+		chunk, err := toJSONChunk(v.Chunk)
+		if err != nil {
+			return jsonConstant{}, err
+		}
+
+		return jsonConstant{Type: "function", Name: v.Name, Params: v.Params, Chunk: chunk}, nil
+	}
+
+	return jsonConstant{}, errors.New(fmt.Sprintf("%s values can't be serialized as constants", v.Type()))
+}
+
+// jsonString write a string as JSON
+func jsonString(s string) json.RawMessage {
+	b, _ := json.Marshal(s)
+	return b
+}
+
+// opcodeNames the instructions by their names, for reading them from JSON
+var opcodeNames = func() map[string]Bytecode {
+	names := make(map[string]Bytecode, len(opcodes))
+	for b, op := range opcodes {
+		names[op.name] = Bytecode(b)
+	}
+
+	return names
+}()
+
+func fromJSONChunk(j *jsonChunk) (*Chunk, error) {
+	c := &Chunk{Decimal: j.Decimal, Strict: j.Strict}
+
+	files := false
+	for _, instruction := range j.Instructions {
+		b, ok := opcodeNames[instruction.Op]
+		if !ok {
+			return nil, errors.New(fmt.Sprintf("unknown instruction %s", instruction.Op))
+		}
+
+		if width := operands(b).width(); len(instruction.Operands) != width {
+			return nil, errors.New(fmt.Sprintf("%s at %d takes %d bytes of operands, got %d", instruction.Op, instruction.Offset, width, len(instruction.Operands)))
+		}
+
+		c.Bytecode = append(c.Bytecode, b)
+		for _, operand := range instruction.Operands {
+			if operand < 0 || operand > math.MaxUint8 {
+				return nil, errors.New(fmt.Sprintf("the operand of %s at %d isn't a byte: %d", instruction.Op, instruction.Offset, operand))
+			}
+
+			c.Bytecode = append(c.Bytecode, Bytecode(operand))
+		}
+
+		// each byte of the instruction is of its line and file
+		for len(c.Lines) < len(c.Bytecode) {
+			c.Lines = append(c.Lines, instruction.Line)
+			c.Files = append(c.Files, instruction.File)
+		}
+		files = files || instruction.File != ""
+	}
+
+	// the bytecode is only marked with files when some of it is of a file, as the compiler does
+	if !files {
+		c.Files = nil
+	}
+
+	for _, constant := range j.Constants {
+		v, err := fromJSONConstant(constant)
+		if err != nil {
+			return nil, err
+		}
+
+		c.Constants = append(c.Constants, v)
+	}
+
+	for _, export := range j.Exports {
+		c.Exports = append(c.Exports, Export{export.Name, export.Global, export.Function, export.Params})
+	}
+
+	return c, nil
+}
+
+func fromJSONConstant(j jsonConstant) (Value, error) {
+	switch j.Type {
+	case "nil":
+		return &NilValue{}, nil
+	case "bool":
+		var b bool
+		if err := json.Unmarshal(j.Value, &b); err != nil {
+			return nil, errors.New(fmt.Sprintf("invalid bool: %v", err))
+		}
+
+		return &BoolValue{b}, nil
+	case "number":
+		var f float64
+		if err := json.Unmarshal(j.Value, &f); err == nil {
+			return &NumberValue{f, nil}, nil
+		}
+
+		var s string
+		if err := json.Unmarshal(j.Value, &s); err != nil {
+			return nil, errors.New(fmt.Sprintf("invalid number: %s", j.Value))
+		}
+
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("invalid number: %s", j.Value))
+		}
+
+		return &NumberValue{f, nil}, nil
+	case "decimal":
+		var s string
+		if err := json.Unmarshal(j.Value, &s); err != nil {
+			return nil, errors.New(fmt.Sprintf("invalid decimal: %s", j.Value))
+		}
+
+		r, ok := new(big.Rat).SetString(s)
+		if !ok {
+			return nil, errors.New(fmt.Sprintf("invalid decimal: %s", j.Value))
+		}
+
+		return newDecimal(r), nil
+	case "string":
+		var s string
+		if err := json.Unmarshal(j.Value, &s); err != nil {
+			return nil, errors.New(fmt.Sprintf("invalid string: %s", j.Value))
+		}
+
+		return &StringValue{s}, nil
+	case "bigint":
+		var s string
+		if err := json.Unmarshal(j.Value, &s); err != nil {
+			return nil, errors.New(fmt.Sprintf("invalid integer: %s", j.Value))
+		}
+
+		n, ok := new(big.Int).SetString(s, 10)
+		if !ok {
+			return nil, errors.New(fmt.Sprintf("invalid integer: %s", j.Value))
+		}
+
+		return &BigIntValue{n}, nil
+	case "list":
+		items := make([]Value, len(j.Items))
+		for i, item := range j.Items {
+			v, err := fromJSONConstant(item)
+			if err != nil {
+				return nil, err
+			}
+
+			items[i] = v
+		}
+
+		return &ListValue{items, j.Frozen, false}, nil
+	case "function":
+		if j.Chunk == nil {
+			return nil, errors.New(fmt.Sprintf("function %s has no chunk", j.Name))
+		}
+
+		chunk, err := fromJSONChunk(j.Chunk)
+		if err != nil {
+			return nil, err
+		}
+
+		return &FunctionValue{Name: j.Name, Params: j.Params, Chunk: chunk}, nil
+	}
+
+	return nil, errors.New(fmt.Sprintf("unknown constant type %q", j.Type))
+}
@@ -3,6 +3,7 @@ package core
 import (
 	"errors"
 	"fmt"
+	"strings"
 	"unicode"
 )
 
@@ -31,6 +32,8 @@ const (
 	TokenNumber
 	TokenString
 	TokenName
+	TokenHeredoc
+	TokenBigInt
 
 	TokenOpenParenthesis
 	TokenCloseParenthesis
@@ -50,6 +53,23 @@ const (
 	TokenIf
 	TokenElse
 	TokenImport
+	TokenAs
+	TokenGlobal
+	TokenComptime
+	TokenDiscard
+	TokenPragma
+	TokenFor
+	TokenTypeKeyword
+	TokenDefer
+	TokenConst
+	TokenIn
+
+	TokenAmpersand
+	TokenPipe
+	TokenCaret
+	TokenShiftLeft
+	TokenShiftRight
+	TokenColon
 
 	TokenComma
 	TokenDot
@@ -65,6 +85,11 @@ const (
 
 	TokenDoubleAmpersand
 	TokenDoublePipe
+	TokenDoubleQuestion
+	TokenQuestionDot
+	TokenDotDot
+	TokenDotDotEqual
+	TokenEllipsis
 
 	TokenBreakpoint
 	TokenEOF
@@ -87,6 +112,8 @@ func (t TokenType) String() string {
 		return "number"
 	case TokenString:
 		return "string"
+	case TokenHeredoc:
+		return "heredoc"
 	case TokenTrue:
 		return "true"
 	case TokenFalse:
@@ -110,7 +137,7 @@ func (t TokenType) String() string {
 	case TokenAssign:
 		return "equals"
 	case TokenBangEquals:
-		return "equals"
+		return "bang equals"
 	case TokenEquals:
 		return "double equals"
 	case TokenGreaterThan:
@@ -147,17 +174,124 @@ func (t TokenType) String() string {
 		return "double ampersand"
 	case TokenDoublePipe:
 		return "double pipe"
+	case TokenDoubleQuestion:
+		return "double question"
+	case TokenQuestionDot:
+		return "question dot"
+	case TokenDotDot:
+		return "dot dot"
+	case TokenDotDotEqual:
+		return "dot dot equal"
+	case TokenEllipsis:
+		return "ellipsis"
 	case TokenOpenBracket:
 		return "open bracket"
 	case TokenCloseBracket:
 		return "close bracket"
 	case TokenImport:
 		return "import"
+	case TokenAs:
+		return "as"
+	case TokenGlobal:
+		return "global"
+	case TokenComptime:
+		return "comptime"
+	case TokenDiscard:
+		return "discard"
+	case TokenPragma:
+		return "pragma"
+	case TokenBigInt:
+		return "bigint"
+	case TokenFor:
+		return "for"
+	case TokenTypeKeyword:
+		return "type"
+	case TokenDefer:
+		return "defer"
+	case TokenConst:
+		return "const"
+	case TokenIn:
+		return "in"
+	case TokenAmpersand:
+		return "ampersand"
+	case TokenPipe:
+		return "pipe"
+	case TokenCaret:
+		return "caret"
+	case TokenShiftLeft:
+		return "shift left"
+	case TokenShiftRight:
+		return "shift right"
+	case TokenColon:
+		return "colon"
 	}
 
 	return "UNDEFINED TOKENTYPE STRING CONVERSION"
 }
 
+// Keywords the reserved words of the language and the tokens they lex to
+var Keywords = map[string]TokenType{
+	"true":       TokenTrue,
+	"false":      TokenFalse,
+	"nil":        TokenNil,
+	"if":         TokenIf,
+	"else":       TokenElse,
+	"var":        TokenVar,
+	"func":       TokenFunc,
+	"while":      TokenWhile,
+	"for":        TokenFor,
+	"breakpoint": TokenBreakpoint,
+	"return":     TokenReturn,
+	"import":     TokenImport,
+	"as":         TokenAs,
+	"global":     TokenGlobal,
+	"comptime":   TokenComptime,
+	"discard":    TokenDiscard,
+	"type":       TokenTypeKeyword,
+	"defer":      TokenDefer,
+	"const":      TokenConst,
+	"in":         TokenIn,
+}
+
+// Operators the punctuation of the language and the tokens they lex to
+var Operators = map[string]TokenType{
+	"+":   TokenPlus,
+	"-":   TokenMinus,
+	"*":   TokenStar,
+	"/":   TokenSlash,
+	"!":   TokenBang,
+	";":   TokenSemicolon,
+	"(":   TokenOpenParenthesis,
+	")":   TokenCloseParenthesis,
+	"[":   TokenOpenBracket,
+	"]":   TokenCloseBracket,
+	"{":   TokenOpenBrace,
+	"}":   TokenCloseBrace,
+	",":   TokenComma,
+	".":   TokenDot,
+	"=":   TokenAssign,
+	":=":  TokenDeclare,
+	"!=":  TokenBangEquals,
+	"==":  TokenEquals,
+	">":   TokenGreaterThan,
+	"<":   TokenLessThan,
+	">=":  TokenGreaterThanOrEqual,
+	"<=":  TokenLessThanOrEqual,
+	"&&":  TokenDoubleAmpersand,
+	"||":  TokenDoublePipe,
+	"??":  TokenDoubleQuestion,
+	"?.":  TokenQuestionDot,
+	"..":  TokenDotDot,
+	"..=": TokenDotDotEqual,
+	"...": TokenEllipsis,
+	"&":   TokenAmpersand,
+	"|":   TokenPipe,
+	"^":   TokenCaret,
+	"<<":  TokenShiftLeft,
+	">>":  TokenShiftRight,
+	":":   TokenColon,
+}
+
 type Lexer struct {
 	src     []rune
 	start   Pos
@@ -182,17 +316,21 @@ func (l *Lexer) NextToken() (Token, error) {
 		return l.makeToken(TokenEOF), nil
 	}
 
-	// skip comments
+	l.start = l.current
+
+	// skip comments, except pragmas (#pragma decimal), which are comments to anything not knowing them
 	if l.match('#') {
-		for !l.match('\n') {
+		for !l.isAtEnd() && !l.match('\n') {
 			l.advance()
 		}
 
+		if strings.HasPrefix(string(l.src[l.start:l.current]), "#pragma ") {
+			return l.makeToken(TokenPragma), nil
+		}
+
 		return l.NextToken()
 	}
 
-	l.start = l.current
-
 	var c = l.src[l.current]
 	l.advance()
 
@@ -232,13 +370,23 @@ func (l *Lexer) NextToken() (Token, error) {
 	case ',':
 		return l.makeToken(TokenComma), nil
 	case '.':
+		if l.accept('.') {
+			if l.accept('=') {
+				return l.makeToken(TokenDotDotEqual), nil
+			} else if l.accept('.') {
+				return l.makeToken(TokenEllipsis), nil
+			}
+
+			return l.makeToken(TokenDotDot), nil
+		}
+
 		return l.makeToken(TokenDot), nil
 	case ':':
-		if !l.accept('=') {
-			return l.makeToken(TokenError), errors.New("malformed token (got ':', expected '=' to follow)")
+		if l.accept('=') {
+			return l.makeToken(TokenDeclare), nil
 		}
 
-		return l.makeToken(TokenDeclare), nil
+		return l.makeToken(TokenColon), nil
 	case '!':
 		if l.accept('=') {
 			return l.makeToken(TokenBangEquals), nil
@@ -254,12 +402,20 @@ func (l *Lexer) NextToken() (Token, error) {
 	case '>':
 		if l.accept('=') {
 			return l.makeToken(TokenGreaterThanOrEqual), nil
+		} else if l.accept('>') {
+			return l.makeToken(TokenShiftRight), nil
 		}
 
 		return l.makeToken(TokenGreaterThan), nil
 	case '<':
+		if l.match('<') && l.current+1 < Pos(len(l.src)) && l.src[l.current+1] == '<' {
+			return l.heredoc()
+		}
+
 		if l.accept('=') {
 			return l.makeToken(TokenLessThanOrEqual), nil
+		} else if l.accept('<') {
+			return l.makeToken(TokenShiftLeft), nil
 		}
 
 		return l.makeToken(TokenLessThan), nil
@@ -269,14 +425,26 @@ func (l *Lexer) NextToken() (Token, error) {
 			return l.makeToken(TokenDoubleAmpersand), nil
 		}
 
-		return l.makeToken(TokenError), errors.New("malformed token (got '&', expected '&' to follow)")
+		return l.makeToken(TokenAmpersand), nil
 
 	case '|':
 		if l.accept('|') {
 			return l.makeToken(TokenDoublePipe), nil
 		}
 
-		return l.makeToken(TokenError), errors.New("malformed token (got '|', expected '|' to follow)")
+		return l.makeToken(TokenPipe), nil
+
+	case '^':
+		return l.makeToken(TokenCaret), nil
+
+	case '?':
+		if l.accept('?') {
+			return l.makeToken(TokenDoubleQuestion), nil
+		} else if l.accept('.') {
+			return l.makeToken(TokenQuestionDot), nil
+		}
+
+		return l.makeToken(TokenError), errors.New("expected ?? or ?.")
 
 	case '"':
 		// include ending quote
@@ -301,39 +469,24 @@ func (l *Lexer) NextToken() (Token, error) {
 				l.advance()
 			}
 
-			switch string(l.src[l.start:l.current]) {
-			case "true":
-				return l.makeToken(TokenTrue), nil
-			case "false":
-				return l.makeToken(TokenFalse), nil
-			case "nil":
-				return l.makeToken(TokenNil), nil
-			case "if":
-				return l.makeToken(TokenIf), nil
-			case "else":
-				return l.makeToken(TokenElse), nil
-			case "var":
-				return l.makeToken(TokenVar), nil
-			case "func":
-				return l.makeToken(TokenFunc), nil
-			case "while":
-				return l.makeToken(TokenWhile), nil
-			case "breakpoint":
-				return l.makeToken(TokenBreakpoint), nil
-			case "return":
-				return l.makeToken(TokenReturn), nil
-			case "import":
-				return l.makeToken(TokenImport), nil
-			default:
-				return l.makeToken(TokenName), nil
+			if t, ok := Keywords[string(l.src[l.start:l.current])]; ok {
+				return l.makeToken(t), nil
 			}
+
+			return l.makeToken(TokenName), nil
 		} else if unicode.IsDigit(c) {
 			for unicode.IsDigit(l.peek()) {
 				l.advance()
 			}
 
-			// if the number has a float-part
-			if l.accept('.') {
+			// integers followed by n are bigints
+			if l.accept('n') {
+				return l.makeToken(TokenBigInt), nil
+			}
+
+			// if the number has a float-part, rather than being the start of a range (1..10)
+			if l.match('.') && (int(l.current)+1 >= len(l.src) || l.src[l.current+1] != '.') {
+				l.advance()
 				for unicode.IsDigit(l.peek()) {
 					l.advance()
 				}
@@ -346,6 +499,65 @@ func (l *Lexer) NextToken() (Token, error) {
 	}
 }
 
+// heredoc lex a block of text which continues until a line with the delimiter following the <<< (<<<END ... END).
+// The lines in between are kept verbatim.
+func (l *Lexer) heredoc() (Token, error) {
+	// skip the rest of <<<
+	l.advance()
+	l.advance()
+
+	delimiterStart := l.current
+	for l.isAlpha(l.peek()) {
+		l.advance()
+	}
+	delimiter := string(l.src[delimiterStart:l.current])
+
+	if delimiter == "" {
+		return l.makeToken(TokenError), errors.New("heredoc is missing a delimiter after <<<")
+	}
+
+	if !l.accept('\n') {
+		return l.makeToken(TokenError), errors.New("heredoc delimiter must end the line")
+	}
+
+	for !l.isAtEnd() {
+		// check whether the line is the end of the heredoc
+		lineStart := l.current
+		for l.match(' ') || l.match('\t') {
+			l.advance()
+		}
+
+		end := l.current + Pos(len([]rune(delimiter)))
+		if end <= Pos(len(l.src)) && string(l.src[l.current:end]) == delimiter &&
+			(end == Pos(len(l.src)) || !l.isAlpha(l.src[end])) {
+			for l.current < end {
+				l.advance()
+			}
+
+			return l.makeToken(TokenHeredoc), nil
+		}
+
+		l.current = lineStart
+		for !l.isAtEnd() && !l.accept('\n') {
+			l.advance()
+		}
+	}
+
+	return l.makeToken(TokenError), errors.New(fmt.Sprintf("heredoc did not end with %s before end of source", delimiter))
+}
+
+// HeredocContent get the text within a heredoc token's lexeme, without the delimiter lines
+func HeredocContent(lexeme string) string {
+	start := strings.IndexByte(lexeme, '\n') + 1
+	end := strings.LastIndexByte(lexeme, '\n')
+
+	if end < start {
+		return ""
+	}
+
+	return lexeme[start:end]
+}
+
 func NewToken(t TokenType, start Pos, length Pos, line Pos, lexeme string) Token {
 	return Token{
 		Type:   t,
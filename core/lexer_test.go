@@ -23,6 +23,10 @@ func GetLexerTestData() map[string]LexerTestData {
 			"1024",
 			[]TokenType{TokenNumber, TokenEOF},
 		},
+		"bigint(3)": {
+			"1024n * 2",
+			[]TokenType{TokenBigInt, TokenStar, TokenNumber, TokenEOF},
+		},
 		"simple_arithmetics(7)": {
 			"1 + 23 / 4 * 3",
 			[]TokenType{
@@ -63,6 +67,25 @@ func GetLexerTestData() map[string]LexerTestData {
 				TokenEOF,
 			},
 		},
+		"bitwise": {
+			"a & b | c ^ 1 << 2 >> 3 && d",
+			[]TokenType{
+				TokenName, TokenAmpersand, TokenName, TokenPipe, TokenName, TokenCaret, TokenNumber, TokenShiftLeft,
+				TokenNumber, TokenShiftRight, TokenNumber, TokenDoubleAmpersand, TokenName,
+				TokenEOF,
+			},
+		},
+		"range": {
+			"1..10 1..=n 1.5",
+			[]TokenType{TokenNumber, TokenDotDot, TokenNumber, TokenNumber, TokenDotDotEqual, TokenName, TokenNumber, TokenEOF},
+		},
+		"spread": {
+			"f(...xs, 1...n)",
+			[]TokenType{
+				TokenName, TokenOpenParenthesis, TokenEllipsis, TokenName, TokenComma, TokenNumber, TokenEllipsis, TokenName,
+				TokenCloseParenthesis, TokenEOF,
+			},
+		},
 		"name": {
 			"print",
 			[]TokenType{TokenName, TokenEOF},
@@ -184,7 +207,7 @@ func TestNewLexer(t *testing.T) {
 func TestLexer_NextTokenErrors(t *testing.T) {
 	invalidCodes := []string{
 		// Invalid tokens
-		"^", "@", "$&", "¨",
+		"~", "@", "$&", "¨",
 		// Non-ending string (in same line)
 		"\"", "Hini minit \"mini moe", "\"this is some test\ncontent\"", "\n\"Hello world",
 	}
@@ -205,6 +228,27 @@ func TestLexer_NextTokenErrors(t *testing.T) {
 	}
 }
 
+func TestLexer_TokenTables(t *testing.T) {
+	tables := map[string]map[string]TokenType{
+		"keywords":  Keywords,
+		"operators": Operators,
+	}
+
+	for name, table := range tables {
+		for lexeme, expected := range table {
+			tok, err := NewLexer(lexeme).NextToken()
+			if err != nil {
+				t.Errorf("%s: unexpected error lexing '%s': %v", name, lexeme, err)
+				continue
+			}
+
+			if tok.Type != expected || tok.Lexeme != lexeme {
+				t.Errorf("%s: expected '%s' to lex to %s, got %s ('%s')", name, lexeme, expected, tok.Type, tok.Lexeme)
+			}
+		}
+	}
+}
+
 func BenchmarkNewLexer(b *testing.B) {
 	for i := 0; i < b.N; i++ {
 		_ = NewLexer("example source")
@@ -228,3 +272,36 @@ func BenchmarkLexer_NextToken(b *testing.B) {
 	}
 
 }
+
+func TestLexer_Heredoc(t *testing.T) {
+	cases := map[string]string{
+		"<<<END\nhello \"world\"\n  # not a comment\nEND": "hello \"world\"\n  # not a comment",
+		"<<<END\nEND":                         "",
+		"<<<EOF\nENDING\nEOF":                 "ENDING",
+		"<<<END\n\tindented\n\tEND":           "\tindented",
+		"<<<END\nline one\n\nline three\nEND": "line one\n\nline three",
+	}
+
+	for src, expected := range cases {
+		tokens, err := NewLexer(src + "\nx").Tokenize()
+		if err != nil {
+			t.Errorf("unexpected error lexing %q: %v", src, err)
+			continue
+		}
+
+		if len(tokens) != 3 || tokens[0].Type != TokenHeredoc || tokens[1].Type != TokenName {
+			t.Errorf("expected a heredoc followed by a name for %q, got %v", src, tokens)
+			continue
+		}
+
+		if content := HeredocContent(tokens[0].Lexeme); content != expected {
+			t.Errorf("expected content %q for %q, got %q", expected, src, content)
+		}
+	}
+
+	for _, src := range []string{"<<<\nEND", "<<<END", "<<<END\nnever ends"} {
+		if _, err := NewLexer(src).Tokenize(); err == nil {
+			t.Errorf("expected an error lexing %q", src)
+		}
+	}
+}
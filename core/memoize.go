@@ -0,0 +1,67 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+)
+
+func init() {
+	// registered here, as memoized functions call the functions they wrap, which refers back to the default builtins
+	if err := DefaultBuiltins.Register(Builtin{
+		"memoize",
+		Signature{[]string{"f"}},
+		false,
+		func(vm *VM, this Value, params map[string]Value) (Value, error) {
+			f := params["f"]
+			if !isFunction(f) {
+				return nil, errors.New(fmt.Sprintf("can only memoize functions, got %s", TypeOf(f)))
+			}
+
+			return memoize(f), nil
+		},
+	}); err != nil {
+		panic(err)
+	}
+}
+
+// memoize wrap a function so it is only called once for arguments which are equal, the result of the first call being
+// returned for the rest. Arguments are looked up by their hash, and kept as copies, so changing a list after calling
+// with it does not change what was memoized. Only pure functions should be memoized.
+func memoize(f Value) *BuiltinFunctionValue {
+	name, params := signature(f)
+	// the results of the calls, keyed by lists of their arguments
+	calls := newValueMap()
+
+	return &BuiltinFunctionValue{name, params, func(vm *VM, this Value, p map[string]Value) (Value, error) {
+		args := make([]Value, len(params))
+		for i, param := range params {
+			args[i] = p[param]
+		}
+
+		if result, ok := calls.get(NewList(args)); ok {
+			return result, nil
+		}
+
+		result, err := vm.Call(f, args)
+		if err != nil {
+			return nil, err
+		}
+
+		calls.set(NewList(args), result)
+		return result, nil
+	}, nil}
+}
+
+// signature get the name and parameters of a function value
+func signature(f Value) (string, []string) {
+	switch f := f.(type) {
+	case *FunctionValue:
+		return f.Name, f.Params
+	case *BuiltinFunctionValue:
+		return f.Name, f.Parameters
+	case *BoundFunctionValue:
+		return signature(f.Function)
+	}
+
+	return "", nil
+}
@@ -0,0 +1,78 @@
+package core
+
+import (
+	"math/big"
+	"testing"
+)
+
+func TestValue_Hash(t *testing.T) {
+	equal := [][2]Value{
+		{NewNumber(3), NewBigInt(big.NewInt(3))},
+		{NewNumber(0), NewNumber(-0.0)},
+		{NewNumber(1 << 70), NewBigInt(new(big.Int).Lsh(big.NewInt(1), 70))},
+		{NewString("a"), NewString("a")},
+		{NewList([]Value{NewNumber(1), NewString("b")}), NewList([]Value{NewNumber(1), NewString("b")})},
+		{
+			NewObject(map[string]Value{"a": NewNumber(1), "b": NewBool(true)}),
+			NewObject(map[string]Value{"b": NewBool(true), "a": NewNumber(1)}),
+		},
+		{NewSet([]Value{NewNumber(1), NewString("a")}), NewSet([]Value{NewString("a"), NewNumber(1)})},
+	}
+
+	for _, pair := range equal {
+		if !pair[0].Equals(pair[1]) {
+			t.Fatalf("Expected %s to equal %s", pair[0].DebugString(), pair[1].DebugString())
+		}
+
+		if pair[0].Hash() != pair[1].Hash() {
+			t.Errorf("Expected %s and %s to hash the same", pair[0].DebugString(), pair[1].DebugString())
+		}
+	}
+
+	different := [][2]Value{
+		{NewNumber(1), NewNumber(2)},
+		{NewString("a"), NewBytes([]byte("a"))},
+		{NewList([]Value{NewNumber(1), NewNumber(2)}), NewList([]Value{NewNumber(2), NewNumber(1)})},
+		{NewBool(true), NewBool(false)},
+		{NewNumber(0.5), NewNumber(1.5)},
+	}
+
+	for _, pair := range different {
+		if pair[0].Hash() == pair[1].Hash() {
+			t.Errorf("Expected %s and %s to hash differently", pair[0].DebugString(), pair[1].DebugString())
+		}
+	}
+
+	// lists containing themselves can be hashed
+	list := NewList([]Value{NewNumber(1)})
+	list.items = append(list.items, list)
+	list.Hash()
+}
+
+func TestMemoize(t *testing.T) {
+	vm := runSource(t, `calls := 0
+func slow(a, b) {
+	calls = calls + 1
+	return a.length() + b
+}
+
+fast := memoize(slow)
+list := [1, 2]
+first := fast(list, 1)
+second := fast([1, 2], 1)
+other := fast([1, 2], 2)
+list.append(3)
+changed := fast(list, 1)
+again := fast([1, 2], 1)`)
+
+	for name, expected := range map[string]Value{
+		"first":   NewNumber(3),
+		"second":  NewNumber(3),
+		"other":   NewNumber(4),
+		"changed": NewNumber(4),
+		"again":   NewNumber(3),
+		"calls":   NewNumber(3),
+	} {
+		CompareValues(t, vm.Variable(name), expected)
+	}
+}
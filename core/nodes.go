@@ -1,7 +1,9 @@
 package core
 
 import (
+	"errors"
 	"fmt"
+	"math/big"
 	"strconv"
 	"strings"
 )
@@ -31,6 +33,21 @@ const (
 	AccessNodeType
 	ImportNodeType
 	BreakpointNodeType
+	CastNodeType
+	GlobalNodeType
+	ComptimeNodeType
+	IndexNodeType
+	PragmaNodeType
+	BigIntNodeType
+	ForNodeType
+	DestructureNodeType
+	ObjectNodeType
+	TypeNodeType
+	DeferNodeType
+	ConstNodeType
+	RangeNodeType
+	SpreadNodeType
+	ForEachNodeType
 )
 
 func (n NodeType) String() string {
@@ -69,6 +86,36 @@ func (n NodeType) String() string {
 		return "Breakpoint"
 	case ImportNodeType:
 		return "Import"
+	case CastNodeType:
+		return "Cast"
+	case GlobalNodeType:
+		return "Global"
+	case ComptimeNodeType:
+		return "Comptime"
+	case IndexNodeType:
+		return "Index"
+	case PragmaNodeType:
+		return "Pragma"
+	case BigIntNodeType:
+		return "BigInt"
+	case ForNodeType:
+		return "For"
+	case DestructureNodeType:
+		return "Destructure"
+	case ObjectNodeType:
+		return "Object"
+	case TypeNodeType:
+		return "Type"
+	case DeferNodeType:
+		return "Defer"
+	case ConstNodeType:
+		return "Const"
+	case RangeNodeType:
+		return "Range"
+	case SpreadNodeType:
+		return "Spread"
+	case ForEachNodeType:
+		return "ForEach"
 	}
 	return "Invalid Node Type"
 }
@@ -112,6 +159,38 @@ func (n NumberNode) String() string {
 	return strconv.FormatFloat(n.value, 'g', -1, NumberSize)
 }
 
+// BigIntNode an integer of any size (123n)
+type BigIntNode struct {
+	value *big.Int
+}
+
+func (n BigIntNode) Type() NodeType {
+	return BigIntNodeType
+}
+
+func (n BigIntNode) String() string {
+	return n.value.String() + "n"
+}
+
+// ObjectNode an object literal ({"key": value}), the members of which are in the order they are written
+type ObjectNode struct {
+	keys   []string
+	values []Node
+}
+
+func (n ObjectNode) Type() NodeType {
+	return ObjectNodeType
+}
+
+func (n ObjectNode) String() string {
+	members := make([]string, len(n.keys))
+	for i, key := range n.keys {
+		members[i] = fmt.Sprintf("%q: %s", key, n.values[i])
+	}
+
+	return "{" + strings.Join(members, ", ") + "}"
+}
+
 // ListNode a list or sequence of values (items)
 type ListNode struct {
 	items []Node
@@ -137,6 +216,9 @@ func (n ListNode) String() string {
 type AccessNode struct {
 	source   Node
 	property string
+	// optional whether the property is only got if the source isn't nil (source?.property), the access being nil
+	// otherwise
+	optional bool
 }
 
 func (n AccessNode) Type() NodeType {
@@ -147,6 +229,20 @@ func (n AccessNode) String() string {
 	return fmt.Sprintf("(%s from %s)", n.property, n.source)
 }
 
+// IndexNode getting an item of a value by its index (source[index])
+type IndexNode struct {
+	source Node
+	index  Node
+}
+
+func (n IndexNode) Type() NodeType {
+	return IndexNodeType
+}
+
+func (n IndexNode) String() string {
+	return fmt.Sprintf("(%s at %s)", n.index, n.source)
+}
+
 type BinaryOperation uint
 
 func (n BinaryOperation) String() string {
@@ -175,6 +271,18 @@ func (n BinaryOperation) String() string {
 		return "and"
 	case BinaryOr:
 		return "or"
+	case BinaryCoalesce:
+		return "coalesce"
+	case BinaryBitwiseAnd:
+		return "bitwise and"
+	case BinaryBitwiseOr:
+		return "bitwise or"
+	case BinaryBitwiseXor:
+		return "bitwise xor"
+	case BinaryShiftLeft:
+		return "shift left"
+	case BinaryShiftRight:
+		return "shift right"
 	}
 
 	return "undefined arithmetic operation"
@@ -188,6 +296,9 @@ const (
 
 	BinaryAnd
 	BinaryOr
+	// BinaryCoalesce the left operand unless it is nil, in which case the right one (a ?? b), which is only evaluated
+	// then
+	BinaryCoalesce
 
 	// Comparison
 	BinaryEquality
@@ -196,6 +307,13 @@ const (
 	BinaryGreater
 	BinaryLessEqual
 	BinaryGreaterEqual
+
+	// Bitwise, on numbers truncated to integers
+	BinaryBitwiseAnd
+	BinaryBitwiseOr
+	BinaryBitwiseXor
+	BinaryShiftLeft
+	BinaryShiftRight
 )
 
 // BinaryNode All operations which take 2 variables
@@ -284,7 +402,7 @@ func (n ConditionalNode) String() string {
 	return fmt.Sprintf("if %s then %s otheriwise %s", n.condition.String(), n.do.String(), n.otherwise.String())
 }
 
-// LoopNode Loops (for/while)
+// LoopNode a while loop
 type LoopNode struct {
 	condition Node
 	do        Node
@@ -298,6 +416,39 @@ func (n LoopNode) String() string {
 	return fmt.Sprintf("while %s loop %s", n.condition.String(), n.do.String())
 }
 
+// ForNode a counting loop, which runs init once, and then the body and step for as long as the condition is true
+// (for i := 0; i < n; i = i + 1 { ... }). The variables init declares are only visible within the loop.
+type ForNode struct {
+	init      Node
+	condition Node
+	step      Node
+	do        Node
+}
+
+func (n ForNode) Type() NodeType {
+	return ForNodeType
+}
+
+func (n ForNode) String() string {
+	return fmt.Sprintf("for %s; %s; %s loop %s", n.init, n.condition, n.step, n.do)
+}
+
+// ForEachNode a loop going through the items of a list or the numbers of a range, running the body with a variable of
+// the name declared for each of them (for x in 1..10 { ... })
+type ForEachNode struct {
+	name  string
+	items Node
+	do    Node
+}
+
+func (n ForEachNode) Type() NodeType {
+	return ForEachNodeType
+}
+
+func (n ForEachNode) String() string {
+	return fmt.Sprintf("for %s in %s loop %s", n.name, n.items, n.do)
+}
+
 // AssignNode assignment
 type AssignNode struct {
 	name    string
@@ -313,6 +464,20 @@ func (n AssignNode) String() string {
 	return fmt.Sprintf("set %s to %s", n.name, n.value)
 }
 
+// DestructureNode a declaration of a variable for each item of a list ([a, b] := list). Items named _ are left out.
+type DestructureNode struct {
+	names []string
+	value Node
+}
+
+func (n DestructureNode) Type() NodeType {
+	return DestructureNodeType
+}
+
+func (n DestructureNode) String() string {
+	return fmt.Sprintf("destructure %s into [%s]", n.value, strings.Join(n.names, ", "))
+}
+
 // CallNode function call
 type CallNode struct {
 	source Node
@@ -332,13 +497,53 @@ func (n CallNode) String() string {
 type FunctionNode struct {
 	name   string
 	params []string
-	logic  Node
+	// types the types the parameters are declared with (func f(p: Point)), "" for those without one, nil if none has
+	types []string
+	// defaults the values of the parameters which callers may leave out (func f(n = 1)), nil for those without one,
+	// nil if none has. They are only the last parameters.
+	defaults []Node
+	logic    Node
 }
 
 func (n FunctionNode) Type() NodeType {
 	return FunctionNodeType
 }
 
+// paramType the type the parameter at i is declared with, any if it has none
+func (n FunctionNode) paramType(i int) string {
+	if i >= len(n.types) || n.types[i] == "" {
+		return "any"
+	}
+
+	return n.types[i]
+}
+
+// required how many arguments the function must be called with, which are those of the parameters without defaults
+func (n FunctionNode) required() int {
+	for i, d := range n.defaults {
+		if d != nil {
+			return i
+		}
+	}
+
+	return len(n.params)
+}
+
+// checkArgs check that the function is called with the right number of arguments, which may leave out the parameters
+// with defaults
+func (n FunctionNode) checkArgs(name string, args int) error {
+	required := n.required()
+	if required == len(n.params) {
+		return (Signature{n.params}).Check(name, args)
+	}
+
+	if args < required || args > len(n.params) {
+		return errors.New(fmt.Sprintf("%s takes %d to %d arguments, got %d", name, required, len(n.params), args))
+	}
+
+	return nil
+}
+
 func (n FunctionNode) String() string {
 	return fmt.Sprintf("definition of %s, do %s", n.name, n.logic.String())
 }
@@ -356,6 +561,20 @@ func (n ReturnNode) String() string {
 	return fmt.Sprintf("return %s", n.value)
 }
 
+// DeferNode a call made when the function it is in returns (defer f(x)). The function and its arguments are evaluated
+// where the defer is, and the calls deferred are made in the reverse order they were deferred in.
+type DeferNode struct {
+	call *CallNode
+}
+
+func (n DeferNode) Type() NodeType {
+	return DeferNodeType
+}
+
+func (n DeferNode) String() string {
+	return fmt.Sprintf("defer %s", n.call)
+}
+
 type BreakpointNode struct{}
 
 func (n BreakpointNode) Type() NodeType {
@@ -365,3 +584,194 @@ func (n BreakpointNode) Type() NodeType {
 func (n BreakpointNode) String() string {
 	return "breakpoint"
 }
+
+// CastNode a runtime checked conversion of a value to a type (value as type)
+type CastNode struct {
+	value  Node
+	target string
+}
+
+func (n CastNode) Type() NodeType {
+	return CastNodeType
+}
+
+func (n CastNode) String() string {
+	return fmt.Sprintf("%s as %s", n.value, n.target)
+}
+
+// RangeNode the numbers from a start up to an end (start..end), or through it (start..=end)
+type RangeNode struct {
+	start     Node
+	end       Node
+	inclusive bool
+}
+
+func (n RangeNode) Type() NodeType {
+	return RangeNodeType
+}
+
+func (n RangeNode) String() string {
+	if n.inclusive {
+		return fmt.Sprintf("%s..=%s", n.start, n.end)
+	}
+
+	return fmt.Sprintf("%s..%s", n.start, n.end)
+}
+
+// SpreadNode a list spread into the items of a list ([1, ...xs]) or the arguments of a call (f(...args))
+type SpreadNode struct {
+	value Node
+}
+
+func (n SpreadNode) Type() NodeType {
+	return SpreadNodeType
+}
+
+func (n SpreadNode) String() string {
+	return fmt.Sprintf("...%s", n.value)
+}
+
+// GlobalNode declaration of a global variable, which outlives the scope it is declared in
+type GlobalNode struct {
+	name  string
+	value Node
+}
+
+func (n GlobalNode) Type() NodeType {
+	return GlobalNodeType
+}
+
+func (n GlobalNode) String() string {
+	return fmt.Sprintf("set global %s to %s", n.name, n.value)
+}
+
+// ConstNode declaration of a variable which can't be given another value (const x = 42). References to it are
+// replaced with its value while compiling if the value is known then.
+type ConstNode struct {
+	name  string
+	value Node
+}
+
+func (n ConstNode) Type() NodeType {
+	return ConstNodeType
+}
+
+func (n ConstNode) String() string {
+	return fmt.Sprintf("declare constant %s as %s", n.name, n.value)
+}
+
+// ComptimeNode a block which is run while compiling, the value it returns being compiled in its place
+type ComptimeNode struct {
+	body Node
+}
+
+func (n ComptimeNode) Type() NodeType {
+	return ComptimeNodeType
+}
+
+func (n ComptimeNode) String() string {
+	return fmt.Sprintf("comptime %s", n.body)
+}
+
+// PragmaNode a setting of how the program is compiled (#pragma name)
+type PragmaNode struct {
+	name string
+}
+
+func (n PragmaNode) Type() NodeType {
+	return PragmaNodeType
+}
+
+func (n PragmaNode) String() string {
+	return fmt.Sprintf("#pragma %s", n.name)
+}
+
+// TypeNode a declaration of a type of objects (type Point { x: number, y: number }), which also declares a function of
+// the same name constructing objects of the type from the values of their members
+type TypeNode struct {
+	signature ObjectSignature
+	// constructor the function constructing objects of the type, which checks the types of the members
+	constructor *FunctionNode
+}
+
+func (n TypeNode) Type() NodeType {
+	return TypeNodeType
+}
+
+func (n TypeNode) String() string {
+	return fmt.Sprintf("type %s", n.signature)
+}
+
+// Children get the nodes directly beneath a node in the tree
+func Children(node Node) []Node {
+	var children []Node
+
+	switch n := node.(type) {
+	case *ListNode:
+		children = append(children, n.items...)
+	case *ObjectNode:
+		children = append(children, n.values...)
+	case *AccessNode:
+		children = append(children, n.source)
+	case *BinaryNode:
+		children = append(children, n.Left, n.Right)
+	case *BlockNode:
+		children = append(children, n.statements...)
+	case *ConditionalNode:
+		children = append(children, n.condition, n.do)
+		if n.otherwise != nil {
+			children = append(children, n.otherwise)
+		}
+	case *LoopNode:
+		children = append(children, n.condition, n.do)
+	case *ForNode:
+		children = append(children, n.init, n.condition, n.step, n.do)
+	case *ForEachNode:
+		children = append(children, n.items, n.do)
+	case *AssignNode:
+		children = append(children, n.value)
+	case *DestructureNode:
+		children = append(children, n.value)
+	case *CallNode:
+		children = append(children, n.args...)
+		children = append(children, n.source)
+	case *FunctionNode:
+		for _, d := range n.defaults {
+			if d != nil {
+				children = append(children, d)
+			}
+		}
+		children = append(children, n.logic)
+	case *ReturnNode:
+		children = append(children, n.value)
+	case *DeferNode:
+		children = append(children, n.call)
+	case *CastNode:
+		children = append(children, n.value)
+	case *GlobalNode:
+		children = append(children, n.value)
+	case *ConstNode:
+		children = append(children, n.value)
+	case *ComptimeNode:
+		children = append(children, n.body)
+	case *IndexNode:
+		children = append(children, n.source, n.index)
+	case *RangeNode:
+		children = append(children, n.start, n.end)
+	case *SpreadNode:
+		children = append(children, n.value)
+	}
+
+	return children
+}
+
+// Walk visit a node and every node beneath it, depth first. The nodes beneath a node are skipped if visit returns false.
+func Walk(node Node, visit func(Node) bool) {
+	if node == nil || !visit(node) {
+		return
+	}
+
+	for _, child := range Children(node) {
+		Walk(child, visit)
+	}
+}
@@ -0,0 +1,198 @@
+package core
+
+// operandKind what the bytes following an instruction are
+type operandKind int
+
+const (
+	// operandNone the instruction has no operand
+	operandNone operandKind = iota
+	// operandConstant the next byte is the index of a constant
+	operandConstant
+	// operandName the next byte is the index of a string constant, such as the name of a variable
+	operandName
+	// operandJump the next two bytes are a distance to jump forwards
+	operandJump
+	// operandLoop the next two bytes are a distance to jump backwards
+	operandLoop
+	// operandCount the next two bytes are a count, such as the number of items to form a list of
+	operandCount
+	// operandArguments the next byte is the number of arguments a function is called with
+	operandArguments
+	// operandCounterJump the next five bytes are the operands of a numeric for loop (see counterOperands), and the two
+	// after them a distance to jump forwards
+	operandCounterJump
+	// operandCounterLoop the operands of a numeric for loop, followed by a distance to jump backwards
+	operandCounterLoop
+)
+
+// width how many bytes the operand takes
+func (k operandKind) width() int {
+	switch k {
+	case operandConstant, operandName, operandArguments:
+		return 1
+	case operandJump, operandLoop, operandCount:
+		return 2
+	case operandCounterJump, operandCounterLoop:
+		return 7
+	}
+
+	return 0
+}
+
+// opcode what is known of an instruction: its name, its operand and how it changes the stack. Variables are left out
+// of the stack effect, as they are only removed when their scope ends; declaring one pops the value it is given.
+type opcode struct {
+	name    string
+	operand operandKind
+	// pops how many values the instruction takes off the stack. If popsOperand is set, the operand is added to it,
+	// such as for the arguments of a call.
+	pops        int
+	popsOperand bool
+	pushes      int
+}
+
+// opcodes the instructions, by their bytecode. Names, operands and stack effects are only kept here, so a new
+// instruction is declared, described here and executed by the VM.
+var opcodes = [...]opcode{
+	InstructionReturn: {"RETURN", operandNone, 1, false, 0},
+	InstructionPop:    {"POP", operandNone, 1, false, 0},
+
+	InstructionAdd:            {"ADD", operandNone, 2, false, 1},
+	InstructionSub:            {"SUB", operandNone, 2, false, 1},
+	InstructionMul:            {"MUL", operandNone, 2, false, 1},
+	InstructionDiv:            {"DIV", operandNone, 2, false, 1},
+	InstructionEquals:         {"EQUALS", operandNone, 2, false, 1},
+	InstructionNotEqual:       {"NOT_EQUALS", operandNone, 2, false, 1},
+	InstructionNot:            {"NOT", operandNone, 1, false, 1},
+	InstructionLess:           {"LESS", operandNone, 2, false, 1},
+	InstructionLessOrEqual:    {"LESS_OR_EQUAL", operandNone, 2, false, 1},
+	InstructionGreater:        {"GREATER", operandNone, 2, false, 1},
+	InstructionGreaterOrEqual: {"GREATER_OR_EQUAL", operandNone, 2, false, 1},
+
+	InstructionAccessProperty: {"ACCESS_PROPERTY", operandName, 1, false, 1},
+	// the function and its arguments
+	InstructionCall: {"CALL", operandArguments, 1, true, 1},
+
+	InstructionDescend: {"DESCEND", operandNone, 0, false, 0},
+	InstructionAscend:  {"ASCEND", operandNone, 0, false, 0},
+
+	InstructionJump:      {"JUMP", operandJump, 0, false, 0},
+	InstructionJumpFalse: {"JUMP_FALSE", operandJump, 1, false, 0},
+	InstructionLoop:      {"LOOP", operandLoop, 0, false, 0},
+
+	InstructionGetLocal:     {"GET_LOCAL", operandName, 0, false, 1},
+	InstructionSetLocal:     {"SET_LOCAL", operandName, 1, false, 0},
+	InstructionDeclareLocal: {"DECLARE_LOCAL", operandName, 1, false, 0},
+	InstructionGetGlobal:    {"GET_GLOBAL", operandName, 0, false, 1},
+	InstructionSetGlobal:    {"SET_GLOBAL", operandName, 1, false, 0},
+
+	InstructionStringConversion:    {"STRING_CONVERSION", operandNone, 1, false, 1},
+	InstructionStringConcatenation: {"STRING_CONCATENATION", operandNone, 2, false, 1},
+
+	InstructionSwap: {"SWAP", operandNone, 2, false, 2},
+
+	InstructionAnd: {"AND", operandNone, 2, false, 1},
+	InstructionOr:  {"OR", operandNone, 2, false, 1},
+
+	InstructionConstant: {"CONSTANT", operandConstant, 0, false, 1},
+	InstructionTrue:     {"TRUE", operandNone, 0, false, 1},
+	InstructionFalse:    {"FALSE", operandNone, 0, false, 1},
+	InstructionNil:      {"NIL", operandNone, 0, false, 1},
+
+	InstructionNewList: {"NEW_LIST", operandNone, 0, false, 1},
+	InstructionAppend:  {"APPEND", operandNone, 2, false, 1},
+	// the operand is the number of items minus one
+	InstructionFormList: {"FORM_LIST", operandCount, 1, true, 1},
+
+	InstructionBreakpoint: {"BREAKPOINT", operandNone, 0, false, 0},
+
+	// the value is checked where it is on the stack
+	InstructionCast:   {"CAST", operandName, 1, false, 1},
+	InstructionImport: {"IMPORT", operandName, 0, false, 0},
+	InstructionIndex:  {"INDEX", operandNone, 2, false, 1},
+
+	InstructionBitwiseAnd: {"BITWISE_AND", operandNone, 2, false, 1},
+	InstructionBitwiseOr:  {"BITWISE_OR", operandNone, 2, false, 1},
+	InstructionBitwiseXor: {"BITWISE_XOR", operandNone, 2, false, 1},
+	InstructionShiftLeft:  {"SHIFT_LEFT", operandNone, 2, false, 1},
+	InstructionShiftRight: {"SHIFT_RIGHT", operandNone, 2, false, 1},
+
+	InstructionDestructure: {"DESTRUCTURE", operandConstant, 1, false, 0},
+	// the operand is the number of keys and values
+	InstructionFormObject: {"FORM_OBJECT", operandCount, 0, true, 1},
+	// the value is looked at, not taken off the stack
+	InstructionJumpNil: {"JUMP_NIL", operandJump, 1, false, 1},
+	// the function and its arguments, which are kept until the function returns
+	InstructionDefer: {"DEFER", operandArguments, 1, true, 0},
+	// the counter and limit are variables, which are left out of the stack effect
+	InstructionForPrep: {"FOR_PREP", operandCounterJump, 0, false, 0},
+	InstructionForLoop: {"FOR_LOOP", operandCounterLoop, 0, false, 0},
+	InstructionClosure: {"CLOSURE", operandConstant, 1, false, 1},
+
+	InstructionRange:          {"RANGE", operandNone, 2, false, 1},
+	InstructionRangeInclusive: {"RANGE_INCLUSIVE", operandNone, 2, false, 1},
+
+	InstructionExtend:     {"EXTEND", operandNone, 2, false, 1},
+	InstructionCallSpread: {"CALL_SPREAD", operandNone, 2, false, 1},
+	// nil is pushed once the loop is left, for it to be popped there
+	InstructionIterate: {"ITERATE", operandJump, 0, false, 1},
+}
+
+// valid whether the bytecode is an instruction
+func (b Bytecode) valid() bool {
+	return int(b) < len(opcodes)
+}
+
+// operands get the kind of operand an instruction has
+func operands(b Bytecode) operandKind {
+	if !b.valid() {
+		return operandNone
+	}
+
+	return opcodes[b].operand
+}
+
+// effect how many values the instruction at a position of the chunk pops off the stack, and how many it pushes
+func (c *Chunk) effect(at Pos) (int, int) {
+	op := opcodes[c.Bytecode[at]]
+	if !op.popsOperand {
+		return op.pops, op.pushes
+	}
+
+	return op.pops + c.operand(at), op.pushes
+}
+
+// operand read the operand of the instruction at a position of the chunk as a number
+func (c *Chunk) operand(at Pos) int {
+	switch operands(c.Bytecode[at]).width() {
+	case 1:
+		return int(c.Bytecode[at+1])
+	case 2:
+		return int(c.Bytecode[at+1])<<8 | int(c.Bytecode[at+2])
+	case 7:
+		// the distance follows the operands of the loop
+		return int(c.Bytecode[at+6])<<8 | int(c.Bytecode[at+7])
+	}
+
+	return 0
+}
+
+// counterOperands what the instructions of a numeric for loop (for i := 0; i < n; i = i + 1) operate on, which are the
+// bytes following them
+type counterOperands struct {
+	// name the constant naming the counter
+	name Bytecode
+	// limit the constant the counter is compared to, which is a number, or a string naming the variable to compare it to
+	limit Bytecode
+	// step the constant the counter is changed by, with operation, each time
+	step Bytecode
+	// comparison the comparison instruction the loop goes on while true of the counter and limit
+	comparison Bytecode
+	// operation InstructionAdd or InstructionSub, which steps the counter
+	operation Bytecode
+}
+
+// counterOperands read the operands of the numeric for loop instruction at a position of the chunk
+func (c *Chunk) counterOperands(at Pos) counterOperands {
+	return counterOperands{c.Bytecode[at+1], c.Bytecode[at+2], c.Bytecode[at+3], c.Bytecode[at+4], c.Bytecode[at+5]}
+}
@@ -0,0 +1,383 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+// operations the verbs of the binary operations, for error messages
+var operations = map[Bytecode]string{
+	InstructionAnd:            "and",
+	InstructionOr:             "or",
+	InstructionAdd:            "add",
+	InstructionSub:            "subtract",
+	InstructionMul:            "multiply",
+	InstructionDiv:            "divide",
+	InstructionLess:           "compare",
+	InstructionLessOrEqual:    "compare",
+	InstructionGreater:        "compare",
+	InstructionGreaterOrEqual: "compare",
+	InstructionBitwiseAnd:     "bitwise and",
+	InstructionBitwiseOr:      "bitwise or",
+	InstructionBitwiseXor:     "bitwise xor",
+	InstructionShiftLeft:      "shift",
+	InstructionShiftRight:     "shift",
+}
+
+// the whole numbers arithmetic results in which are shared rather than allocated each time, as numbers are never
+// changed once made
+const (
+	smallNumberMin = -128
+	smallNumberMax = 1024
+)
+
+var smallNumbers = func() (numbers [smallNumberMax - smallNumberMin]NumberValue) {
+	for i := range numbers {
+		numbers[i].float64 = float64(i + smallNumberMin)
+	}
+
+	return numbers
+}()
+
+// number get a number which isn't a decimal, shared if it is a small whole number
+func number(f float64) *NumberValue {
+	// -0 is left out, as it isn't quite 0 (1 / -0 is -Inf)
+	if f >= smallNumberMin && f < smallNumberMax && f == math.Trunc(f) && (f != 0 || !math.Signbit(f)) {
+		return &smallNumbers[int(f)-smallNumberMin]
+	}
+
+	return &NumberValue{f, nil}
+}
+
+// numberOperation do an arithmetic or comparison instruction on two numbers which aren't decimals, which most are.
+// It is checked before anything else, so they skip looking for overloads and converting to decimals. Returns nil
+// for anything else, which binaryOperation does.
+func numberOperation(op Bytecode, l Value, r Value) Value {
+	ln, ok := l.(*NumberValue)
+	if !ok || ln.decimal != nil {
+		return nil
+	}
+
+	rn, ok := r.(*NumberValue)
+	if !ok || rn.decimal != nil {
+		return nil
+	}
+
+	switch op {
+	case InstructionAdd:
+		return number(ln.float64 + rn.float64)
+	case InstructionSub:
+		return number(ln.float64 - rn.float64)
+	case InstructionMul:
+		return number(ln.float64 * rn.float64)
+	case InstructionDiv:
+		return number(ln.float64 / rn.float64)
+	case InstructionLess:
+		return &BoolValue{ln.float64 < rn.float64}
+	case InstructionLessOrEqual:
+		return &BoolValue{ln.float64 <= rn.float64}
+	case InstructionGreater:
+		return &BoolValue{ln.float64 > rn.float64}
+	case InstructionGreaterOrEqual:
+		return &BoolValue{ln.float64 >= rn.float64}
+	}
+
+	return nil
+}
+
+// compare turn the result of comparing two values (-1, 0 or 1) into the result of a comparison instruction
+func compare(op Bytecode, c int) Value {
+	switch op {
+	case InstructionLess:
+		return &BoolValue{c < 0}
+	case InstructionLessOrEqual:
+		return &BoolValue{c <= 0}
+	case InstructionGreater:
+		return &BoolValue{c > 0}
+	case InstructionGreaterOrEqual:
+		return &BoolValue{c >= 0}
+	}
+
+	return nil
+}
+
+// arithmetic do an arithmetic or comparison instruction on two values. Numbers and bigints support every operation,
+// strings can be added (concatenated), and dates and durations can be added to and subtracted from each other.
+// Durations may be multiplied and divided by numbers. Anything else is an error, such as adding a number to a date.
+func arithmetic(op Bytecode, l Value, r Value) (Value, error) {
+	switch l := l.(type) {
+	case *BigIntValue:
+		return bigIntArithmetic(op, l, r)
+
+	case *NumberValue:
+		if _, ok := r.(*BigIntValue); ok {
+			return bigIntArithmetic(op, l, r)
+		}
+
+		if r, ok := r.(*NumberValue); ok && op >= InstructionBitwiseAnd {
+			return bitwise(op, l.float64, r.float64)
+		}
+
+		if r, ok := r.(*NumberValue); ok {
+			// numbers are only as exact as the least exact of them
+			if l.decimal != nil || r.decimal != nil {
+				if l, r := l.toDecimal(), r.toDecimal(); l.decimal != nil && r.decimal != nil {
+					return decimalArithmetic(op, l.decimal, r.decimal)
+				}
+			}
+
+			switch op {
+			case InstructionAdd:
+				return &NumberValue{l.float64 + r.float64, nil}, nil
+			case InstructionSub:
+				return &NumberValue{l.float64 - r.float64, nil}, nil
+			case InstructionMul:
+				return &NumberValue{l.float64 * r.float64, nil}, nil
+			case InstructionDiv:
+				return &NumberValue{l.float64 / r.float64, nil}, nil
+			}
+
+			// compared directly rather than with compare, as NaN is neither less, greater nor equal to anything
+			switch op {
+			case InstructionLess:
+				return &BoolValue{l.float64 < r.float64}, nil
+			case InstructionLessOrEqual:
+				return &BoolValue{l.float64 <= r.float64}, nil
+			case InstructionGreater:
+				return &BoolValue{l.float64 > r.float64}, nil
+			case InstructionGreaterOrEqual:
+				return &BoolValue{l.float64 >= r.float64}, nil
+			}
+		}
+
+		// numbers can scale durations from either side
+		if r, ok := r.(*DurationValue); ok && op == InstructionMul {
+			return &DurationValue{time.Duration(l.float64 * float64(r.duration))}, nil
+		}
+
+	case *StringValue:
+		if r, ok := r.(*StringValue); ok && op == InstructionAdd {
+			return &StringValue{l.string + r.string}, nil
+		}
+
+	case *DateValue:
+		switch r := r.(type) {
+		case *DurationValue:
+			switch op {
+			case InstructionAdd:
+				return &DateValue{l.time.Add(r.duration)}, nil
+			case InstructionSub:
+				return &DateValue{l.time.Add(-r.duration)}, nil
+			}
+		case *DateValue:
+			if op == InstructionSub {
+				return &DurationValue{l.time.Sub(r.time)}, nil
+			}
+
+			if c := compare(op, l.time.Compare(r.time)); c != nil {
+				return c, nil
+			}
+		}
+
+	case *DurationValue:
+		switch r := r.(type) {
+		case *DurationValue:
+			switch op {
+			case InstructionAdd:
+				return &DurationValue{l.duration + r.duration}, nil
+			case InstructionSub:
+				return &DurationValue{l.duration - r.duration}, nil
+			}
+
+			c := 0
+			if l.duration < r.duration {
+				c = -1
+			} else if l.duration > r.duration {
+				c = 1
+			}
+
+			if c := compare(op, c); c != nil {
+				return c, nil
+			}
+		case *DateValue:
+			if op == InstructionAdd {
+				return &DateValue{r.time.Add(l.duration)}, nil
+			}
+		case *NumberValue:
+			switch op {
+			case InstructionMul:
+				return &DurationValue{time.Duration(float64(l.duration) * r.float64)}, nil
+			case InstructionDiv:
+				return &DurationValue{time.Duration(float64(l.duration) / r.float64)}, nil
+			}
+		}
+	}
+
+	return nil, errors.New(fmt.Sprintf("cannot %s %s and %s", operations[op], TypeOf(l), TypeOf(r)))
+}
+
+// bitwise do a bitwise instruction on two numbers, truncated to 64-bit integers
+func bitwise(op Bytecode, l float64, r float64) (Value, error) {
+	for _, n := range []float64{l, r} {
+		if math.IsNaN(n) || math.IsInf(n, 0) {
+			return nil, errors.New(fmt.Sprintf("cannot %s %s, only finite numbers", operations[op], DefaultNumberFormat.Format(n)))
+		}
+	}
+
+	li, ri := int64(l), int64(r)
+	switch op {
+	case InstructionBitwiseAnd:
+		return &NumberValue{float64(li & ri), nil}, nil
+	case InstructionBitwiseOr:
+		return &NumberValue{float64(li | ri), nil}, nil
+	case InstructionBitwiseXor:
+		return &NumberValue{float64(li ^ ri), nil}, nil
+	}
+
+	if ri < 0 {
+		return nil, errors.New(fmt.Sprintf("cannot shift by a negative amount, got %d", ri))
+	} else if op == InstructionShiftLeft {
+		return &NumberValue{float64(li << ri), nil}, nil
+	}
+
+	return &NumberValue{float64(li >> ri), nil}, nil
+}
+
+// binaryOperation do the binary operation of an instruction on two values. Both the VM and the compiler (when it
+// computes constant expressions) do binary operations with this, so they can't disagree on what they result in.
+func binaryOperation(op Bytecode, l Value, r Value) (Value, error) {
+	switch op {
+	case InstructionEquals:
+		return &BoolValue{l.Equals(r)}, nil
+	case InstructionNotEqual:
+		return &BoolValue{!l.Equals(r)}, nil
+	case InstructionAnd, InstructionOr:
+		lb, lok := l.(*BoolValue)
+		rb, rok := r.(*BoolValue)
+		if !lok || !rok {
+			return nil, errors.New(fmt.Sprintf("cannot %s %s and %s", operations[op], TypeOf(l), TypeOf(r)))
+		}
+
+		if op == InstructionAnd {
+			return &BoolValue{lb.bool && rb.bool}, nil
+		}
+
+		return &BoolValue{lb.bool || rb.bool}, nil
+	}
+
+	return arithmetic(op, l, r)
+}
+
+// overloads the methods objects can have to overload the operators of instructions
+var overloads = map[Bytecode]string{
+	InstructionAdd:            "add",
+	InstructionEquals:         "equals",
+	InstructionNotEqual:       "equals",
+	InstructionLess:           "compare",
+	InstructionLessOrEqual:    "compare",
+	InstructionGreater:        "compare",
+	InstructionGreaterOrEqual: "compare",
+}
+
+// overload get the method an object operand has for the instruction, along with the operands it is called on (the
+// object first). Equality is symmetric, so either operand may overload it; other operators are overloaded by the left
+// operand.
+func overload(op Bytecode, l Value, r Value) (Value, Value, Value) {
+	name, ok := overloads[op]
+	if !ok {
+		return nil, nil, nil
+	}
+
+	if object, ok := l.(*ObjectValue); ok && isFunction(object.members[name]) {
+		return object.members[name], l, r
+	}
+
+	if object, ok := r.(*ObjectValue); ok && name == "equals" && isFunction(object.members[name]) {
+		return object.members[name], r, l
+	}
+
+	return nil, nil, nil
+}
+
+// isFunction whether a value can be called
+func isFunction(v Value) bool {
+	switch v.(type) {
+	case *FunctionValue, *BuiltinFunctionValue, *BoundFunctionValue:
+		return true
+	}
+
+	return false
+}
+
+// bind bind a method to the value it is called on, unless it is already bound to another
+func bind(method Value, this Value) Value {
+	if _, ok := method.(*BoundFunctionValue); ok {
+		return method
+	}
+
+	return &BoundFunctionValue{method, this}
+}
+
+// binaryOperation do the binary operation of an instruction on two values, calling the method of an object operand
+// which overloads it if there is one. add returns the sum, equals whether the operands are equal and compare a
+// negative number, zero or a positive number, as the object is less than, equal to or greater than the other operand.
+func (vm *VM) binaryOperation(op Bytecode, l Value, r Value) (Value, error) {
+	// numbers which aren't decimals, such as those returned by builtins, are made decimals in programs in decimal mode
+	if vm.chunk.Decimal {
+		l, r = decimalValue(l), decimalValue(r)
+	}
+
+	method, this, other := overload(op, l, r)
+	if method == nil {
+		return binaryOperation(op, l, r)
+	}
+
+	name := overloads[op]
+	result, err := vm.Call(bind(method, this), []Value{other})
+	if err != nil {
+		return nil, err
+	}
+
+	switch op {
+	case InstructionAdd:
+		return result, nil
+	case InstructionEquals, InstructionNotEqual:
+		b, ok := result.(*BoolValue)
+		if !ok {
+			return nil, errors.New(fmt.Sprintf("%s must return a bool, got %s", name, TypeOf(result)))
+		}
+
+		return &BoolValue{b.bool == (op == InstructionEquals)}, nil
+	}
+
+	n, ok := result.(*NumberValue)
+	if !ok || n.float64 != n.float64 {
+		return nil, errors.New(fmt.Sprintf("%s must return a number, got %s", name, result.DebugString()))
+	}
+
+	c := 0
+	if n.float64 < 0 {
+		c = -1
+	} else if n.float64 > 0 {
+		c = 1
+	}
+
+	return compare(op, c), nil
+}
+
+// index get the item of a value at an index. Objects with an index method are indexed by calling it, other values
+// by calling their at method, so source[i] is the same as source.at(i).
+func (vm *VM) index(source Value, index Value) (Value, error) {
+	if object, ok := source.(*ObjectValue); ok && isFunction(object.members["index"]) {
+		return vm.Call(bind(object.members["index"], source), []Value{index})
+	}
+
+	at, err := source.Get("at")
+	if err != nil || !isFunction(at) {
+		return nil, errors.New(fmt.Sprintf("cannot index %s", TypeOf(source)))
+	}
+
+	return vm.Call(bind(at, source), []Value{index})
+}
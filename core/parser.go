@@ -4,6 +4,8 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"math/big"
+	"slices"
 	"strconv"
 	"strings"
 )
@@ -57,21 +59,86 @@ func (p *ParsingError) Format(src []rune) string {
 	return builder.String()
 }
 
+// Positions the token each node of a parse tree was parsed from
+type Positions map[Node]*Token
+
 type Parser struct {
-	tokens []Token
-	prev   *Token
-	curr   *Token
-	pos    Pos
+	tokens    []Token
+	prev      *Token
+	curr      *Token
+	pos       Pos
+	positions Positions
 }
 
 func NewParser(tokens []Token) *Parser {
 	return &Parser{
-		tokens: tokens,
-		pos:    0,
+		tokens:    tokens,
+		pos:       0,
+		positions: make(Positions),
+	}
+}
+
+// Positions get the tokens the nodes of the parsed tree begin at
+func (p *Parser) Positions() Positions {
+	return p.positions
+}
+
+// track remember the token a node began at, unless a more precise position is already known
+func (p *Parser) track(start *Token, node *Node) {
+	if *node == nil || start == nil {
+		return
+	}
+
+	if _, ok := p.positions[*node]; !ok {
+		p.positions[*node] = start
+	}
+}
+
+// param the parameter of a function at an index, as parameters aren't nodes of their own. Positions keep where they
+// are declared by these.
+type param struct {
+	function *FunctionNode
+	index    int
+}
+
+func (n param) Type() NodeType {
+	return FunctionNodeType
+}
+
+func (n param) String() string {
+	return n.function.params[n.index]
+}
+
+// trackParams record where the parameters of a function are declared
+func (p *Parser) trackParams(f *FunctionNode, tokens []*Token) {
+	for i, token := range tokens {
+		var n Node = param{f, i}
+		p.track(token, &n)
 	}
 }
 
-func (p *Parser) Parse() (Node, error) {
+// paramNames the names of the parameters parsed by parseParams
+func paramNames(tokens []*Token) []string {
+	names := make([]string, len(tokens))
+	for i, token := range tokens {
+		names[i] = token.Lexeme
+	}
+
+	return names
+}
+
+func (p *Parser) Parse() (n Node, err error) {
+	// statements left unfinished run out of tokens, which ends parsing wherever it is
+	defer func() {
+		if r := recover(); r != nil {
+			if _, ok := r.(endOfInput); !ok {
+				panic(r)
+			}
+
+			n, err = nil, p.error("unexpected end of input", p.curr)
+		}
+	}()
+
 	// top level statements
 	statements := make([]Node, 0)
 
@@ -122,6 +189,9 @@ func (p *Parser) peek() (Token, error) {
 	return p.tokens[p.pos], nil
 }
 
+// endOfInput what advance panics with once there are no more tokens, which Parse recovers from
+type endOfInput struct{}
+
 func (p *Parser) advance() {
 	p.prev = p.curr
 
@@ -129,7 +199,7 @@ func (p *Parser) advance() {
 		p.curr = &p.tokens[p.pos]
 		p.pos++
 	} else {
-		panic("no more tokens")
+		panic(endOfInput{})
 	}
 }
 
@@ -140,7 +210,9 @@ func (p *Parser) error(error string, causer *Token) error {
 	}
 }
 
-func (p *Parser) factor() (Node, error) {
+func (p *Parser) factor() (n Node, err error) {
+	defer p.track(p.curr, &n)
+
 	switch (*p.curr).Type {
 	case TokenString:
 		p.advance()
@@ -149,6 +221,13 @@ func (p *Parser) factor() (Node, error) {
 			(*p.prev).Lexeme,
 		}, nil
 
+	case TokenHeredoc:
+		p.advance()
+		return &StringNode{
+			HeredocContent(p.prev.Lexeme),
+			p.prev.Lexeme,
+		}, nil
+
 	case TokenNumber:
 		p.advance()
 		num, err := strconv.ParseFloat((*p.prev).Lexeme, NumberSize)
@@ -161,6 +240,17 @@ func (p *Parser) factor() (Node, error) {
 			num,
 		}, nil
 
+	case TokenBigInt:
+		p.advance()
+		num, ok := new(big.Int).SetString(strings.TrimSuffix(p.prev.Lexeme, "n"), 10)
+		if !ok {
+			return nil, p.error("Error parsing bigint", p.prev)
+		}
+
+		return &BigIntNode{
+			num,
+		}, nil
+
 	case TokenTrue:
 		p.advance()
 		return &BooleanNode{
@@ -187,7 +277,7 @@ func (p *Parser) factor() (Node, error) {
 				}
 			}
 
-			value, err := p.condition()
+			value, err := p.item()
 
 			if err != nil {
 				return nil, err
@@ -200,6 +290,45 @@ func (p *Parser) factor() (Node, error) {
 			values,
 		}, nil
 
+	case TokenOpenBrace:
+		p.advance()
+
+		var keys []string
+		var values []Node
+		for !p.accept(TokenCloseBrace) {
+			if len(keys) > 0 {
+				if err := p.expect(TokenComma); err != nil {
+					return nil, err
+				}
+			}
+
+			if err := p.expect(TokenString); err != nil {
+				return nil, err
+			}
+
+			key := p.prev.Lexeme[1 : len(p.prev.Lexeme)-1]
+			if slices.Contains(keys, key) {
+				return nil, p.error(fmt.Sprintf("duplicate key %q in object", key), p.prev)
+			}
+
+			if err := p.expect(TokenColon); err != nil {
+				return nil, err
+			}
+
+			value, err := p.condition()
+			if err != nil {
+				return nil, err
+			}
+
+			keys = append(keys, key)
+			values = append(values, value)
+		}
+
+		return &ObjectNode{
+			keys,
+			values,
+		}, nil
+
 	// unary minus
 	case TokenMinus:
 		p.advance()
@@ -218,15 +347,18 @@ func (p *Parser) factor() (Node, error) {
 		name := (*p.prev).Lexeme
 
 		if p.curr.Type == TokenOpenParenthesis {
+			var source Node = &ReferenceNode{
+				name,
+			}
+			p.track(p.prev, &source)
+
 			args, err := p.parseArgs()
 			if err != nil {
 				return nil, err
 			}
 
 			return &CallNode{
-				&ReferenceNode{
-					name,
-				},
+				source,
 				args,
 				true,
 			}, nil
@@ -238,7 +370,7 @@ func (p *Parser) factor() (Node, error) {
 
 	case TokenFunc:
 		p.advance()
-		params, err := p.parseParams()
+		params, types, defaults, err := p.parseParams()
 		if err != nil {
 			return nil, err
 		}
@@ -248,9 +380,59 @@ func (p *Parser) factor() (Node, error) {
 			return nil, err
 		}
 
-		return &FunctionNode{
+		f := &FunctionNode{
+			"*",
+			paramNames(params),
+			types,
+			defaults,
+			b,
+		}
+		p.trackParams(f, params)
+
+		return f, nil
+
+	// lambda, |x| x * 2, which returns the expression after its parameters
+	case TokenPipe, TokenDoublePipe:
+		p.advance()
+		params := make([]*Token, 0)
+		var types []string
+		if p.prev.Type == TokenPipe {
+			params, types, _, err = p.paramList(TokenPipe)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		start := p.curr
+		v, err := p.condition()
+		if err != nil {
+			return nil, err
+		}
+
+		var body Node = &ReturnNode{
+			v,
+		}
+		p.track(start, &body)
+
+		f := &FunctionNode{
 			"*",
-			params,
+			paramNames(params),
+			types,
+			nil,
+			&BlockNode{[]Node{body}},
+		}
+		p.trackParams(f, params)
+
+		return f, nil
+
+	case TokenComptime:
+		p.advance()
+		b, err := p.block(false)
+		if err != nil {
+			return nil, err
+		}
+
+		return &ComptimeNode{
 			b,
 		}, nil
 
@@ -268,19 +450,47 @@ func (p *Parser) factor() (Node, error) {
 
 	default:
 		err := p.error("invalid factor", p.curr)
-		p.advance()
+
+		// there is nothing after the end of the file to carry on from
+		if p.curr.Type != TokenEOF {
+			p.advance()
+		}
+
 		return nil, err
 	}
 }
 
-func (p *Parser) prop() (Node, error) {
+func (p *Parser) prop() (n Node, err error) {
+	defer p.track(p.curr, &n)
+
 	v, err := p.factor()
 	if err != nil {
 		return nil, err
 	}
 
-	// parse chains of prop-getting ( "".split().join().length.round() )
-	for p.accept(TokenDot) {
+	// parse chains of prop-getting ( "".split().join().length.round() ) and indexing ( rows[0][1] ). A bracket on a
+	// new line begins a statement destructuring a list rather than indexing the line before. Props got with ?. are
+	// only got from values which aren't nil ( user?.name ).
+	for p.accept(TokenDot) || p.accept(TokenQuestionDot) || (p.curr.Line == p.prev.Line && p.accept(TokenOpenBracket)) {
+		if p.prev.Type == TokenOpenBracket {
+			index, err := p.condition()
+			if err != nil {
+				return nil, err
+			}
+
+			if err := p.expect(TokenCloseBracket); err != nil {
+				return nil, err
+			}
+
+			v = &IndexNode{
+				v,
+				index,
+			}
+
+			continue
+		}
+
+		optional := p.prev.Type == TokenQuestionDot
 		if err := p.expect(TokenName); err != nil {
 			return nil, err
 		}
@@ -289,7 +499,9 @@ func (p *Parser) prop() (Node, error) {
 		v = &AccessNode{
 			v,
 			property,
+			optional,
 		}
+		p.track(p.prev, &v)
 
 		// if called, also add
 		if (*p.curr).Type == TokenOpenParenthesis {
@@ -306,20 +518,96 @@ func (p *Parser) prop() (Node, error) {
 		}
 	}
 
+	for p.accept(TokenAs) {
+		target, err := p.typeName()
+		if err != nil {
+			return nil, err
+		}
+
+		v = &CastNode{
+			v,
+			target,
+		}
+	}
+
 	return v, nil
 }
 
-func (p *Parser) product() (Node, error) {
+// typeName parse the name of a type, which for dictionaries may name the types of their keys and values
+// (dict[number]string), and for objects must name the type of their members (map[string]number). Types declared with
+// type are known by the compiler, so any name beginning with a capital letter may be one. Types followed by |nil
+// (Node|nil) may also be nil.
+func (p *Parser) typeName() (string, error) {
+	if err := p.expect(TokenName); err != nil {
+		return "", err
+	}
+
+	name := p.prev.Lexeme
+	if name == "map" {
+		if err := p.expect(TokenOpenBracket); err != nil {
+			return "", err
+		}
+	} else if !IsTypeName(name) && !IsDeclaredTypeName(name) {
+		return "", p.error(fmt.Sprintf("unknown type %s", name), p.prev)
+	} else if name != "dict" || !p.accept(TokenOpenBracket) {
+		return p.nullable(name), nil
+	}
+
+	key, err := p.typeName()
+	if err != nil {
+		return "", err
+	}
+
+	// the members of objects are named by strings
+	if name == "map" && key != "string" {
+		return "", p.error(fmt.Sprintf("the keys of maps are strings, got %s", key), p.prev)
+	}
+
+	if err := p.expect(TokenCloseBracket); err != nil {
+		return "", err
+	}
+
+	of, err := p.typeName()
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%s[%s]%s", name, key, of), nil
+}
+
+// nullable parse |nil after the name of a type, which lets its values also be nil (Node|nil)
+func (p *Parser) nullable(name string) string {
+	if next, err := p.peek(); err != nil || p.curr.Type != TokenPipe || next.Type != TokenNil {
+		return name
+	}
+
+	p.advance()
+	p.advance()
+
+	return name + "|nil"
+}
+
+func (p *Parser) product() (n Node, err error) {
+	defer p.track(p.curr, &n)
+
 	left, err := p.prop()
 	if err != nil {
 		return nil, err
 	}
 
-	for p.accept(TokenStar) || p.accept(TokenSlash) {
+	for p.accept(TokenStar) || p.accept(TokenSlash) || p.accept(TokenAmpersand) || p.accept(TokenShiftLeft) ||
+		p.accept(TokenShiftRight) {
 		op := BinaryMultiplication
 
-		if (*p.prev).Type == TokenSlash {
+		switch (*p.prev).Type {
+		case TokenSlash:
 			op = BinaryDivision
+		case TokenAmpersand:
+			op = BinaryBitwiseAnd
+		case TokenShiftLeft:
+			op = BinaryShiftLeft
+		case TokenShiftRight:
+			op = BinaryShiftRight
 		}
 
 		f, err := p.prop()
@@ -337,17 +625,24 @@ func (p *Parser) product() (Node, error) {
 	return left, nil
 }
 
-func (p *Parser) term() (Node, error) {
+func (p *Parser) term() (n Node, err error) {
+	defer p.track(p.curr, &n)
+
 	left, err := p.product()
 	if err != nil {
 		return nil, err
 	}
 
-	for p.accept(TokenPlus) || p.accept(TokenMinus) {
+	for p.accept(TokenPlus) || p.accept(TokenMinus) || p.accept(TokenPipe) || p.accept(TokenCaret) {
 		op := BinaryAddition
 
-		if (*p.prev).Type == TokenMinus {
+		switch (*p.prev).Type {
+		case TokenMinus:
 			op = BinarySubtraction
+		case TokenPipe:
+			op = BinaryBitwiseOr
+		case TokenCaret:
+			op = BinaryBitwiseXor
 		}
 
 		pr, err := p.product()
@@ -365,8 +660,36 @@ func (p *Parser) term() (Node, error) {
 	return left, nil
 }
 
-func (p *Parser) comparison() (Node, error) {
+// span parse a range (1..10, or 1..=10 to include the end), whose ends are terms
+func (p *Parser) span() (n Node, err error) {
+	defer p.track(p.curr, &n)
+
 	left, err := p.term()
+	if err != nil {
+		return nil, err
+	}
+
+	if !p.accept(TokenDotDot) && !p.accept(TokenDotDotEqual) {
+		return left, nil
+	}
+	inclusive := p.prev.Type == TokenDotDotEqual
+
+	right, err := p.term()
+	if err != nil {
+		return nil, err
+	}
+
+	return &RangeNode{
+		left,
+		right,
+		inclusive,
+	}, nil
+}
+
+func (p *Parser) comparison() (n Node, err error) {
+	defer p.track(p.curr, &n)
+
+	left, err := p.span()
 
 	if err != nil {
 		return nil, err
@@ -393,7 +716,7 @@ func (p *Parser) comparison() (Node, error) {
 
 	p.advance()
 
-	t, err := p.term()
+	t, err := p.span()
 
 	if err != nil {
 		return nil, err
@@ -406,7 +729,34 @@ func (p *Parser) comparison() (Node, error) {
 	}, nil
 }
 
-func (p *Parser) condition() (Node, error) {
+// condition parse an expression, the operands of ?? being the lowest in precedence (a || b ?? c is (a || b) ?? c)
+func (p *Parser) condition() (n Node, err error) {
+	defer p.track(p.curr, &n)
+
+	left, err := p.logical()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.accept(TokenDoubleQuestion) {
+		right, err := p.logical()
+		if err != nil {
+			return nil, err
+		}
+
+		left = &BinaryNode{
+			BinaryCoalesce,
+			left,
+			right,
+		}
+	}
+
+	return left, nil
+}
+
+func (p *Parser) logical() (n Node, err error) {
+	defer p.track(p.curr, &n)
+
 	left, err := p.comparison()
 	if err != nil {
 		return nil, err
@@ -437,7 +787,9 @@ func (p *Parser) condition() (Node, error) {
 	}, nil
 }
 
-func (p *Parser) statement() (Node, error) {
+func (p *Parser) statement() (n Node, err error) {
+	defer p.track(p.curr, &n)
+
 	switch (*p.curr).Type {
 	case TokenIf:
 		p.advance()
@@ -473,56 +825,11 @@ func (p *Parser) statement() (Node, error) {
 		}, nil
 
 	case TokenName:
-		p.advance()
-		name := (*p.prev).Lexeme
-
-		if (*p.curr).Type == TokenDot {
-			var v Node = &ReferenceNode{
-				name,
-			}
-
-			// parse chains of prop-getting ( "".split().join().length.round() )
-			for p.accept(TokenDot) {
-				if err := p.expect(TokenName); err != nil {
-					return nil, err
-				}
-				property := (*p.prev).Lexeme
+		if next, err := p.peek(); err == nil && (next.Type == TokenAssign || next.Type == TokenDeclare) {
+			p.advance()
+			name := p.prev.Lexeme
 
-				v = &AccessNode{
-					v,
-					property,
-				}
-
-				// if called, also add
-				if (*p.curr).Type == TokenOpenParenthesis {
-					args, err := p.parseArgs()
-					if err != nil {
-						return nil, err
-					}
-
-					v = &CallNode{
-						v,
-						args,
-						(*p.curr).Type == TokenDot, // if the chain is continued, keep the value.
-					}
-				}
-			}
-
-			return v, nil
-		} else if p.curr.Type == TokenOpenParenthesis {
-			args, err := p.parseArgs()
-			if err != nil {
-				return nil, err
-			}
-
-			return &CallNode{
-				&ReferenceNode{
-					name,
-				},
-				args,
-				false,
-			}, nil
-		} else if p.accept(TokenAssign) || p.accept(TokenDeclare) {
+			p.advance()
 			isDeclaration := p.prev.Type == TokenDeclare
 			c, err := p.condition()
 			if err != nil {
@@ -534,10 +841,133 @@ func (p *Parser) statement() (Node, error) {
 				c,
 				isDeclaration,
 			}, nil
-		} else {
-			return p.condition()
 		}
 
+		start := p.curr
+		v, err := p.condition()
+		if err != nil {
+			return nil, err
+		}
+
+		// the result of the outermost call of a statement is unused, while calls it is chained onto are kept
+		// ( list.append(1).length() )
+		call, ok := v.(*CallNode)
+		if !ok {
+			return nil, p.error("only calls and assignments can be statements, use discard to leave the value unused", start)
+		}
+
+		call.keep = false
+
+		return call, nil
+
+	case TokenOpenBracket:
+		p.advance()
+
+		// declaring the items of a list ([a, _, b] := list)
+		var names []string
+		for !p.accept(TokenCloseBracket) {
+			if len(names) > 0 {
+				if err := p.expect(TokenComma); err != nil {
+					return nil, err
+				}
+			}
+
+			if err := p.expect(TokenName); err != nil {
+				return nil, err
+			}
+
+			names = append(names, p.prev.Lexeme)
+		}
+
+		if len(names) == 0 {
+			return nil, p.error("cannot destructure into no names", p.prev)
+		}
+
+		if err := p.expect(TokenDeclare); err != nil {
+			return nil, err
+		}
+
+		c, err := p.condition()
+		if err != nil {
+			return nil, err
+		}
+
+		return &DestructureNode{
+			names,
+			c,
+		}, nil
+
+	case TokenPragma:
+		p.advance()
+
+		name := strings.TrimSpace(strings.TrimPrefix(p.prev.Lexeme, "#pragma "))
+		return &PragmaNode{name}, nil
+
+	case TokenDiscard:
+		p.advance()
+
+		v, err := p.condition()
+		if err != nil {
+			return nil, err
+		}
+
+		// the same as assigning to _, which is never declared
+		return &AssignNode{
+			"_",
+			v,
+			false,
+		}, nil
+
+	case TokenGlobal:
+		p.advance()
+
+		if err := p.expect(TokenName); err != nil {
+			return nil, err
+		}
+		nameToken := p.prev
+
+		if err := p.expect(TokenDeclare); err != nil {
+			return nil, err
+		}
+
+		c, err := p.condition()
+		if err != nil {
+			return nil, err
+		}
+
+		var g Node = &GlobalNode{
+			nameToken.Lexeme,
+			c,
+		}
+		p.track(nameToken, &g)
+
+		return g, nil
+
+	case TokenConst:
+		p.advance()
+
+		if err := p.expect(TokenName); err != nil {
+			return nil, err
+		}
+		nameToken := p.prev
+
+		if err := p.expect(TokenAssign); err != nil {
+			return nil, err
+		}
+
+		c, err := p.condition()
+		if err != nil {
+			return nil, err
+		}
+
+		var constant Node = &ConstNode{
+			nameToken.Lexeme,
+			c,
+		}
+		p.track(nameToken, &constant)
+
+		return constant, nil
+
 	case TokenImport:
 		p.advance()
 
@@ -558,8 +988,9 @@ func (p *Parser) statement() (Node, error) {
 			return nil, err
 		}
 		name := p.prev.Lexeme
+		nameToken := p.prev
 
-		params, err := p.parseParams()
+		params, types, defaults, err := p.parseParams()
 		if err != nil {
 			return nil, err
 		}
@@ -569,13 +1000,21 @@ func (p *Parser) statement() (Node, error) {
 			return nil, err
 		}
 
+		function := &FunctionNode{
+			name,
+			paramNames(params),
+			types,
+			defaults,
+			b,
+		}
+		p.trackParams(function, params)
+
+		var f Node = function
+		p.track(nameToken, &f)
+
 		return &AssignNode{
 			name,
-			&FunctionNode{
-				name,
-				params,
-				b,
-			},
+			f,
 			true,
 		}, nil
 
@@ -597,6 +1036,67 @@ func (p *Parser) statement() (Node, error) {
 			b,
 		}, nil
 
+	case TokenFor:
+		p.advance()
+
+		// for x in items { ... }
+		if next, err := p.peek(); err == nil && p.curr.Type == TokenName && next.Type == TokenIn {
+			name := p.curr.Lexeme
+			p.advance()
+			p.advance()
+
+			items, err := p.condition()
+			if err != nil {
+				return nil, err
+			}
+
+			b, err := p.block(false)
+			if err != nil {
+				return nil, err
+			}
+
+			return &ForEachNode{
+				name,
+				items,
+				b,
+			}, nil
+		}
+
+		init, err := p.statement()
+		if err != nil {
+			return nil, err
+		}
+
+		if err := p.expect(TokenSemicolon); err != nil {
+			return nil, err
+		}
+
+		c, err := p.condition()
+		if err != nil {
+			return nil, err
+		}
+
+		if err := p.expect(TokenSemicolon); err != nil {
+			return nil, err
+		}
+
+		step, err := p.statement()
+		if err != nil {
+			return nil, err
+		}
+
+		b, err := p.block(false)
+		if err != nil {
+			return nil, err
+		}
+
+		return &ForNode{
+			init,
+			c,
+			step,
+			b,
+		}, nil
+
 	case TokenReturn:
 		p.advance()
 
@@ -609,11 +1109,92 @@ func (p *Parser) statement() (Node, error) {
 			c,
 		}, nil
 
+	case TokenDefer:
+		p.advance()
+
+		start := p.curr
+		v, err := p.condition()
+		if err != nil {
+			return nil, err
+		}
+
+		call, ok := v.(*CallNode)
+		if !ok {
+			return nil, p.error("only calls can be deferred", start)
+		}
+
+		return &DeferNode{
+			call,
+		}, nil
+
 	case TokenBreakpoint:
 		p.advance()
 
 		return &BreakpointNode{}, nil
 
+	case TokenTypeKeyword:
+		p.advance()
+
+		if err := p.expect(TokenName); err != nil {
+			return nil, err
+		}
+		nameToken := p.prev
+
+		if !IsDeclaredTypeName(nameToken.Lexeme) {
+			return nil, p.error(fmt.Sprintf("the names of types begin with a capital letter, got %s", nameToken.Lexeme), nameToken)
+		}
+
+		if err := p.expect(TokenOpenBrace); err != nil {
+			return nil, err
+		}
+
+		var members, types []string
+		var values []Node
+		for !p.accept(TokenCloseBrace) {
+			if len(members) > 0 {
+				if err := p.expect(TokenComma); err != nil {
+					return nil, err
+				}
+			}
+
+			if err := p.expect(TokenName); err != nil {
+				return nil, err
+			}
+
+			member := p.prev.Lexeme
+			if slices.Contains(members, member) {
+				return nil, p.error(fmt.Sprintf("duplicate member %s in type %s", member, nameToken.Lexeme), p.prev)
+			}
+
+			if err := p.expect(TokenColon); err != nil {
+				return nil, err
+			}
+
+			t, err := p.typeName()
+			if err != nil {
+				return nil, err
+			}
+
+			members = append(members, member)
+			types = append(types, t)
+			values = append(values, &ReferenceNode{member})
+		}
+
+		// the constructor takes the members in order, its parameters checking their types
+		var t Node = &TypeNode{
+			ObjectSignature{nameToken.Lexeme, members, types},
+			&FunctionNode{
+				nameToken.Lexeme,
+				members,
+				types,
+				nil,
+				&BlockNode{[]Node{&ReturnNode{&ObjectNode{members, values}}}},
+			},
+		}
+		p.track(nameToken, &t)
+
+		return t, nil
+
 	default:
 		err := p.error("invalid statement", p.curr)
 		p.advance()
@@ -621,7 +1202,9 @@ func (p *Parser) statement() (Node, error) {
 	}
 }
 
-func (p *Parser) block(canBeStatement bool) (Node, error) {
+func (p *Parser) block(canBeStatement bool) (n Node, err error) {
+	defer p.track(p.curr, &n)
+
 	if canBeStatement {
 		if !p.accept(TokenOpenBrace) {
 			return p.statement()
@@ -657,7 +1240,7 @@ func (p *Parser) parseArgs() ([]Node, error) {
 	}
 
 	if !p.accept(TokenCloseParenthesis) {
-		c, err := p.condition()
+		c, err := p.item()
 		if err != nil {
 			return nil, err
 		}
@@ -666,7 +1249,7 @@ func (p *Parser) parseArgs() ([]Node, error) {
 			if err := p.expect(TokenComma); err != nil {
 				return nil, err
 			}
-			c, err = p.condition()
+			c, err = p.item()
 			if err != nil {
 				return nil, err
 			}
@@ -677,31 +1260,88 @@ func (p *Parser) parseArgs() ([]Node, error) {
 	return args, nil
 }
 
-// parseParams parse parameters and parentheses
-func (p *Parser) parseParams() ([]string, error) {
-	if err := p.expect(TokenOpenParenthesis); err != nil {
+// item parse an item of a list or an argument of a call, which may be a list spread into its items (...xs)
+func (p *Parser) item() (n Node, err error) {
+	defer p.track(p.curr, &n)
+
+	if !p.accept(TokenEllipsis) {
+		return p.condition()
+	}
+
+	value, err := p.condition()
+	if err != nil {
 		return nil, err
 	}
-	params := make([]string, 0)
 
-	if p.accept(TokenName) {
-		name := (*p.prev).Lexeme
-		params = append(params, name)
-		for !p.accept(TokenCloseParenthesis) {
+	return &SpreadNode{value}, nil
+}
+
+// parseParams parse the parameters of a function and their parentheses, returning the tokens of their names (see
+// paramNames), the types they are declared with (p: Point) and their defaults. The types are nil if no parameter has
+// one, otherwise "" for those without one.
+func (p *Parser) parseParams() ([]*Token, []string, []Node, error) {
+	if err := p.expect(TokenOpenParenthesis); err != nil {
+		return nil, nil, nil, err
+	}
+
+	return p.paramList(TokenCloseParenthesis)
+}
+
+// paramList parse parameters up to the token which ends them, which is consumed (see parseParams)
+func (p *Parser) paramList(end TokenType) ([]*Token, []string, []Node, error) {
+	params := make([]*Token, 0)
+	var types []string
+	var defaults []Node
+
+	for !p.accept(end) {
+		if len(params) > 0 {
 			if err := p.expect(TokenComma); err != nil {
-				return nil, err
+				return nil, nil, nil, err
 			}
-			if err := p.expect(TokenName); err != nil {
-				return nil, err
+		}
+
+		if err := p.expect(TokenName); err != nil {
+			return nil, nil, nil, err
+		}
+		nameToken := p.prev
+		params = append(params, nameToken)
+
+		if p.accept(TokenColon) {
+			t, err := p.typeName()
+			if err != nil {
+				return nil, nil, nil, err
 			}
-			name = (*p.prev).Lexeme
-			params = append(params, name)
+
+			for len(types) < len(params)-1 {
+				types = append(types, "")
+			}
+			types = append(types, t)
 		}
-	} else {
-		if err := p.expect(TokenCloseParenthesis); err != nil {
-			return nil, err
+
+		if p.accept(TokenAssign) {
+			// the default would take the | ending the parameters of a lambda as its own
+			if end == TokenPipe {
+				return nil, nil, nil, p.error("parameters of lambdas can't have default values, use func instead", p.prev)
+			}
+
+			d, err := p.condition()
+			if err != nil {
+				return nil, nil, nil, err
+			}
+
+			for len(defaults) < len(params)-1 {
+				defaults = append(defaults, nil)
+			}
+			defaults = append(defaults, d)
+		} else if defaults != nil {
+			// arguments are left out from the end, so only the last parameters may have defaults
+			return nil, nil, nil, p.error(fmt.Sprintf("%s follows a parameter with a default value, so it needs one too", nameToken.Lexeme), nameToken)
 		}
 	}
 
-	return params, nil
+	for types != nil && len(types) < len(params) {
+		types = append(types, "")
+	}
+
+	return params, types, defaults, nil
 }
@@ -2,6 +2,7 @@ package core
 
 import (
 	"strconv"
+	"strings"
 	"testing"
 )
 
@@ -358,6 +359,8 @@ func GetTokenTestData() map[string]TokenTestData {
 						&FunctionNode{
 							"*",
 							[]string{"a", "b"},
+							nil,
+							nil,
 							&BlockNode{
 								[]Node{
 									&ReturnNode{
@@ -405,6 +408,8 @@ func GetTokenTestData() map[string]TokenTestData {
 						&FunctionNode{
 							"a",
 							[]string{"a", "b"},
+							nil,
+							nil,
 							&BlockNode{
 								[]Node{
 									&ReturnNode{
@@ -445,6 +450,7 @@ func GetTokenTestData() map[string]TokenTestData {
 								"a",
 							},
 							"b",
+							false,
 						},
 						true,
 					},
@@ -704,3 +710,434 @@ func BenchmarkParser_Parse(b *testing.B) {
 		})
 	}
 }
+
+func TestParser_Positions(t *testing.T) {
+	tokens, err := NewLexer("a := 1\nwrite(a)").Tokenize()
+	if err != nil {
+		t.Fatalf("Unexpected error tokenizing: %v", err)
+	}
+
+	p := NewParser(tokens)
+	tree, err := p.Parse()
+	if err != nil {
+		t.Fatalf("Unexpected error(s): %s", err)
+	}
+
+	statements := tree.(*BlockNode).statements
+	positions := p.Positions()
+
+	for i, statement := range statements {
+		token, ok := positions[statement]
+		if !ok {
+			t.Fatalf("statement %d (%s) has no position", i, statement)
+		}
+
+		if token.Line != Pos(i) {
+			t.Errorf("statement %d is on line %d; want %d", i, token.Line, i)
+		}
+	}
+
+	call := statements[1].(*CallNode)
+	if token := positions[call.source]; token == nil || token.Lexeme != "write" {
+		t.Errorf("call source has position %v; want the token 'write'", token)
+	}
+}
+
+func TestParser_Cast(t *testing.T) {
+	tokens, err := NewLexer("a := b.at(0) as number").Tokenize()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tree, err := NewParser(tokens).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assign := tree.(*BlockNode).statements[0].(*AssignNode)
+	cast, ok := assign.value.(*CastNode)
+	if !ok {
+		t.Fatalf("Expected a cast, got %s", assign.value)
+	}
+
+	if cast.target != "number" || cast.value.Type() != CallNodeType {
+		t.Errorf("Unexpected cast %s", cast)
+	}
+
+	tokens, err = NewLexer("a := b as thing").Tokenize()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = NewParser(tokens).Parse()
+	if err == nil {
+		t.Errorf("Expected an error casting to an unknown type")
+	}
+
+	tokens, err = NewLexer("a := b as dict[number]dict[string]list").Tokenize()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tree, err = NewParser(tokens).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cast := tree.(*BlockNode).statements[0].(*AssignNode).value.(*CastNode); cast.target != "dict[number]dict[string]list" {
+		t.Errorf("Expected a cast to a dictionary type, got %s", cast)
+	}
+}
+
+func TestParser_Index(t *testing.T) {
+	tokens, err := NewLexer("a := rows[0][i + 1].length()").Tokenize()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tree, err := NewParser(tokens).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	call := tree.(*BlockNode).statements[0].(*AssignNode).value.(*CallNode)
+	outer, ok := call.source.(*AccessNode).source.(*IndexNode)
+	if !ok || outer.index.Type() != BinaryNodeType {
+		t.Fatalf("Expected indexing with i + 1, got %s", call.source)
+	}
+
+	if inner, ok := outer.source.(*IndexNode); !ok || inner.source.(*ReferenceNode).name != "rows" {
+		t.Errorf("Expected rows to be indexed twice, got %s", outer)
+	}
+}
+
+func TestParser_Destructure(t *testing.T) {
+	tokens, err := NewLexer("[_, user, domain] := match(email, re)").Tokenize()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tree, err := NewParser(tokens).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	n, ok := tree.(*BlockNode).statements[0].(*DestructureNode)
+	if !ok || strings.Join(n.names, ",") != "_,user,domain" || n.value.Type() != CallNodeType {
+		t.Fatalf("Expected destructuring a call into three names, got %s", tree)
+	}
+
+	for _, src := range []string{"[] := list", "[a b] := list", "[a, b] = list"} {
+		tokens, err := NewLexer(src).Tokenize()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := NewParser(tokens).Parse(); err == nil {
+			t.Errorf("Expected %q to fail parsing", src)
+		}
+	}
+}
+
+func TestParser_For(t *testing.T) {
+	tokens, err := NewLexer("for i := 0; i < 3; i = i + 1 { print(i) }").Tokenize()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tree, err := NewParser(tokens).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	loop, ok := tree.(*BlockNode).statements[0].(*ForNode)
+	if !ok {
+		t.Fatalf("Expected a for loop, got %s", tree)
+	}
+
+	if init, ok := loop.init.(*AssignNode); !ok || !init.declare || init.name != "i" {
+		t.Errorf("Expected the loop to begin by declaring i, got %s", loop.init)
+	}
+
+	if loop.condition.Type() != BinaryNodeType {
+		t.Errorf("Expected the condition of the loop to be i < 3, got %s", loop.condition)
+	}
+
+	if step, ok := loop.step.(*AssignNode); !ok || step.declare || step.name != "i" {
+		t.Errorf("Expected the loop to step by assigning to i, got %s", loop.step)
+	}
+
+	tokens, err = NewLexer("for i := 0 i < 3; i = i + 1 {}").Tokenize()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := NewParser(tokens).Parse(); err == nil {
+		t.Errorf("Expected a loop without semicolons to fail parsing")
+	}
+}
+
+func TestParser_ForEach(t *testing.T) {
+	tokens, err := NewLexer("for x in 1..10 { print(x) }").Tokenize()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tree, err := NewParser(tokens).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	loop, ok := tree.(*BlockNode).statements[0].(*ForEachNode)
+	if !ok {
+		t.Fatalf("Expected a for-each loop, got %s", tree)
+	}
+
+	if loop.name != "x" {
+		t.Errorf("Expected the loop to declare x, got %s", loop.name)
+	}
+
+	if loop.items.Type() != RangeNodeType {
+		t.Errorf("Expected the loop to go through 1..10, got %s", loop.items)
+	}
+
+	for _, src := range []string{"for x in { }", "for x in [1] print(x)", "for 1 in [1] {}"} {
+		tokens, err := NewLexer(src).Tokenize()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := NewParser(tokens).Parse(); err == nil {
+			t.Errorf("Expected %q to fail parsing", src)
+		}
+	}
+}
+
+func TestParser_Object(t *testing.T) {
+	tokens, err := NewLexer(`o := { "name": "ann", "tags": [1, 2] }`).Tokenize()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tree, err := NewParser(tokens).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	object, ok := tree.(*BlockNode).statements[0].(*AssignNode).value.(*ObjectNode)
+	if !ok || strings.Join(object.keys, ",") != "name,tags" || object.values[1].Type() != ListNodeType {
+		t.Fatalf("Expected an object literal with two members, got %s", tree)
+	}
+
+	for _, src := range []string{`o := {"a": 1, "a": 2}`, `o := {a: 1}`, `o := {"a" 1}`, `o := {"a": 1`} {
+		tokens, err := NewLexer(src).Tokenize()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := NewParser(tokens).Parse(); err == nil {
+			t.Errorf("Expected %q to fail parsing", src)
+		}
+	}
+
+	tokens, err = NewLexer("a := b as map[string]list").Tokenize()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tree, err = NewParser(tokens).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cast := tree.(*BlockNode).statements[0].(*AssignNode).value.(*CastNode); cast.target != "map[string]list" {
+		t.Errorf("Expected a cast to a map type, got %s", cast)
+	}
+
+	tokens, err = NewLexer("a := b as map[number]list").Tokenize()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := NewParser(tokens).Parse(); err == nil {
+		t.Errorf("Expected an error casting to a map not keyed by strings")
+	}
+}
+
+func TestParser_Type(t *testing.T) {
+	tokens, err := NewLexer("type Point {\n\tx: number,\n\ty: number\n}\nfunc length(p: Point, scale) {\n\treturn p.x * scale\n}").Tokenize()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tree, err := NewParser(tokens).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	declaration, ok := tree.(*BlockNode).statements[0].(*TypeNode)
+	if !ok || declaration.signature.String() != "Point{x: number, y: number}" {
+		t.Fatalf("Expected a declaration of Point, got %s", tree)
+	}
+
+	if params := declaration.constructor.params; strings.Join(params, ",") != "x,y" {
+		t.Errorf("Expected the constructor to take x and y, got %v", params)
+	}
+
+	f := tree.(*BlockNode).statements[1].(*AssignNode).value.(*FunctionNode)
+	if strings.Join(f.types, ",") != "Point," || f.paramType(1) != "any" {
+		t.Errorf("Expected p to be a Point and scale to have no type, got %v", f.types)
+	}
+
+	for _, src := range []string{"type point {x: number}", "type Point {x: number, x: string}", "type Point {x}", "type Point {x: thing}", "func f(p: thing) {}"} {
+		tokens, err := NewLexer(src).Tokenize()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := NewParser(tokens).Parse(); err == nil {
+			t.Errorf("Expected %q to fail parsing", src)
+		}
+	}
+}
+
+func TestParser_NilCoalescing(t *testing.T) {
+	tokens, err := NewLexer("a := b || c ?? d?.e ?? f\nfunc g(n: Node|nil) {}").Tokenize()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tree, err := NewParser(tokens).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// ?? is the lowest in precedence, and chains to the left
+	outer, ok := tree.(*BlockNode).statements[0].(*AssignNode).value.(*BinaryNode)
+	if !ok || outer.BinaryOperation != BinaryCoalesce {
+		t.Fatalf("Expected a ?? f, got %s", tree)
+	}
+
+	inner, ok := outer.Left.(*BinaryNode)
+	if !ok || inner.BinaryOperation != BinaryCoalesce || inner.Left.(*BinaryNode).BinaryOperation != BinaryOr {
+		t.Fatalf("Expected (b || c) ?? d?.e, got %s", outer.Left)
+	}
+
+	if access, ok := inner.Right.(*AccessNode); !ok || !access.optional {
+		t.Errorf("Expected d?.e to be optional, got %s", inner.Right)
+	}
+
+	f := tree.(*BlockNode).statements[1].(*AssignNode).value.(*FunctionNode)
+	if f.paramType(0) != "Node|nil" {
+		t.Errorf("Expected n to be a Node or nil, got %s", f.paramType(0))
+	}
+
+	if _, err := NewLexer("a ? b").Tokenize(); err == nil {
+		t.Errorf("Expected a lone ? to fail lexing")
+	}
+}
+
+func TestParser_Lambda(t *testing.T) {
+	tokens, err := NewLexer("a := |x, y: number| x * y | 1\nb := || nil").Tokenize()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tree, err := NewParser(tokens).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f, ok := tree.(*BlockNode).statements[0].(*AssignNode).value.(*FunctionNode)
+	if !ok || strings.Join(f.params, ",") != "x,y" || f.paramType(1) != "number" {
+		t.Fatalf("Expected a lambda taking x and y, got %s", tree)
+	}
+
+	// the lambda returns the whole expression after its parameters
+	ret, ok := f.logic.(*BlockNode).statements[0].(*ReturnNode)
+	if !ok || ret.value.(*BinaryNode).BinaryOperation != BinaryBitwiseOr {
+		t.Errorf("Expected the lambda to return x * y | 1, got %s", f.logic)
+	}
+
+	if f := tree.(*BlockNode).statements[1].(*AssignNode).value.(*FunctionNode); len(f.params) != 0 {
+		t.Errorf("Expected a lambda without parameters, got %v", f.params)
+	}
+
+	for _, src := range []string{"a := |x = 1| x", "a := |x x", "a := |1| 1"} {
+		tokens, err := NewLexer(src).Tokenize()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := NewParser(tokens).Parse(); err == nil {
+			t.Errorf("Expected %q to fail parsing", src)
+		}
+	}
+}
+
+func TestParser_Range(t *testing.T) {
+	tokens, err := NewLexer("a := 1..n + 1 == 0..=2").Tokenize()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tree, err := NewParser(tokens).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// ranges are of terms, and are compared as a whole
+	comparison, ok := tree.(*BlockNode).statements[0].(*AssignNode).value.(*BinaryNode)
+	if !ok || comparison.BinaryOperation != BinaryEquality {
+		t.Fatalf("Expected ranges to be compared, got %s", tree)
+	}
+
+	left, ok := comparison.Left.(*RangeNode)
+	if !ok || left.inclusive || left.end.Type() != BinaryNodeType {
+		t.Errorf("Expected 1..n + 1, got %s", comparison.Left)
+	}
+
+	if right, ok := comparison.Right.(*RangeNode); !ok || !right.inclusive {
+		t.Errorf("Expected 0..=2, got %s", comparison.Right)
+	}
+}
+
+func TestParser_Spread(t *testing.T) {
+	tokens, err := NewLexer("f(...xs, [1, ...a + b])").Tokenize()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tree, err := NewParser(tokens).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	call, ok := tree.(*BlockNode).statements[0].(*CallNode)
+	if !ok || len(call.args) != 2 {
+		t.Fatalf("Expected a call with two arguments, got %s", tree)
+	}
+
+	if spread, ok := call.args[0].(*SpreadNode); !ok || spread.value.Type() != ReferenceNodeType {
+		t.Errorf("Expected ...xs, got %s", call.args[0])
+	}
+
+	// the whole expression after ... is spread
+	list, ok := call.args[1].(*ListNode)
+	if !ok || len(list.items) != 2 {
+		t.Fatalf("Expected a list of two items, got %s", call.args[1])
+	}
+
+	if spread, ok := list.items[1].(*SpreadNode); !ok || spread.value.Type() != BinaryNodeType {
+		t.Errorf("Expected ...a + b, got %s", list.items[1])
+	}
+
+	tokens, err = NewLexer("x := ...xs").Tokenize()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := NewParser(tokens).Parse(); err == nil {
+		t.Errorf("Expected spreading outside of a list or call to fail")
+	}
+}
@@ -0,0 +1,71 @@
+package core
+
+import (
+	"sync"
+)
+
+// Profile the builtins a VM has as globals from the start, before those a host gives it (see RunOptions.Builtins).
+// Programs are compiled against the profile they are run with, see CompileOptions.Profile.
+type Profile int
+
+const (
+	// ProfileStandard the default builtins (DefaultBuiltins), which VMs have unless given another profile
+	ProfileStandard Profile = iota
+	// ProfileMinimal no builtins at all, for hosts sandboxing programs they don't trust, which give them only what
+	// they trust with RunOptions.Builtins and RunOptions.Globals
+	ProfileMinimal
+	// ProfileFull the default builtins, along with those running other programs (ExecBuiltins) and connecting to other
+	// machines (SocketBuiltins), so hosts only give it to programs they trust with both, as the CLI only runs programs
+	// with it given --allow-exec and --allow-net
+	ProfileFull
+)
+
+// Profiles the profiles by their names, for choosing one by name, as the CLI's --profile does
+var Profiles = map[string]Profile{
+	"minimal":  ProfileMinimal,
+	"standard": ProfileStandard,
+	"full":     ProfileFull,
+}
+
+func (p Profile) String() string {
+	switch p {
+	case ProfileMinimal:
+		return "minimal"
+	case ProfileStandard:
+		return "standard"
+	case ProfileFull:
+		return "full"
+	}
+
+	return "undefined"
+}
+
+// fullBuiltins the builtins of ProfileFull, gathered the first time they are needed, once the default builtins have
+// all been registered
+var fullBuiltins = sync.OnceValue(func() *Registry {
+	r := NewRegistry()
+	for _, builtins := range []*Registry{DefaultBuiltins, ExecBuiltins, SocketBuiltins} {
+		for _, name := range builtins.Names() {
+			if err := r.Register(*builtins.Get(name)); err != nil {
+				panic(err)
+			}
+		}
+	}
+
+	return r
+})
+
+// Builtins get the builtins of the profile. The registry is shared, so it must not be changed.
+func (p Profile) Builtins() *Registry {
+	switch p {
+	case ProfileMinimal:
+		return emptyRegistry
+	case ProfileFull:
+		return fullBuiltins()
+	}
+
+	return DefaultBuiltins
+}
+
+// emptyRegistry the builtins of ProfileMinimal
+var emptyRegistry = NewRegistry()
@@ -0,0 +1,64 @@
+package core
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestProfile(t *testing.T) {
+	double := NewRegistry(Builtin{
+		"double",
+		Signature{[]string{"n"}},
+		true,
+		func(_ *VM, _ Value, params map[string]Value) (Value, error) {
+			return NewNumber(params["n"].(*NumberValue).float64 * 2), nil
+		},
+	})
+
+	// sandboxed programs only have what they are given
+	program, err := Compile("result := double(2)", CompileOptions{Profile: ProfileMinimal, Builtins: double})
+	if err != nil {
+		t.Fatalf("Unexpected error compiling: %v", err)
+	}
+
+	vm := program.NewVM(RunOptions{Profile: ProfileMinimal, Builtins: double})
+	for vm.Next() {
+	}
+	if err := vm.Error(); err != nil {
+		t.Fatalf("Unexpected error running: %v", err)
+	}
+
+	CompareValues(t, vm.Variable("result"), NewNumber(4))
+	if len(vm.Globals()) != 1 {
+		t.Errorf("Expected the VM to have only the builtin it was given, got %v", vm.Globals())
+	}
+
+	// calls to builtins the profile doesn't have aren't folded while compiling
+	for _, src := range []string{`write("hi")`, "t := typeof(1)", "t := comptime { return typeof(1) }"} {
+		program, err := Compile(src, CompileOptions{Profile: ProfileMinimal})
+		if err != nil {
+			continue
+		}
+
+		if _, err := program.Run(RunOptions{Profile: ProfileMinimal, Output: &bytes.Buffer{}}); err == nil {
+			t.Errorf("Expected %q to fail without the builtins it uses", src)
+		}
+	}
+
+	program, err = Compile("t := typeof(exec)", CompileOptions{Profile: ProfileFull})
+	if err != nil {
+		t.Fatalf("Unexpected error compiling: %v", err)
+	}
+
+	vm = program.NewVM(RunOptions{Profile: ProfileFull})
+	for vm.Next() {
+	}
+
+	CompareValues(t, vm.Variable("t"), NewString("function"))
+
+	for name, profile := range Profiles {
+		if profile.String() != name {
+			t.Errorf("Expected %s to be named %s, got %s", name, name, profile)
+		}
+	}
+}
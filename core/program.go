@@ -0,0 +1,547 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"sync"
+)
+
+// CompileOptions how Compile turns source into a program
+type CompileOptions struct {
+	// Imports resolves the paths the program imports, nil if it can not import anything
+	Imports ImportsResolver
+	// Globals the names of the globals given to the program when it is run (see RunOptions.Globals), besides the
+	// default ones
+	Globals []string
+	// NoFolding stop constant expressions (such as 1 + 2) from being computed while compiling
+	NoFolding bool
+	// Defines constants the program is compiled with, see Compiler.Define
+	Defines map[string]Value
+	// Builtins functions given to the program when it is run (see RunOptions.Builtins), besides the default ones
+	Builtins *Registry
+	// Decimal make the numbers of the program exact decimals rather than floats, as #pragma decimal does
+	Decimal bool
+	// WarnImplicitAny note variables declared with values of types which can't be deduced, see
+	// Compiler.SetImplicitAnyWarnings
+	WarnImplicitAny bool
+	// Strict compile the program in strict mode, as #pragma strict does, see Compiler.SetStrict
+	Strict bool
+	// FileName the name of the file the source is from, for traces and imports to show its lines as file:line, see
+	// Compiler.SetFileName
+	FileName string
+	// Limits how large and complex the program can be, see Compiler.SetLimits
+	Limits Limits
+	// EliminateDeadStores leave assignments whose values are never read out of the bytecode, see
+	// Compiler.SetDeadStoreElimination
+	EliminateDeadStores bool
+	// Profile the builtins the program is run with (see RunOptions.Profile), ProfileStandard if zero
+	Profile Profile
+}
+
+// RunOptions how a program is run. The zero value runs it like the command line does.
+type RunOptions struct {
+	// StackSize the size of the value stack, 256 if zero
+	StackSize Pos
+	// CallstackSize how deep calls can go, 256 if zero
+	CallstackSize Pos
+	// Growth how the stacks grow once full, from their sizes up to their limits
+	Growth GrowthPolicy
+	// StackLimit the size the value stack can grow to, 16 times its size if zero
+	StackLimit Pos
+	// CallstackLimit the size the call stack can grow to, 16 times its size if zero
+	CallstackLimit Pos
+	// Globals values given to the program, which must have been named in CompileOptions.Globals
+	Globals map[string]Value
+	// Builtins functions given to the program as globals, which must have been in CompileOptions.Builtins
+	Builtins *Registry
+	// Profile the builtins the program has as globals before Builtins and Globals, ProfileStandard if zero. Sandboxed
+	// programs can be run with ProfileMinimal, to be given only the builtins they are trusted with.
+	Profile Profile
+	// Output where print and write write to, standard output if nil
+	Output io.Writer
+	// NumberFormat how numbers are converted to strings, DefaultNumberFormat if nil
+	NumberFormat *NumberFormat
+	// MissingKeys what render does with keys the data of a template doesn't have, failing by default
+	MissingKeys MissingKeys
+	// Args the arguments the main function is called with, if the program has one
+	Args []string
+}
+
+// Program a compiled program, ready to be run any number of times. Programs are not changed by running them, so one
+// can be run by several goroutines at once.
+type Program struct {
+	chunk *Chunk
+	// source what the program was compiled from, nil if it was loaded from bytecode or compiled from several files
+	source []rune
+	notes  []Note
+	// imported the sources of the files it imports, by their paths, if they were parsed by the compiler, and of the
+	// files it was compiled from if there were several
+	imported map[string][]rune
+	// parsed what the program was compiled from, for TypeAt, nil unless it was compiled from source
+	parsed *parsedSource
+}
+
+// parsedSource the tree of a program, and the options it was compiled with
+type parsedSource struct {
+	tree      Node
+	positions Positions
+	options   CompileOptions
+
+	// symbols the symbols of the tree, collected the first time they are needed
+	symbols     *SymbolTable
+	symbolsOnce sync.Once
+}
+
+// Compile lex, parse and compile source into a program. Parsing errors are *ParsingError, which FormatError can show
+// along with the source.
+func Compile(src string, options CompileOptions) (*Program, error) {
+	tree, positions, err := parse(src)
+	if err != nil {
+		return nil, err
+	}
+
+	c := options.compiler()
+	c.SetPositions(positions)
+
+	if err := c.Compile(tree); err != nil {
+		return nil, err
+	}
+
+	if err := c.Chunk.verifyStack(); err != nil {
+		return nil, fmt.Errorf("compiled invalid bytecode: %w", err)
+	}
+
+	return &Program{c.Chunk, []rune(src), c.Notes(), c.Sources(), &parsedSource{tree: tree, positions: positions, options: options}}, nil
+}
+
+// SourceFile a file of a program made of several
+type SourceFile struct {
+	// Name the path of the file, which bundles are keyed by
+	Name   string
+	Source string
+}
+
+// FileError an error in one of the files of a program made of several
+type FileError struct {
+	File   string
+	Source []rune
+	Err    error
+	// Imported where the file was imported, from the innermost import out, if it was imported
+	Imported []Location
+}
+
+// Location a line of a file, written as file:line so editors can link to it, or as line N for the source being
+// compiled if it wasn't named
+type Location struct {
+	File string
+	// Line the line, starting at 0
+	Line Pos
+}
+
+func (l Location) String() string {
+	if l.File == "" {
+		return fmt.Sprintf("line %d", l.Line+1)
+	}
+
+	return fmt.Sprintf("%s:%d", l.File, l.Line+1)
+}
+
+func (e *FileError) Error() string {
+	return fmt.Sprintf("%s: %v", e.File, e.Err)
+}
+
+func (e *FileError) Unwrap() error {
+	return e.Err
+}
+
+// CompileFiles compile several files into one program, as if they were one file with the files one after another.
+// The files share their top level variables, and only one of them may have a main function. Notes are marked with
+// the file they are about.
+func CompileFiles(files []SourceFile, options CompileOptions) (*Program, error) {
+	merged := &BlockNode{}
+	positions := Positions{}
+	// tokenFiles which file each token is from, to mark notes with
+	tokenFiles := map[*Token]string{}
+	// mains which file has the main function, if any
+	mains := ""
+
+	for _, file := range files {
+		tree, p, err := parse(file.Source)
+		if err != nil {
+			return nil, &FileError{file.Name, []rune(file.Source), err, nil}
+		}
+
+		for node, token := range p {
+			positions[node] = token
+			tokenFiles[token] = file.Name
+		}
+
+		for _, statement := range tree.(*BlockNode).statements {
+			if assign, ok := statement.(*AssignNode); ok && assign.name == MainFunction && assign.declare {
+				if mains != "" {
+					return nil, &FileError{file.Name, []rune(file.Source), errors.New(fmt.Sprintf("main function already declared in %s", mains)), nil}
+				}
+
+				mains = file.Name
+			}
+		}
+
+		merged.statements = append(merged.statements, tree.(*BlockNode).statements...)
+	}
+
+	c := options.compiler()
+	c.SetPositions(positions)
+
+	// the files are marked like imported files, so the bytecode and notes are marked with them
+	for token, file := range tokenFiles {
+		c.files[token] = file
+	}
+
+	for _, file := range files {
+		c.sources[file.Name] = []rune(file.Source)
+	}
+
+	if err := c.Compile(merged); err != nil {
+		return nil, err
+	}
+
+	if err := c.Chunk.verifyStack(); err != nil {
+		return nil, fmt.Errorf("compiled invalid bytecode: %w", err)
+	}
+
+	return &Program{c.Chunk, nil, c.Notes(), c.Sources(), nil}, nil
+}
+
+// Bundle programs compiled separately from several files, keyed by the name of their file
+type Bundle map[string]*Program
+
+// CompileBundle compile each of the files into a program of its own. Notes are marked with the file they are about.
+func CompileBundle(files []SourceFile, options CompileOptions) (Bundle, error) {
+	bundle := make(Bundle, len(files))
+
+	for _, file := range files {
+		program, err := Compile(file.Source, options)
+		if err != nil {
+			return nil, &FileError{file.Name, []rune(file.Source), err, nil}
+		}
+
+		for i := range program.notes {
+			if program.notes[i].File == "" {
+				program.notes[i].File = file.Name
+			}
+		}
+
+		bundle[file.Name] = program
+	}
+
+	return bundle, nil
+}
+
+// LoadBundle read a bundle made by Bundle.Serialize, verifying each of its programs
+func LoadBundle(b []byte) (Bundle, error) {
+	chunks, err := decodeBundle(b)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("invalid bundle file: %v", err))
+	}
+
+	bundle := make(Bundle, len(chunks))
+	for name, chunk := range chunks {
+		if err := chunk.Verify(); err != nil {
+			return nil, errors.New(fmt.Sprintf("invalid bytecode of %s: %v", name, err))
+		}
+
+		bundle[name] = &Program{chunk, nil, nil, nil, nil}
+	}
+
+	return bundle, nil
+}
+
+// Serialize write the programs of the bundle as bytecode, which LoadBundle can read
+func (b Bundle) Serialize() []byte {
+	chunks := make(map[string]*Chunk, len(b))
+	for name, program := range b {
+		chunks[name] = program.chunk
+	}
+
+	serialized, err := encodeBundle(chunks)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	return serialized
+}
+
+// parse lex and parse source, getting where its nodes are found
+func parse(src string) (Node, Positions, error) {
+	tokens, err := NewLexer(src).Tokenize()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	p := NewParser(tokens)
+	tree, err := p.Parse()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return tree, p.Positions(), nil
+}
+
+// compiler create a compiler set up with the options
+func (options CompileOptions) compiler() *Compiler {
+	c := NewCompiler()
+	c.SetFolding(!options.NoFolding)
+	c.SetDecimal(options.Decimal)
+	c.SetImplicitAnyWarnings(options.WarnImplicitAny)
+	c.SetStrict(options.Strict)
+	c.SetFileName(options.FileName)
+	c.SetLimits(options.Limits)
+	c.SetDeadStoreElimination(options.EliminateDeadStores)
+	c.SetProfile(options.Profile)
+	if options.Imports != nil {
+		c.SetImportsResolver(options.Imports)
+	}
+
+	for _, name := range options.Globals {
+		c.DeclareGlobal(name)
+	}
+
+	if options.Builtins != nil {
+		for _, name := range options.Builtins.Names() {
+			c.DeclareGlobal(name)
+		}
+	}
+
+	for name, value := range options.Defines {
+		c.Define(name, value)
+	}
+
+	return c
+}
+
+// LoadProgram read a program from bytecode made by Program.Serialize, verifying it
+func LoadProgram(b []byte) (*Program, error) {
+	chunk, err := DeserializeChunk(b)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Program{chunk, nil, nil, nil, nil}, nil
+}
+
+// DecodeProgram read a program written by Program.Encode with the codec, verifying its bytecode
+func DecodeProgram(b []byte, codec Codec) (*Program, error) {
+	chunk, err := DecodeChunk(b, codec)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Program{chunk, nil, nil, nil, nil}, nil
+}
+
+// Chunk get the bytecode of the program. Its format is not stable, see the package documentation.
+func (p *Program) Chunk() *Chunk {
+	return p.chunk
+}
+
+// Source get what the program was compiled from, or nil if it was loaded from bytecode or compiled from several files
+func (p *Program) Source() []rune {
+	return p.source
+}
+
+// Exports get the names the program declares at its top level, which are kept in its bytecode
+func (p *Program) Exports() []Export {
+	return p.chunk.Exports
+}
+
+// Strict whether the program was compiled in strict mode, with #pragma strict or CompileOptions.Strict
+func (p *Program) Strict() bool {
+	return p.chunk.Strict
+}
+
+// ImportedSource get the source of a file the program imports, for showing the notes about it, nil if it wasn't
+// parsed by the compiler (see SourceResolver). Programs compiled from several files have the sources of those too.
+func (p *Program) ImportedSource(path string) []rune {
+	return p.imported[path]
+}
+
+// FormatError describe an error from running the program like FormatError, showing the lines of the files it
+// imports where errors happened in them
+func (p *Program) FormatError(err error) string {
+	var runtime *ErrorValue
+	if errors.As(err, &runtime) {
+		return runtime.FormatSources(p.source, p.imported)
+	}
+
+	return FormatError(err, p.source)
+}
+
+// Notes get the notes the compiler made about the program, such as suggestions
+func (p *Program) Notes() []Note {
+	return p.notes
+}
+
+// Diagnostics get the notes of the program as warnings, for tools to read
+func (p *Program) Diagnostics() []Diagnostic {
+	diagnostics := make([]Diagnostic, len(p.notes))
+	for i, n := range p.notes {
+		src := p.source
+		if n.File != "" {
+			src = p.ImportedSource(n.File)
+		}
+
+		diagnostics[i] = n.Diagnostic(src)
+	}
+
+	return diagnostics
+}
+
+// Serialize write the program as bytecode, which LoadProgram can read
+func (p *Program) Serialize() []byte {
+	return p.chunk.Serialize()
+}
+
+// Encode write the program as bytecode in the format of the codec, which DecodeProgram can read
+func (p *Program) Encode(codec Codec) ([]byte, error) {
+	return codec.Encode(p.chunk)
+}
+
+// NewVM create a VM for running the program step by step, with VM.Next. It should be closed once done with.
+func (p *Program) NewVM(options RunOptions) *VM {
+	stackSize, callstackSize := options.StackSize, options.CallstackSize
+	if stackSize == 0 {
+		stackSize = 256
+	}
+
+	if callstackSize == 0 {
+		callstackSize = 256
+	}
+
+	vm := NewVM(p.chunk, stackSize, callstackSize)
+
+	if options.Growth != GrowthFixed {
+		stackLimit, callstackLimit := options.StackLimit, options.CallstackLimit
+		if stackLimit == 0 {
+			stackLimit = stackSize * 16
+		}
+
+		if callstackLimit == 0 {
+			callstackLimit = callstackSize * 16
+		}
+
+		vm.SetStackGrowth(options.Growth, stackLimit, callstackLimit)
+	}
+
+	vm.SetProfile(options.Profile)
+	if options.Builtins != nil {
+		for name, value := range options.Builtins.Values() {
+			vm.SetGlobal(name, value)
+		}
+	}
+
+	for name, value := range options.Globals {
+		vm.SetGlobal(name, value)
+	}
+
+	if options.Output != nil {
+		vm.SetOutput(options.Output)
+	}
+
+	if options.NumberFormat != nil {
+		vm.SetNumberFormat(*options.NumberFormat)
+	}
+
+	vm.SetMissingKeys(options.MissingKeys)
+
+	return vm
+}
+
+// Run run the program to its end, then its main function if it has one, and close the VM. Returns what main
+// returned (or nil), and the *ErrorValue the program failed with, if it did.
+func (p *Program) Run(options RunOptions) (Value, error) {
+	vm := p.NewVM(options)
+	defer vm.Close()
+
+	for vm.Next() {
+	}
+
+	if err := vm.Error(); err != nil {
+		return nil, err
+	}
+
+	var result Value = &NilValue{}
+
+	if main, ok := vm.Variable(MainFunction).(*FunctionValue); ok {
+		args := make([]interface{}, len(options.Args))
+		for i, arg := range options.Args {
+			args[i] = arg
+		}
+
+		v, err := vm.Call(main, []Value{GoToValue(args)})
+		if err != nil {
+			return nil, err
+		}
+
+		result = v
+	}
+
+	// timers are run once the program is otherwise done
+	if err := vm.RunTimers(); err != nil {
+		return nil, err
+	}
+
+	return result, vm.Close()
+}
+
+// FormatError describe an error from compiling or running the program compiled from src, showing where in the
+// source it happened when possible
+func FormatError(err error, src []rune) string {
+	var file *FileError
+	if errors.As(err, &file) {
+		return formatFileError(file)
+	}
+
+	var parsing *ParsingError
+	if errors.As(err, &parsing) {
+		return parsing.Format(src)
+	}
+
+	var runtime *ErrorValue
+	if errors.As(err, &runtime) {
+		return runtime.FormatSource(src)
+	}
+
+	return fmt.Sprintf("error: %v\n", err)
+}
+
+// formatFileError describe an error in a file, with where it is in the file and where the file was imported. Files
+// importing files with errors wrap their errors, so the innermost file is where the error is.
+func formatFileError(file *FileError) string {
+	imported := file.Imported
+	for {
+		var inner *FileError
+		if !errors.As(file.Err, &inner) {
+			break
+		}
+
+		imported = append(append([]Location{}, inner.Imported...), imported...)
+		file = inner
+	}
+
+	at := file.File
+	var parsing *ParsingError
+	if errors.As(file.Err, &parsing) && parsing.Causer != nil {
+		at = Location{file.File, parsing.Causer.Line}.String()
+	}
+
+	b := strings.Builder{}
+	b.WriteString(fmt.Sprintf("in %s\n", at))
+	for _, location := range imported {
+		b.WriteString(fmt.Sprintf("\timported at %s\n", location))
+	}
+
+	return b.String() + FormatError(file.Err, file.Source)
+}
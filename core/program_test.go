@@ -0,0 +1,200 @@
+package core
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestProgram_Run(t *testing.T) {
+	program, err := Compile(`
+greeting := "hello"
+
+func main(args) {
+	print(greeting + " " + name + " " + args.at(0))
+	return 1 + 2
+}
+`, CompileOptions{Globals: []string{"name"}})
+	if err != nil {
+		t.Fatalf("Unexpected error compiling: %v", err)
+	}
+
+	out := bytes.Buffer{}
+	result, err := program.Run(RunOptions{
+		Globals: map[string]Value{"name": NewString("world")},
+		Output:  &out,
+		Args:    []string{"!"},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error running: %v", err)
+	}
+
+	if out.String() != "hello world !" {
+		t.Errorf("Expected the program to print \"hello world !\", got %q", out.String())
+	}
+
+	CompareValues(t, result, NewNumber(3))
+}
+
+func TestProgram_Serialize(t *testing.T) {
+	program, err := Compile(`print([1, "two", true].length())`, CompileOptions{})
+	if err != nil {
+		t.Fatalf("Unexpected error compiling: %v", err)
+	}
+
+	loaded, err := LoadProgram(program.Serialize())
+	if err != nil {
+		t.Fatalf("Unexpected error loading: %v", err)
+	}
+
+	if loaded.Source() != nil {
+		t.Errorf("Expected loaded programs to have no source")
+	}
+
+	out := bytes.Buffer{}
+	if _, err := loaded.Run(RunOptions{Output: &out}); err != nil {
+		t.Fatalf("Unexpected error running: %v", err)
+	}
+
+	if out.String() != "3" {
+		t.Errorf("Expected the program to print 3, got %q", out.String())
+	}
+}
+
+func TestProgram_Exports(t *testing.T) {
+	program, err := Compile(`func add(a, b) {
+	return a + b
+}
+
+limit := 10
+global shared := 1
+
+func main(args) {
+	x := 1
+}`, CompileOptions{})
+	if err != nil {
+		t.Fatalf("Unexpected error compiling: %v", err)
+	}
+
+	loaded, err := LoadProgram(program.Serialize())
+	if err != nil {
+		t.Fatalf("Unexpected error loading: %v", err)
+	}
+
+	// locals and the main function aren't exported
+	expected := []Export{{"add", false, true, []string{"a", "b"}}, {"limit", false, false, nil}, {"shared", true, false, nil}}
+	if !reflect.DeepEqual(loaded.Exports(), expected) {
+		t.Errorf("Expected the loaded program to export %v, got %v", expected, loaded.Exports())
+	}
+}
+
+func TestProgram_Errors(t *testing.T) {
+	src := "x := 1 +"
+	_, err := Compile(src, CompileOptions{})
+	if _, ok := err.(*ParsingError); !ok {
+		t.Fatalf("Expected a parsing error, got %v", err)
+	}
+
+	src = "x := [].at(3)"
+	program, err := Compile(src, CompileOptions{})
+	if err != nil {
+		t.Fatalf("Unexpected error compiling: %v", err)
+	}
+
+	_, err = program.Run(RunOptions{})
+	if _, ok := err.(*ErrorValue); !ok {
+		t.Fatalf("Expected a runtime error, got %v", err)
+	}
+
+	if got := FormatError(err, program.Source()); !strings.Contains(got, "   1 | x := [].at(3)") {
+		t.Errorf("Expected the error to show the source line, got %q", got)
+	}
+}
+
+func TestValue_Accessors(t *testing.T) {
+	if NewString("a").String() != "a" || NewNumber(2).Number() != 2 || !NewBool(true).Bool() {
+		t.Errorf("Expected accessors to give back what values were made with")
+	}
+
+	list := NewList([]Value{NewNumber(1)})
+	items := list.Items()
+	items[0] = NewNumber(2)
+	CompareValues(t, list, NewList([]Value{NewNumber(1)}))
+
+	object := NewObject(map[string]Value{"a": NewNumber(1)})
+	members := object.Members()
+	members["b"] = NewNumber(2)
+	if len(object.Members()) != 1 {
+		t.Errorf("Expected changing the members got from an object not to change it")
+	}
+}
+
+func TestCompileFiles(t *testing.T) {
+	program, err := CompileFiles([]SourceFile{
+		{"a.ang", "func main(args) {\n\tprint(greet(name))\n}\n"},
+		{"b.ang", "name := \"world\"\nfunc greet(who) {\n\treturn \"hello \" + who\n}\nx := unknown\n"},
+	}, CompileOptions{})
+	if err != nil {
+		t.Fatalf("Unexpected error compiling: %v", err)
+	}
+
+	if len(program.Notes()) != 1 || program.Notes()[0].File != "b.ang" {
+		t.Errorf("Expected a note about b.ang, got %v", program.Notes())
+	}
+
+	out := bytes.Buffer{}
+	if _, err := program.Run(RunOptions{Globals: map[string]Value{"unknown": NewNumber(1)}, Output: &out}); err != nil {
+		t.Fatalf("Unexpected error running: %v", err)
+	}
+
+	if out.String() != "hello world" {
+		t.Errorf("Expected the program to print \"hello world\", got %q", out.String())
+	}
+
+	_, err = CompileFiles([]SourceFile{
+		{"a.ang", "func main(args) {}"},
+		{"b.ang", "func main(args) {}"},
+	}, CompileOptions{})
+	if e, ok := err.(*FileError); !ok || e.File != "b.ang" {
+		t.Errorf("Expected an error about b.ang declaring main again, got %v", err)
+	}
+}
+
+func TestBundle(t *testing.T) {
+	bundle, err := CompileBundle([]SourceFile{
+		{"a.ang", "print(\"a\")"},
+		{"b.ang", "print(\"b\")"},
+	}, CompileOptions{})
+	if err != nil {
+		t.Fatalf("Unexpected error compiling: %v", err)
+	}
+
+	loaded, err := LoadBundle(bundle.Serialize())
+	if err != nil {
+		t.Fatalf("Unexpected error loading: %v", err)
+	}
+
+	for _, name := range []string{"a", "b"} {
+		out := bytes.Buffer{}
+		if _, err := loaded[name+".ang"].Run(RunOptions{Output: &out}); err != nil {
+			t.Fatalf("Unexpected error running: %v", err)
+		}
+
+		if out.String() != name {
+			t.Errorf("Expected %s.ang to print %s, got %q", name, name, out.String())
+		}
+	}
+
+	// the files are serialized in the order of their names, whichever order the map gives them in
+	for i := 0; i < 10; i++ {
+		if !bytes.Equal(bundle.Serialize(), loaded.Serialize()) {
+			t.Fatalf("Expected the bundle to be serialized the same each time")
+		}
+	}
+
+	_, err = CompileBundle([]SourceFile{{"broken.ang", "x := 1 +"}}, CompileOptions{})
+	if got := FormatError(err, nil); !strings.HasPrefix(got, "in broken.ang:1\n") {
+		t.Errorf("Expected the error to say which file it is in, got %q", got)
+	}
+}
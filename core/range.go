@@ -0,0 +1,183 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+)
+
+// RangeValue the numbers from a start up to an end (1..10), or through it (1..=10), counting by one. The numbers are
+// only made when they are asked for, so a range takes as little memory however many numbers it has. Ranges are equal
+// when they have the same numbers.
+type RangeValue struct {
+	start     *NumberValue
+	end       *NumberValue
+	inclusive bool
+}
+
+// NewRange create a range from start up to end, or through it if inclusive
+func NewRange(start float64, end float64, inclusive bool) *RangeValue {
+	return &RangeValue{&NumberValue{start, nil}, &NumberValue{end, nil}, inclusive}
+}
+
+// makeRange create a range of the values a program gave, which must be finite numbers
+func makeRange(start Value, end Value, inclusive bool) (*RangeValue, error) {
+	from, ok := start.(*NumberValue)
+	to, ok2 := end.(*NumberValue)
+	if !ok || !ok2 {
+		return nil, errors.New(fmt.Sprintf("cannot make a range from %s to %s, as ranges are of numbers", TypeOf(start), TypeOf(end)))
+	}
+
+	for _, n := range []float64{from.float64, to.float64} {
+		if math.IsInf(n, 0) || math.IsNaN(n) {
+			return nil, errors.New(fmt.Sprintf("cannot make a range from %s to %s, as its ends must be finite", from, to))
+		}
+	}
+
+	return &RangeValue{from, to, inclusive}, nil
+}
+
+// Len how many numbers the range has
+func (v *RangeValue) Len() int {
+	n := math.Ceil(v.end.float64 - v.start.float64)
+	if v.inclusive {
+		n = math.Floor(v.end.float64-v.start.float64) + 1
+	}
+
+	return int(max(n, 0))
+}
+
+// At get the number of the range at an index, which must be less than its length
+func (v *RangeValue) At(i int) *NumberValue {
+	if v.start.decimal != nil {
+		return newDecimal(new(big.Rat).Add(v.start.decimal, new(big.Rat).SetInt64(int64(i))))
+	}
+
+	return &NumberValue{v.start.float64 + float64(i), nil}
+}
+
+// Items get the numbers of the range, all at once
+func (v *RangeValue) Items() []Value {
+	items := make([]Value, v.Len())
+	for i := range items {
+		items[i] = v.At(i)
+	}
+
+	return items
+}
+
+// Has whether a number is one of the numbers of the range
+func (v *RangeValue) Has(n float64) bool {
+	i := n - v.start.float64
+	return i == math.Trunc(i) && i >= 0 && i < float64(v.Len())
+}
+
+func (v *RangeValue) Type() ValueType {
+	return RangeValueType
+}
+
+func (v *RangeValue) String() string {
+	if v.inclusive {
+		return fmt.Sprintf("%s..=%s", v.start, v.end)
+	}
+
+	return fmt.Sprintf("%s..%s", v.start, v.end)
+}
+
+func (v *RangeValue) DebugString() string {
+	return v.String()
+}
+
+func (v *RangeValue) Equals(other Value) bool {
+	r, ok := other.(*RangeValue)
+	if !ok || v.Len() != r.Len() {
+		return false
+	}
+
+	return v.Len() == 0 || v.start.Equals(r.start)
+}
+
+func (v *RangeValue) Hash() uint64 {
+	// empty ranges are equal wherever they start
+	if v.Len() == 0 {
+		return uint64(RangeValueType)
+	}
+
+	return mix(mix(uint64(RangeValueType), v.start.Hash()), uint64(v.Len()))
+}
+
+func (v *RangeValue) Get(key string) (Value, error) {
+	if prop, ok := RangePrototype[key]; ok {
+		return prop, nil
+	}
+
+	return nil, errors.New(fmt.Sprintf("range has no property \"%s\"", key))
+}
+
+// listOf call a builtin of lists with the numbers of the range, for those which go through every one
+func listOf(name string) *BuiltinFunctionValue {
+	f := ListPrototype[name]
+	return &BuiltinFunctionValue{
+		name,
+		f.Parameters,
+		func(vm *VM, this Value, p map[string]Value) (Value, error) {
+			return f.F(vm, NewList(this.(*RangeValue).Items()), p)
+		},
+		nil,
+	}
+}
+
+var RangePrototype = map[string]*BuiltinFunctionValue{
+	"length": {
+		"length",
+		[]string{},
+		func(_ *VM, this Value, p map[string]Value) (Value, error) {
+			return GoToValue(this.(*RangeValue).Len()), nil
+		},
+		nil,
+	},
+	"at": {
+		"at",
+		[]string{"index"},
+		func(_ *VM, this Value, p map[string]Value) (Value, error) {
+			r := this.(*RangeValue)
+
+			i, ok := p["index"].(*NumberValue)
+			if !ok {
+				return nil, errors.New(fmt.Sprintf("range index must be a number, got %s", TypeOf(p["index"])))
+			}
+
+			index := int(i.float64)
+			if index < 0 || index >= r.Len() {
+				return nil, errors.New(fmt.Sprintf("range index %d out of range (length %d)", index, r.Len()))
+			}
+
+			return r.At(index), nil
+		},
+		nil,
+	},
+	"has": {
+		"has",
+		[]string{"n"},
+		func(_ *VM, this Value, p map[string]Value) (Value, error) {
+			n, ok := p["n"].(*NumberValue)
+			return &BoolValue{ok && this.(*RangeValue).Has(n.float64)}, nil
+		},
+		nil,
+	},
+	"toList": {
+		"toList",
+		[]string{},
+		func(_ *VM, this Value, p map[string]Value) (Value, error) {
+			return NewList(this.(*RangeValue).Items()), nil
+		},
+		nil,
+	},
+}
+
+func init() {
+	for _, name := range []string{"map", "filter", "reduce"} {
+		RangePrototype[name] = listOf(name)
+	}
+}
@@ -0,0 +1,68 @@
+package core
+
+import (
+	"testing"
+)
+
+func TestRangeValue(t *testing.T) {
+	cases := []struct {
+		r     *RangeValue
+		items []Value
+	}{
+		{NewRange(1, 4, false), []Value{NewNumber(1), NewNumber(2), NewNumber(3)}},
+		{NewRange(1, 4, true), []Value{NewNumber(1), NewNumber(2), NewNumber(3), NewNumber(4)}},
+		{NewRange(0.5, 2, false), []Value{NewNumber(0.5), NewNumber(1.5)}},
+		{NewRange(3, 1, true), []Value{}},
+		{NewRange(2, 2, false), []Value{}},
+	}
+
+	for _, tc := range cases {
+		CompareValues(t, NewList(tc.r.Items()), NewList(tc.items))
+	}
+
+	if !NewRange(1, 3, false).Equals(NewRange(1, 2, true)) || NewRange(1, 3, false).Hash() != NewRange(1, 2, true).Hash() {
+		t.Errorf("expected ranges of the same numbers to be equal")
+	}
+
+	if !NewRange(5, 1, false).Equals(NewRange(0, 0, false)) || NewRange(1, 3, false).Equals(NewRange(2, 4, false)) {
+		t.Errorf("expected only ranges of the same numbers to be equal")
+	}
+
+	if r := NewRange(0, 10, false); !r.Has(9) || r.Has(10) || r.Has(0.5) || r.Has(-1) {
+		t.Errorf("expected 0..10 to have the integers from 0 to 9")
+	}
+}
+
+func TestRangeValue_Program(t *testing.T) {
+	vm := runSource(t, `
+n := 3
+r := 1..n + 2
+length := r.length()
+third := r[2]
+items := (0..=n).toList()
+squares := r.map(|x| x * x)
+sum := r.reduce(|a, b| a + b, 0)
+has := r.has(4)
+kind := typeof(r)
+text := format("{}", [1..=n])
+`)
+
+	if err := vm.Error(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	CompareValues(t, vm.Variable("length"), NewNumber(4))
+	CompareValues(t, vm.Variable("third"), NewNumber(3))
+	CompareValues(t, vm.Variable("items"), NewList([]Value{NewNumber(0), NewNumber(1), NewNumber(2), NewNumber(3)}))
+	CompareValues(t, vm.Variable("squares"), NewList([]Value{NewNumber(1), NewNumber(4), NewNumber(9), NewNumber(16)}))
+	CompareValues(t, vm.Variable("sum"), NewNumber(10))
+	CompareValues(t, vm.Variable("has"), NewBool(true))
+	CompareValues(t, vm.Variable("kind"), NewString("range"))
+	CompareValues(t, vm.Variable("text"), NewString("1..=3"))
+
+	for _, src := range []string{`r := "a"..3`, "r := 1n..3n", "r := (1..3)[3]"} {
+		if vm := runSource(t, src); vm.Error() == nil {
+			t.Errorf("expected an error running %q", src)
+		}
+	}
+}
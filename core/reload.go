@@ -0,0 +1,69 @@
+package core
+
+// Reload swap the functions of a running program for those of a new version of it, such as once its source has
+// changed. The variables of the top level holding functions the new version declares are given the new functions, so
+// they are what is called from then on, while calls already being executed carry on as they were. Functions which the
+// running program has no variable for are made globals. Nothing of the new version is executed, so the variables of
+// the program keep their values. It returns the names of the functions swapped in.
+func (vm *VM) Reload(program *Program) []string {
+	// the variables of the top level are those before the first call
+	end := vm.stack.Current
+	if vm.call.Current > 0 {
+		end = vm.call.items[0].stackEnd
+	}
+
+	var names []string
+	for _, f := range program.chunk.declaredFunctions() {
+		names = append(names, f.name)
+
+		if v := topLevelVariable(vm.stack.items[:end], f.name); v != nil && !f.global {
+			v.value = f.function
+		} else {
+			vm.SetGlobal(f.name, f.function)
+		}
+	}
+
+	return names
+}
+
+// declaredFunction a function a chunk declares, as a variable or a global
+type declaredFunction struct {
+	name     string
+	function *FunctionValue
+	global   bool
+}
+
+// declaredFunctions find the functions the chunk declares, in the order it declares them. Functions are declared by
+// pushing the constant of the function and then declaring the variable or setting the global.
+func (c *Chunk) declaredFunctions() []declaredFunction {
+	var functions []declaredFunction
+
+	previous := Pos(-1)
+	for at := Pos(0); int(at) < len(c.Bytecode); at += Pos(1 + operands(c.Bytecode[at]).width()) {
+		op := c.Bytecode[at]
+		if (op == InstructionDeclareLocal || op == InstructionSetGlobal) && previous >= 0 &&
+			c.Bytecode[previous] == InstructionConstant {
+			f, isFunction := c.Constants[c.operand(previous)].(*FunctionValue)
+			name, isName := c.Constants[c.operand(at)].(*StringValue)
+
+			if isFunction && isName {
+				functions = append(functions, declaredFunction{name.string, f, op == InstructionSetGlobal})
+			}
+		}
+
+		previous = at
+	}
+
+	return functions
+}
+
+// topLevelVariable find the variable of the top level with a name, among the values of the main frame
+func topLevelVariable(values []Value, name string) *VariableValue {
+	for _, value := range values {
+		if v, ok := value.(*VariableValue); ok && v.name == name && v.scope == 0 {
+			return v
+		}
+	}
+
+	return nil
+}
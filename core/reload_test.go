@@ -0,0 +1,63 @@
+package core
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestVM_Reload(t *testing.T) {
+	program, err := Compile(`func f() {
+	return 1
+}
+
+total := 0
+i := 0
+while i < 10 {
+	total = total + f()
+	i = i + 1
+}`, CompileOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	vm := program.NewVM(RunOptions{})
+	// stopped halfway through the loop
+	for vm.Next() {
+		if i := vm.Variable("i"); i != nil && i.Equals(NewNumber(5)) {
+			break
+		}
+	}
+
+	changed, err := Compile(`func f() {
+	return 10
+}
+
+func g() {
+	return "new"
+}
+
+total := 1000`, CompileOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if names := vm.Reload(changed); !reflect.DeepEqual(names, []string{"f", "g"}) {
+		t.Errorf("Expected f and g to be swapped in, got %v", names)
+	}
+
+	for vm.Next() {
+	}
+
+	if vm.Error() != nil {
+		t.Fatalf("Unexpected error: %s", vm.Error().Format())
+	}
+
+	// the loop calls the new f once reloaded, and nothing else of the new version is executed
+	CompareValues(t, vm.Variable("total"), NewNumber(55))
+
+	result, err := vm.Call(vm.GetGlobal("g"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	CompareValues(t, result, &StringValue{"new"})
+}
@@ -0,0 +1,135 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// TextEdit a change to the source of a program, replacing the runes from Start up to End with Text
+type TextEdit struct {
+	Start Pos
+	End   Pos
+	Text  string
+}
+
+// Symbols the symbols declared in a program and where they are used, or nil if the program wasn't compiled from
+// source (see Compile). The table is the same each time, so its symbols can be compared to find their occurrences.
+func (p *Program) Symbols() *SymbolTable {
+	if p.parsed == nil {
+		return nil
+	}
+
+	p.parsed.symbolsOnce.Do(func() {
+		p.parsed.symbols = NewSymbolTable(p.parsed.tree, p.parsed.positions)
+	})
+
+	return p.parsed.symbols
+}
+
+// References get where a symbol of the program (see Program.Symbols) is declared and used, in the order they are in
+// the source. Symbols which aren't declared in the program, such as globals, are the same wherever their name is used.
+func References(p *Program, s *Symbol) []Occurrence {
+	symbols := p.Symbols()
+	if symbols == nil || s == nil {
+		return nil
+	}
+
+	var references []Occurrence
+	for _, o := range symbols.Occurrences {
+		if o.Symbol == s {
+			references = append(references, o)
+		}
+	}
+
+	if s.Declaration == nil {
+		for _, o := range symbols.Unresolved {
+			if o.Symbol.Name == s.Name && o.Token != nil {
+				references = append(references, o)
+			}
+		}
+	}
+
+	slices.SortFunc(references, func(a, b Occurrence) int {
+		return int(a.Token.Start) - int(b.Token.Start)
+	})
+
+	return references
+}
+
+// Rename get the edits to the source of a program renaming a symbol declared in it (see Program.Symbols), wherever it
+// is declared and used. Renaming fails if the name isn't a valid one, or is already used by another symbol it would
+// clash with: one declared in the same function, or a global the program uses.
+func Rename(p *Program, s *Symbol, name string) ([]TextEdit, error) {
+	symbols := p.Symbols()
+	if symbols == nil {
+		return nil, errors.New("the program wasn't compiled from source")
+	}
+
+	if s == nil {
+		return nil, errors.New("no symbol to rename")
+	}
+
+	if s.Declaration == nil {
+		return nil, errors.New(fmt.Sprintf("%s can't be renamed, as it isn't declared in the program", s.Name))
+	}
+
+	if !validName(name) {
+		return nil, errors.New(fmt.Sprintf("%s isn't a valid name", name))
+	}
+
+	if name == s.Name {
+		return nil, nil
+	}
+
+	for _, other := range symbols.Symbols {
+		if other != s && other.Name == name && other.Parent == s.Parent {
+			return nil, errors.New(fmt.Sprintf("%s is already declared", name))
+		}
+	}
+
+	for _, o := range symbols.Unresolved {
+		if o.Symbol.Name == name {
+			return nil, errors.New(fmt.Sprintf("the program uses the global %s, which %s would hide", name, s.Name))
+		}
+	}
+
+	var edits []TextEdit
+	for _, o := range References(p, s) {
+		// the tokens of declarations are usually their names, but not all are (such as those of destructuring)
+		end := o.Token.Start + Pos(len([]rune(s.Name)))
+		if int(end) > len(p.source) || string(p.source[o.Token.Start:end]) != s.Name {
+			return nil, errors.New(fmt.Sprintf("%s can't be renamed where it is on line %d", s.Name, o.Token.Line+1))
+		}
+
+		edits = append(edits, TextEdit{o.Token.Start, end, name})
+	}
+
+	return edits, nil
+}
+
+// validName whether a name is one variables can be declared with, which isn't a keyword
+func validName(name string) bool {
+	tokens, err := NewLexer(name).Tokenize()
+	return err == nil && len(tokens) == 2 && tokens[0].Type == TokenName && tokens[0].Lexeme == name && name != "_"
+}
+
+// ApplyEdits make edits to source, which may be in any order but mustn't overlap
+func ApplyEdits(src []rune, edits []TextEdit) string {
+	edits = slices.Clone(edits)
+	slices.SortFunc(edits, func(a, b TextEdit) int {
+		return int(a.Start) - int(b.Start)
+	})
+
+	b := strings.Builder{}
+	last := Pos(0)
+	for _, edit := range edits {
+		b.WriteString(string(src[last:edit.Start]))
+		b.WriteString(edit.Text)
+		last = edit.End
+	}
+	b.WriteString(string(src[last:]))
+
+	return b.String()
+}
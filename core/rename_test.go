@@ -0,0 +1,95 @@
+package core
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRename(t *testing.T) {
+	src := `count := 1
+
+func add(count, n = count) {
+	return count + n
+}
+
+func total() {
+	count = count + 1
+	return add(count)
+}
+
+write(total())
+`
+	program, err := Compile(src, CompileOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	symbolAt := func(s string, n int) *Symbol {
+		i := -1
+		for ; n > 0; n-- {
+			i += 1 + strings.Index(src[i+1:], s)
+		}
+
+		o := program.Symbols().At(Pos(len([]rune(src[:i]))))
+		if o == nil {
+			t.Fatalf("expected a symbol at %q", s)
+		}
+
+		return o.Symbol
+	}
+
+	// the top level count, which the default of add uses but its body doesn't, as its parameter shadows it
+	count := symbolAt("count", 1)
+	if references := References(program, count); len(references) != 5 {
+		t.Errorf("expected 5 references to count, got %d", len(references))
+	}
+
+	edits, err := Rename(program, count, "counter")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `counter := 1
+
+func add(count, n = counter) {
+	return count + n
+}
+
+func total() {
+	counter = counter + 1
+	return add(counter)
+}
+
+write(total())
+`
+	if renamed := ApplyEdits(program.source, edits); renamed != expected {
+		t.Errorf("expected count to be renamed to:\n%s\ngot:\n%s", expected, renamed)
+	}
+
+	// the parameter, which is renamed where it is declared too
+	edits, err = Rename(program, symbolAt("count", 4), "c")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if renamed := ApplyEdits(program.source, edits); !strings.Contains(renamed, "func add(c, n = count) {\n\treturn c + n") {
+		t.Errorf("expected the parameter count to be renamed, got:\n%s", renamed)
+	}
+
+	for _, test := range []struct {
+		symbol *Symbol
+		name   string
+		err    string
+	}{
+		{count, "func", "isn't a valid name"},
+		{count, "two words", "isn't a valid name"},
+		{count, "add", "already declared"},
+		{count, "write", "global write"},
+		{symbolAt("n =", 1), "count", "already declared"},
+		{symbolAt("write", 1), "print", "isn't declared in the program"},
+	} {
+		if _, err := Rename(program, test.symbol, test.name); err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("expected renaming %s to %s to fail with %q, got %v", test.symbol.Name, test.name, test.err, err)
+		}
+	}
+}
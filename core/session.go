@@ -0,0 +1,134 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+)
+
+// Session a program entered a piece at a time, such as the lines given to a REPL. Each input is compiled onto what
+// the inputs before it compiled, so the variables, functions, globals and types they declared are known while
+// compiling it (calls to them are checked, and their types deduced), and is run on the same VM, so they keep their
+// values. Inputs which fail to compile or run are undone, leaving the session as it was before them.
+type Session struct {
+	compiler *Compiler
+	vm       *VM
+	// notes the notes the compiler made about the last input
+	notes []Note
+}
+
+// NewSession create a session compiling its inputs with the compile options, and running them with the run options.
+// It should be closed once done with.
+func NewSession(compile CompileOptions, run RunOptions) *Session {
+	c := compile.compiler()
+	// the inputs are all within the scope of the top level, as the statements of a program are
+	c.scope = 1
+
+	vm := (&Program{NewChunk(nil, nil), nil, nil, nil, nil}).NewVM(run)
+
+	return &Session{c, vm, nil}
+}
+
+// Eval compile and run an input of the session. Inputs which are a single expression (such as 1 + 2 or f(3)) return
+// its value, others return nil. Errors are like those of Compile and Program.Run, and positions in them are of the
+// input.
+func (s *Session) Eval(src string) (Value, error) {
+	tree, positions, err := parse(src)
+	expression, expressionPositions, expressionErr := parseExpression(src)
+	if expressionErr == nil {
+		tree, positions, err = &ReturnNode{expression}, expressionPositions, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	c, vm := s.compiler, s.vm
+
+	// what is undone if the input fails
+	locals, declared, functions, globals, types, notes := c.stack.Current, maps.Clone(c.declared),
+		maps.Clone(c.functions), maps.Clone(c.globals), maps.Clone(c.types), len(c.notes)
+	values, variables, scope := vm.stack.Current, vm.variableEnd, vm.scope
+
+	undo := func() {
+		c.stack.Current, c.declared, c.functions, c.globals, c.types = locals, declared, functions, globals, types
+		vm.stack.Current, vm.variableEnd, vm.scope, vm.call.Current = values, variables, scope, 0
+		vm.err = nil
+	}
+
+	c.SetPositions(positions)
+	err = c.compileContinuation(tree)
+	s.notes = c.notes[notes:]
+	if err == nil {
+		if err = c.Chunk.verifyStack(); err != nil {
+			err = fmt.Errorf("compiled invalid bytecode: %w", err)
+		}
+	}
+
+	if err != nil {
+		undo()
+		return nil, err
+	}
+
+	vm.chunk, vm.ip = c.Chunk, 0
+	for vm.Next() {
+	}
+
+	if err := vm.Error(); err != nil {
+		undo()
+		return nil, err
+	}
+
+	if expressionErr != nil {
+		return nil, nil
+	}
+
+	return vm.stack.Pop(), nil
+}
+
+// Notes get the notes the compiler made about the last input
+func (s *Session) Notes() []Note {
+	return s.notes
+}
+
+// Variable get the value of a variable the inputs have declared, or nil if there is none
+func (s *Session) Variable(name string) Value {
+	return s.vm.Variable(name)
+}
+
+// VM get the VM the inputs are run on, for running the timers they set or calling the functions they declare
+func (s *Session) VM() *VM {
+	return s.vm
+}
+
+// Close close the VM of the session
+func (s *Session) Close() error {
+	return s.vm.Close()
+}
+
+// parseExpression lex and parse source which is a single expression, failing if anything follows it
+func parseExpression(src string) (n Node, positions Positions, err error) {
+	tokens, err := NewLexer(src).Tokenize()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// incomplete expressions may run out of tokens
+	defer func() {
+		if r := recover(); r != nil {
+			n, positions, err = nil, nil, errors.New("incomplete expression")
+		}
+	}()
+
+	p := NewParser(tokens)
+	p.advance()
+
+	n, err = p.condition()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if p.curr.Type != TokenEOF {
+		return nil, nil, p.error("expected the end of the expression", p.curr)
+	}
+
+	return n, p.Positions(), nil
+}
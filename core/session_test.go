@@ -0,0 +1,110 @@
+package core
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSession(t *testing.T) {
+	s := NewSession(CompileOptions{WarnImplicitAny: true}, RunOptions{})
+	defer s.Close()
+
+	eval := func(src string) Value {
+		v, err := s.Eval(src)
+		if err != nil {
+			t.Fatalf("Unexpected error evaluating %q: %v", src, err)
+		}
+
+		return v
+	}
+
+	if v := eval("x := 1"); v != nil {
+		t.Errorf("Expected declarations to have no value, got %v", v)
+	}
+
+	CompareValues(t, eval("x + 1"), NewNumber(2))
+
+	// the type of x is still known, so y isn't implicitly any
+	eval("y := x")
+	if notes := s.Notes(); len(notes) != 0 {
+		t.Errorf("Expected no notes declaring y, got %v", notes)
+	}
+
+	eval("func double(n) {\n\treturn n * 2\n}")
+	CompareValues(t, eval("double(y)"), NewNumber(2))
+
+	if _, err := s.Eval("double(1, 2)"); err == nil || !strings.Contains(err.Error(), "double") {
+		t.Errorf("Expected calling double with 2 arguments to fail while compiling, got %v", err)
+	}
+
+	// functions declared later in the same input are known
+	eval("func first() {\n\treturn second()\n}\nfunc second() {\n\treturn 3\n}")
+	if notes := s.Notes(); len(notes) != 0 {
+		t.Errorf("Expected no notes declaring first and second, got %v", notes)
+	}
+	CompareValues(t, eval("first()"), NewNumber(3))
+
+	// functions declared by later inputs are found once they are called
+	eval("func early() {\n\treturn late()\n}")
+	eval("func late() {\n\treturn 4\n}")
+	CompareValues(t, eval("early()"), NewNumber(4))
+
+	// as are types, whose members are still checked
+	eval("type Point {\n\tx: number\n}")
+	CompareValues(t, eval("Point(5).x"), NewNumber(5))
+	if _, err := s.Eval("Point(5).y"); err == nil || !strings.Contains(err.Error(), "no member y") {
+		t.Errorf("Expected y not to be a member of Point, got %v", err)
+	}
+}
+
+func TestSession_Redefinition(t *testing.T) {
+	s := NewSession(CompileOptions{}, RunOptions{})
+	defer s.Close()
+
+	for _, src := range []string{"func f(a) {\n\treturn a\n}", "x := 1", "func f(a, b) {\n\treturn a + b\n}", "x := \"one\""} {
+		if _, err := s.Eval(src); err != nil {
+			t.Fatalf("Unexpected error evaluating %q: %v", src, err)
+		}
+	}
+
+	// calls are checked against the new f
+	v, err := s.Eval("f(1, 2)")
+	if err != nil {
+		t.Fatalf("Expected the redefined f to be called, got %v", err)
+	}
+	CompareValues(t, v, NewNumber(3))
+
+	if _, err := s.Eval("f(1)"); err == nil {
+		t.Errorf("Expected calling the redefined f with 1 argument to fail")
+	}
+
+	CompareValues(t, s.Variable("x"), NewString("one"))
+}
+
+func TestSession_Failure(t *testing.T) {
+	s := NewSession(CompileOptions{}, RunOptions{})
+	defer s.Close()
+
+	if _, err := s.Eval("a := 1"); err != nil {
+		t.Fatal(err)
+	}
+
+	// inputs which fail are undone, along with the variables they declared before failing
+	if _, err := s.Eval("b := 2\ndiscard [].at(1)"); err == nil {
+		t.Fatalf("Expected the input to fail")
+	}
+
+	if v := s.Variable("b"); v != nil {
+		t.Errorf("Expected b to be undone, got %v", v)
+	}
+
+	if _, err := s.Eval("c := "); err == nil {
+		t.Fatalf("Expected the incomplete input to fail")
+	}
+
+	v, err := s.Eval("a + 1")
+	if err != nil {
+		t.Fatalf("Expected the session to carry on after failures, got %v", err)
+	}
+	CompareValues(t, v, NewNumber(2))
+}
@@ -0,0 +1,159 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// SetValue a set of values, which holds each value only once. Values are looked up by their hash, so adding, removing
+// and checking for values takes constant time however many there are. The items are kept in the order they were added.
+type SetValue struct {
+	items *valueMap
+	// frozen whether items can no longer be added or removed
+	frozen bool
+}
+
+func NewSet(items []Value) *SetValue {
+	s := &SetValue{newValueMap(), false}
+	for _, item := range items {
+		s.Add(item)
+	}
+
+	return s
+}
+
+// Add add an item to the set, if it doesn't already have it
+func (v *SetValue) Add(item Value) {
+	if _, ok := v.items.get(item); !ok {
+		v.items.set(item, nil)
+	}
+}
+
+// Has whether the set has an item
+func (v *SetValue) Has(item Value) bool {
+	_, ok := v.items.get(item)
+	return ok
+}
+
+// Remove remove an item from the set, returning whether it had it
+func (v *SetValue) Remove(item Value) bool {
+	return v.items.remove(item)
+}
+
+// Items get the items of the set, in the order they were added
+func (v *SetValue) Items() []Value {
+	return v.items.keys()
+}
+
+func (v *SetValue) Type() ValueType {
+	return SetValueType
+}
+
+func (v *SetValue) String() string {
+	return formatNested(v, map[Value]bool{}, true)
+}
+
+func (v *SetValue) format(visiting map[Value]bool) string {
+	var items []string
+	v.items.each(func(item Value, _ Value) bool {
+		items = append(items, formatNested(item, visiting, true))
+		return true
+	})
+
+	return fmt.Sprintf("set[%s]", strings.Join(items, ", "))
+}
+
+func (v *SetValue) cycle() string {
+	return "set[...]"
+}
+
+func (v *SetValue) DebugString() string {
+	return v.String()
+}
+
+func (v *SetValue) Equals(other Value) bool {
+	return equalsNested(v, other, map[[2]Value]bool{})
+}
+
+func (v *SetValue) Hash() uint64 {
+	return hashNested(v, 0)
+}
+
+// equals sets are equal when they have the same items, whichever order they were added in
+func (v *SetValue) equals(other Value, _ map[[2]Value]bool) bool {
+	set, ok := other.(*SetValue)
+	if !ok || v.items.len() != set.items.len() {
+		return false
+	}
+
+	equal := true
+	v.items.each(func(item Value, _ Value) bool {
+		equal = set.Has(item)
+		return equal
+	})
+
+	return equal
+}
+
+var SetPrototype = map[string]*BuiltinFunctionValue{
+	"add": {
+		"add",
+		[]string{"item"},
+		func(_ *VM, this Value, p map[string]Value) (Value, error) {
+			set := this.(*SetValue)
+			if set.frozen {
+				return nil, errors.New(fmt.Sprintf("cannot add %s to frozen set", p["item"].DebugString()))
+			}
+
+			set.Add(p["item"])
+			return &NilValue{}, nil
+		},
+		nil,
+	},
+	"has": {
+		"has",
+		[]string{"item"},
+		func(_ *VM, this Value, p map[string]Value) (Value, error) {
+			return &BoolValue{this.(*SetValue).Has(p["item"])}, nil
+		},
+		nil,
+	},
+	"remove": {
+		"remove",
+		[]string{"item"},
+		func(_ *VM, this Value, p map[string]Value) (Value, error) {
+			set := this.(*SetValue)
+			if set.frozen {
+				return nil, errors.New(fmt.Sprintf("cannot remove %s from frozen set", p["item"].DebugString()))
+			}
+
+			return &BoolValue{set.Remove(p["item"])}, nil
+		},
+		nil,
+	},
+	"length": {
+		"length",
+		[]string{},
+		func(_ *VM, this Value, p map[string]Value) (Value, error) {
+			return GoToValue(this.(*SetValue).items.len()), nil
+		},
+		nil,
+	},
+	"toList": {
+		"toList",
+		[]string{},
+		func(_ *VM, this Value, p map[string]Value) (Value, error) {
+			return &ListValue{this.(*SetValue).Items(), false, false}, nil
+		},
+		nil,
+	},
+}
+
+func (v *SetValue) Get(key string) (Value, error) {
+	if prop, ok := SetPrototype[key]; ok {
+		return prop, nil
+	}
+
+	return nil, errors.New(fmt.Sprintf("set has no property \"%s\"", key))
+}
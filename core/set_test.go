@@ -0,0 +1,81 @@
+package core
+
+import (
+	"math/big"
+	"testing"
+)
+
+func TestSetValue(t *testing.T) {
+	s := NewSet([]Value{NewNumber(1), NewBigInt(big.NewInt(1)), NewString("a")})
+	if s.items.len() != 2 {
+		t.Fatalf("expected equal items to be added once, got %s", s)
+	}
+
+	// enough removed to compact the entries, keeping the order of the rest
+	for i := 2; i < 10; i++ {
+		s.Add(NewNumber(float64(i)))
+	}
+
+	for i := 1; i < 8; i++ {
+		if !s.Remove(NewNumber(float64(i))) {
+			t.Errorf("expected %d to be removed", i)
+		}
+	}
+
+	if s.Remove(NewNumber(1)) {
+		t.Errorf("expected removing an item the set doesn't have to remove nothing")
+	}
+
+	CompareValues(t, NewList(s.Items()), NewList([]Value{NewString("a"), NewNumber(8), NewNumber(9)}))
+
+	if !s.Has(NewBigInt(big.NewInt(9))) || s.Has(NewNumber(1)) {
+		t.Errorf("expected the set to have 9 and not 1, got %s", s)
+	}
+}
+
+func TestSetValue_Program(t *testing.T) {
+	vm := runSource(t, `
+s := newSet([[1, 2], "a"])
+key := [3]
+s.add(key)
+s.add([1, 2])
+key.append(4)
+length := s.length()
+hasList := s.has([1, 2])
+hasKey := s.has([3])
+removed := s.remove("a")
+items := s.toList()
+same := s == newSet([[3], [1, 2]])
+`)
+
+	if err := vm.Error(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	CompareValues(t, vm.Variable("length"), &NumberValue{3, nil})
+	CompareValues(t, vm.Variable("hasList"), &BoolValue{true})
+	CompareValues(t, vm.Variable("hasKey"), &BoolValue{true})
+	CompareValues(t, vm.Variable("removed"), &BoolValue{true})
+	CompareValues(t, vm.Variable("items"), NewList([]Value{
+		NewList([]Value{NewNumber(1), NewNumber(2)}),
+		NewList([]Value{NewNumber(3)}),
+	}))
+	CompareValues(t, vm.Variable("same"), &BoolValue{true})
+
+	vm = runSource(t, "s := newSet(1)")
+	if vm.Error() == nil {
+		t.Errorf("expected an error making a set from a number")
+	}
+
+	vm = runSource(t, "s := freeze(newSet([1]))\nhas := s.has(1)")
+	if err := vm.Error(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	CompareValues(t, vm.Variable("has"), &BoolValue{true})
+
+	for _, src := range []string{"freeze(newSet(nil)).add(1)", "freeze(newSet([1])).remove(1)"} {
+		if vm := runSource(t, src); vm.Error() == nil {
+			t.Errorf("expected %q to fail", src)
+		}
+	}
+}
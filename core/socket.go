@@ -0,0 +1,180 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"time"
+)
+
+// Socket a connection to another machine, which the socket builtins send and receive through
+type Socket interface {
+	io.Closer
+	// Send send data through the socket, waiting for at most the timeout for it to be sent
+	Send(data []byte, timeout time.Duration) error
+	// Receive receive the data which has arrived, waiting for some to arrive for at most the timeout. Returns nil
+	// without an error if none has arrived by then.
+	Receive(timeout time.Duration) ([]byte, error)
+}
+
+// Dialer connect a socket to an address, taking at most the timeout to
+type Dialer func(address string, timeout time.Duration) (Socket, error)
+
+// SocketBuiltins builtins connecting to other machines over TCP, for hosts to give the programs they allow to use the
+// network (see CompileOptions.Builtins and RunOptions.Builtins), such as the command line does with --allow-net.
+var SocketBuiltins = NewSocketBuiltins(DialTCP)
+
+// NewSocketBuiltins create the socket builtins, connecting sockets with the dialer. Hosts without TCP connect them
+// some other way, such as the browser does with WebSockets.
+//
+// connect(address, timeout) opens a socket, which is a handle, send(socket, data, timeout) sends a string or bytes
+// through it and receive(socket, timeout) returns the bytes which arrive, or nil if none do in time. Timeouts are in
+// milliseconds.
+func NewSocketBuiltins(dial Dialer) *Registry {
+	return NewRegistry(
+		Builtin{
+			"connect",
+			Signature{[]string{"address", "timeout"}},
+			false,
+			func(vm *VM, this Value, params map[string]Value) (Value, error) {
+				address, ok := params["address"].(*StringValue)
+				if !ok {
+					return nil, errors.New(fmt.Sprintf("the address must be a string, got %s", TypeOf(params["address"])))
+				}
+
+				timeout, err := milliseconds(params["timeout"])
+				if err != nil {
+					return nil, err
+				}
+
+				socket, err := dial(address.string, timeout)
+				if err != nil {
+					return nil, errors.New(fmt.Sprintf("could not connect to %s: %v", address.string, err))
+				}
+
+				return vm.OpenHandle("socket "+address.string, socket), nil
+			},
+		},
+		Builtin{
+			"send",
+			Signature{[]string{"socket", "data", "timeout"}},
+			false,
+			func(vm *VM, this Value, params map[string]Value) (Value, error) {
+				socket, err := useSocket(params["socket"])
+				if err != nil {
+					return nil, err
+				}
+
+				var data []byte
+				switch v := params["data"].(type) {
+				case *StringValue:
+					data = []byte(v.string)
+				case *BytesValue:
+					data = v.bytes
+				default:
+					return nil, errors.New(fmt.Sprintf("can only send strings and bytes, got %s", TypeOf(v)))
+				}
+
+				timeout, err := milliseconds(params["timeout"])
+				if err != nil {
+					return nil, err
+				}
+
+				if err := socket.Send(data, timeout); err != nil {
+					return nil, errors.New(fmt.Sprintf("could not send to %s: %v", params["socket"], err))
+				}
+
+				return &NilValue{}, nil
+			},
+		},
+		Builtin{
+			"receive",
+			Signature{[]string{"socket", "timeout"}},
+			false,
+			func(vm *VM, this Value, params map[string]Value) (Value, error) {
+				socket, err := useSocket(params["socket"])
+				if err != nil {
+					return nil, err
+				}
+
+				timeout, err := milliseconds(params["timeout"])
+				if err != nil {
+					return nil, err
+				}
+
+				data, err := socket.Receive(timeout)
+				if err != nil {
+					return nil, errors.New(fmt.Sprintf("could not receive from %s: %v", params["socket"], err))
+				} else if data == nil {
+					return &NilValue{}, nil
+				}
+
+				return &BytesValue{data}, nil
+			},
+		},
+	)
+}
+
+// useSocket get the socket of a handle given to a socket builtin
+func useSocket(v Value) (Socket, error) {
+	h, ok := v.(*HandleValue)
+	if !ok {
+		return nil, errors.New(fmt.Sprintf("expected a socket, got %s", TypeOf(v)))
+	}
+
+	resource, err := h.Use()
+	if err != nil {
+		return nil, err
+	}
+
+	socket, ok := resource.(Socket)
+	if !ok {
+		return nil, errors.New(fmt.Sprintf("%s is not a socket", h.name))
+	}
+
+	return socket, nil
+}
+
+// tcpSocket a socket connected over TCP
+type tcpSocket struct {
+	net.Conn
+}
+
+// DialTCP connect a socket to an address over TCP
+func DialTCP(address string, timeout time.Duration) (Socket, error) {
+	conn, err := net.DialTimeout("tcp", address, timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	return tcpSocket{conn}, nil
+}
+
+func (s tcpSocket) Send(data []byte, timeout time.Duration) error {
+	if err := s.SetWriteDeadline(time.Now().Add(timeout)); err != nil {
+		return err
+	}
+
+	_, err := s.Write(data)
+	return err
+}
+
+func (s tcpSocket) Receive(timeout time.Duration) ([]byte, error) {
+	if err := s.SetReadDeadline(time.Now().Add(timeout)); err != nil {
+		return nil, err
+	}
+
+	buf := make([]byte, 4096)
+	n, err := s.Read(buf)
+	if errors.Is(err, os.ErrDeadlineExceeded) {
+		return nil, nil
+	} else if err == io.EOF {
+		return nil, errors.New("the connection was closed")
+	} else if err != nil {
+		return nil, err
+	}
+
+	return buf[:n], nil
+}
@@ -0,0 +1,71 @@
+package core
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestSocketBuiltins(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unexpected error listening: %v", err)
+	}
+	defer listener.Close()
+
+	// echo what is received
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		io.Copy(conn, conn)
+	}()
+
+	src := `socket := connect(address, 1000)
+send(socket, "hello", 1000)
+print(receive(socket, 1000).toString())
+print(receive(socket, 1))
+socket.close()`
+
+	program, err := Compile(src, CompileOptions{Builtins: SocketBuiltins, Globals: []string{"address"}})
+	if err != nil {
+		t.Fatalf("Unexpected error compiling: %v", err)
+	}
+
+	out := bytes.Buffer{}
+	_, err = program.Run(RunOptions{
+		Builtins: SocketBuiltins,
+		Globals:  map[string]Value{"address": NewString(listener.Addr().String())},
+		Output:   &out,
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error running: %v", err)
+	}
+
+	if out.String() != "hellonil" {
+		t.Errorf("Expected the socket to receive what it sent, and then nothing, got %q", out.String())
+	}
+}
+
+func TestSocketBuiltins_Errors(t *testing.T) {
+	for src, expected := range map[string]string{
+		`connect("127.0.0.1:0", 100)`: "could not connect",
+		`send(1, "data", 100)`:        "expected a socket",
+		`connect(1, 100)`:             "the address must be a string",
+	} {
+		program, err := Compile(src, CompileOptions{Builtins: SocketBuiltins})
+		if err != nil {
+			t.Fatalf("Unexpected error compiling %q: %v", src, err)
+		}
+
+		_, err = program.Run(RunOptions{Builtins: SocketBuiltins, Output: &bytes.Buffer{}})
+		if err == nil || !strings.Contains(err.Error(), expected) {
+			t.Errorf("Expected %q to fail with %q, got %v", src, expected, err)
+		}
+	}
+}
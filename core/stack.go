@@ -1,10 +1,31 @@
 package core
 
+// GrowthPolicy what a stack does once it is full
+type GrowthPolicy int
+
+const (
+	// GrowthFixed the stack never grows, overflowing once full
+	GrowthFixed GrowthPolicy = iota
+	// GrowthDoubling the stack doubles in size once full, using more memory to grow less often
+	GrowthDoubling
+	// GrowthChunked the stack grows by the size it was created with once full
+	GrowthChunked
+)
+
 type Stack[T any] struct {
 	Current Pos
-	Size    Pos
+	// Size how many items the stack can hold before it grows, which a lazy stack only makes room for as they are pushed
+	Size Pos
+	// High the most items the stack has held at once
+	High Pos
 
 	items []T
+
+	growth GrowthPolicy
+	// initial the size the stack was created with
+	initial Pos
+	// limit the size the stack can grow to
+	limit Pos
 }
 
 func NewStack[T any](size Pos) *Stack[T] {
@@ -12,18 +33,82 @@ func NewStack[T any](size Pos) *Stack[T] {
 		items:   make([]T, size),
 		Size:    size,
 		Current: 0,
+		initial: size,
+		limit:   size,
+	}
+}
+
+// lazyStackStart how many items a lazy stack makes room for once the first is pushed
+const lazyStackStart = 16
+
+// newLazyStack create a stack which makes room for its items as they are pushed rather than all at once, doubling
+// the room it has up to its size. Creating it costs next to nothing, which suits stacks most programs use little of,
+// such as the call stack.
+func newLazyStack[T any](size Pos) *Stack[T] {
+	return &Stack[T]{
+		Size:    size,
+		initial: size,
+		limit:   size,
 	}
 }
 
+// SetGrowth set how the stack grows once full, and the size it can not grow past
+func (s *Stack[T]) SetGrowth(policy GrowthPolicy, limit Pos) {
+	s.growth = policy
+	s.limit = max(limit, s.Size)
+}
+
 func (s *Stack[T]) Push(items ...T) {
 	for _, item := range items {
-		if s.Current >= s.Size {
+		if s.Current >= Pos(len(s.items)) && !s.grow() {
 			panic("stack overflow")
 		}
 
 		s.items[s.Current] = item
 		s.Current++
 	}
+
+	if s.Current > s.High {
+		s.High = s.Current
+	}
+}
+
+// grow make room for more items, which are those of its size a lazy stack hasn't made room for yet, or more according
+// to the growth policy once full. Returns whether there is more room.
+func (s *Stack[T]) grow() bool {
+	if Pos(len(s.items)) >= s.Size {
+		size := s.Size
+		switch s.growth {
+		case GrowthDoubling:
+			size = max(size*2, 1)
+		case GrowthChunked:
+			size += max(s.initial, 1)
+		}
+
+		size = min(size, s.limit)
+		if size <= s.Size {
+			return false
+		}
+
+		s.Size = size
+	}
+
+	items := make([]T, min(max(Pos(len(s.items))*2, lazyStackStart), s.Size))
+	copy(items, s.items)
+	s.items = items
+
+	return true
+}
+
+// reserve make room for n more items, growing the stack if it may, returning whether there is room for them
+func (s *Stack[T]) reserve(n Pos) bool {
+	for Pos(len(s.items))-s.Current < n {
+		if !s.grow() {
+			return false
+		}
+	}
+
+	return true
 }
 
 func (s *Stack[T]) Pop() T {
@@ -115,6 +115,86 @@ func TestStackOverflow(t *testing.T) {
 	s.Push(2)
 }
 
+func TestStackGrowth(t *testing.T) {
+	for policy, sizes := range map[GrowthPolicy][]Pos{
+		GrowthDoubling: {2, 4, 8, 10},
+		GrowthChunked:  {2, 4, 6, 8, 10},
+	} {
+		s := NewStack[int](2)
+		s.SetGrowth(policy, 10)
+
+		var got []Pos
+		for i := 0; i < 10; i++ {
+			s.Push(i)
+			if len(got) == 0 || got[len(got)-1] != s.Size {
+				got = append(got, s.Size)
+			}
+		}
+
+		if fmt.Sprint(got) != fmt.Sprint(sizes) {
+			t.Errorf("Expected policy %d to grow through the sizes %v, got %v", policy, sizes, got)
+		}
+
+		for i := 9; i >= 0; i-- {
+			if v := s.Pop(); v != i {
+				t.Errorf("Expected growing to keep the items, popped %d instead of %d", v, i)
+			}
+		}
+
+		if s.High != 10 {
+			t.Errorf("Expected the high-water mark to be 10, got %d", s.High)
+		}
+
+		func() {
+			defer func() {
+				if r := recover(); r == nil {
+					t.Errorf("pushing beyond the limit of a stack did not panic")
+				}
+			}()
+
+			for i := 0; i < 11; i++ {
+				s.Push(i)
+			}
+		}()
+	}
+}
+
+func TestLazyStack(t *testing.T) {
+	s := newLazyStack[int](40)
+	if s.Size != 40 || len(s.items) != 0 {
+		t.Errorf("Expected the lazy stack to be of size 40 without room for any item yet, got %d with room for %d",
+			s.Size, len(s.items))
+	}
+
+	var room []int
+	for i := 0; i < 40; i++ {
+		s.Push(i)
+		if len(room) == 0 || room[len(room)-1] != len(s.items) {
+			room = append(room, len(s.items))
+		}
+	}
+
+	if fmt.Sprint(room) != "[16 32 40]" {
+		t.Errorf("Expected the lazy stack to make room for 16, 32 and then 40 items, got %v", room)
+	}
+
+	for i := 39; i >= 0; i-- {
+		if v := s.Pop(); v != i {
+			t.Errorf("Expected making room to keep the items, popped %d instead of %d", v, i)
+		}
+	}
+
+	defer func() {
+		if r := recover(); r == nil {
+			t.Errorf("pushing beyond the size of a lazy stack did not panic")
+		}
+	}()
+
+	for i := 0; i < 41; i++ {
+		s.Push(i)
+	}
+}
+
 func BenchmarkStack(b *testing.B) {
 	for n := 256; n <= 512; n += 256 {
 		b.Run(fmt.Sprintf("size_%d", n), func(b *testing.B) {
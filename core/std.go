@@ -0,0 +1,117 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+// StandardModules modules provided by the language, imported by path (import "std/test") instead of being resolved
+var StandardModules = map[string]*Registry{}
+
+func init() {
+	// registered here, as the modules' functions refer back to the modules through the VM
+	StandardModules["std/test"] = TestModule
+}
+
+// AssertionError the message of errors raised by failing assertions begin with this
+const AssertionError = "assertion failed"
+
+func assertionFailed(vm *VM, format string, a ...interface{}) error {
+	return NewError(fmt.Sprintf(AssertionError+": "+format, a...), nil, vm.Trace())
+}
+
+// TestModule assertions for testing programs. A failing assertion raises an error, ending the test.
+var TestModule = NewRegistry(
+	Builtin{
+		"assertEq",
+		Signature{[]string{"a", "b"}},
+		false,
+		func(vm *VM, this Value, params map[string]Value) (Value, error) {
+			a := params["a"]
+			b := params["b"]
+
+			if !a.Equals(b) {
+				return nil, assertionFailed(vm, "%s does not equal %s", a.DebugString(), b.DebugString())
+			}
+
+			return &NilValue{}, nil
+		},
+	},
+	Builtin{
+		"assertNotEq",
+		Signature{[]string{"a", "b"}},
+		false,
+		func(vm *VM, this Value, params map[string]Value) (Value, error) {
+			a := params["a"]
+			b := params["b"]
+
+			if a.Equals(b) {
+				return nil, assertionFailed(vm, "%s equals %s", a.DebugString(), b.DebugString())
+			}
+
+			return &NilValue{}, nil
+		},
+	},
+	Builtin{
+		"assertTrue",
+		Signature{[]string{"value"}},
+		false,
+		func(vm *VM, this Value, params map[string]Value) (Value, error) {
+			if !params["value"].Equals(&BoolValue{true}) {
+				return nil, assertionFailed(vm, "%s is not true", params["value"].DebugString())
+			}
+
+			return &NilValue{}, nil
+		},
+	},
+	Builtin{
+		"assertFalse",
+		Signature{[]string{"value"}},
+		false,
+		func(vm *VM, this Value, params map[string]Value) (Value, error) {
+			if !params["value"].Equals(&BoolValue{false}) {
+				return nil, assertionFailed(vm, "%s is not false", params["value"].DebugString())
+			}
+
+			return &NilValue{}, nil
+		},
+	},
+	Builtin{
+		"assertClose",
+		Signature{[]string{"a", "b", "epsilon"}},
+		false,
+		func(vm *VM, this Value, params map[string]Value) (Value, error) {
+			a, aOk := params["a"].(*NumberValue)
+			b, bOk := params["b"].(*NumberValue)
+			epsilon, epsilonOk := params["epsilon"].(*NumberValue)
+			if !aOk || !bOk || !epsilonOk {
+				return nil, errors.New("assertClose expects numbers")
+			}
+
+			if math.Abs(a.float64-b.float64) > epsilon.float64 {
+				return nil, assertionFailed(vm, "%s is not within %s of %s", a, epsilon, b)
+			}
+
+			return &NilValue{}, nil
+		},
+	},
+	Builtin{
+		"assertThrows",
+		Signature{[]string{"f"}},
+		false,
+		func(vm *VM, this Value, params map[string]Value) (Value, error) {
+			_, err := vm.Call(params["f"], []Value{})
+			if err == nil {
+				return nil, assertionFailed(vm, "%s did not throw an error", params["f"].DebugString())
+			}
+
+			e, ok := err.(*ErrorValue)
+			if !ok {
+				e = NewError(err.Error(), nil, nil)
+			}
+
+			return e, nil
+		},
+	},
+)
@@ -0,0 +1,71 @@
+package core
+
+import (
+	"strings"
+	"testing"
+)
+
+func runSource(t *testing.T, src string) *VM {
+	tokens, err := NewLexer(src).Tokenize()
+	if err != nil {
+		t.Fatalf("Unexpected error tokenizing: %v", err)
+	}
+
+	p := NewParser(tokens)
+	tree, err := p.Parse()
+	if err != nil {
+		t.Fatalf("Unexpected error parsing: %v", err)
+	}
+
+	c := NewCompiler()
+	c.SetPositions(p.Positions())
+	if err := c.Compile(tree); err != nil {
+		t.Fatalf("Unexpected error compiling: %v", err)
+	}
+
+	vm := NewVM(c.Chunk, 256, 256)
+	for vm.Next() {
+	}
+
+	return vm
+}
+
+func TestTestModule(t *testing.T) {
+	passing := map[string]string{
+		"assertEq":     "assertEq([1, 2], [1, 2])",
+		"assertNotEq":  "assertNotEq(1, 2)",
+		"assertTrue":   "assertTrue(1 < 2)",
+		"assertFalse":  "assertFalse(1 > 2)",
+		"assertClose":  "assertClose(0.1 + 0.2, 0.3, 0.0001)",
+		"assertThrows": "e := assertThrows(func() { return throw(error(\"bad\")) })\nassertEq(e.message, \"bad\")",
+	}
+
+	for name, src := range passing {
+		t.Run(name, func(t *testing.T) {
+			vm := runSource(t, "import \"std/test\"\n"+src)
+
+			if vm.Error() != nil {
+				t.Errorf("Unexpected failure: %s", vm.Error().Format())
+			}
+		})
+	}
+
+	failing := map[string]string{
+		"assertEq":     "assertEq(1, 2)",
+		"assertNotEq":  "assertNotEq(1, 1)",
+		"assertTrue":   "assertTrue(nil)",
+		"assertFalse":  "assertFalse(true)",
+		"assertClose":  "assertClose(1, 2, 0.5)",
+		"assertThrows": "assertThrows(func() { return 1 })",
+	}
+
+	for name, src := range failing {
+		t.Run(name+"_fails", func(t *testing.T) {
+			vm := runSource(t, "import \"std/test\"\n"+src)
+
+			if vm.Error() == nil || !strings.HasPrefix(vm.Error().Message, AssertionError) {
+				t.Errorf("Expected an assertion failure, got %v", vm.Error())
+			}
+		})
+	}
+}
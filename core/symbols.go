@@ -0,0 +1,324 @@
+package core
+
+import (
+	"fmt"
+	"strings"
+)
+
+type SymbolKind int
+
+const (
+	SymbolVariable SymbolKind = iota
+	SymbolFunction
+	SymbolParameter
+)
+
+func (k SymbolKind) String() string {
+	switch k {
+	case SymbolVariable:
+		return "variable"
+	case SymbolFunction:
+		return "function"
+	case SymbolParameter:
+		return "parameter"
+	}
+
+	return "undefined symbol kind"
+}
+
+// Symbol a variable, function or parameter declared in a program
+type Symbol struct {
+	Name string
+	Kind SymbolKind
+	// Params the parameters, if the symbol is a function
+	Params []string
+	// Value the node the symbol was declared with, if any
+	Value Node
+	// Declaration the token the symbol was declared at, nil if it is unknown
+	Declaration *Token
+	// Parent the function the symbol was declared in, nil if it was declared at the top level
+	Parent *Symbol
+}
+
+// Signature a short human-readable description of the symbol
+func (s *Symbol) Signature() string {
+	switch s.Kind {
+	case SymbolFunction:
+		return fmt.Sprintf("func %s(%s)", s.Name, strings.Join(s.Params, ", "))
+	case SymbolParameter:
+		return fmt.Sprintf("parameter %s", s.Name)
+	}
+
+	return fmt.Sprintf("%s := %s", s.Name, deduceKind(s.Value))
+}
+
+// deduceKind guess what kind of value a node results in, from the literal it is or the type it is cast to
+func deduceKind(n Node) string {
+	switch n := n.(type) {
+	case *StringNode:
+		return "string"
+	case *NumberNode:
+		return "number"
+	case *BigIntNode:
+		return "bigint"
+	case *BooleanNode:
+		return "bool"
+	case *NilNode:
+		return "nil"
+	case *ListNode:
+		return "list"
+	case *ObjectNode:
+		return "object"
+	case *RangeNode:
+		return "range"
+	case *FunctionNode:
+		return "function"
+	case *CastNode:
+		return n.target
+	}
+
+	return "any"
+}
+
+// Occurrence a place in the source where a symbol is declared or referenced
+type Occurrence struct {
+	Symbol *Symbol
+	Token  *Token
+	// Declaration whether this is where the symbol is declared
+	Declaration bool
+}
+
+// SymbolTable the symbols declared in a program, and where they are used
+type SymbolTable struct {
+	Symbols     []*Symbol
+	Occurrences []Occurrence
+	// Unresolved references to names which are not declared in the program (such as globals)
+	Unresolved []Occurrence
+
+	positions Positions
+	scopes    []map[string]*Symbol
+	function  *Symbol
+}
+
+// NewSymbolTable collect the symbols of a parsed tree, resolving references the same way the compiler does
+func NewSymbolTable(tree Node, positions Positions) *SymbolTable {
+	t := &SymbolTable{
+		positions: positions,
+		scopes:    []map[string]*Symbol{{}},
+	}
+
+	t.walk(tree)
+
+	return t
+}
+
+// At get the occurrence of a symbol at an offset in the source, or nil if there is none
+func (t *SymbolTable) At(offset Pos) *Occurrence {
+	for _, occurrences := range [][]Occurrence{t.Occurrences, t.Unresolved} {
+		for i, o := range occurrences {
+			if o.Token != nil && o.Token.Start <= offset && offset <= o.Token.Start+o.Token.Length {
+				return &occurrences[i]
+			}
+		}
+	}
+
+	return nil
+}
+
+// Visible get the symbols declared before an offset in the source, with later declarations shadowing earlier ones
+func (t *SymbolTable) Visible(offset Pos) []*Symbol {
+	seen := map[string]int{}
+	var symbols []*Symbol
+
+	for _, s := range t.Symbols {
+		if s.Declaration != nil && s.Declaration.Start > offset {
+			continue
+		}
+
+		if i, ok := seen[s.Name]; ok {
+			symbols[i] = s
+			continue
+		}
+
+		seen[s.Name] = len(symbols)
+		symbols = append(symbols, s)
+	}
+
+	return symbols
+}
+
+func (t *SymbolTable) descend() {
+	t.scopes = append(t.scopes, map[string]*Symbol{})
+}
+
+func (t *SymbolTable) ascend() {
+	t.scopes = t.scopes[:len(t.scopes)-1]
+}
+
+func (t *SymbolTable) declare(s *Symbol) {
+	s.Parent = t.function
+	t.scopes[len(t.scopes)-1][s.Name] = s
+	t.Symbols = append(t.Symbols, s)
+
+	if s.Declaration != nil {
+		t.Occurrences = append(t.Occurrences, Occurrence{s, s.Declaration, true})
+	}
+}
+
+func (t *SymbolTable) resolve(name string, token *Token) {
+	for i := len(t.scopes) - 1; i >= 0; i-- {
+		if s, ok := t.scopes[i][name]; ok {
+			if token != nil {
+				t.Occurrences = append(t.Occurrences, Occurrence{s, token, false})
+			}
+			return
+		}
+	}
+
+	t.Unresolved = append(t.Unresolved, Occurrence{&Symbol{Name: name}, token, false})
+}
+
+func (t *SymbolTable) walk(node Node) {
+	switch n := node.(type) {
+	case *BlockNode:
+		t.descend()
+		for _, statement := range n.statements {
+			t.walk(statement)
+		}
+		t.ascend()
+
+	case *AssignNode:
+		if n.name == "_" {
+			t.walk(n.value)
+			return
+		}
+
+		if !n.declare {
+			t.walk(n.value)
+			t.resolve(n.name, t.positions[n])
+			return
+		}
+
+		s := &Symbol{
+			Name:        n.name,
+			Kind:        SymbolVariable,
+			Value:       n.value,
+			Declaration: t.positions[n],
+		}
+
+		if f, ok := n.value.(*FunctionNode); ok {
+			s.Kind = SymbolFunction
+			s.Params = f.params
+			if token, ok := t.positions[f]; ok && f.name == n.name {
+				s.Declaration = token
+			}
+
+			// declare functions before their body, so they can be called recursively
+			t.declare(s)
+			t.walkFunction(f, s)
+			return
+		}
+
+		t.walk(n.value)
+		t.declare(s)
+
+	case *ConstNode:
+		t.walk(n.value)
+		t.declare(&Symbol{
+			Name:        n.name,
+			Kind:        SymbolVariable,
+			Value:       n.value,
+			Declaration: t.positions[n],
+		})
+
+	case *DestructureNode:
+		t.walk(n.value)
+
+		for _, name := range n.names {
+			if name != "_" {
+				t.declare(&Symbol{
+					Name:        name,
+					Kind:        SymbolVariable,
+					Declaration: t.positions[n],
+				})
+			}
+		}
+
+	case *GlobalNode:
+		t.walk(n.value)
+
+		// globals are visible everywhere, no matter where they are declared
+		s := &Symbol{
+			Name:        n.name,
+			Kind:        SymbolVariable,
+			Value:       n.value,
+			Declaration: t.positions[n],
+		}
+		s.Parent = t.function
+		t.scopes[0][s.Name] = s
+		t.Symbols = append(t.Symbols, s)
+		t.Occurrences = append(t.Occurrences, Occurrence{s, s.Declaration, true})
+
+	case *TypeNode:
+		// the constructor of the type, which is a function taking its members
+		s := &Symbol{
+			Name:        n.signature.Name,
+			Kind:        SymbolFunction,
+			Params:      n.signature.Members,
+			Value:       n.constructor,
+			Declaration: t.positions[n],
+		}
+		t.declare(s)
+
+	case *ForEachNode:
+		t.walk(n.items)
+
+		t.descend()
+		if n.name != "_" {
+			t.declare(&Symbol{
+				Name:        n.name,
+				Kind:        SymbolVariable,
+				Declaration: t.positions[n],
+			})
+		}
+		t.walk(n.do)
+		t.ascend()
+
+	case *FunctionNode:
+		t.walkFunction(n, t.function)
+
+	case *ReferenceNode:
+		t.resolve(n.name, t.positions[n])
+
+	default:
+		for _, child := range Children(node) {
+			t.walk(child)
+		}
+	}
+}
+
+func (t *SymbolTable) walkFunction(f *FunctionNode, s *Symbol) {
+	// defaults are evaluated by the callers, outside of the function
+	for _, d := range f.defaults {
+		if d != nil {
+			t.walk(d)
+		}
+	}
+
+	function := t.function
+	t.function = s
+	t.descend()
+
+	for i, name := range f.params {
+		t.declare(&Symbol{
+			Name:        name,
+			Kind:        SymbolParameter,
+			Declaration: t.positions[param{f, i}],
+		})
+	}
+
+	t.walk(f.logic)
+
+	t.ascend()
+	t.function = function
+}
@@ -0,0 +1,118 @@
+package core
+
+import (
+	"testing"
+)
+
+func parseForSymbols(t *testing.T, src string) (Node, Positions) {
+	tokens, err := NewLexer(src).Tokenize()
+	if err != nil {
+		t.Fatalf("Unexpected error tokenizing: %v", err)
+	}
+
+	p := NewParser(tokens)
+	tree, err := p.Parse()
+	if err != nil {
+		t.Fatalf("Unexpected error(s): %s", err)
+	}
+
+	return tree, p.Positions()
+}
+
+func TestNewSymbolTable(t *testing.T) {
+	src := "a := 1\nfunc sum(x, y) {\n\treturn x + y + a\n}\nwrite(sum(a, 2))"
+	tree, positions := parseForSymbols(t, src)
+
+	table := NewSymbolTable(tree, positions)
+
+	if len(table.Symbols) != 4 {
+		t.Fatalf("got %d symbols; want 4 (a, sum, x, y)", len(table.Symbols))
+	}
+
+	sum := table.Symbols[1]
+	if sum.Name != "sum" || sum.Kind != SymbolFunction {
+		t.Fatalf("got symbol %s (%s); want function sum", sum.Name, sum.Kind)
+	}
+
+	if sum.Signature() != "func sum(x, y)" {
+		t.Errorf("got signature %q; want %q", sum.Signature(), "func sum(x, y)")
+	}
+
+	if sum.Declaration == nil || sum.Declaration.Lexeme != "sum" {
+		t.Errorf("function should be declared at its name, got %v", sum.Declaration)
+	}
+
+	if table.Symbols[2].Parent != sum {
+		t.Errorf("parameter x should belong to sum")
+	}
+
+	references := 0
+	for _, o := range table.Occurrences {
+		if o.Symbol == table.Symbols[0] && !o.Declaration {
+			references++
+		}
+	}
+
+	if references != 2 {
+		t.Errorf("got %d references to a; want 2", references)
+	}
+
+	if len(table.Unresolved) != 1 || table.Unresolved[0].Symbol.Name != "write" {
+		t.Errorf("expected write to be the only unresolved reference, got %v", table.Unresolved)
+	}
+}
+
+func TestSymbolTable_At(t *testing.T) {
+	src := "value := 1\nwrite(value)"
+	tree, positions := parseForSymbols(t, src)
+
+	table := NewSymbolTable(tree, positions)
+
+	o := table.At(Pos(len("value := 1\nwrite(va")))
+	if o == nil {
+		t.Fatal("expected an occurrence of value")
+	}
+
+	if o.Declaration || o.Symbol.Name != "value" {
+		t.Errorf("got occurrence of %s (declaration: %v); want a reference to value", o.Symbol.Name, o.Declaration)
+	}
+
+	if table.At(Pos(len("value :"))) != nil {
+		t.Errorf("expected no occurrence between tokens")
+	}
+}
+
+func TestSymbolTable_Visible(t *testing.T) {
+	src := "a := 1\nb := 2\na := 3"
+	tree, positions := parseForSymbols(t, src)
+
+	table := NewSymbolTable(tree, positions)
+
+	visible := table.Visible(Pos(len("a := 1\nb")))
+	if len(visible) != 2 {
+		t.Fatalf("got %d visible symbols; want 2", len(visible))
+	}
+
+	visible = table.Visible(Pos(len(src)))
+	if len(visible) != 2 || visible[0].Declaration.Line != 2 {
+		t.Errorf("the latest declaration of a should shadow the first")
+	}
+}
+
+func TestNewSymbolTable_Global(t *testing.T) {
+	tokens, err := NewLexer("func f() {\n\tglobal g := 1\n}\nwrite(g)").Tokenize()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := NewParser(tokens)
+	tree, err := p.Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	table := NewSymbolTable(tree, p.Positions())
+	if len(table.Unresolved) != 1 || table.Unresolved[0].Symbol.Name != "write" {
+		t.Errorf("Expected only write to be unresolved, got %v", table.Unresolved)
+	}
+}
@@ -0,0 +1,257 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"strings"
+)
+
+// MissingKeys what render does with the tags of a template naming keys its data has none of
+type MissingKeys int
+
+const (
+	// MissingKeysError fail rendering, the default
+	MissingKeysError MissingKeys = iota
+	// MissingKeysEmpty render nothing in their place, as if the keys were nil
+	MissingKeysEmpty
+	// MissingKeysKeep keep the tags as they are written, so they can be seen in the output
+	MissingKeysKeep
+)
+
+// templateTag a part of a template: literal text, a tag rendering a value ({{name}} escaped for HTML, {{{name}}} or
+// {{&name}} as it is), or a section ({{#name}}...{{/name}}, or {{^name}}...{{/name}} when inverted)
+type templateTag struct {
+	// kind ' ' for text, '{' for escaped values, '&' for values as they are, '#' for sections and '^' for inverted
+	// sections
+	kind byte
+	// text the text, or the key the tag names
+	text string
+	// written the tag as it is written in the template
+	written  string
+	line     int
+	column   int
+	children []templateTag
+}
+
+// templateError an error at a place in a template
+func templateError(line int, column int, format string, a ...interface{}) error {
+	return errors.New(fmt.Sprintf("template line %d, column %d: %s", line, column, fmt.Sprintf(format, a...)))
+}
+
+// parseTemplate split a mustache-style template into text and tags, with the tags within sections beneath them.
+// Comments ({{! ...}}) are left out.
+func parseTemplate(template string) ([]templateTag, error) {
+	root := templateTag{kind: '#'}
+	sections := []*templateTag{&root}
+
+	line, column := 1, 1
+	// advance move the position past some of the template
+	advance := func(s string) {
+		for _, r := range s {
+			if r == '\n' {
+				line, column = line+1, 1
+			} else {
+				column++
+			}
+		}
+	}
+
+	for len(template) > 0 {
+		current := sections[len(sections)-1]
+
+		start := strings.Index(template, "{{")
+		if start < 0 {
+			start = len(template)
+		}
+
+		if start > 0 {
+			current.children = append(current.children, templateTag{kind: ' ', text: template[:start]})
+			advance(template[:start])
+			template = template[start:]
+			continue
+		}
+
+		closing := "}}"
+		if strings.HasPrefix(template, "{{{") {
+			closing = "}}}"
+		}
+
+		end := strings.Index(template, closing)
+		if end < 0 {
+			return nil, templateError(line, column, "unclosed tag")
+		}
+
+		written := template[:end+len(closing)]
+		tag := templateTag{'{', strings.TrimSpace(template[2:end]), written, line, column, nil}
+		if closing == "}}}" {
+			tag.kind, tag.text = '&', strings.TrimSpace(template[3:end])
+		} else if len(tag.text) > 0 && strings.ContainsRune("&#^/!", rune(tag.text[0])) {
+			tag.kind, tag.text = tag.text[0], strings.TrimSpace(tag.text[1:])
+		}
+
+		if tag.text == "" && tag.kind != '!' {
+			return nil, templateError(line, column, "tag names no key")
+		}
+
+		switch tag.kind {
+		case '!':
+		case '#', '^':
+			current.children = append(current.children, tag)
+			sections = append(sections, &current.children[len(current.children)-1])
+		case '/':
+			if len(sections) == 1 || current.text != tag.text {
+				return nil, templateError(line, column, "%s closes no section", written)
+			}
+
+			sections = sections[:len(sections)-1]
+		default:
+			current.children = append(current.children, tag)
+		}
+
+		advance(written)
+		template = template[len(written):]
+	}
+
+	if len(sections) > 1 {
+		unclosed := sections[len(sections)-1]
+		return nil, templateError(unclosed.line, unclosed.column, "section %s is never closed", unclosed.text)
+	}
+
+	return root.children, nil
+}
+
+// render render a mustache-style template with data. Tags name keys of the objects in the data, such as {{name}} or
+// {{user.name}}, and {{.}} is the value sections are rendering. Sections are rendered once for each item of lists,
+// once with objects and other values, and not at all for false, nil and empty lists; inverted sections are rendered
+// only then. What happens with keys the data doesn't have depends on the VM (see VM.SetMissingKeys).
+func (vm *VM) render(template string, data Value) (string, error) {
+	tags, err := parseTemplate(template)
+	if err != nil {
+		return "", err
+	}
+
+	out := strings.Builder{}
+	if err := vm.renderTags(&out, tags, []Value{data}); err != nil {
+		return "", err
+	}
+
+	return out.String(), nil
+}
+
+// renderTags render the tags of a template, with the values of the sections they are within (the innermost last)
+func (vm *VM) renderTags(out *strings.Builder, tags []templateTag, context []Value) error {
+	for _, tag := range tags {
+		if tag.kind == ' ' {
+			out.WriteString(tag.text)
+			continue
+		}
+
+		v, found := lookupKey(context, tag.text)
+		if !found {
+			switch vm.missingKeys {
+			case MissingKeysError:
+				return templateError(tag.line, tag.column, "the data has no key %s", tag.text)
+			case MissingKeysKeep:
+				if tag.kind == '{' || tag.kind == '&' {
+					out.WriteString(tag.written)
+					continue
+				}
+			}
+
+			v = &NilValue{}
+		}
+
+		switch tag.kind {
+		case '{', '&':
+			if _, ok := v.(*NilValue); ok {
+				continue
+			}
+
+			s := vm.ToString(v)
+			if tag.kind == '{' {
+				s = html.EscapeString(s)
+			}
+
+			out.WriteString(s)
+
+		case '#':
+			var items []Value
+			switch v := v.(type) {
+			case *NilValue:
+			case *BoolValue:
+				if v.bool {
+					items = []Value{v}
+				}
+			case *ListValue:
+				items = v.items
+			default:
+				items = []Value{v}
+			}
+
+			for _, item := range items {
+				if err := vm.renderTags(out, tag.children, append(context, item)); err != nil {
+					return err
+				}
+			}
+
+		case '^':
+			if isEmpty(v) {
+				if err := vm.renderTags(out, tag.children, context); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// lookupKey find the value of a key for a tag, in the innermost section with an object having its first part
+func lookupKey(context []Value, key string) (Value, bool) {
+	if key == "." {
+		return context[len(context)-1], true
+	}
+
+	parts := strings.Split(key, ".")
+	for i := len(context) - 1; i >= 0; i-- {
+		object, ok := context[i].(*ObjectValue)
+		if !ok {
+			continue
+		}
+
+		v, ok := object.members[parts[0]]
+		if !ok {
+			continue
+		}
+
+		for _, part := range parts[1:] {
+			object, ok := v.(*ObjectValue)
+			if !ok {
+				return nil, false
+			}
+
+			if v, ok = object.members[part]; !ok {
+				return nil, false
+			}
+		}
+
+		return v, true
+	}
+
+	return nil, false
+}
+
+// isEmpty whether a section for a value is left out: false, nil and empty lists
+func isEmpty(v Value) bool {
+	switch v := v.(type) {
+	case *NilValue:
+		return true
+	case *BoolValue:
+		return !v.bool
+	case *ListValue:
+		return len(v.items) == 0
+	}
+
+	return false
+}
@@ -0,0 +1,93 @@
+package core
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestVM_Render(t *testing.T) {
+	data := NewObject(map[string]Value{
+		"name":  NewString("<b>"),
+		"count": NewNumber(2),
+		"none":  &NilValue{},
+		"empty": NewList([]Value{}),
+		"items": NewList([]Value{
+			NewObject(map[string]Value{"name": NewString("a")}),
+			NewObject(map[string]Value{"name": NewString("b")}),
+		}),
+		"user": NewObject(map[string]Value{"email": NewString("x@y.z")}),
+		"on":   NewBool(true),
+	})
+
+	vm := NewVM(NewChunk(nil, nil), 16, 16)
+	for template, expected := range map[string]string{
+		"plain text":                                         "plain text",
+		"{{name}} {{{name}}} {{& name}}":                     "&lt;b&gt; <b> <b>",
+		"{{count}} items":                                    "2 items",
+		"{{user.email}}":                                     "x@y.z",
+		"{{#items}}[{{name}}]{{/items}}":                     "[a][b]",
+		"{{#items}}{{count}}{{/items}}":                      "22",
+		"{{#empty}}never{{/empty}}{{^empty}}empty{{/empty}}": "empty",
+		"{{#on}}on{{/on}}{{^on}}off{{/on}}":                  "on",
+		"{{#user}}{{email}}{{/user}}":                        "x@y.z",
+		"a{{! a comment }}b":                                 "ab",
+		"[{{none}}]":                                         "[]",
+		"line\n{{#items}}\n{{name}}{{/items}}":               "line\n\na\nb",
+	} {
+		got, err := vm.render(template, data)
+		if err != nil {
+			t.Errorf("Unexpected error rendering %q: %v", template, err)
+		} else if got != expected {
+			t.Errorf("Expected %q to render as %q, got %q", template, expected, got)
+		}
+	}
+}
+
+func TestVM_RenderErrors(t *testing.T) {
+	vm := NewVM(NewChunk(nil, nil), 16, 16)
+	data := NewObject(map[string]Value{"a": NewNumber(1)})
+
+	for template, expected := range map[string]string{
+		"{{missing}}":         "template line 1, column 1: the data has no key missing",
+		"ab\n  {{a}} {{b":     "template line 2, column 9: unclosed tag",
+		"{{#a}}\n{{/b}}":      "template line 2, column 1: {{/b}} closes no section",
+		"x {{#a}}":            "template line 1, column 3: section a is never closed",
+		"{{}}":                "template line 1, column 1: tag names no key",
+		"{{#a}}{{b.c}}{{/a}}": "template line 1, column 7: the data has no key b.c",
+	} {
+		if _, err := vm.render(template, data); err == nil || err.Error() != expected {
+			t.Errorf("Expected %q to fail with %q, got %v", template, expected, err)
+		}
+	}
+
+	vm.SetMissingKeys(MissingKeysEmpty)
+	if got, err := vm.render("[{{missing}}]{{#gone}}x{{/gone}}", data); err != nil || got != "[]" {
+		t.Errorf("Expected missing keys to render as nothing, got %q (%v)", got, err)
+	}
+
+	vm.SetMissingKeys(MissingKeysKeep)
+	if got, err := vm.render("[{{ missing }}]", data); err != nil || got != "[{{ missing }}]" {
+		t.Errorf("Expected missing keys to be kept as they are written, got %q (%v)", got, err)
+	}
+}
+
+func TestRender(t *testing.T) {
+	vm := runSource(t, `data := newObject()
+data.set("name", "world")
+greeting := render("hello {{name}}", data)`)
+
+	CompareValues(t, vm.Variable("greeting"), NewString("hello world"))
+
+	program, err := Compile(`render("{{a}}", newObject())`, CompileOptions{})
+	if err != nil {
+		t.Fatalf("Unexpected error compiling: %v", err)
+	}
+
+	if _, err := program.Run(RunOptions{MissingKeys: MissingKeysEmpty}); err != nil {
+		t.Errorf("Expected the missing keys to be set by the run options, got %v", err)
+	}
+
+	if _, err := program.Run(RunOptions{}); err == nil || !strings.Contains(err.Error(), "no key a") {
+		t.Errorf("Expected missing keys to fail by default, got %v", err)
+	}
+}
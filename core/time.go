@@ -0,0 +1,150 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// DateValue a point in time
+type DateValue struct {
+	time time.Time
+}
+
+func NewDate(t time.Time) *DateValue {
+	return &DateValue{t}
+}
+
+func (v *DateValue) Time() time.Time {
+	return v.time
+}
+
+func (v *DateValue) Type() ValueType {
+	return DateValueType
+}
+
+func (v *DateValue) String() string {
+	return v.time.Format(time.RFC3339Nano)
+}
+
+func (v *DateValue) DebugString() string {
+	return fmt.Sprintf("date(%s)", v.String())
+}
+
+func (v *DateValue) Equals(other Value) bool {
+	return other.Type() == DateValueType && other.(*DateValue).time.Equal(v.time)
+}
+
+func (v *DateValue) Hash() uint64 {
+	return mix(uint64(DateValueType), uint64(v.time.UnixNano()))
+}
+
+// dateField a builtin getting a number out of the date
+func dateField(name string, get func(t time.Time) int) *BuiltinFunctionValue {
+	return &BuiltinFunctionValue{
+		name,
+		[]string{},
+		func(_ *VM, this Value, p map[string]Value) (Value, error) {
+			return GoToValue(get(this.(*DateValue).time)), nil
+		},
+		nil,
+	}
+}
+
+var DatePrototype = map[string]*BuiltinFunctionValue{
+	"format": {
+		"format",
+		[]string{"layout"},
+		func(_ *VM, this Value, p map[string]Value) (Value, error) {
+			layout, ok := p["layout"].(*StringValue)
+			if !ok {
+				return nil, errors.New(fmt.Sprintf("date layout must be a string, got %s", TypeOf(p["layout"])))
+			}
+
+			return &StringValue{this.(*DateValue).time.Format(layout.string)}, nil
+		},
+		nil,
+	},
+	"unix": {
+		"unix",
+		[]string{},
+		func(_ *VM, this Value, p map[string]Value) (Value, error) {
+			return &NumberValue{float64(this.(*DateValue).time.UnixMilli()) / 1000, nil}, nil
+		},
+		nil,
+	},
+	"year":   dateField("year", time.Time.Year),
+	"month":  dateField("month", func(t time.Time) int { return int(t.Month()) }),
+	"day":    dateField("day", time.Time.Day),
+	"hour":   dateField("hour", time.Time.Hour),
+	"minute": dateField("minute", time.Time.Minute),
+	"second": dateField("second", time.Time.Second),
+}
+
+func (v *DateValue) Get(key string) (Value, error) {
+	if prop, ok := DatePrototype[key]; ok {
+		return prop, nil
+	}
+
+	return nil, errors.New(fmt.Sprintf("date has no property \"%s\"", key))
+}
+
+// DurationValue an amount of time, such as the time between two dates
+type DurationValue struct {
+	duration time.Duration
+}
+
+func NewDuration(d time.Duration) *DurationValue {
+	return &DurationValue{d}
+}
+
+func (v *DurationValue) Duration() time.Duration {
+	return v.duration
+}
+
+func (v *DurationValue) Type() ValueType {
+	return DurationValueType
+}
+
+func (v *DurationValue) String() string {
+	return v.duration.String()
+}
+
+func (v *DurationValue) DebugString() string {
+	return fmt.Sprintf("duration(%s)", v.String())
+}
+
+func (v *DurationValue) Equals(other Value) bool {
+	return other.Type() == DurationValueType && other.(*DurationValue).duration == v.duration
+}
+
+func (v *DurationValue) Hash() uint64 {
+	return mix(uint64(DurationValueType), uint64(v.duration))
+}
+
+var DurationPrototype = map[string]*BuiltinFunctionValue{
+	"seconds": {
+		"seconds",
+		[]string{},
+		func(_ *VM, this Value, p map[string]Value) (Value, error) {
+			return &NumberValue{this.(*DurationValue).duration.Seconds(), nil}, nil
+		},
+		nil,
+	},
+	"milliseconds": {
+		"milliseconds",
+		[]string{},
+		func(_ *VM, this Value, p map[string]Value) (Value, error) {
+			return &NumberValue{float64(this.(*DurationValue).duration) / float64(time.Millisecond), nil}, nil
+		},
+		nil,
+	},
+}
+
+func (v *DurationValue) Get(key string) (Value, error) {
+	if prop, ok := DurationPrototype[key]; ok {
+		return prop, nil
+	}
+
+	return nil, errors.New(fmt.Sprintf("duration has no property \"%s\"", key))
+}
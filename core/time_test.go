@@ -0,0 +1,70 @@
+package core
+
+import (
+	"testing"
+	"time"
+)
+
+func TestArithmetic_Time(t *testing.T) {
+	date := NewDate(time.Date(2024, 2, 28, 12, 0, 0, 0, time.UTC))
+	day := NewDuration(24 * time.Hour)
+
+	cases := []struct {
+		op       Bytecode
+		l        Value
+		r        Value
+		expected Value
+	}{
+		{InstructionAdd, date, day, NewDate(time.Date(2024, 2, 29, 12, 0, 0, 0, time.UTC))},
+		{InstructionAdd, day, date, NewDate(time.Date(2024, 2, 29, 12, 0, 0, 0, time.UTC))},
+		{InstructionSub, date, day, NewDate(time.Date(2024, 2, 27, 12, 0, 0, 0, time.UTC))},
+		{InstructionSub, NewDate(time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)), date, NewDuration(48 * time.Hour)},
+		{InstructionMul, day, &NumberValue{0.5, nil}, NewDuration(12 * time.Hour)},
+		{InstructionMul, &NumberValue{2, nil}, day, NewDuration(48 * time.Hour)},
+		{InstructionDiv, day, &NumberValue{4, nil}, NewDuration(6 * time.Hour)},
+		{InstructionLess, date, NewDate(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)), &BoolValue{true}},
+		{InstructionGreaterOrEqual, day, NewDuration(time.Hour), &BoolValue{true}},
+	}
+
+	for _, c := range cases {
+		result, err := arithmetic(c.op, c.l, c.r)
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+			continue
+		}
+
+		if !result.Equals(c.expected) {
+			t.Errorf("expected %s, got %s", c.expected.DebugString(), result.DebugString())
+		}
+	}
+
+	for _, c := range [][]Value{{date, &NumberValue{1, nil}}, {date, date}, {day, &StringValue{"a"}}} {
+		if _, err := arithmetic(InstructionAdd, c[0], c[1]); err == nil {
+			t.Errorf("expected an error adding %s and %s", c[0].DebugString(), c[1].DebugString())
+		}
+	}
+}
+
+func TestDateValue_Program(t *testing.T) {
+	vm := runSource(t, `
+start := parseDate("2024-01-31T23:00:00Z")
+end := start + parseDuration("1h30m")
+month := end.month()
+formatted := end.format("2006-01-02 15:04")
+elapsed := (end - start).seconds()
+later := end > start
+`)
+
+	if err := vm.Error(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	CompareValues(t, vm.Variable("month"), &NumberValue{2, nil})
+	CompareValues(t, vm.Variable("formatted"), &StringValue{"2024-02-01 00:30"})
+	CompareValues(t, vm.Variable("elapsed"), &NumberValue{5400, nil})
+	CompareValues(t, vm.Variable("later"), &BoolValue{true})
+
+	if runSource(t, "x := now() + 1").Error() == nil {
+		t.Errorf("expected an error adding a number to a date")
+	}
+}
@@ -0,0 +1,195 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// timer a function the VM calls once it is due, and again every interval after if it has one
+type timer struct {
+	id       int
+	due      time.Time
+	interval time.Duration
+	f        Value
+}
+
+func init() {
+	// registered here, as running timers calls functions, which refers back to the default builtins
+	for _, b := range []Builtin{
+		{
+			"setTimeout",
+			Signature{[]string{"f", "milliseconds"}},
+			false,
+			func(vm *VM, this Value, params map[string]Value) (Value, error) {
+				if !isFunction(params["f"]) {
+					return nil, errors.New(fmt.Sprintf("setTimeout must be given a function, got %s", TypeOf(params["f"])))
+				}
+
+				after, err := milliseconds(params["milliseconds"])
+				if err != nil {
+					return nil, err
+				}
+
+				return NewNumber(float64(vm.schedule(params["f"], after, 0))), nil
+			},
+		},
+		{
+			"setInterval",
+			Signature{[]string{"f", "milliseconds"}},
+			false,
+			func(vm *VM, this Value, params map[string]Value) (Value, error) {
+				if !isFunction(params["f"]) {
+					return nil, errors.New(fmt.Sprintf("setInterval must be given a function, got %s", TypeOf(params["f"])))
+				}
+
+				interval, err := milliseconds(params["milliseconds"])
+				if err != nil {
+					return nil, err
+				} else if interval <= 0 {
+					return nil, errors.New("the interval must be longer than 0 milliseconds")
+				}
+
+				return NewNumber(float64(vm.schedule(params["f"], interval, interval))), nil
+			},
+		},
+		{
+			"clearTimer",
+			Signature{[]string{"id"}},
+			false,
+			func(vm *VM, this Value, params map[string]Value) (Value, error) {
+				id, ok := params["id"].(*NumberValue)
+				if !ok {
+					return nil, errors.New(fmt.Sprintf("timer ids are numbers, got %s", TypeOf(params["id"])))
+				}
+
+				vm.clearTimer(int(id.float64))
+				return &NilValue{}, nil
+			},
+		},
+		{
+			"wait",
+			Signature{[]string{"milliseconds"}},
+			false,
+			func(vm *VM, this Value, params map[string]Value) (Value, error) {
+				d, err := milliseconds(params["milliseconds"])
+				if err != nil {
+					return nil, err
+				}
+
+				// the timers due meanwhile are run while waiting
+				return &NilValue{}, vm.runTimersUntil(time.Now().Add(d))
+			},
+		},
+	} {
+		if err := DefaultBuiltins.Register(b); err != nil {
+			panic(err)
+		}
+	}
+}
+
+// schedule have the VM call a function once a time has passed, and then every interval if it is not zero, returning
+// the id of the timer
+func (vm *VM) schedule(f Value, after time.Duration, interval time.Duration) int {
+	vm.timerID++
+	vm.timers = append(vm.timers, &timer{vm.timerID, time.Now().Add(after), interval, f})
+
+	return vm.timerID
+}
+
+// clearTimer stop a timer from being called again. Clearing a timer which has finished does nothing.
+func (vm *VM) clearTimer(id int) {
+	vm.timers = slices.DeleteFunc(vm.timers, func(t *timer) bool {
+		return t.id == id
+	})
+}
+
+// NextTimer get when the next timer of the program is due, if it has any. Hosts with event loops of their own wait
+// until then before running the timers which are due (see RunDueTimers).
+func (vm *VM) NextTimer() (time.Time, bool) {
+	if len(vm.timers) == 0 {
+		return time.Time{}, false
+	}
+
+	next := vm.timers[0].due
+	for _, t := range vm.timers[1:] {
+		if t.due.Before(next) {
+			next = t.due
+		}
+	}
+
+	return next, true
+}
+
+// RunDueTimers call the functions of the timers which are due, in the order they are due. Timers with an interval are
+// due again once it has passed, others are done with. The first error of a function stops the rest from being called.
+func (vm *VM) RunDueTimers() error {
+	now := time.Now()
+
+	var due []*timer
+	for _, t := range vm.timers {
+		if !t.due.After(now) {
+			due = append(due, t)
+		}
+	}
+
+	slices.SortStableFunc(due, func(a, b *timer) int {
+		return a.due.Compare(b.due)
+	})
+
+	for _, t := range due {
+		// an earlier timer may have cleared it
+		if !slices.Contains(vm.timers, t) {
+			continue
+		}
+
+		if t.interval > 0 {
+			t.due = now.Add(t.interval)
+		} else {
+			vm.clearTimer(t.id)
+		}
+
+		if _, err := vm.Call(t.f, nil); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// RunTimers wait for and run the timers of the program until it has none left, or one of them fails. The command line
+// does this once the main function has returned.
+func (vm *VM) RunTimers() error {
+	return vm.runTimersUntil(time.Time{})
+}
+
+// runTimersUntil run the timers of the program as they are due, until it has none left or the deadline has passed
+// (a zero deadline has none)
+func (vm *VM) runTimersUntil(deadline time.Time) error {
+	for {
+		next, ok := vm.NextTimer()
+		if !deadline.IsZero() && (!ok || next.After(deadline)) {
+			time.Sleep(time.Until(deadline))
+			return nil
+		} else if !ok {
+			return nil
+		}
+
+		time.Sleep(time.Until(next))
+
+		if err := vm.RunDueTimers(); err != nil {
+			return err
+		}
+	}
+}
+
+// milliseconds get a duration in milliseconds given to a timer builtin
+func milliseconds(v Value) (time.Duration, error) {
+	ms, ok := v.(*NumberValue)
+	if !ok || ms.float64 < 0 || ms.float64 != ms.float64 {
+		return 0, errors.New(fmt.Sprintf("milliseconds must be a number of at least 0, got %s", v.DebugString()))
+	}
+
+	return time.Duration(ms.float64 * float64(time.Millisecond)), nil
+}
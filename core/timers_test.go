@@ -0,0 +1,88 @@
+package core
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestTimers(t *testing.T) {
+	for src, expected := range map[string]string{
+		`setTimeout(func() { print("b") }, 2)
+setTimeout(func() { print("a") }, 1)
+print("main ")`: "main ab",
+		`n := 0
+id := 0
+id = setInterval(func() {
+	n = n + 1
+	print(n)
+	if n == 3 {
+		clearTimer(id)
+	}
+}, 1)`: "123",
+		`id := setTimeout(func() { print("never") }, 1)
+clearTimer(id)
+print("cleared")`: "cleared",
+		`setTimeout(func() { print("timer ") }, 1)
+wait(5)
+print("waited")`: "timer waited",
+	} {
+		program, err := Compile(src, CompileOptions{})
+		if err != nil {
+			t.Fatalf("Unexpected error compiling %q: %v", src, err)
+		}
+
+		out := bytes.Buffer{}
+		if _, err := program.Run(RunOptions{Output: &out}); err != nil {
+			t.Fatalf("Unexpected error running %q: %v", src, err)
+		}
+
+		if out.String() != expected {
+			t.Errorf("Expected %q to print %q, got %q", src, expected, out.String())
+		}
+	}
+}
+
+func TestTimers_Error(t *testing.T) {
+	program, err := Compile(`setTimeout(func() { throw("late") }, 1)
+setTimeout(func() { print("after") }, 5)`, CompileOptions{})
+	if err != nil {
+		t.Fatalf("Unexpected error compiling: %v", err)
+	}
+
+	out := bytes.Buffer{}
+	if _, err := program.Run(RunOptions{Output: &out}); err == nil || !strings.Contains(err.Error(), "late") {
+		t.Errorf("Expected the error of a timer to fail the program, got %v", err)
+	}
+
+	if out.Len() != 0 {
+		t.Errorf("Expected no timers to run after one failed, got %q", out.String())
+	}
+
+	for _, src := range []string{`setTimeout(1, 1)`, `setInterval(func() {}, 0)`, `setTimeout(func() {}, "1")`} {
+		program, err := Compile(src, CompileOptions{})
+		if err != nil {
+			t.Fatalf("Unexpected error compiling %q: %v", src, err)
+		}
+
+		if _, err := program.Run(RunOptions{Output: &bytes.Buffer{}}); err == nil {
+			t.Errorf("Expected %q to fail", src)
+		}
+	}
+}
+
+func TestVM_RunDueTimers(t *testing.T) {
+	vm := runSource(t, `setTimeout(func() { print("due") }, 0)`)
+
+	if _, ok := vm.NextTimer(); !ok {
+		t.Fatalf("Expected the VM to have a timer once the program has run")
+	}
+
+	if err := vm.RunDueTimers(); err != nil {
+		t.Fatalf("Unexpected error running timers: %v", err)
+	}
+
+	if _, ok := vm.NextTimer(); ok {
+		t.Errorf("Expected timers to be done with once they have run")
+	}
+}
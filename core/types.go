@@ -0,0 +1,107 @@
+package core
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// ObjectSignature the members the objects of a type declared with type have (type Point { x: number, y: number }),
+// and the types of them
+type ObjectSignature struct {
+	Name    string
+	Members []string
+	// Types the types of the members, as they are declared, which may name other declared types
+	Types []string
+}
+
+func (s ObjectSignature) String() string {
+	return shapeName(s.Name, s.Members, s.Types)
+}
+
+// Has whether objects of the type have a member
+func (s ObjectSignature) Has(member string) bool {
+	for _, m := range s.Members {
+		if m == member {
+			return true
+		}
+	}
+
+	return false
+}
+
+// IsDeclaredTypeName whether a name can be the name of a type declared with type, which begin with a capital letter,
+// unlike the names of the builtin types
+func IsDeclaredTypeName(name string) bool {
+	r, _ := utf8.DecodeRuneInString(name)
+	return unicode.IsUpper(r)
+}
+
+// shapeName the name of the type of objects with members of types (Point{x: number, y: number}), which casts check
+// values against. The types are written out, so values can be checked without knowing the declarations.
+func shapeName(name string, members []string, types []string) string {
+	parts := make([]string, len(members))
+	for i, member := range members {
+		parts[i] = member + ": " + types[i]
+	}
+
+	return name + "{" + strings.Join(parts, ", ") + "}"
+}
+
+// shapeType get the members and their types from the name of the type of objects with them, made by shapeName
+func shapeType(name string) ([]string, []string, bool) {
+	open := strings.IndexRune(name, '{')
+	if open <= 0 || !strings.HasSuffix(name, "}") || !IsDeclaredTypeName(name) {
+		return nil, nil, false
+	}
+
+	var members, types []string
+
+	// the types of the members may themselves be shapes or dictionaries, so brackets are counted
+	depth, start := 0, open+1
+	for i := start; i < len(name)-1; i++ {
+		switch name[i] {
+		case '{', '[':
+			depth++
+		case '}', ']':
+			depth--
+		case ',':
+			if depth > 0 {
+				continue
+			}
+
+			members, types = appendMember(members, types, name[start:i])
+			start = i + 1
+		}
+	}
+
+	if start < len(name)-1 {
+		members, types = appendMember(members, types, name[start:len(name)-1])
+	}
+
+	return members, types, true
+}
+
+// appendMember add a member written as name: type to the members and their types
+func appendMember(members []string, types []string, member string) ([]string, []string) {
+	name, of, _ := strings.Cut(member, ":")
+	return append(members, strings.TrimSpace(name)), append(types, strings.TrimSpace(of))
+}
+
+// isShapeOfType whether a value is an object with each of the members, of their types. Objects may have other members
+// besides them.
+func isShapeOfType(value Value, members []string, types []string) bool {
+	object, ok := value.(*ObjectValue)
+	if !ok {
+		return false
+	}
+
+	for i, member := range members {
+		v, ok := object.members[member]
+		if !ok || !IsOfType(v, types[i]) {
+			return false
+		}
+	}
+
+	return true
+}
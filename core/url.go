@@ -0,0 +1,75 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+)
+
+// urlObject the parts of a URL as an object, as urlParse returns them. The query is an object of its parameters (see
+// queryObject), and parts the URL doesn't have are empty strings.
+func urlObject(u *url.URL) *ObjectValue {
+	password, _ := u.User.Password()
+
+	return NewObject(map[string]Value{
+		"scheme":   NewString(u.Scheme),
+		"username": NewString(u.User.Username()),
+		"password": NewString(password),
+		"host":     NewString(u.Host),
+		"hostname": NewString(u.Hostname()),
+		"port":     NewString(u.Port()),
+		"path":     NewString(u.Path),
+		"query":    queryObject(u.Query()),
+		"fragment": NewString(u.Fragment),
+	})
+}
+
+// queryObject the parameters of a query string as an object. Parameters given once are strings, and those given more
+// than once lists of them.
+func queryObject(values url.Values) *ObjectValue {
+	members := make(map[string]Value, len(values))
+	for name, vs := range values {
+		if len(vs) == 1 {
+			members[name] = NewString(vs[0])
+			continue
+		}
+
+		items := make([]Value, len(vs))
+		for i, v := range vs {
+			items[i] = NewString(v)
+		}
+
+		members[name] = NewList(items)
+	}
+
+	return NewObject(members)
+}
+
+// queryString build a query string of the members of an object, sorted by name. Lists are given as one parameter for
+// each item, nil members are left out and other values are converted to strings.
+func (vm *VM) queryString(object *ObjectValue) (string, error) {
+	names := make([]string, 0, len(object.members))
+	for name := range object.members {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	values := url.Values{}
+	for _, name := range names {
+		switch v := object.members[name].(type) {
+		case *NilValue:
+		case *ListValue:
+			for _, item := range v.items {
+				values.Add(name, vm.ToString(item))
+			}
+		case *ObjectValue, *FunctionValue, *BuiltinFunctionValue, *BoundFunctionValue:
+			return "", errors.New(fmt.Sprintf("cannot put %s %s in a query string", TypeOf(v), name))
+		default:
+			values.Add(name, vm.ToString(v))
+		}
+	}
+
+	return values.Encode(), nil
+}
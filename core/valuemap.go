@@ -0,0 +1,123 @@
+package core
+
+// valueEntry a key of a value map and the value it maps to
+type valueEntry struct {
+	key   Value
+	value Value
+	// index where the entry is among the entries of the map
+	index int
+}
+
+// valueMap a map keyed by values, which are looked up by their hash and compared with Equals, so keys which are
+// equal find the same entry in constant time. The entries are kept in the order their keys were first set.
+type valueMap struct {
+	buckets map[uint64][]*valueEntry
+	entries []*valueEntry
+	// removed how many of the entries have been removed, and are nil until the entries are compacted
+	removed int
+}
+
+func newValueMap() *valueMap {
+	return &valueMap{map[uint64][]*valueEntry{}, nil, 0}
+}
+
+// find get the entry of a key, or nil if it has none
+func (m *valueMap) find(key Value, hash uint64) *valueEntry {
+	for _, e := range m.buckets[hash] {
+		if e.key.Equals(key) {
+			return e
+		}
+	}
+
+	return nil
+}
+
+// get the value of a key, and whether it has one
+func (m *valueMap) get(key Value) (Value, bool) {
+	e := m.find(key, key.Hash())
+	if e == nil {
+		return nil, false
+	}
+
+	return e.value, true
+}
+
+// set the value of a key. Keys are cloned when they are added, so changing a list after using it as a key does not
+// change the key.
+func (m *valueMap) set(key Value, value Value) {
+	hash := key.Hash()
+	if e := m.find(key, hash); e != nil {
+		e.value = value
+		return
+	}
+
+	e := &valueEntry{Clone(key), value, len(m.entries)}
+	m.buckets[hash] = append(m.buckets[hash], e)
+	m.entries = append(m.entries, e)
+}
+
+// remove the entry of a key, returning whether there was one
+func (m *valueMap) remove(key Value) bool {
+	hash := key.Hash()
+	bucket := m.buckets[hash]
+	for i, e := range bucket {
+		if !e.key.Equals(key) {
+			continue
+		}
+
+		if len(bucket) == 1 {
+			delete(m.buckets, hash)
+		} else {
+			m.buckets[hash] = append(bucket[:i:i], bucket[i+1:]...)
+		}
+
+		m.entries[e.index] = nil
+		m.removed++
+		if m.removed > len(m.entries)/2 {
+			m.compact()
+		}
+
+		return true
+	}
+
+	return false
+}
+
+// compact drop the entries which have been removed
+func (m *valueMap) compact() {
+	entries := make([]*valueEntry, 0, len(m.entries)-m.removed)
+	for _, e := range m.entries {
+		if e != nil {
+			e.index = len(entries)
+			entries = append(entries, e)
+		}
+	}
+
+	m.entries = entries
+	m.removed = 0
+}
+
+// len how many keys have values
+func (m *valueMap) len() int {
+	return len(m.entries) - m.removed
+}
+
+// each call a function with every key and value, in the order they were added, until it returns false
+func (m *valueMap) each(f func(key Value, value Value) bool) {
+	for _, e := range m.entries {
+		if e != nil && !f(e.key, e.value) {
+			return
+		}
+	}
+}
+
+// keys get the keys, in the order they were added
+func (m *valueMap) keys() []Value {
+	keys := make([]Value, 0, m.len())
+	m.each(func(key Value, _ Value) bool {
+		keys = append(keys, key)
+		return true
+	})
+
+	return keys
+}
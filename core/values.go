@@ -1,11 +1,15 @@
 package core
 
 import (
+	"encoding/base64"
+	"encoding/hex"
 	"errors"
 	"fmt"
+	"golang.org/x/text/language"
+	"math/big"
 	"reflect"
-	"strconv"
 	"strings"
+	"unicode/utf8"
 )
 
 type ValueType int
@@ -20,6 +24,18 @@ const (
 	FunctionValueType
 	BuiltinFunctionValueType
 	VariableValueType
+	BuilderValueType
+	ErrorValueType
+	DequeValueType
+	BytesValueType
+	DateValueType
+	DurationValueType
+	HandleValueType
+	BoundFunctionValueType
+	BigIntValueType
+	SetValueType
+	DictValueType
+	RangeValueType
 )
 
 func (v ValueType) String() string {
@@ -42,14 +58,270 @@ func (v ValueType) String() string {
 		return "builtin function"
 	case VariableValueType:
 		return "variable"
+	case BuilderValueType:
+		return "builder"
+	case ErrorValueType:
+		return "error"
+	case DequeValueType:
+		return "deque"
+	case BytesValueType:
+		return "bytes"
+	case DateValueType:
+		return "date"
+	case DurationValueType:
+		return "duration"
+	case HandleValueType:
+		return "handle"
+	case BoundFunctionValueType:
+		return "bound function"
+	case BigIntValueType:
+		return "bigint"
+	case SetValueType:
+		return "set"
+	case DictValueType:
+		return "dict"
+	case RangeValueType:
+		return "range"
 	}
 
 	return "undefined"
 }
 
-// GoToValue convert go values to anglais VM-values. Works for some values (nil, bool, float64, int, string, slices, maps)
+// TypeNames the names of the types values can be checked against, as returned by typeof
+var TypeNames = []string{"nil", "bool", "number", "string", "list", "object", "function", "builder", "error", "deque", "bytes", "date", "duration", "handle", "bigint", "set", "dict", "range", "any"}
+
+// IsTypeName whether a name is one of the type names
+func IsTypeName(name string) bool {
+	for _, t := range TypeNames {
+		if t == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// TypeOf get the name of the type of a value. Builtin and bound functions are functions like any other.
+func TypeOf(value Value) string {
+	switch value.Type() {
+	case BuiltinFunctionValueType, BoundFunctionValueType:
+		return FunctionValueType.String()
+	case VariableValueType:
+		return TypeOf(value.(*VariableValue).cell().value)
+	}
+
+	return value.Type().String()
+}
+
+// IsOfType whether a value is of the type with the name (any type matches "any"). Dictionary types name the types
+// of their keys and values (dict[number]string), which every entry must match, as map types (map[string]number) name
+// the type of the members of objects. Types declared with type are checked by the members of their objects, which
+// their names list (Point{x: number, y: number}). Types followed by |nil also match nil.
+func IsOfType(value Value, name string) bool {
+	if key, of, ok := keyedType(name, "dict"); ok {
+		return isDictOfType(value, key, of)
+	} else if _, of, ok := keyedType(name, "map"); ok {
+		return isMapOfType(value, of)
+	} else if base, ok := strings.CutSuffix(name, "|nil"); ok {
+		return value.Type() == NilValueType || IsOfType(value, base)
+	} else if members, types, ok := shapeType(name); ok {
+		return isShapeOfType(value, members, types)
+	}
+
+	return name == "any" || TypeOf(value) == name
+}
+
+// Same whether two values are the same value. Lists, objects, sets, dictionaries and deques are only the same as themselves,
+// even if they are equal; other values are the same whenever they are equal, as they can not be changed.
+func Same(a Value, b Value) bool {
+	switch a.(type) {
+	case *ListValue, *ObjectValue, *SetValue, *DictValue, *DequeValue:
+		return a == b
+	}
+
+	return a.Equals(b)
+}
+
+// Freeze make a value and every value within it immutable, so lists can no longer have items added or replaced,
+// objects can no longer have members set, dictionaries can no longer have entries set or removed and sets can no longer
+// have items added or removed, nor deques items pushed or popped. Values which can't be changed to begin with are left
+// as they are.
+func Freeze(value Value) Value {
+	switch v := value.(type) {
+	case *ListValue:
+		if v.frozen {
+			break
+		}
+
+		v.frozen = true
+		for _, item := range v.items {
+			Freeze(item)
+		}
+	case *ObjectValue:
+		if v.frozen {
+			break
+		}
+
+		v.frozen = true
+		for _, member := range v.members {
+			Freeze(member)
+		}
+	case *DictValue:
+		if v.frozen {
+			break
+		}
+
+		v.frozen = true
+		v.entries.each(func(key Value, value Value) bool {
+			Freeze(key)
+			Freeze(value)
+			return true
+		})
+	case *SetValue:
+		if v.frozen {
+			break
+		}
+
+		v.frozen = true
+		for _, item := range v.Items() {
+			Freeze(item)
+		}
+	case *DequeValue:
+		if v.frozen {
+			break
+		}
+
+		v.frozen = true
+		for _, item := range v.Items() {
+			Freeze(item)
+		}
+	}
+
+	return value
+}
+
+// Clone make a deep copy of a value, copying lists, objects and dictionaries and every one within them. The copies
+// can be changed, even if the originals are frozen. Containers which contain themselves are copied as such.
+func Clone(value Value) Value {
+	return clone(value, map[Value]Value{})
+}
+
+func clone(value Value, clones map[Value]Value) Value {
+	if c, ok := clones[value]; ok {
+		return c
+	}
+
+	switch v := value.(type) {
+	case *ListValue:
+		c := &ListValue{make([]Value, len(v.items)), false, false}
+		clones[v] = c
+
+		for i, item := range v.items {
+			c.items[i] = clone(item, clones)
+		}
+
+		return c
+	case *ObjectValue:
+		c := &ObjectValue{make(map[string]Value, len(v.members)), false}
+		clones[v] = c
+
+		for key, member := range v.members {
+			c.members[key] = clone(member, clones)
+		}
+
+		return c
+	case *DictValue:
+		c := NewDict()
+		clones[v] = c
+
+		// the keys are cloned when they are set
+		v.entries.each(func(key Value, value Value) bool {
+			c.Set(key, clone(value, clones))
+			return true
+		})
+
+		return c
+	}
+
+	return value
+}
+
+// container a value which contains other values, and so can contain itself
+type container interface {
+	Value
+
+	// format write the container, with the containers being written around it visiting
+	format(visiting map[Value]bool) string
+	// cycle what the container is written as within itself
+	cycle() string
+	// equals whether the container equals a value, with the pairs of containers being compared around it comparing
+	equals(other Value, comparing map[[2]Value]bool) bool
+}
+
+// formatNested write a value within a container. A container within itself is written as its cycle ([...]), instead
+// of being written forever. Values which aren't containers are written as debug strings if debug is set.
+func formatNested(value Value, visiting map[Value]bool, debug bool) string {
+	c, ok := value.(container)
+	if !ok {
+		if debug {
+			return value.DebugString()
+		}
+
+		return value.String()
+	}
+
+	if visiting[c] {
+		return c.cycle()
+	}
+
+	visiting[c] = true
+	defer delete(visiting, c)
+
+	return c.format(visiting)
+}
+
+// equalsNested whether two values within containers are equal. Comparing containers which are already being compared
+// (because they contain themselves) does not compare them again; they are equal unless a difference is found elsewhere.
+func equalsNested(a Value, b Value, comparing map[[2]Value]bool) bool {
+	c, ok := a.(container)
+	if !ok {
+		return a.Equals(b)
+	}
+
+	pair := [2]Value{a, b}
+	if comparing[pair] {
+		return true
+	}
+
+	comparing[pair] = true
+
+	return c.equals(b, comparing)
+}
+
+// IsFrozen whether a value can not be changed
+func IsFrozen(value Value) bool {
+	switch v := value.(type) {
+	case *ListValue:
+		return v.frozen
+	case *ObjectValue:
+		return v.frozen
+	case *DictValue:
+		return v.frozen
+	case *SetValue:
+		return v.frozen
+	case *DequeValue:
+		return v.frozen
+	}
+
+	return true
+}
+
+// GoToValue convert go values to anglais VM-values. Works for some values (nil, bool, float64, int, string, slices, maps).
+// Values which already are VM-values are returned as they are.
 func GoToValue(gov interface{}) Value {
 	switch v := gov.(type) {
+	case Value:
+		return v
 	case nil:
 		return &NilValue{}
 	case bool:
@@ -59,11 +331,20 @@ func GoToValue(gov interface{}) Value {
 	case int:
 		return &NumberValue{
 			float64(v),
+			nil,
 		}
+
 	case float64:
 		return &NumberValue{
 			v,
+			nil,
 		}
+
+	case *big.Int:
+		return &BigIntValue{
+			v,
+		}
+
 	case string:
 		return &StringValue{
 			v,
@@ -76,6 +357,8 @@ func GoToValue(gov interface{}) Value {
 
 		return &ListValue{
 			values,
+			false,
+			false,
 		}
 	case map[string]interface{}:
 		values := map[string]Value{}
@@ -85,12 +368,51 @@ func GoToValue(gov interface{}) Value {
 
 		return &ObjectValue{
 			values,
+			false,
 		}
 	}
 
 	panic(fmt.Sprintf("unsupported automatic type conversion: %v (%s)", gov, reflect.TypeOf(gov).Name()))
 }
 
+// ValueToGo convert anglais VM-values to go values, the reverse of GoToValue. Nil, booleans, numbers, strings, lists
+// and objects are converted to nil, bool, float64, string, []interface{} and map[string]interface{}. Values without a
+// go counterpart (such as functions) are returned as they are.
+func ValueToGo(value Value) interface{} {
+	switch v := value.(type) {
+	case nil, *NilValue:
+		return nil
+	case *BoolValue:
+		return v.bool
+	case *NumberValue:
+		return v.float64
+	case *BigIntValue:
+		return v.BigInt()
+	case *StringValue:
+		return v.string
+	case *ListValue:
+		values := make([]interface{}, len(v.items))
+		for i, item := range v.items {
+			values[i] = ValueToGo(item)
+		}
+
+		return values
+	case *RangeValue:
+		return ValueToGo(NewList(v.Items()))
+	case *ObjectValue:
+		values := make(map[string]interface{}, len(v.members))
+		for key, member := range v.members {
+			values[key] = ValueToGo(member)
+		}
+
+		return values
+	case *VariableValue:
+		return ValueToGo(v.value)
+	}
+
+	return value
+}
+
 type Value interface {
 	// Type get the type of the value (a ValueType)
 	Type() ValueType
@@ -101,9 +423,16 @@ type Value interface {
 	// DebugString get a debug string of this value. Used in lists.
 	DebugString() string
 
-	// Equals Check if two values are equal
+	// Equals Check if two values are equal. Equality is structural: nil, booleans, numbers, strings, bytes, dates
+	// and durations are equal when their values are, lists when their items are pairwise equal, and objects when they have the same keys
+	// with equal members. Functions, builders, deques and handles are only equal to themselves. This is what == means, both when folded by the
+	// compiler and when executed. Bigints are equal to numbers which are the same integer.
 	Equals(Value) bool
 
+	// Hash get a hash of the value, which is the same for values which are equal, for looking values up by it (such
+	// as memoize does). Values only equal to themselves hash by their type alone.
+	Hash() uint64
+
 	// Get a member from the value. An error is returned if the member does not exist
 	Get(string) (Value, error)
 }
@@ -126,6 +455,10 @@ func (v *NilValue) Equals(other Value) bool {
 	return other.Type() == NilValueType
 }
 
+func (v *NilValue) Hash() uint64 {
+	return uint64(NilValueType)
+}
+
 func (v *NilValue) Get(_ string) (Value, error) {
 	return nil, errors.New("nil has no properties")
 }
@@ -134,6 +467,14 @@ type BoolValue struct {
 	bool
 }
 
+func NewBool(b bool) *BoolValue {
+	return &BoolValue{b}
+}
+
+func (v *BoolValue) Bool() bool {
+	return v.bool
+}
+
 func (v *BoolValue) Type() ValueType {
 	return BoolValueType
 }
@@ -154,6 +495,14 @@ func (v *BoolValue) Equals(other Value) bool {
 	return other.Type() == BoolValueType && other.(*BoolValue).bool == v.bool
 }
 
+func (v *BoolValue) Hash() uint64 {
+	if v.bool {
+		return mix(uint64(BoolValueType), 1)
+	}
+
+	return uint64(BoolValueType)
+}
+
 func (v *BoolValue) Get(_ string) (Value, error) {
 	return nil, errors.New("booleans have no properties")
 }
@@ -161,6 +510,23 @@ func (v *BoolValue) Get(_ string) (Value, error) {
 // ObjectValue An object with any number of members (key-value pairs)
 type ObjectValue struct {
 	members map[string]Value
+	// frozen whether the members can no longer be changed
+	frozen bool
+}
+
+// NewObject create an object with the members, which are not copied
+func NewObject(members map[string]Value) *ObjectValue {
+	return &ObjectValue{members, false}
+}
+
+// Members get a copy of the members of the object
+func (v *ObjectValue) Members() map[string]Value {
+	members := make(map[string]Value, len(v.members))
+	for k, m := range v.members {
+		members[k] = m
+	}
+
+	return members
 }
 
 func (v *ObjectValue) Type() ValueType {
@@ -168,31 +534,48 @@ func (v *ObjectValue) Type() ValueType {
 }
 
 func (v *ObjectValue) String() string {
+	return formatNested(v, map[Value]bool{}, false)
+}
+
+func (v *ObjectValue) format(visiting map[Value]bool) string {
 	out := "{"
 	for key, value := range v.members {
 		if out != "{" {
 			out += ", "
 		}
 
-		out += fmt.Sprintf("%q=%s", key, value.String())
+		out += fmt.Sprintf("%q=%s", key, formatNested(value, visiting, false))
 	}
 	out += "}"
 
 	return out
 }
 
+func (v *ObjectValue) cycle() string {
+	return "{...}"
+}
+
 func (v *ObjectValue) DebugString() string {
 	return v.String()
 }
 
 func (v *ObjectValue) Equals(other Value) bool {
+	return equalsNested(v, other, map[[2]Value]bool{})
+}
+
+func (v *ObjectValue) Hash() uint64 {
+	return hashNested(v, 0)
+}
+
+func (v *ObjectValue) equals(other Value, comparing map[[2]Value]bool) bool {
 	object, ok := other.(*ObjectValue)
-	if !ok {
+	if !ok || len(v.members) != len(object.members) {
 		return false
 	}
 
 	for key, value := range v.members {
-		if !object.members[key].Equals(value) {
+		member, ok := object.members[key]
+		if !ok || !equalsNested(value, member, comparing) {
 			return false
 		}
 	}
@@ -207,13 +590,16 @@ var ObjectPrototype = map[string]Value{
 		func(vm *VM, _this Value, params map[string]Value) (Value, error) {
 			this := _this.(*ObjectValue)
 
-			p := params["property"]
-			v, ok := params["value"].(*StringValue)
+			p, ok := params["property"].(*StringValue)
 			if !ok {
 				return nil, errors.New("property is not a string")
 			}
 
-			this.members[v.string] = p
+			if this.frozen {
+				return nil, errors.New(fmt.Sprintf("cannot set property \"%s\" of frozen object", p.string))
+			}
+
+			this.members[p.string] = params["value"]
 
 			return &NilValue{}, nil
 		},
@@ -234,16 +620,31 @@ func (v *ObjectValue) Get(key string) (Value, error) {
 // NumberValue Integer or floating-point values
 type NumberValue struct {
 	float64
+	// decimal the exact number, for numbers of programs in decimal mode (see Chunk.Decimal), nil for others. The
+	// float is kept as the closest to it, for everything which doesn't do decimal arithmetic.
+	decimal *big.Rat
 }
 
 const NumberSize int = 64
 
+func NewNumber(n float64) *NumberValue {
+	return &NumberValue{n, nil}
+}
+
+func (v *NumberValue) Number() float64 {
+	return v.float64
+}
+
 func (v *NumberValue) Type() ValueType {
 	return NumberValueType
 }
 
 func (v *NumberValue) String() string {
-	return strconv.FormatFloat(v.float64, 'g', -1, NumberSize)
+	if v.decimal != nil {
+		return formatDecimal(v.decimal, DefaultNumberFormat)
+	}
+
+	return DefaultNumberFormat.Format(v.float64)
 }
 
 func (v *NumberValue) DebugString() string {
@@ -251,7 +652,27 @@ func (v *NumberValue) DebugString() string {
 }
 
 func (v *NumberValue) Equals(other Value) bool {
-	return other.Type() == NumberValueType && other.(*NumberValue).float64 == v.float64
+	if b, ok := other.(*BigIntValue); ok {
+		return b.Equals(v)
+	}
+
+	n, ok := other.(*NumberValue)
+	if !ok {
+		return false
+	}
+
+	if v.decimal != nil || n.decimal != nil {
+		if l, r := v.toDecimal(), n.toDecimal(); l.decimal != nil && r.decimal != nil {
+			return l.decimal.Cmp(r.decimal) == 0
+		}
+	}
+
+	return n.float64 == v.float64
+}
+
+func (v *NumberValue) Hash() uint64 {
+	// decimals hash by the float closest to them, which numbers equal to them have too
+	return hashNumber(v.float64)
 }
 
 func (v *NumberValue) Get(_ string) (Value, error) {
@@ -263,6 +684,10 @@ type StringValue struct {
 	string
 }
 
+func NewString(s string) *StringValue {
+	return &StringValue{s}
+}
+
 func (v *StringValue) Type() ValueType {
 	return StringValueType
 }
@@ -279,7 +704,52 @@ func (v *StringValue) Equals(other Value) bool {
 	return other.Type() == StringValueType && other.(*StringValue).string == v.string
 }
 
+func (v *StringValue) Hash() uint64 {
+	return hashBytes(StringValueType, []byte(v.string))
+}
+
 var StringPrototype = map[string]*BuiltinFunctionValue{
+	"at": {
+		"at",
+		[]string{"index"},
+		func(_ *VM, this Value, p map[string]Value) (Value, error) {
+			r, err := runeAt(this, p["index"])
+			if err != nil {
+				return nil, err
+			}
+
+			return &StringValue{string(r)}, nil
+		},
+		nil,
+	},
+	"codePointAt": {
+		"codePointAt",
+		[]string{"index"},
+		func(_ *VM, this Value, p map[string]Value) (Value, error) {
+			r, err := runeAt(this, p["index"])
+			if err != nil {
+				return nil, err
+			}
+
+			return &NumberValue{float64(r), nil}, nil
+		},
+		nil,
+	},
+	"bytes": {
+		"bytes",
+		[]string{},
+		func(_ *VM, this Value, p map[string]Value) (Value, error) {
+			s := this.(*StringValue).string
+
+			bytes := make([]Value, len(s))
+			for i := 0; i < len(s); i++ {
+				bytes[i] = &NumberValue{float64(s[i]), nil}
+			}
+
+			return &ListValue{bytes, false, false}, nil
+		},
+		nil,
+	},
 	"split": {
 		"split",
 		[]string{"seperator"},
@@ -302,6 +772,101 @@ var StringPrototype = map[string]*BuiltinFunctionValue{
 		},
 		nil,
 	},
+	"toUpper": {
+		"toUpper",
+		[]string{},
+		func(_ *VM, this Value, p map[string]Value) (Value, error) {
+			return &StringValue{changeCase(this.(*StringValue).string, language.Und, true)}, nil
+		},
+		nil,
+	},
+	"toLower": {
+		"toLower",
+		[]string{},
+		func(_ *VM, this Value, p map[string]Value) (Value, error) {
+			return &StringValue{changeCase(this.(*StringValue).string, language.Und, false)}, nil
+		},
+		nil,
+	},
+	"toUpperIn": {
+		"toUpperIn",
+		[]string{"locale"},
+		func(_ *VM, this Value, p map[string]Value) (Value, error) {
+			tag, err := locale(p["locale"])
+			if err != nil {
+				return nil, err
+			}
+
+			return &StringValue{changeCase(this.(*StringValue).string, tag, true)}, nil
+		},
+		nil,
+	},
+	"toLowerIn": {
+		"toLowerIn",
+		[]string{"locale"},
+		func(_ *VM, this Value, p map[string]Value) (Value, error) {
+			tag, err := locale(p["locale"])
+			if err != nil {
+				return nil, err
+			}
+
+			return &StringValue{changeCase(this.(*StringValue).string, tag, false)}, nil
+		},
+		nil,
+	},
+	// compares strings as they are sorted in a language, rather than by their code points
+	"localeCompare": {
+		"localeCompare",
+		[]string{"other", "locale"},
+		func(_ *VM, this Value, p map[string]Value) (Value, error) {
+			other, ok := p["other"].(*StringValue)
+			if !ok {
+				return nil, errors.New(fmt.Sprintf("can only compare strings to strings, got %s", TypeOf(p["other"])))
+			}
+
+			tag, err := locale(p["locale"])
+			if err != nil {
+				return nil, err
+			}
+
+			return &NumberValue{float64(collateStrings(this.(*StringValue).string, other.string, tag)), nil}, nil
+		},
+		nil,
+	},
+	"normalize": {
+		"normalize",
+		[]string{"form"},
+		func(_ *VM, this Value, p map[string]Value) (Value, error) {
+			name, _ := p["form"].(*StringValue)
+			if name == nil {
+				return nil, errors.New(fmt.Sprintf("the normal form must be a string, got %s", TypeOf(p["form"])))
+			}
+
+			form, ok := normalForms[name.string]
+			if !ok {
+				return nil, errors.New(fmt.Sprintf("unknown normal form %s, expected NFC, NFD, NFKC or NFKD", name.string))
+			}
+
+			return &StringValue{form.String(this.(*StringValue).string)}, nil
+		},
+		nil,
+	},
+}
+
+// runeAt get the character at an index of a string, counted in characters (runes) rather than bytes
+func runeAt(this Value, index Value) (rune, error) {
+	runes := []rune(this.(*StringValue).string)
+
+	i, ok := index.(*NumberValue)
+	if !ok {
+		return 0, errors.New(fmt.Sprintf("string index must be a number, got %s", TypeOf(index)))
+	}
+
+	if i.float64 < 0 || int(i.float64) >= len(runes) || i.float64 != float64(int(i.float64)) {
+		return 0, errors.New(fmt.Sprintf("string index %s out of range (length %d)", i, len(runes)))
+	}
+
+	return runes[int(i.float64)], nil
 }
 
 func (v *StringValue) Get(key string) (Value, error) {
@@ -315,6 +880,47 @@ func (v *StringValue) Get(key string) (Value, error) {
 // ListValue a dynamic list of values
 type ListValue struct {
 	items []Value
+	// frozen whether the items can no longer be changed
+	frozen bool
+	// shared whether the items are those of a constant, which are copied before the list is changed or an item
+	// which could be changed is given out
+	shared bool
+}
+
+// NewList create a list of the items, which are not copied
+func NewList(items []Value) *ListValue {
+	return &ListValue{items, false, false}
+}
+
+// Items get a copy of the items of the list
+func (v *ListValue) Items() []Value {
+	v.own()
+	return append([]Value{}, v.items...)
+}
+
+// share get a list which shares the items of a constant list, only copying them once it is changed. Evaluating a list
+// literal makes a new list each time, without copying the items of the constant unless it has to.
+func share(value Value) Value {
+	if l, ok := value.(*ListValue); ok && l.frozen {
+		return &ListValue{l.items, false, true}
+	}
+
+	return value
+}
+
+// own copy the items of a list sharing them with a constant, so they can be changed. The lists among them are shared
+// in turn.
+func (v *ListValue) own() {
+	if !v.shared {
+		return
+	}
+
+	items := make([]Value, len(v.items))
+	for i, item := range v.items {
+		items[i] = share(item)
+	}
+
+	v.items, v.shared = items, false
 }
 
 func (v *ListValue) Type() ValueType {
@@ -322,23 +928,39 @@ func (v *ListValue) Type() ValueType {
 }
 
 func (v *ListValue) String() string {
+	return formatNested(v, map[Value]bool{}, true)
+}
+
+func (v *ListValue) format(visiting map[Value]bool) string {
 	out := "["
 	for i, item := range v.items {
 		if i != 0 {
 			out += ", "
 		}
-		out += item.DebugString()
+		out += formatNested(item, visiting, true)
 	}
 	out += "]"
 
 	return out
 }
 
+func (v *ListValue) cycle() string {
+	return "[...]"
+}
+
 func (v *ListValue) DebugString() string {
 	return v.String()
 }
 
 func (v *ListValue) Equals(other Value) bool {
+	return equalsNested(v, other, map[[2]Value]bool{})
+}
+
+func (v *ListValue) Hash() uint64 {
+	return hashNested(v, 0)
+}
+
+func (v *ListValue) equals(other Value, comparing map[[2]Value]bool) bool {
 	if other.Type() != ListValueType {
 		return false
 	}
@@ -349,8 +971,8 @@ func (v *ListValue) Equals(other Value) bool {
 		return false
 	}
 
-	for i, item := range l.items {
-		if !item.Equals(l.items[i]) {
+	for i, item := range v.items {
+		if !equalsNested(item, l.items[i], comparing) {
 			return false
 		}
 	}
@@ -358,31 +980,52 @@ func (v *ListValue) Equals(other Value) bool {
 	return true
 }
 
+// ListPrototype the methods of lists. Each says whether it changes the list; those which do fail on frozen lists,
+// while the others work on any list.
 var ListPrototype = map[string]*BuiltinFunctionValue{
+	// append changes the list, adding the item to its end
 	"append": {
 		"append",
 		[]string{"item"},
 		func(_ *VM, this Value, p map[string]Value) (Value, error) {
-			this.(*ListValue).items = append(this.(*ListValue).items, p["item"])
+			list := this.(*ListValue)
+			if list.frozen {
+				return nil, errors.New(fmt.Sprintf("cannot append to frozen list (at index %d)", len(list.items)))
+			}
+
+			list.own()
+			list.items = append(list.items, p["item"])
 			return &NilValue{}, nil
 		},
 		nil,
 	},
+	// at leaves the list as it is, returning the item at the index
 	"at": {
 		"at",
 		[]string{"index"},
 		func(_ *VM, this Value, p map[string]Value) (Value, error) {
-			items := this.(*ListValue).items
-			index := int(p["index"].(*NumberValue).float64)
+			list := this.(*ListValue)
 
-			if index >= len(items) {
-				return nil, errors.New(fmt.Sprintf("list index %x out of range", index))
+			i, ok := p["index"].(*NumberValue)
+			if !ok {
+				return nil, errors.New(fmt.Sprintf("list index must be a number, got %s", TypeOf(p["index"])))
+			}
+
+			index := int(i.float64)
+			if index < 0 || index >= len(list.items) {
+				return nil, errors.New(fmt.Sprintf("list index %d out of range (length %d)", index, len(list.items)))
+			}
+
+			// the list in a constant can't be given out, as it could be changed
+			if _, ok := list.items[index].(*ListValue); ok {
+				list.own()
 			}
 
-			return items[index], nil
+			return list.items[index], nil
 		},
 		nil,
 	},
+	// length leaves the list as it is
 	"length": {
 		"length",
 		[]string{},
@@ -391,43 +1034,119 @@ var ListPrototype = map[string]*BuiltinFunctionValue{
 		},
 		nil,
 	},
+	// pop changes the list, removing its last item and returning it
+	"pop": {
+		"pop",
+		[]string{},
+		func(_ *VM, this Value, p map[string]Value) (Value, error) {
+			list := this.(*ListValue)
+			if list.frozen {
+				return nil, errors.New("cannot pop from frozen list")
+			}
+
+			if len(list.items) == 0 {
+				return nil, errors.New("cannot pop from empty list")
+			}
+
+			list.own()
+			item := list.items[len(list.items)-1]
+			list.items = list.items[:len(list.items)-1]
+			return item, nil
+		},
+		nil,
+	},
+	// map leaves the list as it is, returning a new list of what the function returns for each item
 	"map": {
 		"map",
 		[]string{"f"},
 		func(vm *VM, value Value, m map[string]Value) (Value, error) {
 			list := value.(*ListValue)
+			if !isFunction(m["f"]) {
+				return nil, errors.New(fmt.Sprintf("not a function to apply: %s", m["f"]))
+			}
 
-			v := m["f"]
-			var f Value
-			f, ok := v.(*FunctionValue)
-			if !ok {
-				f, ok = v.(*BuiltinFunctionValue)
+			list.own()
+			items := make([]Value, 0, len(list.items))
+			for _, item := range list.items {
+				result, err := vm.Call(m["f"], []Value{item})
+				if err != nil {
+					return nil, err
+				}
 
+				items = append(items, result)
+			}
+
+			return NewList(items), nil
+		},
+		nil,
+	},
+	// filter leaves the list as it is, returning a new list of the items the function returns true for
+	"filter": {
+		"filter",
+		[]string{"f"},
+		func(vm *VM, value Value, m map[string]Value) (Value, error) {
+			list := value.(*ListValue)
+			if !isFunction(m["f"]) {
+				return nil, errors.New(fmt.Sprintf("not a function to filter with: %s", m["f"]))
+			}
+
+			list.own()
+			items := make([]Value, 0)
+			for _, item := range list.items {
+				result, err := vm.Call(m["f"], []Value{item})
+				if err != nil {
+					return nil, err
+				}
+
+				keep, ok := result.(*BoolValue)
 				if !ok {
-					return nil, errors.New(fmt.Sprintf("not a function to apply: %s", v))
+					return nil, errors.New(fmt.Sprintf("filter must be given a function returning a bool, got %s", TypeOf(result)))
+				}
+
+				if keep.bool {
+					items = append(items, item)
 				}
 			}
 
-			for i, item := range list.items {
-				var err error
-				list.items[i], err = vm.Call(f, []Value{
-					item,
-				})
+			return NewList(items), nil
+		},
+		nil,
+	},
+	// mapInPlace changes the list, replacing each item with what the function returns for it
+	"mapInPlace": {
+		"mapInPlace",
+		[]string{"f"},
+		func(vm *VM, value Value, m map[string]Value) (Value, error) {
+			list := value.(*ListValue)
+			if list.frozen {
+				return nil, errors.New("cannot map frozen list in place")
+			}
+
+			if !isFunction(m["f"]) {
+				return nil, errors.New(fmt.Sprintf("not a function to apply: %s", m["f"]))
+			}
 
+			list.own()
+			for i, item := range list.items {
+				result, err := vm.Call(m["f"], []Value{item})
 				if err != nil {
 					return nil, err
 				}
+
+				list.items[i] = result
 			}
 
-			return list, nil
+			return &NilValue{}, nil
 		},
 		nil,
 	},
+	// reduce leaves the list as it is, combining the items into one value with the function, from the start value
 	"reduce": {
 		"reduce",
 		[]string{"f", "start"},
 		func(vm *VM, value Value, m map[string]Value) (Value, error) {
 			list := value.(*ListValue)
+			list.own()
 			f := m["f"]
 			sum := m["start"]
 
@@ -457,7 +1176,12 @@ type FunctionValue struct {
 	Name   string
 	Params []string
 	Chunk  *Chunk
+	// Parent the value of this when the function is called, if any. Members of values are not given their value
+	// here, as the function may be shared; they are bound to it with a BoundFunctionValue instead.
 	Parent Value
+	// captured the variables of the functions enclosing it which the function refers to, if it is a closure (see
+	// InstructionClosure), which it keeps once they return
+	captured []*VariableValue
 }
 
 func (v *FunctionValue) Type() ValueType {
@@ -478,6 +1202,10 @@ func (v *FunctionValue) Equals(other Value) bool {
 		v.Chunk == other.(*FunctionValue).Chunk
 }
 
+func (v *FunctionValue) Hash() uint64 {
+	return hashBytes(FunctionValueType, []byte(v.Name))
+}
+
 func (v *FunctionValue) Get(_ string) (Value, error) {
 	return nil, errors.New("functions have no properties")
 }
@@ -486,7 +1214,9 @@ type BuiltinFunctionValue struct {
 	Name       string
 	Parameters []string
 	F          func(*VM, Value, map[string]Value) (Value, error)
-	Parent     Value
+	// Parent the value passed as this, if any. The builtins of prototypes are shared by every value (and VM), so
+	// they are bound to the value they are a member of with a BoundFunctionValue instead.
+	Parent Value
 }
 
 func (v *BuiltinFunctionValue) Type() ValueType {
@@ -503,18 +1233,90 @@ func (v *BuiltinFunctionValue) DebugString() string {
 
 func (v *BuiltinFunctionValue) Equals(other Value) bool {
 	return other.Type() == BuiltinFunctionValueType &&
-		v.Name == other.(*BuiltinFunctionValue).Name
+		v.Name == other.(*BuiltinFunctionValue).Name &&
+		reflect.ValueOf(v.F).Pointer() == reflect.ValueOf(other.(*BuiltinFunctionValue).F).Pointer()
+}
+
+func (v *BuiltinFunctionValue) Hash() uint64 {
+	return hashBytes(BuiltinFunctionValueType, []byte(v.Name))
 }
 
 func (v *BuiltinFunctionValue) Get(_ string) (Value, error) {
 	return nil, errors.New("functions have no properties")
 }
 
+// BoundFunctionValue a function (or builtin function) called with a value as this, as when a member of the value
+// was accessed
+type BoundFunctionValue struct {
+	Function Value
+	This     Value
+}
+
+func (v *BoundFunctionValue) Type() ValueType {
+	return BoundFunctionValueType
+}
+
+func (v *BoundFunctionValue) String() string {
+	return v.Function.String()
+}
+
+func (v *BoundFunctionValue) DebugString() string {
+	return v.Function.DebugString()
+}
+
+func (v *BoundFunctionValue) Equals(other Value) bool {
+	return other.Type() == BoundFunctionValueType &&
+		v.Function.Equals(other.(*BoundFunctionValue).Function) &&
+		Same(v.This, other.(*BoundFunctionValue).This)
+}
+
+func (v *BoundFunctionValue) Hash() uint64 {
+	return mix(uint64(BoundFunctionValueType), v.Function.Hash())
+}
+
+func (v *BoundFunctionValue) Get(_ string) (Value, error) {
+	return nil, errors.New("functions have no properties")
+}
+
+// prototypes the members every value of a type has, for the types whose members are decided by their type alone.
+// Objects and errors have members of their own, so they have none.
+var prototypes map[ValueType]map[string]*BuiltinFunctionValue
+
+func init() {
+	// registered here, as the builtins of the prototypes call functions which access properties themselves
+	prototypes = map[ValueType]map[string]*BuiltinFunctionValue{
+		StringValueType:   StringPrototype,
+		ListValueType:     ListPrototype,
+		BuilderValueType:  BuilderPrototype,
+		DequeValueType:    DequePrototype,
+		BytesValueType:    BytesPrototype,
+		DateValueType:     DatePrototype,
+		DurationValueType: DurationPrototype,
+		HandleValueType:   HandlePrototype,
+		BigIntValueType:   BigIntPrototype,
+		SetValueType:      SetPrototype,
+		DictValueType:     DictPrototype,
+		RangeValueType:    RangePrototype,
+	}
+}
+
 // VariableValue a value wrapper for variables kept on the stack
 type VariableValue struct {
 	name  string
 	value Value
 	scope Pos
+	// captured the variable of an enclosing function a closure refers to, which this stands for in calls to the
+	// closure, nil for variables of their own (see cell)
+	captured *VariableValue
+}
+
+// cell the variable which holds the value, which is the variable itself unless it stands for a captured one
+func (v *VariableValue) cell() *VariableValue {
+	if v.captured != nil {
+		return v.captured
+	}
+
+	return v
 }
 
 func (v *VariableValue) Type() ValueType {
@@ -522,7 +1324,7 @@ func (v *VariableValue) Type() ValueType {
 }
 
 func (v *VariableValue) String() string {
-	return fmt.Sprintf("<variable name=%s value=%s scope=%d>", v.name, v.value, v.scope)
+	return fmt.Sprintf("<variable name=%s value=%s scope=%d>", v.name, v.cell().value, v.scope)
 
 	// variables should not be accessed on the stack; normal values should be pushed and popped predictably
 	//panic("tried getting string value of a unreachable value")
@@ -535,9 +1337,602 @@ func (v *VariableValue) DebugString() string {
 func (v *VariableValue) Equals(other Value) bool {
 	return other.Type() == VariableValueType &&
 		v.name == other.(*VariableValue).name &&
-		v.value.Equals(other.(*VariableValue).value)
+		v.cell().value.Equals(other.(*VariableValue).cell().value)
+}
+
+func (v *VariableValue) Hash() uint64 {
+	return v.cell().value.Hash()
 }
 
 func (v *VariableValue) Get(_ string) (Value, error) {
 	return nil, errors.New("variables have no properties")
 }
+
+// BuilderValue accumulates strings efficiently, instead of concatenating strings over and over
+type BuilderValue struct {
+	builder *strings.Builder
+}
+
+func (v *BuilderValue) Type() ValueType {
+	return BuilderValueType
+}
+
+func (v *BuilderValue) String() string {
+	return fmt.Sprintf("<builder length=%d>", v.builder.Len())
+}
+
+func (v *BuilderValue) DebugString() string {
+	return v.String()
+}
+
+func (v *BuilderValue) Equals(other Value) bool {
+	return v == other
+}
+
+func (v *BuilderValue) Hash() uint64 {
+	return uint64(BuilderValueType)
+}
+
+var BuilderPrototype = map[string]*BuiltinFunctionValue{
+	"add": {
+		"add",
+		[]string{"value"},
+		func(_ *VM, this Value, p map[string]Value) (Value, error) {
+			this.(*BuilderValue).builder.WriteString(p["value"].String())
+			return this, nil
+		},
+		nil,
+	},
+	"build": {
+		"build",
+		[]string{},
+		func(_ *VM, this Value, p map[string]Value) (Value, error) {
+			return &StringValue{this.(*BuilderValue).builder.String()}, nil
+		},
+		nil,
+	},
+	"length": {
+		"length",
+		[]string{},
+		func(_ *VM, this Value, p map[string]Value) (Value, error) {
+			return GoToValue(this.(*BuilderValue).builder.Len()), nil
+		},
+		nil,
+	},
+}
+
+func (v *BuilderValue) Get(key string) (Value, error) {
+	if prop, ok := BuilderPrototype[key]; ok {
+		return prop, nil
+	}
+
+	return nil, errors.New(fmt.Sprintf("builder has no property \"%s\"", key))
+}
+
+// DequeValue a double-ended queue, which can have items added and removed at both ends in constant time. The items
+// are kept in a ring buffer, starting at head and wrapping around to the start of the buffer.
+type DequeValue struct {
+	items  []Value
+	head   int
+	length int
+	// frozen whether items can no longer be pushed or popped
+	frozen bool
+}
+
+func NewDeque(items []Value) *DequeValue {
+	d := &DequeValue{make([]Value, max(len(items), 8)), 0, 0, false}
+	for _, item := range items {
+		d.PushBack(item)
+	}
+
+	return d
+}
+
+// grow double the capacity of the buffer, moving the items to its start
+func (v *DequeValue) grow() {
+	items := make([]Value, len(v.items)*2)
+	for i := 0; i < v.length; i++ {
+		items[i] = v.at(i)
+	}
+
+	v.items = items
+	v.head = 0
+}
+
+// at get the item at an index counted from the front
+func (v *DequeValue) at(index int) Value {
+	return v.items[(v.head+index)%len(v.items)]
+}
+
+func (v *DequeValue) PushBack(item Value) {
+	if v.length == len(v.items) {
+		v.grow()
+	}
+
+	v.items[(v.head+v.length)%len(v.items)] = item
+	v.length++
+}
+
+func (v *DequeValue) PushFront(item Value) {
+	if v.length == len(v.items) {
+		v.grow()
+	}
+
+	v.head = (v.head - 1 + len(v.items)) % len(v.items)
+	v.items[v.head] = item
+	v.length++
+}
+
+// PopBack remove the item at the back, or return nil if the deque is empty
+func (v *DequeValue) PopBack() Value {
+	if v.length == 0 {
+		return nil
+	}
+
+	i := (v.head + v.length - 1) % len(v.items)
+	item := v.items[i]
+	v.items[i] = nil
+	v.length--
+
+	return item
+}
+
+// PopFront remove the item at the front, or return nil if the deque is empty
+func (v *DequeValue) PopFront() Value {
+	if v.length == 0 {
+		return nil
+	}
+
+	item := v.items[v.head]
+	v.items[v.head] = nil
+	v.head = (v.head + 1) % len(v.items)
+	v.length--
+
+	return item
+}
+
+// Items get the items of the deque, from front to back
+func (v *DequeValue) Items() []Value {
+	items := make([]Value, v.length)
+	for i := range items {
+		items[i] = v.at(i)
+	}
+
+	return items
+}
+
+func (v *DequeValue) Type() ValueType {
+	return DequeValueType
+}
+
+func (v *DequeValue) String() string {
+	return formatNested(v, map[Value]bool{}, true)
+}
+
+func (v *DequeValue) format(visiting map[Value]bool) string {
+	items := make([]string, v.length)
+	for i := range items {
+		items[i] = formatNested(v.at(i), visiting, true)
+	}
+
+	return fmt.Sprintf("deque[%s]", strings.Join(items, ", "))
+}
+
+func (v *DequeValue) cycle() string {
+	return "deque[...]"
+}
+
+func (v *DequeValue) DebugString() string {
+	return v.String()
+}
+
+func (v *DequeValue) Equals(other Value) bool {
+	return v == other
+}
+
+func (v *DequeValue) Hash() uint64 {
+	return uint64(DequeValueType)
+}
+
+// equals deques are only equal to themselves, so comparing them never goes into their items
+func (v *DequeValue) equals(other Value, _ map[[2]Value]bool) bool {
+	return v == other
+}
+
+// popped turn an item popped from a deque into a result, failing if there was none because the deque is empty
+func popped(item Value, end string) (Value, error) {
+	if item == nil {
+		return nil, errors.New(fmt.Sprintf("cannot take from the %s of an empty deque", end))
+	}
+
+	return item, nil
+}
+
+var DequePrototype = map[string]*BuiltinFunctionValue{
+	"pushBack": {
+		"pushBack",
+		[]string{"item"},
+		func(_ *VM, this Value, p map[string]Value) (Value, error) {
+			deque := this.(*DequeValue)
+			if deque.frozen {
+				return nil, errors.New("cannot push to the back of frozen deque")
+			}
+
+			deque.PushBack(p["item"])
+			return &NilValue{}, nil
+		},
+		nil,
+	},
+	"pushFront": {
+		"pushFront",
+		[]string{"item"},
+		func(_ *VM, this Value, p map[string]Value) (Value, error) {
+			deque := this.(*DequeValue)
+			if deque.frozen {
+				return nil, errors.New("cannot push to the front of frozen deque")
+			}
+
+			deque.PushFront(p["item"])
+			return &NilValue{}, nil
+		},
+		nil,
+	},
+	"popBack": {
+		"popBack",
+		[]string{},
+		func(_ *VM, this Value, p map[string]Value) (Value, error) {
+			deque := this.(*DequeValue)
+			if deque.frozen {
+				return nil, errors.New("cannot pop from the back of frozen deque")
+			}
+
+			return popped(deque.PopBack(), "back")
+		},
+		nil,
+	},
+	"popFront": {
+		"popFront",
+		[]string{},
+		func(_ *VM, this Value, p map[string]Value) (Value, error) {
+			deque := this.(*DequeValue)
+			if deque.frozen {
+				return nil, errors.New("cannot pop from the front of frozen deque")
+			}
+
+			return popped(deque.PopFront(), "front")
+		},
+		nil,
+	},
+	"peekBack": {
+		"peekBack",
+		[]string{},
+		func(_ *VM, this Value, p map[string]Value) (Value, error) {
+			d := this.(*DequeValue)
+			if d.length == 0 {
+				return popped(nil, "back")
+			}
+
+			return d.at(d.length - 1), nil
+		},
+		nil,
+	},
+	"peekFront": {
+		"peekFront",
+		[]string{},
+		func(_ *VM, this Value, p map[string]Value) (Value, error) {
+			d := this.(*DequeValue)
+			if d.length == 0 {
+				return popped(nil, "front")
+			}
+
+			return d.at(0), nil
+		},
+		nil,
+	},
+	"length": {
+		"length",
+		[]string{},
+		func(_ *VM, this Value, p map[string]Value) (Value, error) {
+			return GoToValue(this.(*DequeValue).length), nil
+		},
+		nil,
+	},
+	"toList": {
+		"toList",
+		[]string{},
+		func(_ *VM, this Value, p map[string]Value) (Value, error) {
+			return &ListValue{this.(*DequeValue).Items(), false, false}, nil
+		},
+		nil,
+	},
+}
+
+func (v *DequeValue) Get(key string) (Value, error) {
+	if prop, ok := DequePrototype[key]; ok {
+		return prop, nil
+	}
+
+	return nil, errors.New(fmt.Sprintf("deque has no property \"%s\"", key))
+}
+
+// BytesValue an immutable sequence of bytes, for binary data which is not necessarily valid UTF-8
+type BytesValue struct {
+	bytes []byte
+}
+
+func NewBytes(bytes []byte) *BytesValue {
+	return &BytesValue{bytes}
+}
+
+func (v *BytesValue) Bytes() []byte {
+	return v.bytes
+}
+
+func (v *BytesValue) Type() ValueType {
+	return BytesValueType
+}
+
+func (v *BytesValue) String() string {
+	return fmt.Sprintf("bytes[%s]", hex.EncodeToString(v.bytes))
+}
+
+func (v *BytesValue) DebugString() string {
+	return v.String()
+}
+
+func (v *BytesValue) Equals(other Value) bool {
+	return other.Type() == BytesValueType && string(other.(*BytesValue).bytes) == string(v.bytes)
+}
+
+func (v *BytesValue) Hash() uint64 {
+	return hashBytes(BytesValueType, v.bytes)
+}
+
+// byteIndex get an index into bytes from a value. The index may equal the length if end is set, as when slicing.
+func byteIndex(index Value, length int, end bool) (int, error) {
+	i, ok := index.(*NumberValue)
+	if !ok {
+		return 0, errors.New(fmt.Sprintf("bytes index must be a number, got %s", TypeOf(index)))
+	}
+
+	limit := length
+	if end {
+		limit++
+	}
+
+	if i.float64 < 0 || int(i.float64) >= limit || i.float64 != float64(int(i.float64)) {
+		return 0, errors.New(fmt.Sprintf("bytes index %s out of range (length %d)", i, length))
+	}
+
+	return int(i.float64), nil
+}
+
+var BytesPrototype = map[string]*BuiltinFunctionValue{
+	"at": {
+		"at",
+		[]string{"index"},
+		func(_ *VM, this Value, p map[string]Value) (Value, error) {
+			bytes := this.(*BytesValue).bytes
+
+			i, err := byteIndex(p["index"], len(bytes), false)
+			if err != nil {
+				return nil, err
+			}
+
+			return GoToValue(int(bytes[i])), nil
+		},
+		nil,
+	},
+	"length": {
+		"length",
+		[]string{},
+		func(_ *VM, this Value, p map[string]Value) (Value, error) {
+			return GoToValue(len(this.(*BytesValue).bytes)), nil
+		},
+		nil,
+	},
+	"slice": {
+		"slice",
+		[]string{"start", "end"},
+		func(_ *VM, this Value, p map[string]Value) (Value, error) {
+			bytes := this.(*BytesValue).bytes
+
+			start, err := byteIndex(p["start"], len(bytes), true)
+			if err != nil {
+				return nil, err
+			}
+
+			end, err := byteIndex(p["end"], len(bytes), true)
+			if err != nil {
+				return nil, err
+			}
+
+			if end < start {
+				return nil, errors.New(fmt.Sprintf("cannot slice bytes from %d to %d", start, end))
+			}
+
+			// bytes can't be changed, so the slice may share them
+			return &BytesValue{bytes[start:end]}, nil
+		},
+		nil,
+	},
+	"toString": {
+		"toString",
+		[]string{},
+		func(_ *VM, this Value, p map[string]Value) (Value, error) {
+			bytes := this.(*BytesValue).bytes
+			if !utf8.Valid(bytes) {
+				return nil, errors.New("bytes are not valid UTF-8")
+			}
+
+			return &StringValue{string(bytes)}, nil
+		},
+		nil,
+	},
+	"toBase64": {
+		"toBase64",
+		[]string{},
+		func(_ *VM, this Value, p map[string]Value) (Value, error) {
+			return &StringValue{base64.StdEncoding.EncodeToString(this.(*BytesValue).bytes)}, nil
+		},
+		nil,
+	},
+	"toHex": {
+		"toHex",
+		[]string{},
+		func(_ *VM, this Value, p map[string]Value) (Value, error) {
+			return &StringValue{hex.EncodeToString(this.(*BytesValue).bytes)}, nil
+		},
+		nil,
+	},
+	"toList": {
+		"toList",
+		[]string{},
+		func(_ *VM, this Value, p map[string]Value) (Value, error) {
+			bytes := this.(*BytesValue).bytes
+			items := make([]Value, len(bytes))
+			for i, b := range bytes {
+				items[i] = GoToValue(int(b))
+			}
+
+			return &ListValue{items, false, false}, nil
+		},
+		nil,
+	},
+}
+
+func (v *BytesValue) Get(key string) (Value, error) {
+	if prop, ok := BytesPrototype[key]; ok {
+		return prop, nil
+	}
+
+	return nil, errors.New(fmt.Sprintf("bytes has no property \"%s\"", key))
+}
+
+// TraceFrame a function being executed, and the line (starting at 0) it was at, or -1 if it is unknown
+type TraceFrame struct {
+	Function string
+	Line     Pos
+	// Instruction the position of the instruction being executed in the chunk of the function
+	Instruction Pos
+	// File the file the line is in, "" if it is in the source being compiled (see Chunk.File)
+	File string
+}
+
+func (f TraceFrame) String() string {
+	if f.Line < 0 {
+		return fmt.Sprintf("at %s", f.Function)
+	}
+
+	return fmt.Sprintf("at %s (%s)", f.Function, Location{f.File, f.Line})
+}
+
+// ErrorValue a failure, with where in the program it happened and optionally the error which caused it
+type ErrorValue struct {
+	Message string
+	Cause   *ErrorValue
+	Trace   []TraceFrame
+}
+
+func NewError(message string, cause *ErrorValue, trace []TraceFrame) *ErrorValue {
+	return &ErrorValue{message, cause, trace}
+}
+
+func (v *ErrorValue) Type() ValueType {
+	return ErrorValueType
+}
+
+func (v *ErrorValue) String() string {
+	return "error: " + v.Error()
+}
+
+func (v *ErrorValue) DebugString() string {
+	return v.String()
+}
+
+// Error get the message of the error and the errors causing it
+func (v *ErrorValue) Error() string {
+	if v.Cause != nil {
+		return v.Message + ": " + v.Cause.Error()
+	}
+
+	return v.Message
+}
+
+func (v *ErrorValue) Equals(other Value) bool {
+	return v == other
+}
+
+func (v *ErrorValue) Hash() uint64 {
+	return uint64(ErrorValueType)
+}
+
+// Format describe the error with its stack trace, and those of its causes
+func (v *ErrorValue) Format() string {
+	return v.FormatSource(nil)
+}
+
+// FormatSource describe the error like Format, also showing the line of the source where each error happened
+func (v *ErrorValue) FormatSource(src []rune) string {
+	return v.FormatSources(src, nil)
+}
+
+// FormatSources describe the error like FormatSource, showing the lines of errors happening in other files than the
+// source from their sources, by their names (see Program.ImportedSource)
+func (v *ErrorValue) FormatSources(src []rune, sources map[string][]rune) string {
+	b := strings.Builder{}
+
+	for e := v; e != nil; e = e.Cause {
+		if e != v {
+			b.WriteString("caused by ")
+		}
+
+		b.WriteString("error: ")
+		b.WriteString(e.Message)
+		b.WriteRune('\n')
+
+		for i, frame := range e.Trace {
+			b.WriteString("\t")
+			b.WriteString(frame.String())
+			b.WriteRune('\n')
+
+			// the innermost frame is where the error happened
+			if i > 0 || frame.Line < 0 {
+				continue
+			}
+
+			source, ok := sources[frame.File]
+			if !ok {
+				source = src
+			}
+
+			if lines := strings.Split(string(source), "\n"); source != nil && int(frame.Line) < len(lines) {
+				b.WriteString(fmt.Sprintf("\t%4d | %s\n", frame.Line+1, strings.TrimSpace(lines[frame.Line])))
+			}
+		}
+	}
+
+	return b.String()
+}
+
+func (v *ErrorValue) Get(key string) (Value, error) {
+	switch key {
+	case "message":
+		return &StringValue{v.Message}, nil
+	case "cause":
+		if v.Cause == nil {
+			return &NilValue{}, nil
+		}
+
+		return v.Cause, nil
+	case "trace":
+		frames := make([]Value, len(v.Trace))
+		for i, frame := range v.Trace {
+			frames[i] = &StringValue{frame.String()}
+		}
+
+		return &ListValue{frames, true, false}, nil
+	}
+
+	return nil, errors.New(fmt.Sprintf("error has no property \"%s\"", key))
+}
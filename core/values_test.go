@@ -1,6 +1,11 @@
 package core
 
-import "testing"
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
 
 func CompareValues(t *testing.T, got Value, want Value) {
 	if got == nil || want == nil {
@@ -27,6 +32,10 @@ func CompareValues(t *testing.T, got Value, want Value) {
 		} else {
 			t.Logf("Both are same number (%s)", got.(*NumberValue).String())
 		}
+	case BigIntValueType:
+		if got.(*BigIntValue).int.Cmp(want.(*BigIntValue).int) != 0 {
+			t.Errorf("bigint value mismatch: got %v, want %v", got.(*BigIntValue), want.(*BigIntValue))
+		}
 	case StringValueType:
 		if got.(*StringValue).string != want.(*StringValue).string {
 			t.Errorf("string value mismatch: got %v, want %v", got.(*StringValue), want.(*StringValue))
@@ -73,6 +82,17 @@ func CompareValues(t *testing.T, got Value, want Value) {
 		if &n.F != &m.F {
 			t.Errorf("builtin function f mismatch: got %v, want %v", &n.F, &m.F)
 		}
+	case ListValueType:
+		n := got.(*ListValue)
+		m := want.(*ListValue)
+
+		if len(n.items) != len(m.items) {
+			t.Fatalf("list length mismatch: got %v, want %v", len(n.items), len(m.items))
+		}
+
+		for i, item := range n.items {
+			CompareValues(t, item, m.items[i])
+		}
 	case VariableValueType:
 		n := got.(*VariableValue)
 		m := want.(*VariableValue)
@@ -91,3 +111,371 @@ func CompareValues(t *testing.T, got Value, want Value) {
 		panic("unimplemented comparison")
 	}
 }
+
+func TestValueToGo(t *testing.T) {
+	values := []interface{}{
+		nil,
+		true,
+		1.5,
+		"Hello world!",
+		[]interface{}{1.0, "a", []interface{}{false}},
+		map[string]interface{}{"a": 1.0, "b": []interface{}{nil}},
+	}
+
+	for _, v := range values {
+		t.Run(fmt.Sprint(v), func(t *testing.T) {
+			got := ValueToGo(GoToValue(v))
+
+			if !reflect.DeepEqual(got, v) {
+				t.Errorf("got %#v after converting back and forth; want %#v", got, v)
+			}
+		})
+	}
+
+	f := &FunctionValue{Name: "f"}
+	if ValueToGo(f) != f {
+		t.Errorf("functions should be returned as they are")
+	}
+}
+
+func TestValue_Equals(t *testing.T) {
+	f := &FunctionValue{"f", nil, NewChunk(nil, nil), nil, nil}
+
+	cases := []struct {
+		a, b  Value
+		equal bool
+	}{
+		{&NilValue{}, &NilValue{}, true},
+		{&NumberValue{1, nil}, &NumberValue{1, nil}, true},
+		{&NumberValue{1, nil}, &StringValue{"1"}, false},
+		{&ListValue{[]Value{&NumberValue{1, nil}}, false, false}, &ListValue{[]Value{&NumberValue{1, nil}}, false, false}, true},
+		{&ListValue{[]Value{&NumberValue{1, nil}}, false, false}, &ListValue{[]Value{&NumberValue{2, nil}}, false, false}, false},
+		{&ObjectValue{map[string]Value{"a": &NumberValue{1, nil}}, false}, &ObjectValue{map[string]Value{"a": &NumberValue{1, nil}}, false}, true},
+		{&ObjectValue{map[string]Value{"a": &NumberValue{1, nil}}, false}, &ObjectValue{map[string]Value{"b": &NumberValue{1, nil}}, false}, false},
+		{&ObjectValue{map[string]Value{}, false}, &ObjectValue{map[string]Value{"a": &NilValue{}}, false}, false},
+		{f, f, true},
+		{f, &FunctionValue{"f", nil, NewChunk(nil, nil), nil, nil}, false},
+	}
+
+	for _, tc := range cases {
+		if tc.a.Equals(tc.b) != tc.equal || tc.b.Equals(tc.a) != tc.equal {
+			t.Errorf("expected equality of %s and %s to be %v", tc.a.DebugString(), tc.b.DebugString(), tc.equal)
+		}
+	}
+}
+
+func TestSame(t *testing.T) {
+	list := &ListValue{[]Value{&NumberValue{1, nil}}, false, false}
+
+	if !Same(list, list) {
+		t.Errorf("expected a list to be the same as itself")
+	}
+
+	if Same(list, &ListValue{[]Value{&NumberValue{1, nil}}, false, false}) {
+		t.Errorf("expected equal lists to not be the same")
+	}
+
+	if !Same(&StringValue{"a"}, &StringValue{"a"}) {
+		t.Errorf("expected equal strings to be the same")
+	}
+}
+
+func TestFreeze(t *testing.T) {
+	inner := &ObjectValue{map[string]Value{}, false}
+	list := &ListValue{[]Value{inner}, false, false}
+
+	Freeze(list)
+
+	if !IsFrozen(list) || !IsFrozen(inner) {
+		t.Fatalf("expected the list and the object within it to be frozen")
+	}
+
+	_, err := ListPrototype["append"].F(nil, list, map[string]Value{"item": &NilValue{}})
+	if err == nil {
+		t.Errorf("expected appending to a frozen list to fail")
+	}
+
+	set := ObjectPrototype["set"].(*BuiltinFunctionValue)
+	_, err = set.F(nil, inner, map[string]Value{"property": &StringValue{"a"}, "value": &NilValue{}})
+	if err == nil {
+		t.Errorf("expected setting a property of a frozen object to fail")
+	}
+
+	object := &ObjectValue{map[string]Value{}, false}
+	_, err = set.F(nil, object, map[string]Value{"property": &StringValue{"a"}, "value": &NumberValue{1, nil}})
+	if err != nil {
+		t.Fatalf("unexpected error setting property: %v", err)
+	}
+
+	if !object.members["a"].Equals(&NumberValue{1, nil}) {
+		t.Errorf("expected property a to be set to 1, got %v", object.members["a"])
+	}
+}
+
+func TestListPrototype_Map(t *testing.T) {
+	vm := runSource(t, `
+func double(x) {
+	return x * 2
+}
+
+func large(x) {
+	return x > 2
+}
+
+numbers := freeze([1, 2, 3])
+doubled := numbers.map(double)
+kept := [1, 2, 3, 4].filter(large)
+changed := [1, 2]
+changed.mapInPlace(double)
+`)
+
+	if err := vm.Error(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// map and filter make new lists, so they work on frozen lists
+	CompareValues(t, vm.Variable("numbers"), NewList([]Value{NewNumber(1), NewNumber(2), NewNumber(3)}))
+	CompareValues(t, vm.Variable("doubled"), NewList([]Value{NewNumber(2), NewNumber(4), NewNumber(6)}))
+	CompareValues(t, vm.Variable("kept"), NewList([]Value{NewNumber(3), NewNumber(4)}))
+	CompareValues(t, vm.Variable("changed"), NewList([]Value{NewNumber(2), NewNumber(4)}))
+
+	for _, src := range []string{
+		"func double(x) {\n\treturn x * 2\n}\nl := freeze([1])\nl.mapInPlace(double)",
+		"x := [1].filter(typeof)",
+	} {
+		if vm := runSource(t, src); vm.Error() == nil {
+			t.Errorf("expected %q to fail", src)
+		}
+	}
+}
+
+func TestBuilderValue(t *testing.T) {
+	b := &BuilderValue{&strings.Builder{}}
+
+	for _, v := range []Value{&StringValue{"a"}, &NumberValue{1, nil}, &BoolValue{true}} {
+		result, err := BuilderPrototype["add"].F(nil, b, map[string]Value{"value": v})
+		if err != nil {
+			t.Fatalf("unexpected error adding to builder: %v", err)
+		}
+
+		if result != b {
+			t.Errorf("expected add to return the builder for chaining")
+		}
+	}
+
+	s, err := BuilderPrototype["build"].F(nil, b, map[string]Value{})
+	if err != nil {
+		t.Fatalf("unexpected error building: %v", err)
+	}
+
+	CompareValues(t, s, &StringValue{"a1true"})
+}
+
+func TestStringPrototype_Characters(t *testing.T) {
+	s := &StringValue{"héllo ☃"}
+
+	at, err := StringPrototype["at"].F(nil, s, map[string]Value{"index": &NumberValue{6, nil}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	CompareValues(t, at, &StringValue{"☃"})
+
+	code, err := StringPrototype["codePointAt"].F(nil, s, map[string]Value{"index": &NumberValue{1, nil}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	CompareValues(t, code, &NumberValue{'é', nil})
+
+	bytes, err := StringPrototype["bytes"].F(nil, &StringValue{"é"}, map[string]Value{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	CompareValues(t, bytes, &ListValue{[]Value{&NumberValue{0xc3, nil}, &NumberValue{0xa9, nil}}, false, false})
+
+	for _, index := range []float64{-1, 7, 0.5} {
+		_, err := StringPrototype["at"].F(nil, s, map[string]Value{"index": &NumberValue{index, nil}})
+		if err == nil {
+			t.Errorf("expected an error for index %v", index)
+		}
+	}
+
+	char, err := DefaultGlobals["fromCharCode"].(*BuiltinFunctionValue).F(nil, nil, map[string]Value{"code": &NumberValue{9731, nil}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	CompareValues(t, char, &StringValue{"☃"})
+}
+
+func TestDequeValue(t *testing.T) {
+	d := NewDeque(nil)
+
+	// push past the initial capacity from both ends, so the buffer wraps around and grows
+	for i := 0; i < 10; i++ {
+		d.PushBack(&NumberValue{float64(i), nil})
+		d.PushFront(&NumberValue{float64(-i - 1), nil})
+	}
+
+	if d.length != 20 {
+		t.Fatalf("expected 20 items, got %d", d.length)
+	}
+
+	for i := 10; i > 0; i-- {
+		CompareValues(t, d.PopFront(), &NumberValue{float64(-i), nil})
+	}
+
+	for i := 9; i >= 0; i-- {
+		CompareValues(t, d.PopBack(), &NumberValue{float64(i), nil})
+	}
+
+	if d.PopFront() != nil || d.PopBack() != nil {
+		t.Errorf("expected popping an empty deque to give nothing")
+	}
+}
+
+func TestDequeValue_Program(t *testing.T) {
+	vm := runSource(t, `
+q := newDeque([2, 3])
+q.pushFront(1)
+q.pushBack(4)
+first := q.popFront()
+last := q.popBack()
+rest := q.toList()
+`)
+
+	if err := vm.Error(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	CompareValues(t, vm.Variable("first"), &NumberValue{1, nil})
+	CompareValues(t, vm.Variable("last"), &NumberValue{4, nil})
+	CompareValues(t, vm.Variable("rest"), &ListValue{[]Value{&NumberValue{2, nil}, &NumberValue{3, nil}}, false, false})
+
+	vm = runSource(t, "x := newDeque([]).popFront()")
+	if vm.Error() == nil {
+		t.Errorf("expected an error popping from an empty deque")
+	}
+
+	for _, src := range []string{"freeze(newDeque(nil)).pushFront(1)", "freeze(newDeque(nil)).pushBack(1)",
+		"x := freeze(newDeque([1])).popFront()", "x := freeze(newDeque([1])).popBack()"} {
+		if vm := runSource(t, src); vm.Error() == nil {
+			t.Errorf("expected %q to fail", src)
+		}
+	}
+
+	if a, b := NewDeque(nil), NewDeque(nil); Same(a, b) || !Same(a, a) {
+		t.Errorf("expected deques to only be the same as themselves")
+	}
+}
+
+func TestBytesValue(t *testing.T) {
+	vm := runSource(t, `
+b := bytes("héllo")
+length := b.length()
+second := b.at(1)
+sliced := b.slice(1, 3).toString()
+encoded := b.toBase64()
+decoded := fromHex("c3a9").toString()
+same := fromBase64(encoded) == b
+`)
+
+	if err := vm.Error(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	CompareValues(t, vm.Variable("length"), &NumberValue{6, nil})
+	CompareValues(t, vm.Variable("second"), &NumberValue{0xc3, nil})
+	CompareValues(t, vm.Variable("sliced"), &StringValue{"é"})
+	CompareValues(t, vm.Variable("encoded"), &StringValue{"aMOpbGxv"})
+	CompareValues(t, vm.Variable("decoded"), &StringValue{"é"})
+	CompareValues(t, vm.Variable("same"), &BoolValue{true})
+
+	failing := []string{
+		`x := bytes("é").slice(0, 1).toString()`,
+		`x := bytes([256])`,
+		`x := fromHex("zz")`,
+		`x := bytes("a").at(1)`,
+	}
+
+	for _, src := range failing {
+		if runSource(t, src).Error() == nil {
+			t.Errorf("expected an error running %q", src)
+		}
+	}
+}
+
+func TestValue_Cycles(t *testing.T) {
+	list := &ListValue{[]Value{&NumberValue{1, nil}}, false, false}
+	list.items = append(list.items, list)
+
+	object := &ObjectValue{map[string]Value{"list": list}, false}
+	object.members["self"] = object
+
+	if s := list.String(); s != "[1, [...]]" {
+		t.Errorf("expected the list to be written as [1, [...]], got %s", s)
+	}
+
+	if s := (&ListValue{[]Value{list, list}, false, false}).String(); s != "[[1, [...]], [1, [...]]]" {
+		t.Errorf("expected a list shared twice to be written in full both times, got %s", s)
+	}
+
+	if s := (&ObjectValue{map[string]Value{"self": object.members["self"]}, false}).String(); !strings.Contains(s, "{...}") {
+		t.Errorf("expected the object cycle to be written as {...}, got %s", s)
+	}
+
+	copied := Clone(list).(*ListValue)
+	if copied == list || copied.items[1] != copied {
+		t.Errorf("expected the clone to be a new list containing itself")
+	}
+
+	if !list.Equals(copied) || !copied.Equals(list) {
+		t.Errorf("expected a list containing itself to equal its clone")
+	}
+
+	copied.items[0] = &NumberValue{2, nil}
+	if list.Equals(copied) {
+		t.Errorf("expected lists differing outside of the cycle to not be equal")
+	}
+
+	if !object.Equals(Clone(object)) {
+		t.Errorf("expected an object containing itself to equal its clone")
+	}
+}
+
+func TestStringPrototype_Locale(t *testing.T) {
+	vm := runSource(t, `turkish := "istanbul".toUpperIn("tr")
+upper := "straße".toUpper()
+lower := "ÉCOLE".toLower()
+dotless := "I".toLowerIn("tr")
+before := "a".localeCompare("B", "en")
+swedish := "ä".localeCompare("z", "sv")
+german := "ä".localeCompare("z", "de")
+same := "e".localeCompare("e", "")
+composed := "é".normalize("NFC").bytes().length()
+decomposed := "é".normalize("NFD").bytes().length()`)
+
+	for name, expected := range map[string]Value{
+		"turkish":    NewString("İSTANBUL"),
+		"upper":      NewString("STRASSE"),
+		"lower":      NewString("école"),
+		"dotless":    NewString("ı"),
+		"before":     NewNumber(-1),
+		"swedish":    NewNumber(1),
+		"german":     NewNumber(-1),
+		"same":       NewNumber(0),
+		"composed":   NewNumber(2),
+		"decomposed": NewNumber(3),
+	} {
+		CompareValues(t, vm.Variable(name), expected)
+	}
+
+	for _, src := range []string{`discard "a".toUpperIn("not a locale!")`, `discard "a".normalize("NFX")`, `discard "a".localeCompare(1, "en")`} {
+		program, err := Compile(src, CompileOptions{})
+		if err != nil {
+			t.Fatalf("Unexpected error compiling %q: %v", src, err)
+		}
+
+		if _, err := program.Run(RunOptions{}); err == nil {
+			t.Errorf("Expected %q to fail", src)
+		}
+	}
+}
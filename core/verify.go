@@ -0,0 +1,302 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Disassemble describe the instruction at a position of the chunk along with its operands, such as the constant it
+// refers to or where it jumps to
+func (c *Chunk) Disassemble(at Pos) string {
+	b := c.Bytecode[at]
+
+	switch kind := operands(b); kind {
+	case operandConstant, operandName:
+		if int(at)+kind.width() >= len(c.Bytecode) || int(c.Bytecode[at+1]) >= len(c.Constants) {
+			break
+		}
+
+		index := c.Bytecode[at+1]
+		return fmt.Sprintf("%s %d (%s)", b, index, c.Constants[index].DebugString())
+
+	case operandJump, operandLoop, operandCount:
+		if int(at)+kind.width() >= len(c.Bytecode) {
+			break
+		}
+
+		n := int(c.Bytecode[at+1])<<8 | int(c.Bytecode[at+2])
+
+		// jumps are relative to the end of the instruction
+		switch kind {
+		case operandJump:
+			return fmt.Sprintf("%s %d (to %d)", b, n, int(at)+3+n)
+		case operandLoop:
+			return fmt.Sprintf("%s %d (to %d)", b, n, int(at)+3-n)
+		}
+
+		return fmt.Sprintf("%s %d", b, n)
+
+	case operandArguments:
+		if int(at)+kind.width() >= len(c.Bytecode) {
+			break
+		}
+
+		return fmt.Sprintf("%s %d", b, c.Bytecode[at+1])
+
+	case operandCounterJump, operandCounterLoop:
+		if int(at)+kind.width() >= len(c.Bytecode) || c.verifyCounter(at) != nil {
+			break
+		}
+
+		loop, n := c.counterOperands(at), c.operand(at)
+		to := int(at) + 8 + n
+		if kind == operandCounterLoop {
+			to = int(at) + 8 - n
+		}
+
+		name := c.Constants[loop.name].(*StringValue).string
+		limit := c.Constants[loop.limit].DebugString()
+		if v, ok := c.Constants[loop.limit].(*StringValue); ok {
+			limit = v.string
+		}
+
+		return fmt.Sprintf("%s %s %s %s, %s %s %s (to %d)", b, name, counterSymbols[loop.comparison], limit, name,
+			counterSymbols[loop.operation], c.Constants[loop.step].DebugString(), to)
+	}
+
+	return b.String()
+}
+
+// counterSymbols the operators of the comparisons and operations of numeric for loops, for them to be disassembled
+var counterSymbols = map[Bytecode]string{
+	InstructionLess:           "<",
+	InstructionLessOrEqual:    "<=",
+	InstructionGreater:        ">",
+	InstructionGreaterOrEqual: ">=",
+	InstructionAdd:            "+",
+	InstructionSub:            "-",
+}
+
+// verifyCounter check the operands of the numeric for loop instruction at a position of the chunk refer to what they
+// should: a name, a limit which is a number or a name, a number to step by and a comparison and operation
+func (c *Chunk) verifyCounter(at Pos) error {
+	b, loop := c.Bytecode[at], c.counterOperands(at)
+	for _, index := range []Bytecode{loop.name, loop.limit, loop.step} {
+		if int(index) >= len(c.Constants) {
+			return errors.New(fmt.Sprintf("%s at %d refers to constant %d, but there are %d", b, at, index, len(c.Constants)))
+		}
+	}
+
+	if _, ok := c.Constants[loop.name].(*StringValue); !ok {
+		return errors.New(fmt.Sprintf("%s at %d needs a string constant naming its counter, got %s", b, at, c.Constants[loop.name].DebugString()))
+	}
+
+	switch c.Constants[loop.limit].(type) {
+	case *NumberValue, *StringValue:
+	default:
+		return errors.New(fmt.Sprintf("%s at %d needs a number or name as its limit, got %s", b, at, c.Constants[loop.limit].DebugString()))
+	}
+
+	if _, ok := c.Constants[loop.step].(*NumberValue); !ok {
+		return errors.New(fmt.Sprintf("%s at %d needs a number to step by, got %s", b, at, c.Constants[loop.step].DebugString()))
+	}
+
+	if loop.operation != InstructionAdd && loop.operation != InstructionSub {
+		return errors.New(fmt.Sprintf("%s at %d steps its counter by %s, which isn't adding or subtracting", b, at, loop.operation))
+	}
+
+	switch loop.comparison {
+	case InstructionLess, InstructionLessOrEqual, InstructionGreater, InstructionGreaterOrEqual:
+	default:
+		return errors.New(fmt.Sprintf("%s at %d compares its counter by %s, which isn't a comparison", b, at, loop.comparison))
+	}
+
+	return nil
+}
+
+// Verify check that the bytecode of the chunk (and of the functions in its constants) is well-formed: every
+// instruction exists and has its operands, constants are in range and of the right type, jumps land on instructions
+// within the chunk, and every path through it leaves the stack as it should (see verifyStack). Chunks which are not
+// compiled by the compiler, such as those read from files, should be verified before being run, as the VM trusts its
+// bytecode.
+func (c *Chunk) Verify() error {
+	for i := 0; i < len(c.Bytecode); i++ {
+		at := i
+		b := c.Bytecode[i]
+
+		if !b.valid() {
+			return errors.New(fmt.Sprintf("invalid instruction %d at %d", b, at))
+		}
+
+		kind := operands(b)
+		if i+kind.width() >= len(c.Bytecode) {
+			return errors.New(fmt.Sprintf("%s at %d is missing its operand", b, at))
+		}
+
+		i += kind.width()
+
+		switch kind {
+		case operandConstant, operandName:
+			index := int(c.Bytecode[i])
+			if index >= len(c.Constants) {
+				return errors.New(fmt.Sprintf("%s at %d refers to constant %d, but there are %d", b, at, index, len(c.Constants)))
+			}
+
+			if _, ok := c.Constants[index].(*StringValue); kind == operandName && !ok {
+				return errors.New(fmt.Sprintf("%s at %d needs a string constant, got %s", b, at, c.Constants[index].DebugString()))
+			}
+
+			if (b == InstructionDestructure || b == InstructionClosure) && !isNameList(c.Constants[index]) {
+				return errors.New(fmt.Sprintf("%s at %d needs a list of names, got %s", b, at, c.Constants[index].DebugString()))
+			}
+
+		case operandJump, operandLoop, operandCount:
+			n := int(c.Bytecode[i-1])<<8 | int(c.Bytecode[i])
+
+			// jumps are relative to the end of the instruction
+			if kind == operandJump && i+1+n > len(c.Bytecode) {
+				return errors.New(fmt.Sprintf("%s at %d jumps past the end of the chunk", b, at))
+			}
+
+			if kind == operandLoop && i+1-n < 0 {
+				return errors.New(fmt.Sprintf("%s at %d loops before the start of the chunk", b, at))
+			}
+
+		case operandCounterJump, operandCounterLoop:
+			if err := c.verifyCounter(Pos(at)); err != nil {
+				return err
+			}
+
+			n := c.operand(Pos(at))
+			if kind == operandCounterJump && i+1+n > len(c.Bytecode) {
+				return errors.New(fmt.Sprintf("%s at %d jumps past the end of the chunk", b, at))
+			}
+
+			if kind == operandCounterLoop && i+1-n < 0 {
+				return errors.New(fmt.Sprintf("%s at %d loops before the start of the chunk", b, at))
+			}
+		}
+	}
+
+	if err := c.verifyStack(); err != nil {
+		return err
+	}
+
+	for i, constant := range c.Constants {
+		switch v := constant.(type) {
+		case nil:
+			return errors.New(fmt.Sprintf("constant %d is missing", i))
+		case *FunctionValue:
+			if v.Chunk == nil {
+				return errors.New(fmt.Sprintf("function %s has no chunk", v.Name))
+			}
+
+			if err := v.Chunk.Verify(); err != nil {
+				return errors.New(fmt.Sprintf("in function %s: %v", v.Name, err))
+			}
+		}
+	}
+
+	return nil
+}
+
+// verifyStack follow every path through the chunk, counting the values on the stack, to make sure no instruction pops
+// values which aren't there, paths meet with as many values on the stack, returns leave nothing beneath the value they
+// return and the chunk ends with nothing left. The instructions and their operands must already be verified.
+func (c *Chunk) verifyStack() error {
+	if len(c.Bytecode) == 0 {
+		return nil
+	}
+
+	// depths how many values are on the stack before each instruction, -1 for those not reached yet and -2 for
+	// operands, which can't be jumped to
+	depths := make([]int, len(c.Bytecode))
+	for i := 0; i < len(depths); i++ {
+		depths[i] = -1
+		for width := operands(c.Bytecode[i]).width(); width > 0; width-- {
+			i++
+			depths[i] = -2
+		}
+	}
+
+	depths[0] = 0
+	pending := []int{0}
+
+	for len(pending) > 0 {
+		at := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+
+		b := c.Bytecode[at]
+		depth := depths[at]
+
+		pops, pushes := c.effect(Pos(at))
+		if pops > depth {
+			return errors.New(fmt.Sprintf("%s at %d pops %d values, but there are %d", b, at, pops, depth))
+		}
+
+		depth += pushes - pops
+
+		// jumps are relative to the end of the instruction
+		next := at + 1 + operands(b).width()
+
+		var targets []int
+		switch b {
+		case InstructionReturn:
+			if depth != 0 {
+				return errors.New(fmt.Sprintf("%s at %d leaves %d values on the stack", b, at, depth))
+			}
+		case InstructionJump:
+			targets = []int{next + c.operand(Pos(at))}
+		case InstructionJumpFalse, InstructionJumpNil, InstructionIterate:
+			targets = []int{next, next + c.operand(Pos(at))}
+		case InstructionLoop:
+			targets = []int{next - c.operand(Pos(at))}
+		case InstructionForPrep:
+			targets = []int{next, next + c.operand(Pos(at))}
+		case InstructionForLoop:
+			targets = []int{next, next - c.operand(Pos(at))}
+		default:
+			targets = []int{next}
+		}
+
+		for _, target := range targets {
+			if target == len(c.Bytecode) {
+				if depth != 0 {
+					return errors.New(fmt.Sprintf("the chunk ends with %d values left on the stack", depth))
+				}
+
+				continue
+			}
+
+			if depths[target] == -2 {
+				return errors.New(fmt.Sprintf("%s at %d jumps into the operand of an instruction", b, at))
+			}
+
+			if depths[target] == -1 {
+				depths[target] = depth
+				pending = append(pending, target)
+			} else if depths[target] != depth {
+				return errors.New(fmt.Sprintf("%s at %d is reached with %d values on the stack from %d, but %d from elsewhere",
+					c.Bytecode[target], target, depth, at, depths[target]))
+			}
+		}
+	}
+
+	return nil
+}
+
+// isNameList whether a constant is a list of names, as destructuring needs
+func isNameList(v Value) bool {
+	list, ok := v.(*ListValue)
+	if !ok {
+		return false
+	}
+
+	for _, item := range list.items {
+		if _, ok := item.(*StringValue); !ok {
+			return false
+		}
+	}
+
+	return true
+}
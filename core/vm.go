@@ -1,12 +1,23 @@
 package core
 
 import (
-	"bytes"
-	"encoding/gob"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
 	"errors"
 	"fmt"
-	"log"
+	"io"
+	"math/big"
+	"net/url"
+	"os"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
+	"unicode"
 )
 
 type Pos int
@@ -43,7 +54,8 @@ const (
 
 	// InstructionAccessProperty gets a property from a value, and pops it onto the stack
 	InstructionAccessProperty
-	// InstructionCall pops a function object from the stack and begins execution of the chunk
+	// InstructionCall pops a function object from the stack and begins execution of the chunk. The next byte is the
+	// number of arguments on the stack, which must be as many as the function takes
 	InstructionCall
 
 	// InstructionDescend increase the scope depth
@@ -82,7 +94,8 @@ const (
 	// InstructionOr pop two booleans and push true if either are true
 	InstructionOr
 
-	// InstructionConstant Push a constant to the stack (2 bytes, second = constant index)
+	// InstructionConstant Push a constant to the stack (2 bytes, second = constant index). Lists and objects are
+	// pushed as copies, so the constant itself is never changed
 	InstructionConstant
 	// InstructionTrue Push a true literal to the stack
 	InstructionTrue
@@ -102,93 +115,116 @@ const (
 
 	// InstructionBreakpoint for debugging purposes
 	InstructionBreakpoint
+
+	// InstructionCast check that the top value on the stack is of the type named by the constant in the next byte,
+	// raising an error if it is not
+	InstructionCast
+
+	// InstructionImport make the values of the standard module, whose path is the constant in the next byte,
+	// available as globals
+	InstructionImport
+
+	// InstructionIndex pops an index and a value, pushing the item of the value at the index. Objects are indexed by
+	// their index method, everything else by its at method.
+	InstructionIndex
+
+	// InstructionBitwiseAnd pop two integers and push the bits set in both
+	InstructionBitwiseAnd
+	// InstructionBitwiseOr pop two integers and push the bits set in either
+	InstructionBitwiseOr
+	// InstructionBitwiseXor pop two integers and push the bits set in only one of them
+	InstructionBitwiseXor
+	// InstructionShiftLeft pop two integers and push the second shifted left by the first
+	InstructionShiftLeft
+	// InstructionShiftRight pop two integers and push the second shifted right by the first, keeping its sign
+	InstructionShiftRight
+	// InstructionDestructure pop a list and declare a variable for each of its items, named by the list of names
+	// which is the constant in the next byte. Names which are _ are not declared.
+	InstructionDestructure
+	// InstructionFormObject form keys and the values after each of them on the stack into an object. The 2 bytes
+	// after the instruction are the amount of keys and values.
+	InstructionFormObject
+	// InstructionJumpNil jump forwards by the value of the next two bytes as a u16 if the value on top of the stack is
+	// nil, leaving it on the stack either way
+	InstructionJumpNil
+	// InstructionDefer pop a function and its arguments, like InstructionCall, and keep them to call once the function
+	// being executed returns. The next byte is the number of arguments.
+	InstructionDefer
+	// InstructionForPrep begin a numeric for loop (for i := 0; i < n; i = i + 1), jumping past it if its counter isn't
+	// within the limit already. A limit which isn't a number is looked up once, and kept in the variable loopLimit. The
+	// next five bytes are the operands of the loop (see counterOperands), and the two after them the distance to jump
+	// forwards as a u16.
+	InstructionForPrep
+	// InstructionForLoop step the counter of a numeric for loop, looping back to its body while the counter is within
+	// the limit. The operands are those of InstructionForPrep, with the distance to jump backwards. The counter is the
+	// last variable declared, as the body has left its own by then.
+	InstructionForLoop
+	// InstructionClosure pop a function and push a closure of it, which keeps the variables of the functions enclosing
+	// it named by the list which is the constant in the next byte, so it can still refer to them once they return
+	InstructionClosure
+	// InstructionRange pop the end and the start of a range, pushing the range of the numbers from the start up to the
+	// end (start..end)
+	InstructionRange
+	// InstructionRangeInclusive as InstructionRange, but the range includes its end (start..=end)
+	InstructionRangeInclusive
+	// InstructionExtend pop a list or range and the list below it, appending its items to the list before pushing it
+	// back, as InstructionAppend does for a single item ([1, ...xs])
+	InstructionExtend
+	// InstructionCallSpread pop a function and the list below it, calling the function with the items of the list as
+	// its arguments, like InstructionCall (f(...args))
+	InstructionCallSpread
+	// InstructionIterate push the next item of the list or range a for-each loop goes through, which is the variable
+	// loopItems, where the variable loopIndex is at. Once there are none left, nil is pushed instead and the loop is
+	// left, jumping forwards by the value of the next two bytes as a u16.
+	InstructionIterate
+)
+
+// the variables a for-each loop keeps what it goes through and where it is at in, which programs can't refer to, as
+// their names aren't names of the language. Loops within loops declare their own, which hide those of the loops they
+// are in.
+const (
+	loopItems = "loop items"
+	loopIndex = "loop index"
 )
 
+// loopLimit the variable a numeric for loop whose limit isn't a number keeps it in, which stands for the variable the
+// limit is (see VariableValue.captured), or is the name of the global it is
+const loopLimit = "loop limit"
+
 func (b Bytecode) String() string {
-	switch b {
-	case InstructionReturn:
-		return "RETURN"
-	case InstructionPop:
-		return "POP"
-	case InstructionAdd:
-		return "ADD"
-	case InstructionSub:
-		return "SUB"
-	case InstructionMul:
-		return "MUL"
-	case InstructionDiv:
-		return "DIV"
-	case InstructionEquals:
-		return "EQUALS"
-	case InstructionNotEqual:
-		return "NOT_EQUALS"
-	case InstructionNot:
-		return "NOT"
-	case InstructionLess:
-		return "LESS"
-	case InstructionLessOrEqual:
-		return "LESS_OR_EQUAL"
-	case InstructionGreater:
-		return "GREATER_OR_EQUAL"
-	case InstructionGreaterOrEqual:
-		return "GREATER_OR_EQUAL"
-	case InstructionJump:
-		return "JUMP"
-	case InstructionJumpFalse:
-		return "JUMP_FALSE"
-	case InstructionLoop:
-		return "LOOP"
-	case InstructionConstant:
-		return "CONSTANT"
-	case InstructionTrue:
-		return "TRUE"
-	case InstructionFalse:
-		return "FALSE"
-	case InstructionNil:
-		return "NIL"
-	case InstructionGetLocal:
-		return "GET_LOCAL"
-	case InstructionDeclareLocal:
-		return "DECLARE_LOCAL"
-	case InstructionSetLocal:
-		return "SET_LOCAL"
-	case InstructionGetGlobal:
-		return "GET_GLOBAL"
-	case InstructionSetGlobal:
-		return "SET_GLOBAL"
-	case InstructionCall:
-		return "CALL"
-	case InstructionDescend:
-		return "DESCEND"
-	case InstructionAscend:
-		return "ASCEND"
-	case InstructionStringConversion:
-		return "STRING_CONVERSION"
-	case InstructionStringConcatenation:
-		return "STRING_CONCATENATION"
-	case InstructionSwap:
-		return "SWAP"
-	case InstructionAnd:
-		return "AND"
-	case InstructionOr:
-		return "OR"
-	case InstructionFormList:
-		return "FORM_LIST"
-	case InstructionBreakpoint:
-		return "BREAKPOINT"
-	case InstructionNewList:
-		return "NEW_LIST"
-	case InstructionAppend:
-		return "APPEND"
-	case InstructionAccessProperty:
-		return "ACCESS_PROPERTY"
+	if !b.valid() {
+		return "UNDEFINED"
 	}
-	return "UNDEFINED"
+
+	return opcodes[b].name
 }
 
 type Chunk struct {
 	Bytecode  []Bytecode
 	Constants []Value
+	// Lines the source line each byte of bytecode was compiled from
+	Lines []Pos
+	// Files the file each byte of bytecode was compiled from, when the program has code of files other than the
+	// source being compiled or the source was named (see Compiler.SetFileName). Bytes without one are of the source.
+	Files []string
+	// Decimal whether numbers are decimals rather than floats, so arithmetic is exact (0.1 + 0.2 == 0.3)
+	Decimal bool
+	// Strict whether the program was compiled in strict mode, see Compiler.SetStrict. Only the chunks of programs
+	// have it, not those of their functions.
+	Strict bool
+	// Exports the names the program declares at its top level, for programs importing its bytecode to be checked
+	// against. Only the chunks of programs have them, not those of their functions.
+	Exports []Export
+}
+
+// Export a name a program declares at its top level
+type Export struct {
+	Name string
+	// Global whether the name is declared as a global rather than a variable
+	Global bool
+	// Function whether the name is declared as a function, which takes Params
+	Function bool
+	Params   []string
 }
 
 func (c Chunk) String() string {
@@ -216,48 +252,48 @@ func (c Chunk) String() string {
 }
 
 func NewChunk(bytecode []Bytecode, constants []Value) *Chunk {
-	return &Chunk{bytecode, constants}
-}
-
-func RegisterGOBTypes() {
-	gob.Register(&StringValue{""})
-	gob.Register(&BoolValue{false})
-	gob.Register(&NumberValue{0})
-	gob.Register(&FunctionValue{
-		Name:   "",
-		Params: nil,
-		Chunk:  nil,
-	})
+	return &Chunk{bytecode, constants, nil, nil, false, false, nil}
 }
 
-func (c Chunk) Serialize() []byte {
-	b := bytes.Buffer{}
-
-	e := gob.NewEncoder(&b)
-
-	err := e.Encode(c)
-	if err != nil {
-		log.Fatal(err)
+// Line get the source line the instruction at ip was compiled from, or -1 if it is unknown
+func (c Chunk) Line(ip Pos) Pos {
+	if ip < 0 || int(ip) >= len(c.Lines) {
+		return -1
 	}
 
-	return b.Bytes()
+	return c.Lines[ip]
 }
 
-func DeserializeChunk(b []byte) *Chunk {
-	m := Chunk{}
-
-	buf := bytes.Buffer{}
-	buf.Write(b)
+// File get the file the instruction at ip was compiled from, or "" if it is of the source being compiled
+func (c Chunk) File(ip Pos) string {
+	if ip < 0 || int(ip) >= len(c.Files) {
+		return ""
+	}
 
-	d := gob.NewDecoder(&buf)
+	return c.Files[ip]
+}
 
-	err := d.Decode(&m)
+// ChunkSummary how much a chunk has, along with the chunks of the functions it declares
+type ChunkSummary struct {
+	Functions int `json:"functions"`
+	Constants int `json:"constants"`
+	// Bytecode the bytes of bytecode
+	Bytecode int `json:"bytecode"`
+}
 
-	if err != nil {
-		log.Fatal(err)
+// Summary count the functions, constants and bytes of bytecode of the chunk and the functions it declares
+func (c Chunk) Summary() ChunkSummary {
+	s := ChunkSummary{Constants: len(c.Constants), Bytecode: len(c.Bytecode)}
+	for _, ct := range c.Constants {
+		if f, ok := ct.(*FunctionValue); ok {
+			inner := f.Chunk.Summary()
+			s.Functions += 1 + inner.Functions
+			s.Constants += inner.Constants
+			s.Bytecode += inner.Bytecode
+		}
 	}
 
-	return &m
+	return s
 }
 
 type VM struct {
@@ -268,412 +304,1578 @@ type VM struct {
 	ip    Pos
 	scope Pos
 
-	// global variable storage
-	globals     map[string]Value
+	// global variable storage, in addition to the default globals
+	globals map[string]Value
+	// defaults the globals of the profile, which the program begins with (see SetProfile)
+	defaults    map[string]Value
 	variableEnd Pos
 
 	stack *Stack[Value]
 	call  *Stack[Call]
+
+	// breakpoint called when a breakpoint instruction is executed
+	breakpoint func(vm *VM)
+	// instructionHandler called before each instruction is executed, if set
+	instructionHandler func(vm *VM, chunk *Chunk, at Pos)
+
+	// instruction the position of the instruction being executed
+	instruction Pos
+	// err the error the execution stopped with, if any
+	err *ErrorValue
+
+	// imported values of the standard modules imported, available as globals
+	imported map[string]Value
+
+	// numberFormat how numbers are converted to strings by the program
+	numberFormat NumberFormat
+	// missingKeys what render does with keys the data of a template doesn't have
+	missingKeys MissingKeys
+
+	// handles the resources opened by the program, closed when the VM is
+	handles []*HandleValue
+
+	// timers the functions to call once they are due, see RunTimers
+	timers []*timer
+	// timerID the id of the last timer scheduled
+	timerID int
+
+	// caches the property caches of the instructions of each chunk, by the position of the instruction
+	caches map[*Chunk][]propertyCache
+	// globalCaches the global caches of each chunk, by the constant naming the global. The caches of the chunk last
+	// getting a global are kept aside, as chunks mostly get several globals in a row (such as in loops).
+	globalCaches  map[*Chunk][]globalCache
+	cachedChunk   *Chunk
+	cachedGlobals []globalCache
+	// globalsVersion changed whenever a global is set or imported, making the values cached for them out of date
+	globalsVersion uint64
+
+	// output where the program writes to, standard output unless set otherwise
+	output io.Writer
+}
+
+// propertyCache the member found the last time a property access instruction was executed, if it was found in the
+// prototype of the type of the value
+type propertyCache struct {
+	valueType ValueType
+	member    *BuiltinFunctionValue
+}
+
+// propertyCache get the property cache of the instruction being executed
+func (vm *VM) propertyCache() *propertyCache {
+	caches, ok := vm.caches[vm.chunk]
+	if !ok {
+		if vm.caches == nil {
+			vm.caches = make(map[*Chunk][]propertyCache)
+		}
+
+		caches = make([]propertyCache, len(vm.chunk.Bytecode))
+		vm.caches[vm.chunk] = caches
+	}
+
+	return &caches[vm.instruction]
+}
+
+// globalCache the value a global get instruction found the last time it was executed, while the globals were at the
+// version
+type globalCache struct {
+	value   Value
+	version uint64
+}
+
+// globalCache get the global cache of the constant naming a global in the chunk being executed
+func (vm *VM) globalCache(constant Bytecode) *globalCache {
+	if vm.cachedChunk != vm.chunk || int(constant) >= len(vm.cachedGlobals) {
+		caches, ok := vm.globalCaches[vm.chunk]
+		if !ok || int(constant) >= len(caches) {
+			if vm.globalCaches == nil {
+				vm.globalCaches = make(map[*Chunk][]globalCache)
+			}
+
+			caches = make([]globalCache, max(len(vm.chunk.Constants), int(constant)+1))
+			vm.globalCaches[vm.chunk] = caches
+		}
+
+		vm.cachedChunk, vm.cachedGlobals = vm.chunk, caches
+	}
+
+	return &vm.cachedGlobals[constant]
 }
 
 type Call struct {
-	chunk       *Chunk
-	ip          Pos
+	// function the name of the function called
+	function string
+	chunk    *Chunk
+	ip       Pos
+	// instruction where the function was called from, for traces
+	instruction Pos
 	stackEnd    Pos
 	variableEnd Pos
 	scope       Pos
+	// deferred the calls the function has deferred, which are made once it returns
+	deferred []deferredCall
+}
+
+// deferredCall a call kept until the function it was deferred in returns
+type deferredCall struct {
+	function Value
+	args     []Value
 }
 
-var DefaultGlobals = map[string]Value{
-	"write": &BuiltinFunctionValue{
+// DefaultBuiltins the builtins every VM has as globals. Like the prototypes and standard modules, they are shared by
+// every VM (which may run at the same time), so they are never changed; VMs get globals of their own with SetGlobal.
+var DefaultBuiltins = NewRegistry(
+	Builtin{
 		"write", // always remember where you come from...
-		[]string{"value"},
-		func(_ *VM, this Value, v map[string]Value) (Value, error) {
-			println(v["value"].String())
-			return nil, nil
+		Signature{[]string{"value"}},
+		false,
+		func(vm *VM, this Value, v map[string]Value) (Value, error) {
+			fmt.Fprintln(vm.output, vm.ToString(v["value"]))
+			return &NilValue{}, nil
 		},
-		nil,
 	},
-	"print": &BuiltinFunctionValue{
+	Builtin{
 		"print",
-		[]string{"value"},
-		func(_ *VM, this Value, v map[string]Value) (Value, error) {
-			print(v["value"].String())
-			return nil, nil
+		Signature{[]string{"value"}},
+		false,
+		func(vm *VM, this Value, v map[string]Value) (Value, error) {
+			fmt.Fprint(vm.output, vm.ToString(v["value"]))
+			return &NilValue{}, nil
 		},
-		nil,
 	},
-	"format": &BuiltinFunctionValue{
+	Builtin{
 		"format",
-		[]string{"format_string", "values"},
+		Signature{[]string{"format_string", "values"}},
+		true,
 		func(vm *VM, value Value, m map[string]Value) (Value, error) {
-			valuies := m["values"].(*ListValue).items
+			values, ok := m["values"].(*ListValue)
+			if !ok {
+				return nil, errors.New(fmt.Sprintf("format values must be a list, got %s", TypeOf(m["values"])))
+			}
 
-			return GoToValue(fmt.Sprintf(m["format_string"].String(), valuies)), nil
+			s, err := Format(m["format_string"].String(), values.items)
+			if err != nil {
+				return nil, err
+			}
+
+			return &StringValue{s}, nil
 		},
-		nil,
 	},
-	"assertEq": &BuiltinFunctionValue{
-		"assertEq",
-		[]string{"a", "b"},
+	Builtin{
+		"render",
+		Signature{[]string{"template", "data"}},
+		false,
 		func(vm *VM, this Value, params map[string]Value) (Value, error) {
-			a := params["a"]
-			b := params["b"]
+			template, ok := params["template"].(*StringValue)
+			if !ok {
+				return nil, errors.New(fmt.Sprintf("the template must be a string, got %s", TypeOf(params["template"])))
+			}
 
-			if !a.Equals(b) {
-				return nil, errors.New(fmt.Sprintf("assertion failed: %s does not equal %s", a, b))
+			s, err := vm.render(template.string, params["data"])
+			if err != nil {
+				return nil, err
 			}
 
-			return &NilValue{}, nil
+			return &StringValue{s}, nil
 		},
-		nil,
 	},
-	"assertNotEq": &BuiltinFunctionValue{
-		"assertNotEq",
-		[]string{"a", "b"},
+	Builtin{
+		"urlParse",
+		Signature{[]string{"url"}},
+		true,
 		func(vm *VM, this Value, params map[string]Value) (Value, error) {
-			a := params["a"]
-			b := params["b"]
+			s, ok := params["url"].(*StringValue)
+			if !ok {
+				return nil, errors.New(fmt.Sprintf("the url must be a string, got %s", TypeOf(params["url"])))
+			}
 
-			if a.Equals(b) {
-				return nil, errors.New(fmt.Sprintf("assertion failed: %s does not equal %s", a, b))
+			u, err := url.Parse(s.string)
+			if err != nil {
+				return nil, errors.New(fmt.Sprintf("invalid url %s: %v", s.string, errors.Unwrap(err)))
 			}
 
-			return &NilValue{}, nil
+			return urlObject(u), nil
 		},
-		nil,
 	},
-}
-
-func NewVM(chunk *Chunk, stackSize Pos, callstackSize Pos) *VM {
-	vm := &VM{
-		chunk: chunk,
-		stack: NewStack[Value](stackSize),
-		call:  NewStack[Call](callstackSize),
-
-		globals: DefaultGlobals,
-	}
-
-	return vm
-}
+	Builtin{
+		"urlEncode",
+		Signature{[]string{"text"}},
+		true,
+		func(vm *VM, this Value, params map[string]Value) (Value, error) {
+			s, ok := params["text"].(*StringValue)
+			if !ok {
+				return nil, errors.New(fmt.Sprintf("can only encode strings, got %s", TypeOf(params["text"])))
+			}
 
-// Next execute instruction
-// returns true if more instructions should be executed
-func (vm *VM) Next() bool {
-	if !vm.HasNext() {
-		return false
-	}
+			return &StringValue{url.QueryEscape(s.string)}, nil
+		},
+	},
+	Builtin{
+		"urlDecode",
+		Signature{[]string{"text"}},
+		true,
+		func(vm *VM, this Value, params map[string]Value) (Value, error) {
+			s, ok := params["text"].(*StringValue)
+			if !ok {
+				return nil, errors.New(fmt.Sprintf("can only decode strings, got %s", TypeOf(params["text"])))
+			}
 
-	switch vm.NextByte() {
-	case InstructionReturn:
-		if vm.call.Current == 0 {
-			return false
-		} else {
-			v := vm.stack.Pop()
-			c := vm.call.Pop()
+			decoded, err := url.QueryUnescape(s.string)
+			if err != nil {
+				return nil, errors.New(fmt.Sprintf("cannot decode %s: %v", s.string, err))
+			}
 
-			// reset stack current and variable end and scope
-			vm.variableEnd = c.variableEnd
-			vm.stack.Current = c.stackEnd
-			vm.scope = c.scope
+			return &StringValue{decoded}, nil
+		},
+	},
+	Builtin{
+		"parseQuery",
+		Signature{[]string{"query"}},
+		true,
+		func(vm *VM, this Value, params map[string]Value) (Value, error) {
+			s, ok := params["query"].(*StringValue)
+			if !ok {
+				return nil, errors.New(fmt.Sprintf("the query must be a string, got %s", TypeOf(params["query"])))
+			}
 
-			// reset to calling position
-			vm.ip = c.ip
-			vm.chunk = c.chunk
+			values, err := url.ParseQuery(strings.TrimPrefix(s.string, "?"))
+			if err != nil {
+				return nil, errors.New(fmt.Sprintf("invalid query %s: %v", s.string, err))
+			}
 
-			vm.purgeVars()
+			return queryObject(values), nil
+		},
+	},
+	Builtin{
+		"queryString",
+		Signature{[]string{"parameters"}},
+		false,
+		func(vm *VM, this Value, params map[string]Value) (Value, error) {
+			object, ok := params["parameters"].(*ObjectValue)
+			if !ok {
+				return nil, errors.New(fmt.Sprintf("the parameters must be an object, got %s", TypeOf(params["parameters"])))
+			}
 
-			vm.stack.Push(v)
-		}
+			s, err := vm.queryString(object)
+			if err != nil {
+				return nil, err
+			}
 
-	case InstructionPop:
-		vm.stack.Pop()
+			return &StringValue{s}, nil
+		},
+	},
+	Builtin{
+		"match",
+		Signature{[]string{"text", "pattern"}},
+		true,
+		func(vm *VM, this Value, params map[string]Value) (Value, error) {
+			text, ok := params["text"].(*StringValue)
+			if !ok {
+				return nil, errors.New(fmt.Sprintf("can only match strings, got %s", TypeOf(params["text"])))
+			}
 
-	case InstructionConstant:
-		vm.stack.Push(vm.ReadConstant())
+			pattern, ok := params["pattern"].(*StringValue)
+			if !ok {
+				return nil, errors.New(fmt.Sprintf("the pattern must be a string, got %s", TypeOf(params["pattern"])))
+			}
 
-	case InstructionAdd:
-		r := vm.stack.Pop().(*NumberValue).float64
-		l := vm.stack.Pop().(*NumberValue).float64
+			re, err := regexp.Compile(pattern.string)
+			if err != nil {
+				return nil, errors.New(fmt.Sprintf("invalid pattern %q: %v", pattern.string, err))
+			}
 
-		vm.stack.Push(&NumberValue{l + r})
+			// the whole match, then each group, which is nil if it matched nothing
+			indices := re.FindStringSubmatchIndex(text.string)
+			if indices == nil {
+				return &NilValue{}, nil
+			}
 
-	case InstructionSub:
-		r := vm.stack.Pop().(*NumberValue).float64
-		l := vm.stack.Pop().(*NumberValue).float64
+			groups := make([]Value, len(indices)/2)
+			for i := range groups {
+				if start, end := indices[2*i], indices[2*i+1]; start >= 0 {
+					groups[i] = &StringValue{text.string[start:end]}
+				} else {
+					groups[i] = &NilValue{}
+				}
+			}
 
-		vm.stack.Push(&NumberValue{l - r})
+			return &ListValue{groups, false, false}, nil
+		},
+	},
+	Builtin{
+		"typeof",
+		Signature{[]string{"value"}},
+		true,
+		func(vm *VM, this Value, params map[string]Value) (Value, error) {
+			return &StringValue{TypeOf(params["value"])}, nil
+		},
+	},
+	Builtin{
+		"deepEquals",
+		Signature{[]string{"a", "b"}},
+		true,
+		func(vm *VM, this Value, params map[string]Value) (Value, error) {
+			return &BoolValue{params["a"].Equals(params["b"])}, nil
+		},
+	},
+	Builtin{
+		"same",
+		Signature{[]string{"a", "b"}},
+		false,
+		func(vm *VM, this Value, params map[string]Value) (Value, error) {
+			return &BoolValue{Same(params["a"], params["b"])}, nil
+		},
+	},
+	Builtin{
+		"clone",
+		Signature{[]string{"value"}},
+		false,
+		func(vm *VM, this Value, params map[string]Value) (Value, error) {
+			return Clone(params["value"]), nil
+		},
+	},
+	Builtin{
+		"freeze",
+		Signature{[]string{"value"}},
+		false,
+		func(vm *VM, this Value, params map[string]Value) (Value, error) {
+			return Freeze(params["value"]), nil
+		},
+	},
+	Builtin{
+		"isFrozen",
+		Signature{[]string{"value"}},
+		false,
+		func(vm *VM, this Value, params map[string]Value) (Value, error) {
+			return &BoolValue{IsFrozen(params["value"])}, nil
+		},
+	},
+	Builtin{
+		"newBuilder",
+		Signature{[]string{}},
+		false,
+		func(vm *VM, this Value, params map[string]Value) (Value, error) {
+			return &BuilderValue{&strings.Builder{}}, nil
+		},
+	},
+	Builtin{
+		"newObject",
+		Signature{[]string{}},
+		false,
+		func(vm *VM, this Value, params map[string]Value) (Value, error) {
+			return NewObject(map[string]Value{}), nil
+		},
+	},
+	Builtin{
+		"newDeque",
+		Signature{[]string{"items"}},
+		false,
+		func(vm *VM, this Value, params map[string]Value) (Value, error) {
+			switch items := params["items"].(type) {
+			case *NilValue:
+				return NewDeque(nil), nil
+			case *ListValue:
+				items.own()
+				return NewDeque(items.items), nil
+			}
 
-	case InstructionMul:
-		r := vm.stack.Pop().(*NumberValue).float64
-		l := vm.stack.Pop().(*NumberValue).float64
+			return nil, errors.New(fmt.Sprintf("cannot make a deque from %s", params["items"].DebugString()))
+		},
+	},
+	Builtin{
+		"newSet",
+		Signature{[]string{"items"}},
+		false,
+		func(vm *VM, this Value, params map[string]Value) (Value, error) {
+			switch items := params["items"].(type) {
+			case *NilValue:
+				return NewSet(nil), nil
+			case *ListValue:
+				return NewSet(items.items), nil
+			}
 
-		vm.stack.Push(&NumberValue{l * r})
+			return nil, errors.New(fmt.Sprintf("cannot make a set from %s", params["items"].DebugString()))
+		},
+	},
+	Builtin{
+		"newDict",
+		Signature{[]string{"entries"}},
+		false,
+		func(vm *VM, this Value, params map[string]Value) (Value, error) {
+			dict := NewDict()
+
+			switch entries := params["entries"].(type) {
+			case *NilValue:
+				return dict, nil
+			case *ObjectValue:
+				// added in order of their names, as the members of objects have no order
+				keys := make([]string, 0, len(entries.members))
+				for key := range entries.members {
+					keys = append(keys, key)
+				}
 
-	case InstructionDiv:
-		r := vm.stack.Pop().(*NumberValue).float64
-		l := vm.stack.Pop().(*NumberValue).float64
+				sort.Strings(keys)
 
-		vm.stack.Push(&NumberValue{l / r})
+				for _, key := range keys {
+					dict.Set(&StringValue{key}, entries.members[key])
+				}
 
-	case InstructionEquals:
-		vm.stack.Push(
-			&BoolValue{vm.stack.Pop().Equals(vm.stack.Pop())},
-		)
+				return dict, nil
+			case *ListValue:
+				// a list of [key, value] pairs
+				for _, entry := range entries.items {
+					pair, ok := entry.(*ListValue)
+					if !ok || len(pair.items) != 2 {
+						return nil, errors.New(fmt.Sprintf("entries of a dict must be [key, value] pairs, got %s", entry.DebugString()))
+					}
 
-	case InstructionNotEqual:
-		vm.stack.Push(
-			&BoolValue{!vm.stack.Pop().Equals(vm.stack.Pop())},
-		)
+					dict.Set(pair.items[0], pair.items[1])
+				}
 
-	case InstructionNot:
-		b := vm.stack.Pop().(*BoolValue).bool
-		vm.stack.Push(&BoolValue{!b})
+				return dict, nil
+			}
 
-	case InstructionAnd:
-		r := vm.stack.Pop().(*BoolValue).bool
-		l := vm.stack.Pop().(*BoolValue).bool
-		vm.stack.Push(&BoolValue{l && r})
+			return nil, errors.New(fmt.Sprintf("cannot make a dict from %s", params["entries"].DebugString()))
+		},
+	},
+	Builtin{
+		"bytes",
+		Signature{[]string{"value"}},
+		false,
+		func(vm *VM, this Value, params map[string]Value) (Value, error) {
+			switch v := params["value"].(type) {
+			case *BytesValue:
+				return v, nil
+			case *StringValue:
+				return NewBytes([]byte(v.string)), nil
+			case *ListValue:
+				bytes := make([]byte, len(v.items))
+				for i, item := range v.items {
+					n, ok := item.(*NumberValue)
+					if !ok || n.float64 < 0 || n.float64 > 255 || n.float64 != float64(int(n.float64)) {
+						return nil, errors.New(fmt.Sprintf("item %d is not a byte: %s", i, item.DebugString()))
+					}
+
+					bytes[i] = byte(n.float64)
+				}
 
-	case InstructionOr:
-		r := vm.stack.Pop().(*BoolValue).bool
-		l := vm.stack.Pop().(*BoolValue).bool
-		vm.stack.Push(&BoolValue{l || r})
+				return NewBytes(bytes), nil
+			}
 
-	case InstructionLess:
-		r := vm.stack.Pop().(*NumberValue).float64
-		l := vm.stack.Pop().(*NumberValue).float64
+			return nil, errors.New(fmt.Sprintf("cannot make bytes from %s", params["value"].DebugString()))
+		},
+	},
+	Builtin{
+		"fromBase64",
+		Signature{[]string{"string"}},
+		false,
+		func(vm *VM, this Value, params map[string]Value) (Value, error) {
+			s, ok := params["string"].(*StringValue)
+			if !ok {
+				return nil, errors.New(fmt.Sprintf("can only decode strings, got %s", TypeOf(params["string"])))
+			}
 
-		vm.stack.Push(&BoolValue{l < r})
+			bytes, err := base64.StdEncoding.DecodeString(s.string)
+			if err != nil {
+				return nil, errors.New(fmt.Sprintf("invalid base64: %v", err))
+			}
 
-	case InstructionLessOrEqual:
-		r := vm.stack.Pop().(*NumberValue).float64
-		l := vm.stack.Pop().(*NumberValue).float64
+			return NewBytes(bytes), nil
+		},
+	},
+	Builtin{
+		"fromHex",
+		Signature{[]string{"string"}},
+		false,
+		func(vm *VM, this Value, params map[string]Value) (Value, error) {
+			s, ok := params["string"].(*StringValue)
+			if !ok {
+				return nil, errors.New(fmt.Sprintf("can only decode strings, got %s", TypeOf(params["string"])))
+			}
 
-		vm.stack.Push(&BoolValue{l <= r})
+			bytes, err := hex.DecodeString(s.string)
+			if err != nil {
+				return nil, errors.New(fmt.Sprintf("invalid hex: %v", err))
+			}
 
-	case InstructionGreater:
-		r := vm.stack.Pop().(*NumberValue).float64
-		l := vm.stack.Pop().(*NumberValue).float64
+			return NewBytes(bytes), nil
+		},
+	},
+	Builtin{
+		"randomBytes",
+		Signature{[]string{"n"}},
+		false,
+		func(vm *VM, this Value, params map[string]Value) (Value, error) {
+			n, ok := params["n"].(*NumberValue)
+			if !ok || n.float64 < 0 || n.float64 != float64(int(n.float64)) {
+				return nil, errors.New(fmt.Sprintf("the number of bytes must be an integer of at least 0, got %s", params["n"].DebugString()))
+			}
 
-		vm.stack.Push(&BoolValue{l > r})
+			// from the random source of the system, so they can be used for tokens and keys
+			bytes := make([]byte, int(n.float64))
+			if _, err := rand.Read(bytes); err != nil {
+				return nil, errors.New(fmt.Sprintf("could not read random bytes: %v", err))
+			}
 
-	case InstructionGreaterOrEqual:
-		r := vm.stack.Pop().(*NumberValue).float64
-		l := vm.stack.Pop().(*NumberValue).float64
+			return NewBytes(bytes), nil
+		},
+	},
+	Builtin{
+		"randomUUID",
+		Signature{[]string{}},
+		false,
+		func(vm *VM, this Value, params map[string]Value) (Value, error) {
+			b := make([]byte, 16)
+			if _, err := rand.Read(b); err != nil {
+				return nil, errors.New(fmt.Sprintf("could not read random bytes: %v", err))
+			}
 
-		vm.stack.Push(&BoolValue{l >= r})
+			// version 4, variant 10
+			b[6] = b[6]&0x0f | 0x40
+			b[8] = b[8]&0x3f | 0x80
 
-	case InstructionCall:
-		v := vm.stack.Pop()
-		switch f := v.(type) {
-		case *FunctionValue:
-			vm.call.Push(Call{
-				chunk:       vm.chunk,
-				ip:          vm.ip,
-				stackEnd:    vm.stack.Current - Pos(len(f.Params)),
-				variableEnd: vm.variableEnd,
-				scope:       vm.scope,
-			})
-
-			for i := len(f.Params) - 1; i >= 0; i-- {
-				p := vm.stack.Current - Pos(len(f.Params)) + Pos(i)
-				vm.stack.items[p] = &VariableValue{
-					f.Params[i],
-					vm.stack.items[p],
-					vm.scope,
+			return &StringValue{fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])}, nil
+		},
+	},
+	Builtin{
+		"secureEquals",
+		Signature{[]string{"a", "b"}},
+		true,
+		func(vm *VM, this Value, params map[string]Value) (Value, error) {
+			var sides [2][]byte
+			for i, name := range []string{"a", "b"} {
+				switch v := params[name].(type) {
+				case *StringValue:
+					sides[i] = []byte(v.string)
+				case *BytesValue:
+					sides[i] = v.bytes
+				default:
+					return nil, errors.New(fmt.Sprintf("can only compare strings and bytes, got %s", TypeOf(v)))
 				}
 			}
 
-			if f.Parent != nil {
-				vm.addVar("this", f.Parent)
+			// takes as long whichever byte they differ at, so the time doesn't give away how much of a secret was guessed
+			return &BoolValue{subtle.ConstantTimeCompare(sides[0], sides[1]) == 1}, nil
+		},
+	},
+	Builtin{
+		"now",
+		Signature{[]string{}},
+		false,
+		func(vm *VM, this Value, params map[string]Value) (Value, error) {
+			return NewDate(time.Now()), nil
+		},
+	},
+	Builtin{
+		"parseDate",
+		Signature{[]string{"string"}},
+		false,
+		func(vm *VM, this Value, params map[string]Value) (Value, error) {
+			s, ok := params["string"].(*StringValue)
+			if !ok {
+				return nil, errors.New(fmt.Sprintf("can only parse dates from strings, got %s", TypeOf(params["string"])))
 			}
 
-			vm.variableEnd = vm.stack.Current
-
-			vm.chunk = f.Chunk
-			vm.ip = 0
-		case *BuiltinFunctionValue:
-			args := map[string]Value{}
+			t, err := time.Parse(time.RFC3339Nano, s.string)
+			if err != nil {
+				return nil, errors.New(fmt.Sprintf("invalid date %s, expected a date such as 2006-01-02T15:04:05Z", s.DebugString()))
+			}
 
-			for i := len(f.Parameters) - 1; i >= 0; i-- {
-				args[f.Parameters[i]] = vm.stack.Pop()
+			return NewDate(t), nil
+		},
+	},
+	Builtin{
+		"parseDuration",
+		Signature{[]string{"string"}},
+		false,
+		func(vm *VM, this Value, params map[string]Value) (Value, error) {
+			s, ok := params["string"].(*StringValue)
+			if !ok {
+				return nil, errors.New(fmt.Sprintf("can only parse durations from strings, got %s", TypeOf(params["string"])))
 			}
 
-			v, err := f.F(vm, f.Parent, args)
+			d, err := time.ParseDuration(s.string)
 			if err != nil {
-				vm.error(err.Error())
+				return nil, errors.New(fmt.Sprintf("invalid duration %s, expected a duration such as 1h30m", s.DebugString()))
 			}
 
-			vm.stack.Push(v)
-		default:
-			vm.error(fmt.Sprintf("value called is not a function (%s, type %T)", v.DebugString(), v))
-			return false
-		}
+			return NewDuration(d), nil
+		},
+	},
+	Builtin{
+		"seconds",
+		Signature{[]string{"seconds"}},
+		false,
+		func(vm *VM, this Value, params map[string]Value) (Value, error) {
+			n, ok := params["seconds"].(*NumberValue)
+			if !ok {
+				return nil, errors.New(fmt.Sprintf("seconds must be a number, got %s", TypeOf(params["seconds"])))
+			}
 
-	case InstructionJump:
-		vm.ip += Pos(vm.NextU16())
+			return NewDuration(time.Duration(n.float64 * float64(time.Second))), nil
+		},
+	},
+	Builtin{
+		"parseInt",
+		Signature{[]string{"string", "base"}},
+		true,
+		func(vm *VM, this Value, params map[string]Value) (Value, error) {
+			base, ok := params["base"].(*NumberValue)
+			if !ok {
+				return NewError("base must be a number", nil, vm.Trace()), nil
+			}
 
-	case InstructionLoop:
-		vm.ip -= Pos(vm.NextU16())
+			// a base of 0 is taken from the prefix of the string (0x, 0o, 0b)
+			n, err := strconv.ParseInt(params["string"].String(), int(base.float64), 64)
+			if err != nil {
+				return NewError(fmt.Sprintf("cannot parse integer: %v", err), nil, vm.Trace()), nil
+			}
+
+			return &NumberValue{float64(n), nil}, nil
+		},
+	},
+	Builtin{
+		"bigint",
+		Signature{[]string{"value"}},
+		true,
+		func(vm *VM, this Value, params map[string]Value) (Value, error) {
+			switch v := params["value"].(type) {
+			case *BigIntValue:
+				return v, nil
+			case *NumberValue:
+				if n, ok := v.toBigInt(); ok {
+					return &BigIntValue{n}, nil
+				}
+			case *StringValue:
+				// a base of 0 is taken from the prefix of the string (0x, 0o, 0b)
+				if n, ok := new(big.Int).SetString(v.string, 0); ok {
+					return &BigIntValue{n}, nil
+				}
+			}
+
+			return NewError(fmt.Sprintf("cannot make a bigint of %s", params["value"].DebugString()), nil, vm.Trace()), nil
+		},
+	},
+	Builtin{
+		"parseFloat",
+		Signature{[]string{"string"}},
+		true,
+		func(vm *VM, this Value, params map[string]Value) (Value, error) {
+			n, err := strconv.ParseFloat(params["string"].String(), NumberSize)
+			if err != nil {
+				return NewError(fmt.Sprintf("cannot parse number: %v", err), nil, vm.Trace()), nil
+			}
+
+			return &NumberValue{n, nil}, nil
+		},
+	},
+	Builtin{
+		"formatNumber",
+		Signature{[]string{"number", "base", "precision"}},
+		true,
+		func(vm *VM, this Value, params map[string]Value) (Value, error) {
+			n, nOk := params["number"].(*NumberValue)
+			base, baseOk := params["base"].(*NumberValue)
+			precision, precisionOk := params["precision"].(*NumberValue)
+			if !nOk || !baseOk || !precisionOk {
+				return NewError("formatNumber expects numbers", nil, vm.Trace()), nil
+			}
+
+			s, err := FormatNumber(n.float64, int(base.float64), int(precision.float64))
+			if err != nil {
+				return NewError(err.Error(), nil, vm.Trace()), nil
+			}
+
+			return &StringValue{s}, nil
+		},
+	},
+	Builtin{
+		"fromCharCode",
+		Signature{[]string{"code"}},
+		true,
+		func(vm *VM, this Value, params map[string]Value) (Value, error) {
+			code, ok := params["code"].(*NumberValue)
+			if !ok || code.float64 < 0 || code.float64 > unicode.MaxRune || code.float64 != float64(int(code.float64)) {
+				return nil, errors.New(fmt.Sprintf("invalid character code %s", params["code"].DebugString()))
+			}
+
+			return &StringValue{string(rune(code.float64))}, nil
+		},
+	},
+	Builtin{
+		"error",
+		Signature{[]string{"message"}},
+		false,
+		func(vm *VM, this Value, params map[string]Value) (Value, error) {
+			return NewError(params["message"].String(), nil, vm.Trace()), nil
+		},
+	},
+	Builtin{
+		"wrapError",
+		Signature{[]string{"cause", "message"}},
+		false,
+		func(vm *VM, this Value, params map[string]Value) (Value, error) {
+			cause, ok := params["cause"].(*ErrorValue)
+			if !ok {
+				cause = NewError(params["cause"].String(), nil, nil)
+			}
+
+			return NewError(params["message"].String(), cause, vm.Trace()), nil
+		},
+	},
+	Builtin{
+		"throw",
+		Signature{[]string{"error"}},
+		false,
+		func(vm *VM, this Value, params map[string]Value) (Value, error) {
+			if e, ok := params["error"].(*ErrorValue); ok {
+				return nil, e
+			}
+
+			return nil, errors.New(params["error"].String())
+		},
+	},
+)
+
+// DefaultGlobals the values of the default builtins, by name
+var DefaultGlobals = DefaultBuiltins.Values()
+
+func NewVM(chunk *Chunk, stackSize Pos, callstackSize Pos) *VM {
+	vm := &VM{
+		chunk: chunk,
+		stack: NewStack[Value](stackSize),
+		// most programs make few calls at once, so the call stack only makes room for them as they are made
+		call: newLazyStack[Call](callstackSize),
+
+		defaults: DefaultGlobals,
+
+		numberFormat: DefaultNumberFormat,
+
+		output: os.Stdout,
+	}
+
+	return vm
+}
+
+// stackHeadroom how many values an instruction may push onto the stack at most, which there is always room for as
+// an instruction begins. Instructions pushing more make room for them themselves.
+const stackHeadroom = 4
+
+// Next execute instruction
+// returns true if more instructions should be executed
+func (vm *VM) Next() bool {
+	if !vm.HasNext() || vm.err != nil {
+		return false
+	}
+
+	if Pos(len(vm.stack.items))-vm.stack.Current < stackHeadroom && !vm.stack.reserve(stackHeadroom) {
+		vm.error("stack overflow")
+		return false
+	}
+
+	vm.instruction = vm.ip
+
+	if vm.instructionHandler != nil {
+		vm.instructionHandler(vm, vm.chunk, vm.ip)
+	}
+
+	switch vm.NextByte() {
+	case InstructionReturn:
+		if vm.call.Current == 0 {
+			return false
+		} else {
+			v := vm.stack.Pop()
+			if vm.call.items[vm.call.Current-1].deferred != nil && !vm.runDeferred() {
+				return false
+			}
+
+			c := vm.call.Pop()
+
+			// reset stack current and variable end and scope
+			vm.variableEnd = c.variableEnd
+			vm.stack.Current = c.stackEnd
+			vm.scope = c.scope
+
+			// reset to calling position
+			vm.ip = c.ip
+			vm.chunk = c.chunk
+
+			vm.purgeVars()
+
+			vm.stack.Push(v)
+		}
+
+	case InstructionPop:
+		vm.stack.Pop()
+
+	case InstructionConstant:
+		v := vm.ReadConstant()
+
+		// a constant list is pushed each time its literal is evaluated, and each time it must be a new list, which
+		// shares the items of the constant until it is changed
+		vm.stack.Push(share(v))
+
+	case InstructionAdd, InstructionSub, InstructionMul, InstructionDiv,
+		InstructionLess, InstructionLessOrEqual, InstructionGreater, InstructionGreaterOrEqual,
+		InstructionEquals, InstructionNotEqual, InstructionAnd, InstructionOr, InstructionBitwiseAnd,
+		InstructionBitwiseOr, InstructionBitwiseXor, InstructionShiftLeft, InstructionShiftRight:
+		r := vm.stack.Pop()
+		l := vm.stack.Pop()
+		op := vm.chunk.Bytecode[vm.instruction]
+
+		// numbers of programs in decimal mode are made decimals first
+		if !vm.chunk.Decimal {
+			if result := numberOperation(op, l, r); result != nil {
+				vm.stack.Push(result)
+				break
+			}
+		}
+
+		result, err := vm.binaryOperation(op, l, r)
+		if err != nil {
+			vm.fail(err)
+			return false
+		}
+
+		vm.stack.Push(result)
+
+	case InstructionForPrep:
+		loop := vm.chunk.counterOperands(vm.instruction)
+		vm.ip += 5
+		n := vm.NextU16()
+
+		counter := vm.counter(loop)
+		if counter == nil {
+			return false
+		}
+
+		// limits which aren't numbers are variables, which are looked up as InstructionGetLocal does, but only once. It
+		// is kept in loopLimit, which is put below the counter so the body finds the counter as quickly.
+		if name, ok := vm.GetConstant(loop.limit).(*StringValue); ok {
+			v := vm.getVar(name.string)
+			if v == nil && vm.GetGlobal(name.string) == nil {
+				vm.error(fmt.Sprintf("undefined global '%s'", name.string))
+				return false
+			}
+
+			vm.addVar(loopLimit, name)
+			vm.stack.Peek().(*VariableValue).captured = v
+
+			items := vm.stack.items
+			items[vm.variableEnd-2], items[vm.variableEnd-1] = items[vm.variableEnd-1], items[vm.variableEnd-2]
+		}
+
+		within, ok := vm.counterWithin(loop, counter)
+		if !ok {
+			return false
+		}
+
+		if !within {
+			vm.ip += Pos(n)
+		}
+
+	case InstructionForLoop:
+		loop := vm.chunk.counterOperands(vm.instruction)
+		vm.ip += 5
+		n := vm.NextU16()
+
+		counter := vm.counter(loop)
+		if counter == nil {
+			return false
+		}
+
+		v, err := vm.counterOperation(loop.operation, counter.value, vm.GetConstant(loop.step))
+		if err != nil {
+			vm.fail(err)
+			return false
+		}
+		counter.value = v
+
+		within, ok := vm.counterWithin(loop, counter)
+		if !ok {
+			return false
+		}
+
+		if within {
+			vm.ip -= Pos(n)
+		}
+
+	case InstructionIterate:
+		n := vm.NextU16()
+
+		items, at := vm.getVar(loopItems), vm.getVar(loopIndex)
+		if items == nil || at == nil {
+			vm.error("cannot iterate outside of a for loop")
+			return false
+		}
+
+		index, ok := at.value.(*NumberValue)
+		if !ok {
+			vm.error(fmt.Sprintf("the index of a loop must be a number, got %s", TypeOf(at.value)))
+			return false
+		}
+
+		i := int(index.float64)
+		var item Value
+		switch v := items.value.(type) {
+		case *ListValue:
+			if i < len(v.items) {
+				item = share(v.items[i])
+			}
+		case *RangeValue:
+			if i < v.Len() {
+				item = v.At(i)
+			}
+		default:
+			vm.error(fmt.Sprintf("cannot go through %s, only lists and ranges", TypeOf(items.value)))
+			return false
+		}
+
+		if item == nil {
+			vm.stack.Push(&NilValue{})
+			vm.ip += Pos(n)
+			break
+		}
+
+		at.value = number(float64(i + 1))
+		vm.stack.Push(item)
+
+	case InstructionClosure:
+		v := vm.stack.Pop()
+		function, ok := v.(*FunctionValue)
+		if !ok {
+			vm.error(fmt.Sprintf("cannot make a closure of %s, as it isn't a function", TypeOf(v)))
+			return false
+		}
+
+		f := *function
+		names := vm.ReadConstant().(*ListValue).items
+
+		// variables which aren't declared (yet) are looked up when the closure is called, as any other
+		f.captured = make([]*VariableValue, 0, len(names))
+		for _, name := range names {
+			if v := vm.getVar(name.(*StringValue).string); v != nil {
+				f.captured = append(f.captured, v)
+			}
+		}
+
+		vm.stack.Push(&f)
+
+	case InstructionRange, InstructionRangeInclusive:
+		end := vm.stack.Pop()
+		start := vm.stack.Pop()
+
+		r, err := makeRange(start, end, vm.chunk.Bytecode[vm.instruction] == InstructionRangeInclusive)
+		if err != nil {
+			vm.fail(err)
+			return false
+		}
+
+		vm.stack.Push(r)
+
+	case InstructionNot:
+		v := vm.stack.Pop()
+		b, ok := v.(*BoolValue)
+		if !ok {
+			vm.error(fmt.Sprintf("cannot negate %s, as only bools can be negated", TypeOf(v)))
+			return false
+		}
+
+		vm.stack.Push(&BoolValue{!b.bool})
+
+	case InstructionCall:
+		args := int(vm.NextByte())
+		if !vm.callValue(vm.stack.Pop(), args) {
+			return false
+		}
+
+	case InstructionCallSpread:
+		f := vm.stack.Pop()
+		v := vm.stack.Pop()
+		list, ok := v.(*ListValue)
+		if !ok {
+			vm.error(fmt.Sprintf("the arguments of a call must be a list, got %s", TypeOf(v)))
+			return false
+		}
+
+		args := list.items
+		if !vm.stack.reserve(Pos(len(args)) + stackHeadroom) {
+			vm.error("stack overflow")
+			return false
+		}
+
+		vm.stack.Push(args...)
+		if !vm.callValue(f, len(args)) {
+			return false
+		}
+
+	case InstructionDefer:
+		args := make([]Value, vm.NextByte())
+		f := vm.stack.Pop()
+		for i := len(args) - 1; i >= 0; i-- {
+			args[i] = vm.stack.Pop()
+		}
+
+		if vm.call.Current == 0 {
+			vm.error("calls can only be deferred within functions")
+			return false
+		}
+
+		// the call is checked now, as the function is called by the time it would fail
+		callee := f
+		if b, ok := callee.(*BoundFunctionValue); ok {
+			callee = b.Function
+		}
+
+		var err error
+		switch callee := callee.(type) {
+		case *FunctionValue:
+			err = (Signature{callee.Params}).Check(callee.Name, len(args))
+		case *BuiltinFunctionValue:
+			err = (Signature{callee.Parameters}).Check(callee.Name, len(args))
+		default:
+			err = errors.New(fmt.Sprintf("value deferred is not a function (%s, type %T)", f.DebugString(), f))
+		}
+
+		if err != nil {
+			vm.fail(err)
+			return false
+		}
+
+		frame := &vm.call.items[vm.call.Current-1]
+		frame.deferred = append(frame.deferred, deferredCall{f, args})
+
+	case InstructionJump:
+		vm.ip += Pos(vm.NextU16())
+
+	case InstructionLoop:
+		vm.ip -= Pos(vm.NextU16())
+
+	case InstructionJumpNil:
+		n := vm.NextU16()
+		if vm.stack.Peek().Type() == NilValueType {
+			vm.ip += Pos(n)
+		}
 
 	case InstructionJumpFalse:
 		n := vm.NextU16()
-		if !vm.stack.Pop().(*BoolValue).bool {
+		v := vm.stack.Pop()
+		b, ok := v.(*BoolValue)
+		if !ok {
+			vm.error(fmt.Sprintf("condition must be a bool, got %s", TypeOf(v)))
+			return false
+		}
+
+		if !b.bool {
 			vm.ip += Pos(n)
 		}
 
-	case InstructionGetLocal:
-		name := vm.GetConstant(vm.NextByte()).(*StringValue).string
-		v := vm.getVar(name)
+	case InstructionGetLocal:
+		name := vm.GetConstant(vm.NextByte()).(*StringValue).string
+		v := vm.getVar(name)
+
+		if v == nil {
+			// the variable may be a global the compiler didn't know of, such as one set by the host
+			global := vm.GetGlobal(name)
+			if global == nil {
+				vm.error(fmt.Sprintf("undefined global '%s'", name))
+				return false
+			}
+
+			vm.stack.Push(global)
+			break
+		}
+
+		vm.stack.Push(v.value)
+
+	case InstructionSetLocal:
+		value := vm.stack.Pop().(Value)
+		name := vm.GetConstant(vm.NextByte()).(*StringValue).string
+
+		v := vm.getVar(name)
+
+		if v == nil {
+			// as when getting, the variable may be a global the compiler didn't know of
+			if vm.GetGlobal(name) == nil {
+				vm.error(fmt.Sprintf("cannot set local: undefined variable %s", name))
+				return false
+			}
+
+			vm.SetGlobal(name, value)
+			break
+		}
+
+		v.value = value
+
+	case InstructionDeclareLocal:
+		vm.addVar(
+			vm.GetConstant(vm.NextByte()).(*StringValue).string,
+			vm.stack.Pop().(Value),
+		)
+
+	case InstructionGetGlobal:
+		constant := vm.NextByte()
+
+		// globals are only looked up again once any has been set since
+		cache := vm.globalCache(constant)
+		if cache.value != nil && cache.version == vm.globalsVersion {
+			vm.stack.Push(cache.value)
+			break
+		}
+
+		name := vm.GetConstant(constant).(*StringValue).string
+		v := vm.GetGlobal(name)
+
+		if v == nil {
+			vm.error(fmt.Sprintf("undefined global '%s'", name))
+			return false
+		}
+
+		*cache = globalCache{v, vm.globalsVersion}
+		vm.stack.Push(v)
+
+	case InstructionSetGlobal:
+		vm.SetGlobal(vm.GetConstant(vm.NextByte()).(*StringValue).string, vm.stack.Pop())
+
+	case InstructionTrue:
+		vm.stack.Push(&BoolValue{true})
+
+	case InstructionFalse:
+		vm.stack.Push(&BoolValue{false})
+
+	case InstructionNil:
+		vm.stack.Push(&NilValue{})
+
+	case InstructionFormList:
+		n := int(vm.NextU16())
+
+		items := make([]Value, n+1)
+		for i := 0; i <= n; i++ {
+			items[n-i] = vm.stack.Pop()
+		}
+
+		vm.stack.Push(&ListValue{items, false, false})
+
+	case InstructionNewList:
+		vm.stack.Push(&ListValue{[]Value{}, false, false})
+
+	case InstructionFormObject:
+		n := int(vm.NextU16())
+
+		members := make(map[string]Value, n/2)
+		for i := 0; i < n; i += 2 {
+			value := vm.stack.Pop()
+			key, ok := vm.stack.Pop().(*StringValue)
+			if !ok {
+				vm.error("the keys of objects must be strings")
+				return false
+			}
+
+			members[key.string] = value
+		}
+
+		vm.stack.Push(&ObjectValue{members, false})
+
+	case InstructionAppend:
+		value := vm.stack.Pop()
+		list, ok := vm.stack.Pop().(*ListValue)
+		if !ok {
+			vm.error("cannot append to a value which isn't a list")
+			return false
+		}
+		if list.frozen {
+			vm.error("cannot append to frozen list")
+			return false
+		}
+		list.own()
+		list.items = append(list.items, value)
+		vm.stack.Push(list)
+
+	case InstructionExtend:
+		value := vm.stack.Pop()
+		list, ok := vm.stack.Pop().(*ListValue)
+		if !ok {
+			vm.error("cannot spread into a value which isn't a list")
+			return false
+		}
+
+		var items []Value
+		switch v := value.(type) {
+		case *ListValue:
+			items = v.items
+		case *RangeValue:
+			items = v.Items()
+		default:
+			vm.error(fmt.Sprintf("cannot spread %s, as only lists can be spread", TypeOf(value)))
+			return false
+		}
+
+		// the lists among the items of constants are shared, as they are when a list literal is evaluated
+		list.own()
+		for _, item := range items {
+			list.items = append(list.items, share(item))
+		}
+		vm.stack.Push(list)
+
+	case InstructionDescend:
+		vm.descend()
+
+	case InstructionAscend:
+		if !vm.ascend() {
+			vm.error("cannot leave the top scope")
+			return false
+		}
+
+	case InstructionStringConversion:
+		v := vm.stack.Pop()
+		vm.stack.Push(&StringValue{vm.ToString(v)})
+
+	case InstructionStringConcatenation:
+		r, ok := vm.stack.Pop().(*StringValue)
+		l, ok2 := vm.stack.Pop().(*StringValue)
+		if !ok || !ok2 {
+			vm.error("only strings can be concatenated")
+			return false
+		}
+
+		vm.stack.Push(&StringValue{l.string + r.string})
+
+	case InstructionSwap:
+		r := vm.stack.Pop()
+		l := vm.stack.Pop()
+
+		vm.stack.Push(r, l)
+
+	case InstructionAccessProperty:
+		source := vm.stack.Pop()
+		property := vm.ReadConstant()
+
+		name := property.(*StringValue).string
+
+		// the same property is accessed every time, so the value is usually of the same type as the last time too
+		cache := vm.propertyCache()
+
+		var member Value
+		if cache.member != nil && cache.valueType == source.Type() {
+			member = cache.member
+		} else {
+			var err error
+			member, err = source.Get(name)
+			if err != nil {
+				vm.fail(err)
+				return false
+			}
+
+			if b, ok := member.(*BuiltinFunctionValue); ok && prototypes[source.Type()][name] == b {
+				*cache = propertyCache{source.Type(), b}
+			}
+		}
+
+		// functions are called with the value they are a member of as this
+		if member.Type() == FunctionValueType || member.Type() == BuiltinFunctionValueType {
+			member = &BoundFunctionValue{member, source}
+		}
+
+		vm.stack.Push(member)
+
+	case InstructionIndex:
+		index := vm.stack.Pop()
+		source := vm.stack.Pop()
+
+		item, err := vm.index(source, index)
+		if err != nil {
+			vm.fail(err)
+			return false
+		}
+
+		vm.stack.Push(item)
+
+	case InstructionBreakpoint:
+		if vm.breakpoint != nil {
+			vm.breakpoint(vm)
+		}
+
+	case InstructionImport:
+		path := vm.ReadConstant().(*StringValue).string
 
-		if v == nil {
-			vm.error(fmt.Sprintf("cannot get local: undefined variable %s", name))
+		module, ok := StandardModules[path]
+		if !ok {
+			vm.error(fmt.Sprintf("no standard module %s", path))
 			return false
 		}
 
-		vm.stack.Push(v.value)
+		if vm.imported == nil {
+			vm.imported = make(map[string]Value, len(module.Values()))
+		}
 
-	case InstructionSetLocal:
-		value := vm.stack.Pop().(Value)
-		name := vm.GetConstant(vm.NextByte()).(*StringValue).string
+		for name, value := range module.Values() {
+			vm.imported[name] = value
+		}
+		vm.globalsVersion++
 
-		v := vm.getVar(name)
+	case InstructionDestructure:
+		names := vm.ReadConstant().(*ListValue).items
+		v := vm.stack.Pop()
 
-		if v == nil {
-			vm.error(fmt.Sprintf("cannot set local: undefined variable %s", name))
+		list, ok := v.(*ListValue)
+		if !ok {
+			vm.error(fmt.Sprintf("cannot destructure %s into %d names", v.DebugString(), len(names)))
+			return false
+		} else if len(list.items) != len(names) {
+			vm.error(fmt.Sprintf("cannot destructure a list of %d items into %d names", len(list.items), len(names)))
+			return false
 		}
 
-		v.value = value
-
-	case InstructionDeclareLocal:
-		vm.addVar(
-			vm.GetConstant(vm.NextByte()).(*StringValue).string,
-			vm.stack.Pop().(Value),
-		)
+		if !vm.stack.reserve(Pos(len(names)) + stackHeadroom) {
+			vm.error("stack overflow")
+			return false
+		}
 
-	case InstructionGetGlobal:
-		vm.stack.Push(vm.globals[vm.GetConstant(vm.NextByte()).(*StringValue).string])
+		for i, name := range names {
+			if name := name.(*StringValue).string; name != "_" {
+				vm.addVar(name, list.items[i])
+			}
+		}
 
-	case InstructionSetGlobal:
-		vm.globals[vm.GetConstant(vm.NextByte()).(*StringValue).string] = vm.stack.Pop()
+	case InstructionCast:
+		target := vm.ReadConstant().(*StringValue).string
+		v := vm.stack.Peek()
 
-	case InstructionTrue:
-		vm.stack.Push(&BoolValue{true})
+		if !IsOfType(v, target) {
+			vm.error(fmt.Sprintf("cannot cast %s (%s) to %s", v.DebugString(), TypeOf(v), target))
+			return false
+		}
 
-	case InstructionFalse:
-		vm.stack.Push(&BoolValue{false})
+	default:
+		vm.error(fmt.Sprintf("invalid instruction %d", vm.chunk.Bytecode[vm.instruction]))
+		return false
+	}
 
-	case InstructionNil:
-		vm.stack.Push(&NilValue{})
+	return true
+}
 
-	case InstructionFormList:
-		n := int(vm.NextU16())
+// callValue call a function with the arguments on the stack above it, beginning the execution of its chunk if it is a
+// function of a program, or pushing what it returns if it is a builtin. It returns whether the call could be made.
+func (vm *VM) callValue(v Value, args int) bool {
+	var this Value
+	if b, ok := v.(*BoundFunctionValue); ok {
+		v, this = b.Function, b.This
+	}
 
-		items := make([]Value, n+1)
-		for i := 0; i <= n; i++ {
-			items[n-i] = vm.stack.Pop()
+	switch f := v.(type) {
+	case *FunctionValue:
+		if err := (Signature{f.Params}).Check(f.Name, args); err != nil {
+			vm.error(err.Error())
+			return false
 		}
 
-	case InstructionNewList:
-		vm.stack.Push(&ListValue{[]Value{}})
-
-	case InstructionAppend:
-		value := vm.stack.Pop()
-		list := vm.stack.Pop().(*ListValue)
-		list.items = append(list.items, value)
-		vm.stack.Push(list)
+		if !vm.reserveCall(f) {
+			return false
+		}
 
-	case InstructionDescend:
-		vm.descend()
+		// there is room for the frame, so it is set in place rather than pushed, which copies it more than once
+		frame := &vm.call.items[vm.call.Current]
+		*frame = Call{
+			function:    f.Name,
+			chunk:       vm.chunk,
+			ip:          vm.ip,
+			instruction: vm.instruction,
+			stackEnd:    vm.stack.Current - Pos(len(f.Params)),
+			variableEnd: vm.variableEnd,
+			scope:       vm.scope,
+		}
+		vm.call.Current++
+		vm.call.High = max(vm.call.High, vm.call.Current)
+
+		for i := len(f.Params) - 1; i >= 0; i-- {
+			p := vm.stack.Current - Pos(len(f.Params)) + Pos(i)
+			vm.stack.items[p] = &VariableValue{
+				f.Params[i],
+				vm.stack.items[p],
+				vm.scope,
+				nil,
+			}
+		}
 
-	case InstructionAscend:
-		vm.ascend()
+		if this == nil {
+			this = f.Parent
+		}
 
-	case InstructionStringConversion:
-		v := vm.stack.Pop()
-		vm.stack.Push(&StringValue{v.String()})
+		if this != nil {
+			vm.addVar("this", this)
+		}
+		vm.addCaptured(f)
 
-	case InstructionStringConcatenation:
-		r := vm.stack.Pop().(*StringValue).string
-		l := vm.stack.Pop().(*StringValue).string
+		vm.variableEnd = vm.stack.Current
 
-		vm.stack.Push(&StringValue{l + r})
+		vm.chunk = f.Chunk
+		vm.ip = 0
+	case *BuiltinFunctionValue:
+		if err := (Signature{f.Parameters}).Check(f.Name, args); err != nil {
+			vm.error(err.Error())
+			return false
+		}
 
-	case InstructionSwap:
-		r := vm.stack.Pop()
-		l := vm.stack.Pop()
+		params := map[string]Value{}
 
-		vm.stack.Push(r, l)
+		for i := len(f.Parameters) - 1; i >= 0; i-- {
+			params[f.Parameters[i]] = vm.stack.Pop()
+		}
 
-	case InstructionAccessProperty:
-		source := vm.stack.Pop()
-		property := vm.ReadConstant()
+		if this == nil {
+			this = f.Parent
+		}
 
-		member, err := source.Get(property.(*StringValue).String())
+		v, err := f.F(vm, this, params)
 		if err != nil {
-			vm.error(err.Error())
+			vm.fail(err)
+			return false
 		}
 
-		// add parent if function
-		if member.Type() == FunctionValueType {
-			member.(*FunctionValue).Parent = source
-		} else if member.Type() == BuiltinFunctionValueType {
-			member.(*BuiltinFunctionValue).Parent = source
+		vm.stack.Push(v)
+	default:
+		vm.error(fmt.Sprintf("value called is not a function (%s, type %T)", v.DebugString(), v))
+		return false
+	}
+
+	return true
+}
+
+// runDeferred make the calls deferred by the function on top of the call stack, the last deferred first. Returns false
+// if one of them failed, which fails the VM.
+func (vm *VM) runDeferred() bool {
+	frame := &vm.call.items[vm.call.Current-1]
+	deferred := frame.deferred
+	frame.deferred = nil
+
+	for i := len(deferred) - 1; i >= 0; i-- {
+		if _, err := vm.Call(deferred[i].function, deferred[i].args); err != nil {
+			vm.fail(err)
+			return false
 		}
+	}
 
-		vm.stack.Push(member)
+	return true
+}
 
-	case InstructionBreakpoint:
+// reserveCall make room for a call to a function, with its parameters, this and the variables it captured, failing
+// with a stack overflow if there isn't any, such as when a function calls itself without end
+func (vm *VM) reserveCall(f *FunctionValue) bool {
+	n := Pos(len(f.Params)+len(f.captured)+1) + stackHeadroom
 
-	default:
-		panic("invalid byte code")
+	// most calls have room already, which is checked here rather than by reserve, as reserve is not inlined
+	if vm.call.Current < Pos(len(vm.call.items)) && Pos(len(vm.stack.items))-vm.stack.Current >= n {
+		return true
+	}
+
+	if !vm.call.reserve(1) || !vm.stack.reserve(n) {
+		vm.error("stack overflow")
+		return false
 	}
 
 	return true
 }
 
+// Call call a function and get what it returns, for hosts and for builtins calling the functions they are given (such
+// as map). The function gets a frame of its own on top of whatever the VM is executing, and is executed until that
+// frame returns, so it may itself call builtins which call functions. Missing arguments are nil, extra ones are left
+// out. If the function fails, the VM is left as it was before the call, so the caller can carry on.
 func (vm *VM) Call(v Value, args []Value) (Value, error) {
+	var this Value
+	if b, ok := v.(*BoundFunctionValue); ok {
+		v, this = b.Function, b.This
+	}
+
 	switch f := v.(type) {
 	case *FunctionValue:
+		// a VM which has failed executes nothing more
+		if vm.err != nil {
+			return nil, vm.err
+		}
+
+		if !vm.reserveCall(f) {
+			return nil, vm.err
+		}
+
+		depth, instruction := vm.call.Current, vm.instruction
 		vm.call.Push(Call{
+			function:    f.Name,
 			chunk:       vm.chunk,
 			ip:          vm.ip,
+			instruction: vm.instruction,
 			stackEnd:    vm.stack.Current,
 			variableEnd: vm.variableEnd,
 			scope:       vm.scope,
 		})
 
 		for i := 0; i < len(f.Params); i++ {
-			vm.addVar(f.Params[i], args[i])
+			var arg Value = &NilValue{}
+			if i < len(args) {
+				arg = args[i]
+			}
+
+			vm.addVar(f.Params[i], arg)
+		}
+
+		if this == nil {
+			this = f.Parent
 		}
 
-		if f.Parent != nil {
-			vm.addVar("this", f.Parent)
+		if this != nil {
+			vm.addVar("this", this)
 		}
+		vm.addCaptured(f)
 
 		vm.variableEnd = vm.stack.Current
 
 		vm.chunk = f.Chunk
 		vm.ip = 0
 
-		for vm.chunk.Bytecode[vm.ip] != InstructionReturn && vm.Next() {
+		// execute until the frame of the function has returned, however many frames are called on top of it
+		for vm.call.Current > depth && vm.Next() {
 		}
 
-		if vm.HasNext() {
-			vm.Next()
+		// the instruction the caller is at, which errors it has are traced from
+		defer func() {
+			vm.instruction = instruction
+		}()
+
+		if vm.call.Current > depth || vm.err != nil {
+			var err error = errors.New(fmt.Sprintf("%s stopped without returning", f.Name))
+			if vm.err != nil {
+				err = vm.err
+			}
+
+			// leave the VM as it was before the call, so the caller can carry on despite the error
+			c := vm.call.items[depth]
+			vm.call.Current = depth
+			vm.variableEnd = c.variableEnd
+			vm.stack.Current = c.stackEnd
+			vm.scope = c.scope
+			vm.ip = c.ip
+			vm.chunk = c.chunk
+			vm.err = nil
+
+			return nil, err
 		}
 
 		return vm.stack.Pop(), nil
 
 	case *BuiltinFunctionValue:
+		if err := (Signature{f.Parameters}).Check(f.Name, len(args)); err != nil {
+			return nil, err
+		}
+
 		argies := map[string]Value{}
 
 		for i, arg := range args {
 			argies[f.Parameters[i]] = arg
 		}
 
-		return f.F(vm, f.Parent, argies)
+		if this == nil {
+			this = f.Parent
+		}
+
+		return f.F(vm, this, argies)
 	}
 
 	return nil, errors.New(fmt.Sprintf("value is not a function (%s)", v.DebugString()))
@@ -700,14 +1902,16 @@ func (vm *VM) NextByte() Bytecode {
 	return b
 }
 
-func (vm *VM) ascend() {
-	vm.scope--
-
-	if vm.scope < 0 {
-		panic("invalid scope")
+// ascend leave the scope being executed, removing its variables, returning whether there was one to leave
+func (vm *VM) ascend() bool {
+	if vm.scope <= 0 {
+		return false
 	}
 
+	vm.scope--
 	vm.purgeVars()
+
+	return true
 }
 
 // purgeVars remove all variables not within scope
@@ -727,9 +1931,18 @@ func (vm *VM) addVar(name string, value Value) {
 		name,
 		value,
 		vm.scope,
+		nil,
 	})
 }
 
+// addCaptured declare the variables a closure captured in a call to it, standing for the variables themselves
+func (vm *VM) addCaptured(f *FunctionValue) {
+	for _, v := range f.captured {
+		vm.addVar(v.name, nil)
+		vm.stack.Peek().(*VariableValue).captured = v
+	}
+}
+
 func (vm *VM) getVar(name string) *VariableValue {
 	for i := vm.variableEnd - 1; i >= 0; i-- {
 		v, ok := vm.stack.items[i].(*VariableValue)
@@ -739,7 +1952,7 @@ func (vm *VM) getVar(name string) *VariableValue {
 		}
 
 		if v.name == name {
-			return v
+			return v.cell()
 		}
 	}
 
@@ -762,14 +1975,328 @@ func (vm *VM) NextU16() uint16 {
 	return (uint16(vm.NextByte()) << 8) | uint16(vm.NextByte())
 }
 
-func (vm *VM) error(error string) {
-	log.Fatal(error)
+// counterOperation step or compare the counter of a numeric for loop, as the arithmetic and comparison instructions
+// would
+// counter get the counter of a numeric for loop, which is the variable its init declared last, as the body has left
+// its own by the time the loop steps it
+func (vm *VM) counter(loop counterOperands) *VariableValue {
+	name := vm.GetConstant(loop.name).(*StringValue).string
+	if vm.variableEnd > 0 {
+		if v := vm.stack.items[vm.variableEnd-1].(*VariableValue); v.name == name {
+			return v.cell()
+		}
+	}
+
+	vm.error(fmt.Sprintf("undefined global '%s'", name))
+	return nil
+}
+
+// counterWithin whether the counter of a numeric for loop is within its limit, which the loop goes on while. Fails
+// the execution if they can't be compared.
+func (vm *VM) counterWithin(loop counterOperands, counter *VariableValue) (bool, bool) {
+	limit := vm.GetConstant(loop.limit)
+	if name, ok := limit.(*StringValue); ok {
+		if vm.variableEnd < 2 || vm.stack.items[vm.variableEnd-2].(*VariableValue).name != loopLimit {
+			vm.error("cannot loop outside of a for loop")
+			return false, false
+		}
+
+		// limits which aren't variables are globals, which are looked up each time as they can be set while looping
+		if v := vm.stack.items[vm.variableEnd-2].(*VariableValue).captured; v != nil {
+			limit = v.value
+		} else if limit = vm.GetGlobal(name.string); limit == nil {
+			vm.error(fmt.Sprintf("undefined global '%s'", name.string))
+			return false, false
+		}
+	}
+
+	// counters are mostly numbers, which are compared without making a bool
+	if c, ok := counter.value.(*NumberValue); ok && c.decimal == nil && !vm.chunk.Decimal {
+		if l, ok := limit.(*NumberValue); ok && l.decimal == nil {
+			switch loop.comparison {
+			case InstructionLess:
+				return c.float64 < l.float64, true
+			case InstructionLessOrEqual:
+				return c.float64 <= l.float64, true
+			case InstructionGreater:
+				return c.float64 > l.float64, true
+			case InstructionGreaterOrEqual:
+				return c.float64 >= l.float64, true
+			}
+		}
+	}
+
+	within, err := vm.counterOperation(loop.comparison, counter.value, limit)
+	if err != nil {
+		vm.fail(err)
+		return false, false
+	}
+
+	b, ok := within.(*BoolValue)
+	if !ok {
+		vm.error(fmt.Sprintf("the condition of a loop must be a bool, got %s", TypeOf(within)))
+		return false, false
+	}
+
+	return b.bool, true
+}
+
+func (vm *VM) counterOperation(op Bytecode, l Value, r Value) (Value, error) {
+	if !vm.chunk.Decimal {
+		if result := numberOperation(op, l, r); result != nil {
+			return result, nil
+		}
+	}
+
+	return vm.binaryOperation(op, l, r)
+}
+
+// error stop the execution with an error with the message
+func (vm *VM) error(message string) {
+	vm.fail(errors.New(message))
+}
+
+// fail stop the execution with an error. Errors which aren't anglais errors are turned into one, with the stack
+// trace of where the execution is.
+func (vm *VM) fail(err error) {
+	e, ok := err.(*ErrorValue)
+	if !ok {
+		e = NewError(err.Error(), nil, vm.Trace())
+	}
+
+	vm.err = e
+}
+
+// Error get the error the execution stopped with, or nil if it has not failed
+func (vm *VM) Error() *ErrorValue {
+	return vm.err
+}
+
+// Trace get the functions being executed, starting with the innermost
+func (vm *VM) Trace() []TraceFrame {
+	frames := make([]TraceFrame, 0, vm.call.Current+1)
+
+	chunk, instruction := vm.chunk, vm.instruction
+	for i := vm.call.Current - 1; i >= 0; i-- {
+		c := vm.call.items[i]
+
+		frames = append(frames, TraceFrame{c.function, chunk.Line(instruction), instruction, chunk.File(instruction)})
+
+		chunk, instruction = c.chunk, c.instruction
+	}
+
+	return append(frames, TraceFrame{"main", chunk.Line(instruction), instruction, chunk.File(instruction)})
+}
+
+// StackUsage how much of a stack a program has used
+type StackUsage struct {
+	// High the most the stack has held at once
+	High Pos
+	// Size the size of the stack, which it may have grown to
+	Size Pos
+}
+
+// StackUsage get how much of the value stack and the call stack the program has used so far, such as to tune their
+// sizes and growth
+func (vm *VM) StackUsage() (values StackUsage, calls StackUsage) {
+	return StackUsage{vm.stack.High, vm.stack.Size}, StackUsage{vm.call.High, vm.call.Size}
+}
+
+// SetStackGrowth set how the value stack and the call stack grow once full, and the sizes they can not grow past. By
+// default, they do not grow.
+func (vm *VM) SetStackGrowth(policy GrowthPolicy, stackLimit Pos, callstackLimit Pos) {
+	vm.stack.SetGrowth(policy, stackLimit)
+	vm.call.SetGrowth(policy, callstackLimit)
 }
 
+// Frame the part of the stack belonging to a function being executed
+type Frame struct {
+	TraceFrame
+	// Variables the variables declared in the function which are still in scope, from the first declared
+	Variables []Variable
+	// Values the other values on its part of the stack, such as operands of an expression, from the bottom up
+	Values []Value
+}
+
+// Variable a variable on the stack
+type Variable struct {
+	Name  string
+	Value Value
+	// Scope how deeply nested the block it was declared in is
+	Scope Pos
+}
+
+// Frames get the stack divided into the functions being executed, starting with the innermost. The frames are copies,
+// but the values in them are not, so they should not be changed.
+func (vm *VM) Frames() []Frame {
+	trace := vm.Trace()
+	frames := make([]Frame, len(trace))
+
+	end := vm.stack.Current
+	for i := range frames {
+		// the innermost frame is that of the last call, and main has the stack before the first call
+		start := Pos(0)
+		if c := vm.call.Current - 1 - Pos(i); c >= 0 {
+			start = vm.call.items[c].stackEnd
+		}
+
+		frames[i].TraceFrame = trace[i]
+		for _, v := range vm.stack.items[start:end] {
+			if variable, ok := v.(*VariableValue); ok {
+				frames[i].Variables = append(frames[i].Variables, Variable{variable.name, variable.cell().value, variable.scope})
+			} else {
+				frames[i].Values = append(frames[i].Values, v)
+			}
+		}
+
+		end = start
+	}
+
+	return frames
+}
+
+// SetProfile set the builtins the VM has as globals before any it is given, which are the default ones unless set
+// otherwise. The program should be compiled for the same profile (see Compiler.SetProfile).
+func (vm *VM) SetProfile(profile Profile) {
+	vm.defaults = profile.Builtins().Values()
+	vm.globalsVersion++
+}
+
+// SetGlobal set a global of the VM, which other VMs don't see. It shadows any default global with the same name.
 func (vm *VM) SetGlobal(name string, value Value) {
+	// most VMs are given no globals, so they only have room for them once they are
+	if vm.globals == nil {
+		vm.globals = make(map[string]Value)
+	}
+
 	vm.globals[name] = value
+	vm.globalsVersion++
 }
 
 func (vm *VM) GetGlobal(name string) Value {
-	return vm.globals[name]
+	if v, ok := vm.globals[name]; ok {
+		return v
+	}
+
+	if v, ok := vm.imported[name]; ok {
+		return v
+	}
+
+	return vm.defaults[name]
+}
+
+// Variable get the value of the variable with the name visible where the execution is, or nil if there is none
+func (vm *VM) Variable(name string) Value {
+	v := vm.getVar(name)
+	if v == nil {
+		return nil
+	}
+
+	return v.value
+}
+
+// OpenHandle give the program a handle to a resource, which the VM closes when it is closed, if the program hasn't
+// closed it already. Builtins opening files, sockets and the like return their resources this way.
+func (vm *VM) OpenHandle(name string, resource io.Closer) *HandleValue {
+	h := &HandleValue{name, resource, false, false}
+	vm.handles = append(vm.handles, h)
+
+	return h
+}
+
+// Bind give the program a handle to a Go value of the host, such as a large object it works on, which the program
+// can pass to the builtins of the host (see HandleValue.Object). The host keeps the value, and can revoke the handle
+// once the program should no longer use it.
+func (vm *VM) Bind(name string, object any) *HandleValue {
+	return vm.OpenHandle(name, bound{object})
+}
+
+// Revoke take the resource of a handle back from the program, without closing it. The handle stays with the program,
+// but no longer refers to the resource, so a long-lived VM does not keep it alive; using it fails.
+func (vm *VM) Revoke(h *HandleValue) {
+	h.revoke()
+	vm.handles = slices.DeleteFunc(vm.handles, func(other *HandleValue) bool {
+		return other == h
+	})
+}
+
+// Close close every handle the program left open. Hosts should close the VM once they are done running it, and it
+// may be closed more than once.
+func (vm *VM) Close() error {
+	var errs []error
+	for _, h := range vm.handles {
+		if err := h.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	vm.handles = nil
+
+	return errors.Join(errs...)
+}
+
+// SetOutput set where the program writes to with print and write
+func (vm *VM) SetOutput(w io.Writer) {
+	vm.output = w
+}
+
+// SetNumberFormat set how numbers are converted to strings, by string conversions and when printed
+func (vm *VM) SetNumberFormat(format NumberFormat) {
+	vm.numberFormat = format
+}
+
+// SetMissingKeys set what render does with the tags of a template naming keys its data doesn't have, failing by default
+func (vm *VM) SetMissingKeys(missing MissingKeys) {
+	vm.missingKeys = missing
+}
+
+// ToString convert a value to a string, writing numbers in the number format of the VM
+func (vm *VM) ToString(v Value) string {
+	if n, ok := v.(*NumberValue); ok && n.decimal != nil {
+		return formatDecimal(n.decimal, vm.numberFormat)
+	} else if ok {
+		return vm.numberFormat.Format(n.float64)
+	}
+
+	return v.String()
+}
+
+// SetBreakpointHandler set a function to call whenever a breakpoint instruction is executed
+func (vm *VM) SetBreakpointHandler(handler func(vm *VM)) {
+	vm.breakpoint = handler
+}
+
+// SetInstructionHandler set a function to call before each instruction is executed, with the chunk and position of
+// the instruction. Meant for tracing and profiling, as it slows the VM down.
+func (vm *VM) SetInstructionHandler(handler func(vm *VM, chunk *Chunk, at Pos)) {
+	vm.instructionHandler = handler
+}
+
+// Line get the source line of the instruction that will be executed next, or -1 if it is unknown
+func (vm *VM) Line() Pos {
+	return vm.chunk.Line(vm.ip)
+}
+
+// Stack get a copy of the values currently on the stack, from the bottom up
+func (vm *VM) Stack() []Value {
+	values := make([]Value, vm.stack.Current)
+	copy(values, vm.stack.items[:vm.stack.Current])
+
+	return values
+}
+
+// Globals get a copy of the global variables
+func (vm *VM) Globals() map[string]Value {
+	globals := make(map[string]Value, len(vm.defaults)+len(vm.globals)+len(vm.imported))
+	for name, value := range vm.defaults {
+		globals[name] = value
+	}
+	for name, value := range vm.imported {
+		globals[name] = value
+	}
+	for name, value := range vm.globals {
+		globals[name] = value
+	}
+
+	return globals
 }
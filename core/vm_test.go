@@ -1,7 +1,11 @@
 package core
 
 import (
+	"bytes"
 	"fmt"
+	"io"
+	"slices"
+	"strings"
 	"testing"
 )
 
@@ -49,7 +53,7 @@ func TestNewVM(t *testing.T) {
 	chunk := NewChunk([]Bytecode{
 		InstructionConstant, 0,
 	}, []Value{
-		&NumberValue{0},
+		&NumberValue{0, nil},
 	})
 	stackSize := Pos(256)
 	callstackSize := Pos(256)
@@ -107,10 +111,10 @@ func GetExecutionTestData() map[string]struct {
 				InstructionAdd,
 			},
 				[]Value{
-					&NumberValue{1}, &NumberValue{2},
+					&NumberValue{1, nil}, &NumberValue{2, nil},
 				}),
 			[]Value{
-				&NumberValue{3},
+				&NumberValue{3, nil},
 			},
 		},
 		"push_constant": {
@@ -119,11 +123,11 @@ func GetExecutionTestData() map[string]struct {
 					InstructionConstant, 0,
 				},
 				[]Value{
-					&NumberValue{1},
+					&NumberValue{1, nil},
 				},
 			),
 			[]Value{
-				&NumberValue{1},
+				&NumberValue{1, nil},
 			},
 		},
 		"push_true": {
@@ -181,11 +185,11 @@ func GetExecutionTestData() map[string]struct {
 					InstructionDiv,
 				},
 				[]Value{
-					&NumberValue{2}, &NumberValue{1}, &NumberValue{5}, &NumberValue{6},
+					&NumberValue{2, nil}, &NumberValue{1, nil}, &NumberValue{5, nil}, &NumberValue{6, nil},
 				},
 			),
 			[]Value{
-				&NumberValue{3.75},
+				&NumberValue{3.75, nil},
 			},
 		},
 		"equality_true": {
@@ -196,7 +200,7 @@ func GetExecutionTestData() map[string]struct {
 					InstructionEquals,
 				},
 				[]Value{
-					&NumberValue{1},
+					&NumberValue{1, nil},
 				},
 			),
 			[]Value{
@@ -211,7 +215,7 @@ func GetExecutionTestData() map[string]struct {
 					InstructionEquals,
 				},
 				[]Value{
-					&NumberValue{1}, &NumberValue{2},
+					&NumberValue{1, nil}, &NumberValue{2, nil},
 				},
 			),
 			[]Value{
@@ -226,7 +230,7 @@ func GetExecutionTestData() map[string]struct {
 					InstructionNotEqual,
 				},
 				[]Value{
-					&NumberValue{1},
+					&NumberValue{1, nil},
 				},
 			),
 			[]Value{
@@ -241,7 +245,7 @@ func GetExecutionTestData() map[string]struct {
 					InstructionNotEqual,
 				},
 				[]Value{
-					&NumberValue{1}, &NumberValue{2},
+					&NumberValue{1, nil}, &NumberValue{2, nil},
 				},
 			),
 			[]Value{
@@ -280,11 +284,11 @@ func GetExecutionTestData() map[string]struct {
 					InstructionConstant, 1, // should execute
 				},
 				[]Value{
-					&NumberValue{0}, &NumberValue{1},
+					&NumberValue{0, nil}, &NumberValue{1, nil},
 				},
 			),
 			[]Value{
-				&NumberValue{1},
+				&NumberValue{1, nil},
 			},
 		},
 		"jump_false/false": {
@@ -296,11 +300,11 @@ func GetExecutionTestData() map[string]struct {
 					InstructionConstant, 1, // should execute
 				},
 				[]Value{
-					&NumberValue{0}, &NumberValue{1},
+					&NumberValue{0, nil}, &NumberValue{1, nil},
 				},
 			),
 			[]Value{
-				&NumberValue{1},
+				&NumberValue{1, nil},
 			},
 		},
 		"jump_false/true": {
@@ -312,11 +316,11 @@ func GetExecutionTestData() map[string]struct {
 					InstructionConstant, 1, // should execute
 				},
 				[]Value{
-					&NumberValue{0}, &NumberValue{1},
+					&NumberValue{0, nil}, &NumberValue{1, nil},
 				},
 			),
 			[]Value{
-				&NumberValue{0}, &NumberValue{1},
+				&NumberValue{0, nil}, &NumberValue{1, nil},
 			},
 		},
 		"declare_local": {
@@ -326,14 +330,15 @@ func GetExecutionTestData() map[string]struct {
 					InstructionDeclareLocal, 1,
 				},
 				[]Value{
-					&NumberValue{0}, &StringValue{"a"},
+					&NumberValue{0, nil}, &StringValue{"a"},
 				},
 			),
 			[]Value{
 				&VariableValue{
 					"a",
-					&NumberValue{0},
+					&NumberValue{0, nil},
 					0,
+					nil,
 				},
 			},
 		},
@@ -346,14 +351,15 @@ func GetExecutionTestData() map[string]struct {
 					InstructionSetLocal, 1, // reassign
 				},
 				[]Value{
-					&NumberValue{0}, &StringValue{"a"}, &NumberValue{1},
+					&NumberValue{0, nil}, &StringValue{"a"}, &NumberValue{1, nil},
 				},
 			),
 			[]Value{
 				&VariableValue{
 					"a",
-					&NumberValue{1},
+					&NumberValue{1, nil},
 					0,
+					nil,
 				},
 			},
 		},
@@ -365,16 +371,17 @@ func GetExecutionTestData() map[string]struct {
 					InstructionGetLocal, 1, // reassign
 				},
 				[]Value{
-					&NumberValue{0}, &StringValue{"a"},
+					&NumberValue{0, nil}, &StringValue{"a"},
 				},
 			),
 			[]Value{
 				&VariableValue{
 					"a",
-					&NumberValue{0},
+					&NumberValue{0, nil},
 					0,
+					nil,
 				},
-				&NumberValue{0},
+				&NumberValue{0, nil},
 			},
 		},
 		"get_reassigned_local": {
@@ -388,17 +395,18 @@ func GetExecutionTestData() map[string]struct {
 					InstructionGetLocal, 1,
 				},
 				[]Value{
-					&NumberValue{0}, &StringValue{"a"}, &NumberValue{1},
+					&NumberValue{0, nil}, &StringValue{"a"}, &NumberValue{1, nil},
 				},
 			),
 			[]Value{
 				&VariableValue{
 					"a",
-					&NumberValue{1},
+					&NumberValue{1, nil},
 					0,
+					nil,
 				},
-				&NumberValue{0},
-				&NumberValue{1},
+				&NumberValue{0, nil},
+				&NumberValue{1, nil},
 			},
 		},
 		"variable_scope": {
@@ -416,16 +424,17 @@ func GetExecutionTestData() map[string]struct {
 					InstructionAscend,
 				},
 				[]Value{
-					&NumberValue{0}, &StringValue{"a"},
-					&NumberValue{1}, &StringValue{"b"},
-					&NumberValue{2}, &StringValue{"c"},
+					&NumberValue{0, nil}, &StringValue{"a"},
+					&NumberValue{1, nil}, &StringValue{"b"},
+					&NumberValue{2, nil}, &StringValue{"c"},
 				},
 			),
 			[]Value{
 				&VariableValue{
 					"a",
-					&NumberValue{0},
+					&NumberValue{0, nil},
 					0,
+					nil,
 				},
 			},
 		},
@@ -435,11 +444,11 @@ func GetExecutionTestData() map[string]struct {
 					InstructionConstant, 0,
 					InstructionConstant, 1,
 					InstructionConstant, 2,
-					InstructionCall,
+					InstructionCall, 2,
 				},
 				[]Value{
-					&NumberValue{1},
-					&NumberValue{2},
+					&NumberValue{1, nil},
+					&NumberValue{2, nil},
 					&FunctionValue{
 						Name:   "sum",
 						Params: []string{"a", "b"},
@@ -458,7 +467,7 @@ func GetExecutionTestData() map[string]struct {
 				},
 			),
 			[]Value{
-				&NumberValue{3},
+				&NumberValue{3, nil},
 			},
 		},
 		"function_calling_function": {
@@ -469,20 +478,20 @@ func GetExecutionTestData() map[string]struct {
 					InstructionConstant, 0,
 					InstructionConstant, 1,
 					InstructionConstant, 2,
-					InstructionCall,
+					InstructionCall, 2,
 				},
 				[]Value{
-					&NumberValue{1},
-					&NumberValue{2},
+					&NumberValue{1, nil},
+					&NumberValue{2, nil},
 					&FunctionValue{
 						Name:   "sum",
 						Params: []string{"a", "b"},
 						Chunk: NewChunk(
 							[]Bytecode{
 								InstructionGetLocal, 0,
-								InstructionGetLocal, 2, InstructionCall, // square the number
+								InstructionGetLocal, 2, InstructionCall, 1, // square the number
 								InstructionGetLocal, 1,
-								InstructionGetLocal, 2, InstructionCall, // square the number
+								InstructionGetLocal, 2, InstructionCall, 1, // square the number
 								InstructionAdd,
 								InstructionReturn,
 							},
@@ -528,8 +537,9 @@ func GetExecutionTestData() map[string]struct {
 						),
 					},
 					0,
+					nil,
 				},
-				&NumberValue{5},
+				&NumberValue{5, nil},
 			},
 		},
 	}
@@ -564,6 +574,23 @@ func BenchmarkVM_Execution(b *testing.B) {
 	}
 }
 
+// BenchmarkVM_ExecutionReused as BenchmarkVM_Execution, but with one VM executing the chunk again and again, so what
+// is measured is executing it rather than allocating the stacks
+func BenchmarkVM_ExecutionReused(b *testing.B) {
+	data := GetExecutionTestData()
+
+	for name, test := range data {
+		b.Run(name, func(b *testing.B) {
+			vm := NewVM(test.chunk, 256, 256)
+			for n := 0; n < b.N; n++ {
+				vm.ip, vm.scope, vm.variableEnd, vm.stack.Current, vm.err = 0, 0, 0, 0, nil
+				for vm.Next() {
+				}
+			}
+		})
+	}
+}
+
 func TestVM_NextByte(t *testing.T) {
 	vm := NewVM(
 		NewChunk(
@@ -571,7 +598,7 @@ func TestVM_NextByte(t *testing.T) {
 				InstructionConstant, 0,
 			},
 			[]Value{
-				&NumberValue{0},
+				&NumberValue{0, nil},
 			},
 		),
 		16,
@@ -682,7 +709,7 @@ func TestVM_Jump(t *testing.T) {
 				InstructionConstant, 2,
 			},
 			[]Value{
-				&NumberValue{0}, &NumberValue{1}, &NumberValue{2},
+				&NumberValue{0, nil}, &NumberValue{1, nil}, &NumberValue{2, nil},
 			},
 		),
 		16,
@@ -707,7 +734,7 @@ func TestVM_JumpFalse(t *testing.T) {
 				InstructionConstant, 2,
 			},
 			[]Value{
-				&NumberValue{0}, &NumberValue{1}, &NumberValue{2},
+				&NumberValue{0, nil}, &NumberValue{1, nil}, &NumberValue{2, nil},
 			},
 		),
 		16,
@@ -733,7 +760,7 @@ func TestVM_DontJumpFalse(t *testing.T) {
 				InstructionConstant, 2,
 			},
 			[]Value{
-				&NumberValue{0}, &NumberValue{1}, &NumberValue{2},
+				&NumberValue{0, nil}, &NumberValue{1, nil}, &NumberValue{2, nil},
 			},
 		),
 		16,
@@ -749,3 +776,1087 @@ func TestVM_DontJumpFalse(t *testing.T) {
 }
 
 func TestVM_GetGlobal(t *testing.T) {}
+
+func TestVM_Line(t *testing.T) {
+	chunk := NewChunk([]Bytecode{
+		InstructionTrue,
+		InstructionFalse,
+	}, []Value{})
+	chunk.Lines = []Pos{0, 3}
+
+	vm := NewVM(chunk, 16, 16)
+
+	if vm.Line() != 0 {
+		t.Errorf("got line %d; want 0", vm.Line())
+	}
+
+	vm.Next()
+
+	if vm.Line() != 3 {
+		t.Errorf("got line %d; want 3", vm.Line())
+	}
+
+	vm.Next()
+
+	if vm.Line() != -1 {
+		t.Errorf("got line %d past the end; want -1", vm.Line())
+	}
+}
+
+func TestVM_BreakpointHandler(t *testing.T) {
+	vm := NewVM(NewChunk([]Bytecode{
+		InstructionTrue,
+		InstructionBreakpoint,
+	}, []Value{}), 16, 16)
+
+	hits := 0
+	vm.SetBreakpointHandler(func(vm *VM) {
+		hits++
+
+		if len(vm.Stack()) != 1 {
+			t.Errorf("got %d values on the stack at the breakpoint; want 1", len(vm.Stack()))
+		}
+	})
+
+	for vm.Next() {
+	}
+
+	if hits != 1 {
+		t.Errorf("breakpoint handler was called %d times; want 1", hits)
+	}
+}
+
+func TestVM_FormList(t *testing.T) {
+	vm := NewVM(NewChunk([]Bytecode{
+		InstructionConstant, 0,
+		InstructionConstant, 1,
+		InstructionFormList, 0, 1,
+	}, []Value{
+		&NumberValue{1, nil}, &NumberValue{2, nil},
+	}), 16, 16)
+
+	for vm.Next() {
+	}
+
+	CompareStacks(t, []Value{&ListValue{[]Value{&NumberValue{1, nil}, &NumberValue{2, nil}}, false, false}}, vm.stack)
+}
+
+func TestVM_Error(t *testing.T) {
+	src := "func inner() {\n\treturn [].at(1)\n}\n\nfunc outer() {\n\treturn inner()\n}\n\nouter()"
+
+	tokens, err := NewLexer(src).Tokenize()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := NewParser(tokens)
+	tree, err := p.Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := NewCompiler()
+	c.SetPositions(p.Positions())
+	if err := c.Compile(tree); err != nil {
+		t.Fatal(err)
+	}
+
+	vm := NewVM(c.Chunk, 256, 256)
+	for vm.Next() {
+	}
+
+	e := vm.Error()
+	if e == nil {
+		t.Fatalf("expected the execution to fail")
+	}
+
+	expected := []TraceFrame{{"inner", 1, 0, ""}, {"outer", 5, 0, ""}, {"main", 8, 0, ""}}
+	if len(e.Trace) != len(expected) {
+		t.Fatalf("expected trace %v, got %v", expected, e.Trace)
+	}
+
+	for i, frame := range expected {
+		if e.Trace[i].Function != frame.Function || e.Trace[i].Line != frame.Line {
+			t.Errorf("expected frame %d to be %v, got %v", i, frame, e.Trace[i])
+		}
+	}
+
+	// the frames calling other functions are at their calls
+	if c.Chunk.Bytecode[e.Trace[2].Instruction] != InstructionCall {
+		t.Errorf("expected the main frame to be at its call, got instruction %d", e.Trace[2].Instruction)
+	}
+
+	if formatted := e.FormatSource([]rune(src)); !strings.Contains(formatted, "at inner (line 2)\n\t   2 | return [].at(1)\n") {
+		t.Errorf("expected the error to show the line it happened at, got:\n%s", formatted)
+	}
+
+	if vm.Next() {
+		t.Errorf("expected a failed VM to not execute further")
+	}
+}
+
+func TestVM_ReentrantCall(t *testing.T) {
+	vm := runSource(t, `func add(sum, x) {
+	return sum + x
+}
+
+func double(x) {
+	return x * 2
+}
+
+func total(l) {
+	return l.map(double).reduce(add, 0)
+}
+
+result := [[1, 2], [3]].map(total)`)
+
+	CompareValues(t, vm.Variable("result"), &ListValue{[]Value{NewNumber(6), NewNumber(6)}, false, false})
+
+	program, err := Compile(`func fail(x) {
+	return [].at(x)
+}
+
+func apply(l) {
+	return l.map(fail)
+}
+
+discard [[1]].map(apply)`, CompileOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = program.Run(RunOptions{})
+	e, ok := err.(*ErrorValue)
+	if !ok {
+		t.Fatalf("expected the execution to fail, got %v", err)
+	}
+
+	// functions called by builtins are traced from where the builtin was called
+	expected := []TraceFrame{{"fail", 1, 0, ""}, {"apply", 5, 0, ""}, {"main", 8, 0, ""}}
+	if len(e.Trace) != len(expected) {
+		t.Fatalf("expected trace %v, got %v", expected, e.Trace)
+	}
+
+	for i, frame := range expected {
+		if e.Trace[i].Function != frame.Function || e.Trace[i].Line != frame.Line {
+			t.Errorf("expected frame %d to be %v, got %v", i, frame, e.Trace[i])
+		}
+	}
+}
+
+func TestVM_Throw(t *testing.T) {
+	cause := NewError("cause", nil, nil)
+
+	vm := NewVM(NewChunk([]Bytecode{
+		InstructionConstant, 0,
+		InstructionConstant, 1,
+		InstructionCall, 1,
+	}, []Value{
+		cause,
+		DefaultGlobals["throw"],
+	}), 256, 256)
+
+	for vm.Next() {
+	}
+
+	if vm.Error() != cause {
+		t.Errorf("expected the thrown error to be the error the execution failed with, got %v", vm.Error())
+	}
+}
+
+func TestVM_UndefinedGlobal(t *testing.T) {
+	vm := NewVM(NewChunk([]Bytecode{
+		InstructionGetGlobal, 0,
+	}, []Value{
+		&StringValue{"undefined"},
+	}), 256, 256)
+
+	for vm.Next() {
+	}
+
+	if vm.Error() == nil || vm.Error().Message != "undefined global 'undefined'" {
+		t.Errorf("expected an undefined global error, got %v", vm.Error())
+	}
+}
+
+func TestVM_GetLocalFallsBackToGlobal(t *testing.T) {
+	vm := NewVM(NewChunk([]Bytecode{
+		InstructionGetLocal, 0,
+	}, []Value{
+		&StringValue{"typeof"},
+	}), 256, 256)
+
+	for vm.Next() {
+	}
+
+	if vm.Error() != nil {
+		t.Fatalf("unexpected error: %v", vm.Error())
+	}
+
+	CompareStacks(t, []Value{DefaultGlobals["typeof"]}, vm.stack)
+}
+
+func TestVM_GetLocalUndefinedGlobal(t *testing.T) {
+	for _, src := range []string{
+		"write(foo)",
+		"for i := 0; i < foo; i = i + 1 {\n}",
+	} {
+		vm := runSource(t, src)
+
+		if vm.Error() == nil || vm.Error().Message != "undefined global 'foo'" {
+			t.Errorf("expected running %q to fail with an undefined global error, got %v", src, vm.Error())
+		}
+	}
+}
+
+func TestVM_CallNested(t *testing.T) {
+	vm := runSource(t, "func inner(x) {\n\treturn x + 1\n}\nfunc outer(x) {\n\treturn inner(x) * 2\n}")
+
+	result, err := vm.Call(vm.Variable("outer"), []Value{&NumberValue{1, nil}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	CompareValues(t, result, &NumberValue{4, nil})
+}
+
+// closer counts how many times it has been closed
+type closer struct {
+	closes int
+}
+
+func (c *closer) Close() error {
+	c.closes++
+	return nil
+}
+
+func TestVM_Handles(t *testing.T) {
+	vm := runSource(t, "func use(handle) {\n\thandle.close()\n\treturn handle.isClosed()\n}")
+
+	used, left := &closer{}, &closer{}
+	result, err := vm.Call(vm.Variable("use"), []Value{vm.OpenHandle("used", used)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	CompareValues(t, result, &BoolValue{true})
+
+	h := vm.OpenHandle("left", left)
+
+	if err := vm.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := vm.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if used.closes != 1 || left.closes != 1 {
+		t.Errorf("expected each handle to be closed once, got %d and %d", used.closes, left.closes)
+	}
+
+	if h.Resource() != nil {
+		t.Errorf("expected a closed handle to have no resource")
+	}
+}
+
+func TestVM_Revoke(t *testing.T) {
+	vm := runSource(t, "func use(handle) {\n\thandle.close()\n\treturn handle.isRevoked()\n}")
+
+	revoked := &closer{}
+	h := vm.OpenHandle("revoked", revoked)
+	vm.Revoke(h)
+
+	if _, err := h.Use(); err == nil || !strings.Contains(err.Error(), "revoked has been revoked") {
+		t.Errorf("expected using a revoked handle to fail, got %v", err)
+	}
+
+	result, err := vm.Call(vm.Variable("use"), []Value{h})
+	if err != nil {
+		t.Fatal(err)
+	}
+	CompareValues(t, result, &BoolValue{true})
+
+	object := []int{1, 2, 3}
+	b := vm.Bind("numbers", &object)
+	if b.Object() != &object {
+		t.Errorf("expected a bound handle to give the value it was bound to")
+	}
+
+	vm.Revoke(b)
+	if err := vm.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the resource belongs to the host, so revoking it doesn't close it
+	if revoked.closes != 0 || b.Object() != nil || h.Resource() != nil {
+		t.Errorf("expected revoked handles to let go of their resources without closing them")
+	}
+
+	if h.String() != "<handle revoked revoked>" {
+		t.Errorf("expected the handle to be shown as revoked, got %s", h)
+	}
+}
+
+func TestVM_ConstantListsAreCopied(t *testing.T) {
+	vm := runSource(t, "func grow() {\n\tl := [1, [2]]\n\tl.append(3)\n\treturn l\n}\na := grow()\nb := grow()")
+
+	if err := vm.Error(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	CompareValues(t, vm.Variable("b"), &ListValue{[]Value{&NumberValue{1, nil}, &ListValue{[]Value{&NumberValue{2, nil}}, false, false}, &NumberValue{3, nil}}, false, false})
+
+	if vm.Variable("a") == vm.Variable("b") {
+		t.Errorf("expected each evaluation of a list literal to be a new list")
+	}
+
+	for _, constant := range vm.Variable("grow").(*FunctionValue).Chunk.Constants {
+		if l, ok := constant.(*ListValue); ok && !IsFrozen(l) {
+			t.Errorf("expected the constant list %s to be frozen", l)
+		}
+	}
+}
+
+func TestVM_ConstantListsAreShared(t *testing.T) {
+	vm := runSource(t, "func make() {\n\treturn [1, [2], 3]\n}\na := make()\nb := make()\nc := make()\n"+
+		"c.at(1).append(4)\nd := make()\nd.pop()\nlength := d.length()")
+
+	if err := vm.Error(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	a, b := vm.Variable("a").(*ListValue), vm.Variable("b").(*ListValue)
+	if !a.shared || &a.items[0] != &b.items[0] {
+		t.Errorf("expected lists which are not changed to share the items of the constant")
+	}
+
+	CompareValues(t, vm.Variable("c"), GoToValue([]interface{}{1, []interface{}{2, 4}, 3}))
+	CompareValues(t, vm.Variable("d"), GoToValue([]interface{}{1, []interface{}{2}}))
+	CompareValues(t, vm.Variable("length"), &NumberValue{2, nil})
+	CompareValues(t, a, GoToValue([]interface{}{1, []interface{}{2}, 3}))
+
+	if vm.Variable("c").(*ListValue).shared {
+		t.Errorf("expected a changed list to have items of its own")
+	}
+}
+
+func TestVM_BoundFunctions(t *testing.T) {
+	vm := runSource(t, "func first(x) {\n\treturn x.at(0)\n}\na := first(\"ab\")\nb := first([1, 2, 3])\nc := first(\"cd\")\nf := [1].length\nd := typeof(f)")
+
+	if err := vm.Error(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// the same access site is used with values of different types
+	CompareValues(t, vm.Variable("a"), &StringValue{"a"})
+	CompareValues(t, vm.Variable("b"), &NumberValue{1, nil})
+	CompareValues(t, vm.Variable("c"), &StringValue{"c"})
+	CompareValues(t, vm.Variable("d"), &StringValue{"function"})
+
+	result, err := vm.Call(vm.Variable("f"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	CompareValues(t, result, &NumberValue{1, nil})
+
+	if ListPrototype["length"].Parent != nil || StringPrototype["at"].Parent != nil {
+		t.Errorf("expected accessing members to leave the shared prototypes as they are")
+	}
+}
+
+func TestVM_ConcurrentPrototypes(t *testing.T) {
+	done := make(chan *ErrorValue)
+
+	for i := 0; i < 4; i++ {
+		go func() {
+			tokens, _ := NewLexer("l := [1, 2]\nl.append(3)\nn := l.length()\ns := \"ab\".at(1)").Tokenize()
+			tree, _ := NewParser(tokens).Parse()
+
+			c := NewCompiler()
+			if err := c.Compile(tree); err != nil {
+				done <- NewError(err.Error(), nil, nil)
+				return
+			}
+
+			vm := NewVM(c.Chunk, 256, 256)
+			for vm.Next() {
+			}
+
+			done <- vm.Error()
+		}()
+	}
+
+	for i := 0; i < 4; i++ {
+		if err := <-done; err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	}
+}
+
+func TestVM_ParallelGlobals(t *testing.T) {
+	tokens, _ := NewLexer("global count := 0\nfunc bump(n) {\n\tcount = count + n\n\treturn count\n}\nprint := \"shadowed\"").Tokenize()
+	p := NewParser(tokens)
+	tree, _ := p.Parse()
+
+	c := NewCompiler()
+	c.SetPositions(p.Positions())
+	if err := c.Compile(tree); err != nil {
+		t.Fatal(err)
+	}
+
+	// every VM runs the same chunk, each with globals of its own
+	results := make(chan Value)
+	for i := 1; i <= 8; i++ {
+		go func(n float64) {
+			vm := NewVM(c.Chunk, 256, 256)
+			vm.SetGlobal("offset", &NumberValue{n, nil})
+			for vm.Next() {
+			}
+
+			var result Value
+			for j := 0; j < 100; j++ {
+				result, _ = vm.Call(vm.Variable("bump"), []Value{vm.GetGlobal("offset")})
+			}
+
+			results <- &ListValue{[]Value{&NumberValue{n, nil}, result}, false, false}
+		}(float64(i))
+	}
+
+	for i := 0; i < 8; i++ {
+		result := (<-results).(*ListValue)
+		n := result.items[0].(*NumberValue).float64
+
+		CompareValues(t, result.items[1], &NumberValue{n * 100, nil})
+	}
+
+	if _, ok := DefaultGlobals["print"].(*BuiltinFunctionValue); !ok {
+		t.Errorf("expected programs to leave the default globals as they are")
+	}
+}
+
+func TestChunk_Verify(t *testing.T) {
+	invalid := map[string]*Chunk{
+		"unknown instruction":   NewChunk([]Bytecode{Bytecode(len(opcodes))}, nil),
+		"missing constant":      NewChunk([]Bytecode{InstructionConstant}, nil),
+		"constant out of range": NewChunk([]Bytecode{InstructionConstant, 1}, []Value{&NumberValue{1, nil}}),
+		"name not a string":     NewChunk([]Bytecode{InstructionGetLocal, 0}, []Value{&NumberValue{1, nil}}),
+		"jump past the end":     NewChunk([]Bytecode{InstructionJump, 0, 2, InstructionPop}, nil),
+		"loop before the start": NewChunk([]Bytecode{InstructionLoop, 0, 4}, nil),
+		"truncated operand":     NewChunk([]Bytecode{InstructionFormList, 0}, nil),
+		"stack underflow":       NewChunk([]Bytecode{InstructionTrue, InstructionAdd}, nil),
+		"value left at the end": NewChunk([]Bytecode{InstructionTrue}, nil),
+		"value left on return":  NewChunk([]Bytecode{InstructionTrue, InstructionTrue, InstructionReturn}, nil),
+		"unbalanced paths": NewChunk([]Bytecode{
+			InstructionTrue, InstructionJumpFalse, 0, 1, InstructionTrue, InstructionNil, InstructionPop,
+		}, nil),
+		"jump into an operand": NewChunk([]Bytecode{InstructionJump, 0, 1, InstructionConstant, 0}, []Value{&NilValue{}}),
+		"invalid function": NewChunk([]Bytecode{InstructionConstant, 0}, []Value{
+			&FunctionValue{"f", nil, NewChunk([]Bytecode{InstructionGetGlobal}, nil), nil, nil},
+		}),
+	}
+
+	for name, chunk := range invalid {
+		if err := chunk.Verify(); err == nil {
+			t.Errorf("expected an error verifying a chunk with %s", name)
+		}
+	}
+
+	valid := NewChunk([]Bytecode{InstructionJump, 0, 1, InstructionPop, InstructionLoop, 0, 7}, nil)
+	if err := valid.Verify(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	for _, src := range fuzzSources {
+		if err := compileFuzzSource(src).Verify(); err != nil {
+			t.Errorf("unexpected error verifying %q: %v", src, err)
+		}
+	}
+}
+
+func TestOpcodes(t *testing.T) {
+	names := map[string]Bytecode{}
+	for b, op := range opcodes {
+		if op.name == "" {
+			t.Errorf("instruction %d has no name", b)
+		}
+
+		if other, ok := names[op.name]; ok {
+			t.Errorf("instructions %d and %d are both named %s", other, b, op.name)
+		}
+
+		names[op.name] = Bytecode(b)
+	}
+
+	if InstructionGreater.String() != "GREATER" {
+		t.Errorf("got %s; want GREATER", InstructionGreater)
+	}
+
+	chunk := NewChunk([]Bytecode{InstructionFormList, 0, 2, InstructionCall, 3}, nil)
+	if pops, pushes := chunk.effect(0); pops != 3 || pushes != 1 {
+		t.Errorf("forming a list of 3 items pops %d and pushes %d; want 3 and 1", pops, pushes)
+	}
+
+	if pops, pushes := chunk.effect(3); pops != 4 || pushes != 1 {
+		t.Errorf("calling with 3 arguments pops %d and pushes %d; want 4 and 1", pops, pushes)
+	}
+}
+
+func TestDeserializeChunk_Invalid(t *testing.T) {
+	if _, err := DeserializeChunk([]byte("not bytecode")); err == nil {
+		t.Errorf("expected an error deserializing garbage")
+	}
+
+	if _, err := DeserializeChunk(NewChunk([]Bytecode{InstructionConstant, 3}, nil).Serialize()); err == nil {
+		t.Errorf("expected an error deserializing a chunk which does not verify")
+	}
+}
+
+func TestChunk_SerializeRoundTrip(t *testing.T) {
+	chunk := compileFuzzSource("func f(x) {\n\treturn [x, 1.5, \"a\", true, nil]\n}\nl := f(2)")
+
+	deserialized, err := DeserializeChunk(chunk.Serialize())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	vm := NewVM(deserialized, 256, 256)
+	for vm.Next() {
+	}
+
+	if vm.Error() != nil {
+		t.Fatalf("unexpected error: %v", vm.Error())
+	}
+
+	CompareValues(t, vm.Variable("l"), &ListValue{[]Value{&NumberValue{2, nil}, &NumberValue{1.5, nil}, &StringValue{"a"}, &BoolValue{true}, &NilValue{}}, false, false})
+}
+
+func TestChunk_SerializeDeterministic(t *testing.T) {
+	src := "#pragma decimal\nimport \"std/test\"\nfunc f(x) {\n\treturn [x, 0.1, \"a\", 123456789012345678901234567890n]\n}\nl := f(2)"
+
+	first, err := Compile(src, CompileOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	second, err := Compile(src, CompileOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	serialized := first.Serialize()
+	if !bytes.Equal(serialized, second.Serialize()) {
+		t.Errorf("expected compiling the same source twice to serialize to the same bytes")
+	}
+
+	loaded, err := LoadProgram(serialized)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !bytes.Equal(serialized, loaded.Serialize()) {
+		t.Errorf("expected loaded bytecode to serialize to the bytes it was loaded from")
+	}
+}
+
+func TestVM_GlobalCache(t *testing.T) {
+	vm := runSource(t, `
+global step := 1
+func read() {
+	return step
+}
+
+total := 0
+i := 0
+while i < 4 {
+	total = total + read()
+	if i == 1 {
+		step = 10
+	}
+	i = i + 1
+}
+`)
+
+	if err := vm.Error(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// reads after step is set get its new value, not the one cached
+	CompareValues(t, vm.Variable("total"), NewNumber(22))
+
+	vm.SetGlobal("step", NewNumber(100))
+	v, err := vm.Call(vm.Variable("read"), nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	CompareValues(t, v, NewNumber(100))
+}
+
+// BenchmarkVM_GlobalLoop a loop calling write, which is got from the globals on each iteration
+func BenchmarkVM_GlobalLoop(b *testing.B) {
+	program, err := Compile("i := 0\nwhile i < 1000 {\n\twrite(\"\")\n\ti = i + 1\n}", CompileOptions{})
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := program.Run(RunOptions{Output: io.Discard}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestVM_InstructionHandler(t *testing.T) {
+	program, err := Compile("x := 0\nwhile x < 2 {\n\tx = x + 1\n}", CompileOptions{NoFolding: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var executed []string
+	vm := program.NewVM(RunOptions{})
+	vm.SetInstructionHandler(func(vm *VM, chunk *Chunk, at Pos) {
+		executed = append(executed, chunk.Disassemble(at))
+	})
+
+	for vm.Next() {
+	}
+
+	if vm.Error() != nil {
+		t.Fatalf("Unexpected error: %s", vm.Error().Format())
+	}
+
+	loops := 0
+	for _, instruction := range executed {
+		if strings.HasPrefix(instruction, "LOOP") {
+			loops++
+
+			// the loop goes back to the condition, which begins by getting x
+			var n, to int
+			if _, err := fmt.Sscanf(instruction, "LOOP %d (to %d)", &n, &to); err != nil {
+				t.Fatal(err)
+			}
+
+			if got := program.Chunk().Disassemble(Pos(to)); !strings.HasPrefix(got, "GET_LOCAL") {
+				t.Errorf("Expected the loop to go back to getting x, got %s", got)
+			}
+		}
+	}
+
+	if loops != 2 {
+		t.Errorf("Expected the loop instruction to be executed twice, got %d in %v", loops, executed)
+	}
+
+	if got := program.Chunk().Disassemble(0); got != "CONSTANT 0 (0)" {
+		t.Errorf("Expected the first instruction to be CONSTANT 0 (0), got %s", got)
+	}
+}
+
+func TestVM_Frames(t *testing.T) {
+	program, err := Compile("func f(a) {\n\tb := a * 2\n\tbreakpoint\n\treturn b\n}\nx := 1\ny := 10 + f(x)", CompileOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var frames []Frame
+	vm := program.NewVM(RunOptions{})
+	vm.SetBreakpointHandler(func(vm *VM) {
+		frames = vm.Frames()
+	})
+
+	for vm.Next() {
+	}
+
+	if vm.Error() != nil {
+		t.Fatalf("Unexpected error: %s", vm.Error().Format())
+	}
+
+	if len(frames) != 2 || frames[0].Function != "f" || frames[1].Function != "main" {
+		t.Fatalf("Expected to be in f called by main, got %v", frames)
+	}
+
+	if frames[0].Line != 2 {
+		t.Errorf("Expected f to be at line 2, got %d", frames[0].Line)
+	}
+
+	want := []Variable{{"a", &NumberValue{1, nil}, 0}, {"b", &NumberValue{2, nil}, 1}}
+	if len(frames[0].Variables) != len(want) || len(frames[0].Values) != 0 {
+		t.Fatalf("Expected f to have the variables %v, got %v and values %v", want, frames[0].Variables, frames[0].Values)
+	}
+
+	for i, v := range want {
+		got := frames[0].Variables[i]
+		if got.Name != v.Name || got.Scope != v.Scope {
+			t.Errorf("Expected variable %v, got %v", v, got)
+		}
+
+		CompareValues(t, got.Value, v.Value)
+	}
+
+	// main has its variables, and the 10 waiting to be added to what f returns
+	names := []string{}
+	for _, v := range frames[1].Variables {
+		names = append(names, v.Name)
+	}
+
+	if strings.Join(names, ",") != "f,x" {
+		t.Errorf("Expected main to have the variables f and x, got %v", names)
+	}
+
+	if len(frames[1].Values) != 1 {
+		t.Fatalf("Expected main to have one value, got %v", frames[1].Values)
+	}
+
+	CompareValues(t, frames[1].Values[0], &NumberValue{10, nil})
+}
+
+func TestVM_StackGrowth(t *testing.T) {
+	program, err := Compile("func f(n) {\n\tif n == 0 {\n\t\treturn 0\n\t}\n\treturn 1 + f(n - 1)\n}\nx := f(100)", CompileOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	vm := program.NewVM(RunOptions{StackSize: 16, CallstackSize: 16, Growth: GrowthDoubling, StackLimit: 1024, CallstackLimit: 128})
+	for vm.Next() {
+	}
+
+	if vm.Error() != nil {
+		t.Fatalf("Unexpected error: %s", vm.Error().Format())
+	}
+
+	CompareValues(t, vm.Variable("x"), &NumberValue{100, nil})
+
+	values, calls := vm.StackUsage()
+	if calls.High != 101 || calls.Size != 128 {
+		t.Errorf("Expected the call stack to have held 101 calls and grown to 128, got %+v", calls)
+	}
+
+	if values.High <= 100 || values.Size < values.High {
+		t.Errorf("Expected the value stack to have held the argument of each call, got %+v", values)
+	}
+}
+
+func TestVM_Overloading(t *testing.T) {
+	vm := runSource(t, `
+func vector(x, y) {
+	v := newObject()
+	v.set("x", x)
+	v.set("y", y)
+	v.set("add", func(other) {
+		return vector(this.x + other.x, this.y + other.y)
+	})
+	v.set("equals", func(other) {
+		return (this.x == other.x) && (this.y == other.y)
+	})
+	v.set("compare", func(other) {
+		return this.x + this.y - other.x - other.y
+	})
+	v.set("index", func(i) {
+		return [this.x, this.y][i]
+	})
+	return v
+}
+
+a := vector(1, 2)
+b := vector(3, 4)
+sum := a + b
+x := sum[0]
+y := sum[1]
+equal := sum == vector(4, 6)
+different := a != b
+less := a < b
+greater := a >= b
+item := [1, 2, 3][2]
+`)
+
+	CompareValues(t, vm.Variable("x"), NewNumber(4))
+	CompareValues(t, vm.Variable("y"), NewNumber(6))
+	CompareValues(t, vm.Variable("equal"), NewBool(true))
+	CompareValues(t, vm.Variable("different"), NewBool(true))
+	CompareValues(t, vm.Variable("less"), NewBool(true))
+	CompareValues(t, vm.Variable("greater"), NewBool(false))
+	CompareValues(t, vm.Variable("item"), NewNumber(3))
+
+	program, err := Compile("x := newObject()\nx.set(\"compare\", func(other) { return \"less\" })\ny := x < 1", CompileOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := program.Run(RunOptions{}); err == nil || !strings.Contains(err.Error(), "compare must return a number") {
+		t.Errorf("Expected compare returning a string to fail, got %v", err)
+	}
+}
+
+func TestVM_Defer(t *testing.T) {
+	vm := runSource(t, `
+log := []
+func record(entry) {
+	log.append(entry)
+}
+
+func work(n) {
+	defer record("first")
+	defer record(n)
+	n = n * 2
+	if n > 2 {
+		return n
+	}
+
+	record("working")
+	return n + 1
+}
+
+a := work(1)
+b := work(2)
+
+func nested() {
+	defer record("nested")
+	discard work(5)
+}
+nested()
+`)
+
+	if err := vm.Error(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	CompareValues(t, vm.Variable("a"), NewNumber(3))
+	CompareValues(t, vm.Variable("b"), NewNumber(4))
+
+	// the arguments are evaluated where the call is deferred, and the calls are made last deferred first
+	first := NewString("first")
+	CompareValues(t, vm.Variable("log"), NewList([]Value{NewString("working"), NewNumber(1), first, NewNumber(2), first,
+		NewNumber(5), first, NewString("nested")}))
+
+	// calls deferred by functions called by the host are made as well
+	before := len(vm.Variable("log").(*ListValue).items)
+	if _, err := vm.Call(vm.Variable("work"), []Value{NewNumber(3)}); err != nil {
+		t.Fatal(err)
+	}
+	if after := len(vm.Variable("log").(*ListValue).items); after != before+2 {
+		t.Errorf("expected calling work to record 2 entries, recorded %d", after-before)
+	}
+
+	vm = runSource(t, "func fail() {\n\tdiscard [].at(1)\n}\nfunc f() {\n\tdefer fail()\n\treturn 1\n}\nx := f()")
+	if vm.Error() == nil {
+		t.Errorf("expected a deferred call failing to fail the program")
+	}
+}
+
+func TestVM_NumericLoop(t *testing.T) {
+	for src, expected := range map[string]float64{
+		"for i := 0; i < 10; i = i + 1 {\n\tresult = result + i\n}":                                                                               45,
+		"for i := 10; i >= 1; i = i - 2 {\n\tresult = result + i\n}":                                                                              30,
+		"for i := 0; i <= 2; i = i + 0.5 {\n\tresult = result + 1\n}":                                                                             5,
+		"for i := 5; i < 0; i = i + 1 {\n\tresult = 1\n}":                                                                                         0,
+		"for i := 0; i < 10; i = i + 1 {\n\ti = i + 1\n\tresult = result + i\n}":                                                                  25,
+		"n := 3\nfor i := 0; i < n; i = i + 1 {\n\tif n < 6 {\n\t\tn = n + 1\n\t}\n\tresult = result + 1\n}":                                      6,
+		"const size = 4\nfor i := 0; i < size; i = i + 1 {\n\tresult = result + size\n}":                                                          16,
+		"func first(n) {\n\tfor i := 0; i < 100; i = i + 1 {\n\t\tif i * i > n {\n\t\t\treturn i\n\t\t}\n\t}\n\treturn -1\n}\nresult = first(50)": 8,
+	} {
+		program, err := Compile("result := 0\n"+src, CompileOptions{})
+		if err != nil {
+			t.Fatalf("Unexpected error compiling %q: %v", src, err)
+		}
+
+		if err := program.chunk.Verify(); err != nil {
+			t.Errorf("expected the bytecode of %q to verify, got %v", src, err)
+		}
+
+		vm := program.NewVM(RunOptions{})
+		for vm.Next() {
+		}
+		if err := vm.Error(); err != nil {
+			t.Fatalf("Unexpected error running %q: %v", src, err)
+		}
+
+		CompareValues(t, vm.Variable("result"), NewNumber(expected))
+	}
+
+	program, err := Compile("for i := 0; i < 3; i = i + 1 {\n}", CompileOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !slices.Contains(program.chunk.Bytecode, InstructionForLoop) {
+		t.Errorf("expected the loop to be compiled to %s", InstructionForLoop)
+	}
+
+	// loops which count by something other than a number are compiled as they are
+	program, err = Compile("for i := 0n; i < 3n; i = i + 1n {\n}", CompileOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if slices.Contains(program.chunk.Bytecode, InstructionForLoop) {
+		t.Errorf("expected the loop counting bigints not to be compiled to %s", InstructionForLoop)
+	}
+}
+
+func TestVM_NumericLoopOutsideLoop(t *testing.T) {
+	// the limit is a variable, which InstructionForPrep would have kept below the counter
+	vm := NewVM(NewChunk([]Bytecode{
+		InstructionConstant, 2,
+		InstructionDeclareLocal, 0,
+		InstructionForLoop, 0, 1, 2, InstructionLess, InstructionAdd, 0, 0,
+	}, []Value{
+		&StringValue{"i"},
+		&StringValue{"n"},
+		&NumberValue{1, nil},
+	}), 256, 256)
+
+	for vm.Next() {
+	}
+
+	if vm.Error() == nil || vm.Error().Message != "cannot loop outside of a for loop" {
+		t.Errorf("expected looping without a loop to fail, got %v", vm.Error())
+	}
+}
+
+func TestVM_ForEach(t *testing.T) {
+	for src, expected := range map[string]float64{
+		"for x in 1..5 {\n\tresult = result + x\n}":                                                                                     10,
+		"for x in 1..=5 {\n\tresult = result + x\n}":                                                                                    15,
+		"for x in 5..1 {\n\tresult = 1\n}":                                                                                              0,
+		"for x in [2, 4, 6] {\n\tresult = result + x\n}":                                                                                12,
+		"for x in [] {\n\tresult = 1\n}":                                                                                                0,
+		"for _ in 0..3 {\n\tresult = result + 1\n}":                                                                                     3,
+		"for x in 0..3 {\n\tfor y in [1, 10] {\n\t\tresult = result + x * y\n\t}\n}":                                                    33,
+		"n := 2\nfor x in 0..n {\n\tx = x + 1\n\tresult = result + x\n}":                                                                3,
+		"xs := [1, 2]\nfor x in xs {\n\tif x < 4 {\n\t\txs.append(x + 2)\n\t}\n\tresult = result + x\n}":                                15,
+		"func find(xs, y) {\n\tfor x in xs {\n\t\tif x == y {\n\t\t\treturn x * 10\n\t\t}\n\t}\n\treturn -1\n}\nresult = find(1..9, 4)": 40,
+	} {
+		program, err := Compile("result := 0\n"+src, CompileOptions{})
+		if err != nil {
+			t.Fatalf("Unexpected error compiling %q: %v", src, err)
+		}
+
+		if err := program.chunk.Verify(); err != nil {
+			t.Errorf("expected the bytecode of %q to verify, got %v", src, err)
+		}
+
+		vm := program.NewVM(RunOptions{})
+		for vm.Next() {
+		}
+		if err := vm.Error(); err != nil {
+			t.Fatalf("Unexpected error running %q: %v", src, err)
+		}
+
+		CompareValues(t, vm.Variable("result"), NewNumber(expected))
+	}
+
+	for _, src := range []string{"for x in 3 {\n}", "for x in \"abc\" {\n}", "for x in nil {\n}"} {
+		if vm := runSource(t, src); vm.Error() == nil {
+			t.Errorf("expected an error running %q", src)
+		}
+	}
+}
+
+func TestVM_Closures(t *testing.T) {
+	for src, expected := range map[string]float64{
+		"func counter() {\n\tn := 0\n\treturn func() {\n\t\tn = n + 1\n\t\treturn n\n\t}\n}\nc := counter()\nc()\nresult = c()":                                                   2,
+		"func adder(a) {\n\treturn func(b) {\n\t\treturn a + b\n\t}\n}\nadd2 := adder(2)\nadder(10)\nresult = add2(3)":                                                            5,
+		"func adder(a) {\n\treturn func(b) {\n\t\treturn func(c) {\n\t\t\treturn a + b + c\n\t\t}\n\t}\n}\nadd1 := adder(1)\nadd3 := add1(2)\nresult = add3(3)":                   6,
+		"func pair() {\n\tn := 10\n\tinc := func() {\n\t\tn = n + 1\n\t}\n\tget := func() {\n\t\treturn n\n\t}\n\tinc()\n\tinc()\n\treturn get\n}\nget := pair()\nresult = get()": 12,
+		"func reset() {\n\tn := 5\n\tclear := func() {\n\t\tn = 0\n\t}\n\tclear()\n\treturn n\n}\nresult = reset()":                                                               0,
+		"func scale(n) {\n\treturn [1, 2].map(|x| x * n)\n}\nresult = scale(3)[1]":                                                                                                6,
+		"fs := []\ni := 0\nwhile i < 3 {\n\tj := i * 10\n\tfs.append(func() {\n\t\treturn j\n\t})\n\ti = i + 1\n}\nf := fs[2]\nresult = f()":                                      20,
+		"fs := []\nfor i in 0..3 {\n\tfs.append(|| i)\n}\nf := fs[1]\nresult = f()":                                                                                               1,
+		"fs := []\nfor i := 0; i < 3; i = i + 1 {\n\tfs.append(|| i)\n}\nf := fs[0]\nresult = f()":                                                                                3,
+		"func separate() {\n\tn := 0\n\treturn func() {\n\t\tn = n + 1\n\t\treturn n\n\t}\n}\na := separate()\nb := separate()\na()\na()\nresult = a() * 10 + b()":                31,
+	} {
+		program, err := Compile("result := 0\n"+src, CompileOptions{})
+		if err != nil {
+			t.Fatalf("Unexpected error compiling %q: %v", src, err)
+		}
+
+		if err := program.chunk.Verify(); err != nil {
+			t.Errorf("expected the bytecode of %q to verify, got %v", src, err)
+		}
+
+		vm := program.NewVM(RunOptions{})
+		for vm.Next() {
+		}
+		if err := vm.Error(); err != nil {
+			t.Fatalf("Unexpected error running %q: %v", src, err)
+		}
+
+		CompareValues(t, vm.Variable("result"), NewNumber(expected))
+	}
+}
+
+func TestVM_Spread(t *testing.T) {
+	vm := runSource(t, `
+xs := [2, 3]
+func add(a, b, c) {
+	return a + b + c
+}
+list := [1, ...xs, 4, ...1..=2]
+nested := [...[[1]]]
+nested[0].append(2)
+sum := add(...xs, 4)
+part := "abc".at(...[1])
+text := "xy" as string|nil
+none := nil as string|nil
+optional := text?.at(...[1])
+skipped := none?.at(...[1])
+empty := [...[], ...xs]
+`)
+	if err := vm.Error(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	CompareValues(t, vm.Variable("list"), NewList([]Value{NewNumber(1), NewNumber(2), NewNumber(3), NewNumber(4), NewNumber(1), NewNumber(2)}))
+	CompareValues(t, vm.Variable("xs"), NewList([]Value{NewNumber(2), NewNumber(3)}))
+	CompareValues(t, vm.Variable("nested"), NewList([]Value{NewList([]Value{NewNumber(1), NewNumber(2)})}))
+	CompareValues(t, vm.Variable("sum"), NewNumber(9))
+	CompareValues(t, vm.Variable("part"), NewString("b"))
+	CompareValues(t, vm.Variable("optional"), NewString("y"))
+	CompareValues(t, vm.Variable("skipped"), &NilValue{})
+	CompareValues(t, vm.Variable("empty"), NewList([]Value{NewNumber(2), NewNumber(3)}))
+
+	program, err := Compile("xs := [1]\nys := [0, ...xs]\ntext := nil as string|nil\ntext?.at(...xs)", CompileOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := program.chunk.Verify(); err != nil {
+		t.Errorf("Expected the bytecode of spreads to verify, got %v", err)
+	}
+
+	for src, expected := range map[string]string{
+		"x := [1, ...\"a\"]":                       "cannot spread string",
+		"func f(a) {\n\treturn a\n}\nf(...2)":      "cannot spread number",
+		"func f(a) {\n\tdefer print(...[a])\n}":    "can't be deferred",
+		"x := 2 as any\ny := [...x]":               "cannot spread number",
+		"func f(a) {\n\treturn a\n}\nf(...[1, 2])": "f takes",
+	} {
+		program, err := Compile(src, CompileOptions{})
+		if err == nil {
+			_, err = program.Run(RunOptions{})
+		}
+
+		if err == nil || !strings.Contains(err.Error(), expected) {
+			t.Errorf("Expected %q to fail with %q, got %v", src, expected, err)
+		}
+	}
+}
+
+func BenchmarkVM_NumericLoop(b *testing.B) {
+	for name, src := range map[string]string{
+		"for":   "sum := 0\nfor i := 0; i < 1000; i = i + 1 {\n\tsum = sum + i\n}",
+		"while": "sum := 0\ni := 0\nwhile i < 1000 {\n\tsum = sum + i\n\ti = i + 1\n}",
+	} {
+		program, err := Compile(src, CompileOptions{})
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		b.Run(name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, err := program.Run(RunOptions{}); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,208 @@
+//go:build wasm && go1.23
+
+package main
+
+import (
+	"log"
+	"neemek.com/anglais/core"
+	"syscall/js"
+)
+
+// debugSession a program being executed step by step from the browser
+type debugSession struct {
+	vm *core.VM
+
+	// breakpoints lines (starting at 1) to pause at when continuing
+	breakpoints map[int]bool
+	// hitBreakpoint whether a breakpoint statement was executed since last checked
+	hitBreakpoint bool
+	done          bool
+}
+
+// line get the line (starting at 1) of the next instruction, or 0 if it is unknown
+func (s *debugSession) line() int {
+	return int(s.vm.Line()) + 1
+}
+
+// next execute one instruction
+func (s *debugSession) next() {
+	if s.done {
+		return
+	}
+
+	s.done = !s.vm.Next()
+}
+
+// paused check (and reset) whether a breakpoint statement was hit
+func (s *debugSession) paused() bool {
+	hit := s.hitBreakpoint
+	s.hitBreakpoint = false
+
+	return hit
+}
+
+// state describe where the execution is, for the debugger UI
+func (s *debugSession) state(done bool) js.Value {
+	line := js.Null()
+	if l := s.line(); l > 0 && !done {
+		line = js.ValueOf(l)
+	}
+
+	failure := js.Null()
+	if err := s.vm.Error(); err != nil {
+		failure = js.ValueOf(err.Format())
+	}
+
+	return js.ValueOf(map[string]interface{}{
+		"done":  done,
+		"line":  line,
+		"error": failure,
+	})
+}
+
+func (s *debugSession) stepInstruction(_ js.Value, _ []js.Value) interface{} {
+	s.next()
+	s.paused()
+
+	return s.state(s.done)
+}
+
+func (s *debugSession) stepLine(_ js.Value, _ []js.Value) interface{} {
+	start := s.line()
+
+	for s.next(); !s.done && !s.paused(); s.next() {
+		if l := s.line(); l != start && l > 0 {
+			break
+		}
+	}
+
+	return s.state(s.done)
+}
+
+// continueExecution run until a breakpoint is reached or the program finishes. Returns a promise of the state.
+func (s *debugSession) continueExecution(_ js.Value, args []js.Value) interface{} {
+	options := defaultRunOptions()
+	if len(args) > 0 {
+		options = parseRunOptions(args[0])
+	}
+
+	if s.done {
+		return js.Global().Get("Promise").Call("resolve", s.state(true))
+	}
+
+	last := s.line()
+
+	return execute(s.vm, options, func() bool {
+		line := s.line()
+		changed := line != last
+		last = line
+
+		return s.paused() || (changed && s.breakpoints[line])
+	}, func(done bool) js.Value {
+		s.done = done
+		return s.state(done)
+	})
+}
+
+func (s *debugSession) getStack(_ js.Value, _ []js.Value) interface{} {
+	stack := s.vm.Stack()
+	values := make([]interface{}, len(stack))
+	for i, v := range stack {
+		values[i] = valueToJS(s.vm, v)
+	}
+
+	return js.ValueOf(values)
+}
+
+// getFrames get the functions being executed, innermost first, with their variables and the other values on their
+// part of the stack
+func (s *debugSession) getFrames(_ js.Value, _ []js.Value) interface{} {
+	frames := s.vm.Frames()
+	result := make([]interface{}, len(frames))
+
+	for i, frame := range frames {
+		variables := make([]interface{}, len(frame.Variables))
+		for j, v := range frame.Variables {
+			variables[j] = map[string]interface{}{
+				"name":  v.Name,
+				"value": valueToJS(s.vm, v.Value),
+			}
+		}
+
+		values := make([]interface{}, len(frame.Values))
+		for j, v := range frame.Values {
+			values[j] = valueToJS(s.vm, v)
+		}
+
+		line := js.Null()
+		if frame.Line >= 0 {
+			line = js.ValueOf(int(frame.Line) + 1)
+		}
+
+		result[i] = map[string]interface{}{
+			"function":  frame.Function,
+			"line":      line,
+			"variables": variables,
+			"values":    values,
+		}
+	}
+
+	return js.ValueOf(result)
+}
+
+func (s *debugSession) getGlobals(_ js.Value, _ []js.Value) interface{} {
+	globals := map[string]interface{}{}
+	for name, v := range s.vm.Globals() {
+		globals[name] = valueToJS(s.vm, v)
+	}
+
+	return js.ValueOf(globals)
+}
+
+func (s *debugSession) setBreakpoint(_ js.Value, args []js.Value) interface{} {
+	s.breakpoints[args[0].Int()] = true
+	return nil
+}
+
+func (s *debugSession) clearBreakpoint(_ js.Value, args []js.Value) interface{} {
+	delete(s.breakpoints, args[0].Int())
+	return nil
+}
+
+// debug compiles the source and returns a session object for executing it step by step
+func debug(_ js.Value, args []js.Value) interface{} {
+	source := args[0].String()
+	outputHandler := args[1]
+	resolver := args[2]
+
+	options := defaultRunOptions()
+	if len(args) > 3 {
+		options = parseRunOptions(args[3])
+	}
+
+	chunk, err := compile(source, resolver, options)
+	if err != nil {
+		return jsError(err)
+	}
+
+	log.Println("Starting debug session")
+
+	session := &debugSession{
+		vm:          newVM(chunk, outputHandler, options),
+		breakpoints: map[int]bool{},
+	}
+	session.vm.SetBreakpointHandler(func(_ *core.VM) {
+		session.hitBreakpoint = true
+	})
+
+	return js.ValueOf(map[string]interface{}{
+		"stepInstruction": js.FuncOf(session.stepInstruction),
+		"stepLine":        js.FuncOf(session.stepLine),
+		"continue":        js.FuncOf(session.continueExecution),
+		"getStack":        js.FuncOf(session.getStack),
+		"getFrames":       js.FuncOf(session.getFrames),
+		"getGlobals":      js.FuncOf(session.getGlobals),
+		"setBreakpoint":   js.FuncOf(session.setBreakpoint),
+		"clearBreakpoint": js.FuncOf(session.clearBreakpoint),
+	})
+}
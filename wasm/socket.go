@@ -0,0 +1,124 @@
+//go:build wasm && go1.23
+
+package main
+
+import (
+	"errors"
+	"neemek.com/anglais/core"
+	"syscall/js"
+	"time"
+)
+
+// socketBuiltins the socket builtins of scripts allowed to use the network, which connect with WebSockets
+var socketBuiltins = core.NewSocketBuiltins(dialWebSocket)
+
+// webSocket a socket connected with a WebSocket of the browser. The browser can't be blocked, so connecting doesn't
+// wait for the connection to open, data sent before it has is sent once it does, and receiving returns what has
+// arrived without waiting for more.
+type webSocket struct {
+	ws js.Value
+	// pending the data sent before the connection opened
+	pending [][]byte
+	// received the messages which have arrived but not been received yet
+	received [][]byte
+	// err why the connection failed or was closed, if it has
+	err error
+
+	callbacks []js.Func
+}
+
+// dialWebSocket connect a socket to the WebSocket at an address (ws://... or wss://...). The timeout is not used, as
+// WebSockets time out on their own.
+func dialWebSocket(address string, _ time.Duration) (core.Socket, error) {
+	ws := js.Global().Get("WebSocket")
+	if ws.IsUndefined() {
+		return nil, errors.New("WebSockets are not supported")
+	}
+
+	s := &webSocket{ws: ws.New(address)}
+	s.ws.Set("binaryType", "arraybuffer")
+
+	s.on("open", func(js.Value) {
+		for _, data := range s.pending {
+			s.send(data)
+		}
+
+		s.pending = nil
+	})
+	s.on("message", func(event js.Value) {
+		data := event.Get("data")
+		if data.Type() == js.TypeString {
+			s.received = append(s.received, []byte(data.String()))
+			return
+		}
+
+		array := js.Global().Get("Uint8Array").New(data)
+		b := make([]byte, array.Length())
+		js.CopyBytesToGo(b, array)
+		s.received = append(s.received, b)
+	})
+	s.on("error", func(js.Value) {
+		s.err = errors.New("the connection failed")
+	})
+	s.on("close", func(js.Value) {
+		if s.err == nil {
+			s.err = errors.New("the connection was closed")
+		}
+	})
+
+	return s, nil
+}
+
+// on listen for an event of the WebSocket
+func (s *webSocket) on(event string, listener func(event js.Value)) {
+	f := js.FuncOf(func(_ js.Value, args []js.Value) interface{} {
+		listener(args[0])
+		return nil
+	})
+
+	s.callbacks = append(s.callbacks, f)
+	s.ws.Call("addEventListener", event, f)
+}
+
+func (s *webSocket) send(data []byte) {
+	array := js.Global().Get("Uint8Array").New(len(data))
+	js.CopyBytesToJS(array, data)
+	s.ws.Call("send", array)
+}
+
+// Send send data through the WebSocket. The timeout is not used, as WebSockets buffer what is sent rather than
+// waiting for it to be.
+func (s *webSocket) Send(data []byte, _ time.Duration) error {
+	if s.err != nil {
+		return s.err
+	}
+
+	// still connecting
+	if s.ws.Get("readyState").Int() == 0 {
+		s.pending = append(s.pending, data)
+		return nil
+	}
+
+	s.send(data)
+	return nil
+}
+
+func (s *webSocket) Receive(_ time.Duration) ([]byte, error) {
+	if len(s.received) > 0 {
+		data := s.received[0]
+		s.received = s.received[1:]
+		return data, nil
+	}
+
+	return nil, s.err
+}
+
+func (s *webSocket) Close() error {
+	s.ws.Call("close")
+
+	for _, f := range s.callbacks {
+		f.Release()
+	}
+
+	return nil
+}
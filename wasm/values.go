@@ -0,0 +1,115 @@
+//go:build wasm && go1.23
+
+package main
+
+import (
+	"fmt"
+	"neemek.com/anglais/core"
+	"syscall/js"
+)
+
+// valueToJS convert an anglais value to the closest native javascript value. Functions are wrapped in javascript
+// functions calling them on the VM.
+func valueToJS(vm *core.VM, value core.Value) js.Value {
+	return js.ValueOf(goToJS(vm, core.ValueToGo(value)))
+}
+
+func goToJS(vm *core.VM, gov interface{}) interface{} {
+	switch v := gov.(type) {
+	case []interface{}:
+		values := make([]interface{}, len(v))
+		for i, item := range v {
+			values[i] = goToJS(vm, item)
+		}
+
+		return values
+	case map[string]interface{}:
+		values := make(map[string]interface{}, len(v))
+		for key, member := range v {
+			values[key] = goToJS(vm, member)
+		}
+
+		return values
+	case core.Value:
+		if core.TypeOf(v) != "function" {
+			return v.String()
+		}
+
+		return js.FuncOf(func(_ js.Value, args []js.Value) interface{} {
+			values := make([]core.Value, len(args))
+			for i, arg := range args {
+				values[i] = jsToValue(arg)
+			}
+
+			result, err := vm.Call(v, values)
+			if err != nil {
+				return jsError(err)
+			}
+
+			return valueToJS(vm, result)
+		})
+	}
+
+	return gov
+}
+
+// jsToValue convert a javascript value to an anglais value. Javascript functions become builtin functions, so
+// they can be provided by the host and called from scripts.
+func jsToValue(value js.Value) core.Value {
+	return core.GoToValue(jsToGo(value))
+}
+
+func jsToGo(value js.Value) interface{} {
+	switch value.Type() {
+	case js.TypeUndefined, js.TypeNull:
+		return nil
+	case js.TypeBoolean:
+		return value.Bool()
+	case js.TypeNumber:
+		return value.Float()
+	case js.TypeString:
+		return value.String()
+	case js.TypeFunction:
+		return jsFunctionToBuiltin(value)
+	case js.TypeObject:
+		if js.Global().Get("Array").Call("isArray", value).Bool() {
+			values := make([]interface{}, value.Length())
+			for i := range values {
+				values[i] = jsToGo(value.Index(i))
+			}
+
+			return values
+		}
+
+		keys := js.Global().Get("Object").Call("keys", value)
+		values := make(map[string]interface{}, keys.Length())
+		for i := 0; i < keys.Length(); i++ {
+			key := keys.Index(i).String()
+			values[key] = jsToGo(value.Get(key))
+		}
+
+		return values
+	}
+
+	return value.String()
+}
+
+func jsFunctionToBuiltin(f js.Value) *core.BuiltinFunctionValue {
+	parameters := make([]string, f.Length())
+	for i := range parameters {
+		parameters[i] = fmt.Sprintf("arg%d", i)
+	}
+
+	return &core.BuiltinFunctionValue{
+		Name:       f.Get("name").String(),
+		Parameters: parameters,
+		F: func(vm *core.VM, this core.Value, m map[string]core.Value) (core.Value, error) {
+			args := make([]interface{}, len(parameters))
+			for i, parameter := range parameters {
+				args[i] = valueToJS(vm, m[parameter])
+			}
+
+			return jsToValue(f.Invoke(args...)), nil
+		},
+	}
+}
@@ -4,9 +4,11 @@ package main
 
 import (
 	"errors"
+	"fmt"
 	"log"
 	"neemek.com/anglais/core"
 	"syscall/js"
+	"time"
 )
 
 type JsResolver struct {
@@ -14,18 +16,11 @@ type JsResolver struct {
 }
 
 func (r *JsResolver) Resolve(name string) (core.Node, error) {
-	jsv := r.jsResolver.Invoke(name)
-
-	if jsv.Type() == js.TypeUndefined {
-		return nil, errors.New("cannot find import with name " + name)
-	}
-
-	if jsv.Type() != js.TypeString {
-		return nil, errors.New("invalid value for source: " + jsv.String())
+	source, err := r.ResolveSource(name)
+	if err != nil {
+		return nil, err
 	}
 
-	source := jsv.String()
-
 	l := core.NewLexer(source)
 	tokens, err := l.Tokenize()
 	if err != nil {
@@ -41,6 +36,21 @@ func (r *JsResolver) Resolve(name string) (core.Node, error) {
 	return tree, nil
 }
 
+// ResolveSource get the source of an import from the resolver function, for the compiler to parse itself
+func (r *JsResolver) ResolveSource(name string) (string, error) {
+	jsv := r.jsResolver.Invoke(name)
+
+	if jsv.Type() == js.TypeUndefined {
+		return "", errors.New("cannot find import with name " + name)
+	}
+
+	if jsv.Type() != js.TypeString {
+		return "", errors.New("invalid value for source: " + jsv.String())
+	}
+
+	return jsv.String(), nil
+}
+
 func jsError(err error) interface{} {
 	return jsErrorOfString(err.Error())
 }
@@ -52,17 +62,77 @@ func jsErrorOfString(err string) interface{} {
 	return errorObject
 }
 
-func run(_ js.Value, args []js.Value) interface{} {
-	source := args[0].String()
-	outputHandler := args[1]
-	resolver := args[2]
-	log.Printf("got source: %s", source)
+// defaultSliceSize the amount of instructions executed before yielding to the browser
+const defaultSliceSize = 10000
+
+// runOptions options passed as the optional fourth argument to run
+type runOptions struct {
+	// signal an AbortSignal which cancels the execution when aborted
+	signal js.Value
+	// sliceSize the amount of instructions executed per macrotask
+	sliceSize int
+	// globals values provided by the host, which are made available to the script as globals
+	globals js.Value
+	// defines constants the script is compiled with, in addition to wasm (which is true)
+	defines js.Value
+	// network whether the script may connect to other machines, with the socket builtins
+	network bool
+}
+
+func defaultRunOptions() runOptions {
+	return runOptions{
+		signal:    js.Undefined(),
+		sliceSize: defaultSliceSize,
+		globals:   js.Undefined(),
+		defines:   js.Undefined(),
+	}
+}
+
+func parseRunOptions(v js.Value) runOptions {
+	options := defaultRunOptions()
+
+	if v.Type() != js.TypeObject {
+		return options
+	}
+
+	if signal := v.Get("signal"); signal.Type() == js.TypeObject {
+		options.signal = signal
+	}
+
+	if size := v.Get("sliceSize"); size.Type() == js.TypeNumber && size.Int() > 0 {
+		options.sliceSize = size.Int()
+	}
+
+	if globals := v.Get("globals"); globals.Type() == js.TypeObject {
+		options.globals = globals
+	}
+
+	if defines := v.Get("defines"); defines.Type() == js.TypeObject {
+		options.defines = defines
+	}
 
+	if network := v.Get("network"); network.Type() == js.TypeBoolean {
+		options.network = network.Bool()
+	}
+
+	return options
+}
+
+// cancellationError get the reason an AbortSignal was aborted with, or a generic error if it has none
+func cancellationError(signal js.Value) js.Value {
+	if reason := signal.Get("reason"); !reason.IsUndefined() {
+		return reason
+	}
+
+	return jsErrorOfString("execution cancelled").(js.Value)
+}
+
+func compile(source string, resolver js.Value, options runOptions) (chunk *core.Chunk, err error) {
 	lexer := core.NewLexer(source)
 	tokens, err := lexer.Tokenize()
 
 	if err != nil {
-		return jsError(err)
+		return nil, err
 	}
 
 	log.Printf("got tokens: %v", tokens)
@@ -72,31 +142,61 @@ func run(_ js.Value, args []js.Value) interface{} {
 	tree, err := parser.Parse()
 
 	if err != nil {
-		return jsErrorOfString(err.Error())
+		return nil, err
 	}
 
 	log.Printf("Parsed tree: %s", tree.String())
 
 	compiler := core.NewCompiler()
+	compiler.SetPositions(parser.Positions())
+
+	if !options.globals.IsUndefined() {
+		keys := js.Global().Get("Object").Call("keys", options.globals)
+		for i := 0; i < keys.Length(); i++ {
+			compiler.DeclareGlobal(keys.Index(i).String())
+		}
+	}
+
+	if options.network {
+		for _, name := range socketBuiltins.Names() {
+			compiler.DeclareGlobal(name)
+		}
+	}
+
+	// scripts can check whether they run in the browser, such as with `if wasm { ... }`
+	compiler.Define("wasm", core.NewBool(true))
+	if !options.defines.IsUndefined() {
+		for name, value := range jsToGo(options.defines).(map[string]interface{}) {
+			compiler.Define(name, core.GoToValue(value))
+		}
+	}
 
 	compiler.SetImportsResolver(&JsResolver{
 		resolver,
 	})
 
+	// the compiler panics on unresolvable imports
 	defer func() {
-		if err := recover(); err != nil {
-			log.Printf("panic recovered: %v", err)
+		if r := recover(); r != nil {
+			log.Printf("panic recovered: %v", r)
+			err = fmt.Errorf("%v", r)
 		}
 	}()
 
 	err = compiler.Compile(tree)
 	if err != nil {
-		return nil
+		return nil, err
 	}
 
 	log.Printf("Compiled tree (into %v instructions)", len(compiler.Chunk.Bytecode))
 
-	vm := core.NewVM(compiler.Chunk, 256, 256)
+	return compiler.Chunk, nil
+}
+
+// newVM create a VM for the chunk which sends its output to the output handler. The handler is called with the
+// text to output and the value being written.
+func newVM(chunk *core.Chunk, outputHandler js.Value, options runOptions) *core.VM {
+	vm := core.NewVM(chunk, 256, 256)
 
 	// overwrite output
 	vm.SetGlobal("write", &core.BuiltinFunctionValue{
@@ -104,7 +204,7 @@ func run(_ js.Value, args []js.Value) interface{} {
 		Parameters: []string{"value"},
 		F: func(vm *core.VM, this core.Value, v map[string]core.Value) (core.Value, error) {
 			log.Printf("Writing value: %s", v["value"].String())
-			outputHandler.Invoke(js.ValueOf(v["value"].String() + "\n"))
+			outputHandler.Invoke(js.ValueOf(v["value"].String()+"\n"), valueToJS(vm, v["value"]))
 			return nil, nil
 		},
 	})
@@ -113,23 +213,200 @@ func run(_ js.Value, args []js.Value) interface{} {
 		Parameters: []string{"value"},
 		F: func(vm *core.VM, this core.Value, v map[string]core.Value) (core.Value, error) {
 			log.Printf("Printing value: %s", v["value"].String())
-			outputHandler.Invoke(js.ValueOf(v["value"].String()))
+			outputHandler.Invoke(js.ValueOf(v["value"].String()), valueToJS(vm, v["value"]))
 			return nil, nil
 		},
 	})
 
-	for vm.Next() {
+	// the browser can't be blocked, so timers are only run once the program has run to its end
+	vm.SetGlobal("wait", &core.BuiltinFunctionValue{
+		Name:       "wait",
+		Parameters: []string{"milliseconds"},
+		F: func(vm *core.VM, this core.Value, v map[string]core.Value) (core.Value, error) {
+			return nil, errors.New("wait is not supported in the browser, use setTimeout instead")
+		},
+	})
+
+	if options.network {
+		for name, value := range socketBuiltins.Values() {
+			vm.SetGlobal(name, value)
+		}
 	}
 
-	log.Println("Finished executing")
+	if !options.globals.IsUndefined() {
+		for name, value := range jsToGo(options.globals).(map[string]interface{}) {
+			vm.SetGlobal(name, core.GoToValue(value))
+		}
+	}
+
+	return vm
+}
+
+// result get the value a finished program resulted in; the value it returned at the top level, or null.
+func result(vm *core.VM) js.Value {
+	stack := vm.Stack()
+	if len(stack) == 0 || stack[len(stack)-1].Type() == core.VariableValueType {
+		return js.Null()
+	}
+
+	return valueToJS(vm, stack[len(stack)-1])
+}
+
+// callMain call the main function of the program once its top level has run, if it has one, as Program.Run does.
+// Scripts in the browser are given no arguments, so main is called with an empty list.
+func callMain(vm *core.VM) error {
+	main, ok := vm.Variable(core.MainFunction).(*core.FunctionValue)
+	if !ok {
+		return nil
+	}
 
-	return js.Null()
+	_, err := vm.Call(main, []core.Value{core.NewList([]core.Value{})})
+	return err
+}
+
+// execute run the VM in slices of instructions, yielding to the browser in between so the page stays responsive.
+// Returns a promise resolving with the value of result once the program finishes or pause returns true.
+func execute(vm *core.VM, options runOptions, pause func() bool, result func(done bool) js.Value) js.Value {
+	var executor js.Func
+	executor = js.FuncOf(func(_ js.Value, args []js.Value) interface{} {
+		resolve, reject := args[0], args[1]
+
+		var step, pump js.Func
+		finish := func(reason js.Value, failed bool) {
+			step.Release()
+			pump.Release()
+			executor.Release()
+
+			// the program is over unless it was only paused, so the resources it left open can be closed
+			if _, timers := vm.NextTimer(); failed || (!vm.HasNext() && !timers) {
+				vm.Close()
+			}
+
+			if failed {
+				reject.Invoke(reason)
+			} else {
+				resolve.Invoke(reason)
+			}
+		}
+
+		// wait for the next timer of the program with the browser, once it has run to its end, and finish once it has
+		// none left
+		wait := func() {
+			next, ok := vm.NextTimer()
+			if !ok {
+				log.Println("Finished executing")
+				finish(result(true), false)
+				return
+			}
+
+			js.Global().Call("setTimeout", pump, time.Until(next).Milliseconds())
+		}
+
+		pump = js.FuncOf(func(_ js.Value, _ []js.Value) interface{} {
+			defer func() {
+				if r := recover(); r != nil {
+					log.Printf("panic recovered: %v", r)
+					finish(jsErrorOfString(fmt.Sprint(r)).(js.Value), true)
+				}
+			}()
+
+			if !options.signal.IsUndefined() && options.signal.Get("aborted").Bool() {
+				log.Println("Execution cancelled")
+				finish(cancellationError(options.signal), true)
+				return nil
+			}
+
+			if err := vm.RunDueTimers(); err != nil {
+				log.Println("Timer failed")
+				finish(jsErrorOfString(core.FormatError(err, nil)).(js.Value), true)
+				return nil
+			}
+
+			wait()
+			return nil
+		})
+
+		step = js.FuncOf(func(_ js.Value, _ []js.Value) interface{} {
+			defer func() {
+				if r := recover(); r != nil {
+					log.Printf("panic recovered: %v", r)
+					finish(jsErrorOfString(fmt.Sprint(r)).(js.Value), true)
+				}
+			}()
+
+			if !options.signal.IsUndefined() && options.signal.Get("aborted").Bool() {
+				log.Println("Execution cancelled")
+				finish(cancellationError(options.signal), true)
+				return nil
+			}
+
+			for i := 0; i < options.sliceSize; i++ {
+				if !vm.Next() {
+					if err := vm.Error(); err != nil {
+						log.Println("Execution failed")
+						finish(jsErrorOfString(err.Format()).(js.Value), true)
+						return nil
+					}
+
+					if err := callMain(vm); err != nil {
+						log.Println("Main failed")
+						finish(jsErrorOfString(core.FormatError(err, nil)).(js.Value), true)
+						return nil
+					}
+
+					wait()
+					return nil
+				}
+
+				if pause != nil && pause() {
+					log.Println("Paused execution")
+					finish(result(false), false)
+					return nil
+				}
+			}
+
+			// yield to the browser before continuing
+			js.Global().Call("setTimeout", step, 0)
+			return nil
+		})
+
+		js.Global().Call("setTimeout", step, 0)
+		return nil
+	})
+
+	return js.Global().Get("Promise").New(executor)
+}
+
+// run compiles and executes the source, and returns a promise resolving when the execution is done.
+func run(_ js.Value, args []js.Value) interface{} {
+	source := args[0].String()
+	outputHandler := args[1]
+	resolver := args[2]
+
+	options := defaultRunOptions()
+	if len(args) > 3 {
+		options = parseRunOptions(args[3])
+	}
+
+	log.Printf("got source: %s", source)
+
+	chunk, err := compile(source, resolver, options)
+	if err != nil {
+		return js.Global().Get("Promise").Call("reject", jsError(err))
+	}
+
+	vm := newVM(chunk, outputHandler, options)
+
+	return execute(vm, options, nil, func(_ bool) js.Value {
+		return result(vm)
+	})
 }
 
 func main() {
 	log.Println("Initializing Anglais WASM module")
 
 	js.Global().Set("run", js.FuncOf(run))
+	js.Global().Set("debug", js.FuncOf(debug))
 
 	log.Println("Initialized Anglais WASM module")
 